@@ -1,39 +1,216 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
+	"github.com/BioHazard786/Warpdrop/backend/internal/metrics"
 	"github.com/BioHazard786/Warpdrop/backend/internal/server"
 	"github.com/BioHazard786/Warpdrop/backend/internal/signaling"
 )
 
-// Health Check endpoint
-func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Signaling server is healthy."))
+// shutdownTimeout bounds how long in-flight HTTP requests and queued webhook
+// events may take to finish once the server is asked to stop.
+const shutdownTimeout = 10 * time.Second
+
+// Health Check endpoint, which also reports how many rooms and connections
+// are open against their limits
+func healthCheckHandler(hub *signaling.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rooms, clients := hub.Usage()
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "Signaling server is healthy.\nRooms: %s\nClients: %s\n",
+			usage(rooms, hub.MaxRooms), usage(clients, hub.MaxClients))
+	}
+}
+
+// usage formats a count against its limit, where zero is unlimited.
+func usage(count, limit int) string {
+	if limit == 0 {
+		return strconv.Itoa(count)
+	}
+	return fmt.Sprintf("%d of %d", count, limit)
+}
+
+// parseLimit parses a non-negative capacity limit from the environment,
+// where zero is unlimited.
+func parseLimit(name, value string) int {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		fatal("Invalid "+name+": must be 0 for no limit or a positive integer", "value", value)
+	}
+	return n
+}
+
+// newLogger builds the server's logger for the given LOG_FORMAT.
+func newLogger(format string) *slog.Logger {
+	switch format {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(os.Stderr, nil))
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	default:
+		fatal("Invalid LOG_FORMAT: must be json or text", "value", format)
+		return nil
+	}
+}
+
+// fatal logs an error and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
 
 func main() {
 
+	// Log as text for humans or JSON for log pipelines
+	slog.SetDefault(newLogger(os.Getenv("LOG_FORMAT")))
+
 	// 1. Create the Hub
 	hub := signaling.NewHub()
 
+	// Optionally fire webhooks on room lifecycle events
+	if webhookURL := os.Getenv("WEBHOOK_URL"); webhookURL != "" {
+		hub.Webhooks = signaling.NewWebhookDispatcher(webhookURL)
+		go hub.Webhooks.Run()
+		slog.Info("Webhooks enabled")
+	}
+
+	// Optionally change how long dropped peers may take to rejoin
+	if value := os.Getenv("RECONNECT_GRACE"); value != "" {
+		grace, err := time.ParseDuration(value)
+		if err != nil || grace < 0 {
+			fatal("Invalid RECONNECT_GRACE: must be a duration such as 30s, or 0 to disable", "value", value)
+		}
+		hub.ReconnectGrace = grace
+		slog.Info("Reconnect grace period set", "grace", grace.String())
+	}
+
+	// Optionally change how long rooms may wait for a receiver
+	if value := os.Getenv("ROOM_TTL"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl < 0 {
+			fatal("Invalid ROOM_TTL: must be a duration such as 1h, or 0 to disable", "value", value)
+		}
+		hub.RoomTTL = ttl
+		slog.Info("Room TTL set", "ttl", ttl.String())
+	}
+
+	// Optionally change how many words make up a room ID
+	if value := os.Getenv("ROOM_ID_WORDS"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < signaling.MinRoomIDWords || n > signaling.MaxRoomIDWords {
+			fatal(fmt.Sprintf("Invalid ROOM_ID_WORDS: must be between %d and %d", signaling.MinRoomIDWords, signaling.MaxRoomIDWords), "value", value)
+		}
+		hub.RoomIDWords = n
+		slog.Info("Room ID length set", "words", n)
+	}
+
+	// Optionally relay file data for peers that can't connect
+	if value := os.Getenv("DATA_RELAY"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			fatal("Invalid DATA_RELAY: must be true or false", "value", value)
+		}
+		hub.DataRelay = enabled
+		if enabled {
+			slog.Info("File data relay enabled")
+		}
+	}
+
+	// Optionally cap how many rooms and connections a small instance takes
+	if value := os.Getenv("MAX_ROOMS"); value != "" {
+		hub.MaxRooms = parseLimit("MAX_ROOMS", value)
+		slog.Info("Room limit set", "max_rooms", hub.MaxRooms)
+	}
+	if value := os.Getenv("MAX_CLIENTS"); value != "" {
+		hub.MaxClients = parseLimit("MAX_CLIENTS", value)
+		slog.Info("Connection limit set", "max_clients", hub.MaxClients)
+	}
+
+	// Optionally issue short-lived credentials for a TURN server sharing
+	// TURN_SECRET, instead of clients using static ones
+	if secret := os.Getenv("TURN_SECRET"); secret != "" {
+		var ttl time.Duration
+		if value := os.Getenv("TURN_TTL"); value != "" {
+			var err error
+			ttl, err = time.ParseDuration(value)
+			if err != nil || ttl <= 0 {
+				fatal("Invalid TURN_TTL: must be a duration such as 12h", "value", value)
+			}
+		}
+		servers := os.Getenv("TURN_SERVER")
+		issuer, err := signaling.NewTURNIssuer(secret, servers, ttl)
+		if err != nil {
+			fatal("Invalid TURN_SERVER: must list the TURN servers sharing TURN_SECRET", "value", servers)
+		}
+		hub.TURN = issuer
+		slog.Info("TURN credentials enabled", "servers", issuer.URLs, "ttl", issuer.TTL.String())
+	}
+
+	// Restrict which websites may open websocket connections
+	origins := server.NewOriginAllowlist(os.Getenv("ALLOWED_ORIGINS"))
+	if origins.AllowsAny() {
+		slog.Info("Accepting websocket connections from any origin")
+	} else if os.Getenv("ALLOWED_ORIGINS") == "" {
+		slog.Warn("ALLOWED_ORIGINS is not set: only native clients without an Origin header can connect")
+	}
+
 	// 2. Run the Hub in a separate goroutine
 	// This starts the hub's main event loop (the 'select' statement)
 	go hub.Run()
 
 	// 3. Register our handlers
-	http.HandleFunc("/health", healthCheckHandler)
+	http.HandleFunc("/health", healthCheckHandler(hub))
+	http.Handle("/metrics", metrics.Handler())
 
 	// Get the ServeWs handler function (which includes the hub as a dependency)
 	// and register it for the "/ws" route
-	http.HandleFunc("/ws", server.ServeWs(hub))
+	http.HandleFunc("/ws", server.ServeWs(hub, origins))
 
 	// 4. Start the server
 	port := ":8080"
-	log.Printf("Starting signaling server on http://localhost%s", port)
+	srv := &http.Server{Addr: port}
+
+	// Stop on Ctrl+C, or on SIGTERM from a container runtime
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("Starting signaling server", "addr", "http://localhost"+port)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		fatal("Server stopped", "error", err)
+	case <-ctx.Done():
+	}
+
+	// 5. Shut down: stop accepting connections, then tell websocket clients
+	// (which Shutdown does not track) that the server is going away
+	slog.Info("Shutting down signaling server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Warn("HTTP shutdown incomplete", "error", err)
+	}
 
-	log.Fatal(http.ListenAndServe(port, nil))
+	hub.Stop()
+	if hub.Webhooks != nil {
+		if err := hub.Webhooks.Close(shutdownCtx); err != nil {
+			slog.Warn("Webhook events not delivered before shutdown", "error", err)
+		}
+	}
+	slog.Info("Signaling server stopped")
 }
@@ -0,0 +1,65 @@
+// Package metrics exposes the signaling server's Prometheus metrics.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "warpdrop"
+
+var (
+	// ActiveRooms is the number of rooms currently open.
+	ActiveRooms = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_rooms",
+		Help:      "Number of rooms currently open.",
+	})
+
+	// ConnectedClients is the number of open websocket connections.
+	ConnectedClients = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "connected_clients",
+		Help:      "Number of open websocket connections.",
+	})
+
+	// Messages counts the messages the hub handled, by message type.
+	Messages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_total",
+		Help:      "Messages handled by the hub, by message type.",
+	}, []string{"type"})
+
+	// SignalsRelayed counts signals forwarded to another peer.
+	SignalsRelayed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "signals_relayed_total",
+		Help:      "Signals forwarded from one peer to another.",
+	})
+
+	// DataRelayedBytes counts file data forwarded between peers that
+	// couldn't connect directly.
+	DataRelayedBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "data_relayed_bytes_total",
+		Help:      "Bytes of file data forwarded between peers through the server.",
+	})
+
+	// RoomFailures counts rejected room requests, by operation and reason.
+	RoomFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "room_failures_total",
+		Help:      "Rejected room requests, by operation and reason.",
+	}, []string{"op", "reason"})
+)
+
+func init() {
+	prometheus.MustRegister(ActiveRooms, ConnectedClients, Messages, SignalsRelayed, DataRelayedBytes, RoomFailures)
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
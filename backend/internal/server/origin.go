@@ -0,0 +1,46 @@
+package server
+
+import "strings"
+
+// OriginAllowlist decides which browser origins may open a websocket.
+// Requests without an Origin header come from native clients such as the
+// CLI and are always allowed.
+type OriginAllowlist struct {
+	any     bool
+	origins map[string]bool
+}
+
+// NewOriginAllowlist parses a comma-separated list of origins such as
+// "https://warpdrop.qzz.io,http://localhost:5173". "*" allows every origin.
+func NewOriginAllowlist(list string) *OriginAllowlist {
+	a := &OriginAllowlist{origins: make(map[string]bool)}
+	for _, origin := range strings.Split(list, ",") {
+		origin = normalizeOrigin(origin)
+		switch origin {
+		case "":
+		case "*":
+			a.any = true
+		default:
+			a.origins[origin] = true
+		}
+	}
+	return a
+}
+
+// AllowsAny reports whether every origin is accepted.
+func (a *OriginAllowlist) AllowsAny() bool {
+	return a.any
+}
+
+// Allowed reports whether a request with the given Origin header may connect.
+func (a *OriginAllowlist) Allowed(origin string) bool {
+	if origin == "" || a.any {
+		return true
+	}
+	return a.origins[normalizeOrigin(origin)]
+}
+
+// normalizeOrigin makes origins comparable regardless of case and a trailing slash.
+func normalizeOrigin(origin string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(origin)), "/")
+}
@@ -1,7 +1,7 @@
 package server
 
 import (
-	"log"
+	"log/slog"
 	"net/http"
 
 	"github.com/gorilla/websocket"
@@ -9,26 +9,50 @@ import (
 	"github.com/BioHazard786/Warpdrop/backend/internal/signaling"
 )
 
+// capacityRetryAfter is the Retry-After, in seconds, sent with connections
+// refused because the server is full.
+const capacityRetryAfter = "30"
+
 // Configure the websocket upgrader
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  64 * 1024, // 64 KB
 	WriteBufferSize: 64 * 1024, // 64 KB
 
-	// We need to check the origin, but for development, we can allow all.
-	// In production, you'd check r.Header.Get("Origin") against your frontend's domain
+	// Negotiate permessage-deflate; SDP offers and answers shrink well
+	EnableCompression: true,
+
+	// ServeWs checks the origin against its allowlist before upgrading so
+	// that rejections can be logged with a reason
 	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all connections for now
+		return true
 	},
 }
 
 // ServeWs returns an http.HandlerFunc that handles websocket requests.
-// It takes the hub as a dependency.
-func ServeWs(hub *signaling.Hub) http.HandlerFunc {
+// It takes the hub and the allowed browser origins as dependencies.
+func ServeWs(hub *signaling.Hub, origins *OriginAllowlist) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// Refuse browsers on sites we don't serve
+		if origin := r.Header.Get("Origin"); !origins.Allowed(origin) {
+			slog.Warn("Rejected websocket: origin is not in ALLOWED_ORIGINS", "addr", r.RemoteAddr, "origin", origin)
+			http.Error(w, "Origin not allowed", http.StatusForbidden)
+			return
+		}
+
+		// Refuse connections over MAX_CLIENTS before upgrading, so they
+		// cost the server as little as possible
+		if !hub.AcquireConnection() {
+			slog.Warn("Rejected websocket: server is at MAX_CLIENTS", "addr", r.RemoteAddr)
+			w.Header().Set("Retry-After", capacityRetryAfter)
+			http.Error(w, "Server has too many connections, try again later", http.StatusServiceUnavailable)
+			return
+		}
+
 		// Upgrade the HTTP connection to a WebSocket
 		conn, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
-			log.Println("Failed to upgrade connection:", err)
+			hub.ReleaseConnection()
+			slog.Warn("Failed to upgrade connection", "addr", r.RemoteAddr, "error", err)
 			return
 		}
 
@@ -40,8 +64,15 @@ func ServeWs(hub *signaling.Hub) http.HandlerFunc {
 			Send:   make(chan *signaling.Message, 256), // Buffered channel for *Message
 		}
 
-		// Register the client with the hub
-		client.Hub.Register <- client
+		// Register the client with the hub, unless it is shutting down
+		select {
+		case client.Hub.Register <- client:
+		case <-client.Hub.Done():
+			hub.ReleaseConnection()
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseServiceRestart, "server shutting down"))
+			conn.Close()
+			return
+		}
 
 		// Start the client's read and write pumps in separate goroutines
 		// These methods will handle the client's lifecycle
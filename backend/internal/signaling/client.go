@@ -1,7 +1,9 @@
 package signaling
 
 import (
-	"log"
+	"encoding/json"
+	"io"
+	"log/slog"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -17,7 +19,7 @@ const (
 	// Send pings to peer with this period. Must be less than pongWait.
 	pingPeriod = (pongWait * 9) / 10
 
-	// Maximum message size allowed from peer.
+	// Maximum message size allowed from peer, after decompression.
 	maxMessageSize = 64 * 1024 // 64 KB - enough for WebRTC SDP messages
 )
 
@@ -29,6 +31,9 @@ type Client struct {
 	// conn is the websocket connection.
 	Conn *websocket.Conn
 
+	// ID identifies the client in logs and TURN credentials.
+	ID string
+
 	// roomID is the ID of the room the client is in.
 	RoomID string
 
@@ -39,6 +44,29 @@ type Client struct {
 
 	// Client metadata for protocol negotiation
 	ClientType string // "cli" or "web"
+
+	// Protocols are the transfer protocols the client advertised, passed
+	// on to its peer so both ends can pick the same one.
+	Protocols []string
+
+	// ReconnectToken is the secret this client can rejoin its room with.
+	ReconnectToken string
+
+	// closedCleanly is set when the client closed the connection itself,
+	// in which case its slot is released at once instead of held.
+	closedCleanly bool
+}
+
+// logger returns a logger tagged with the client's address, peer ID and room.
+func (c *Client) logger() *slog.Logger {
+	attrs := []any{"peer", c.ID}
+	if c.Conn != nil {
+		attrs = append(attrs, "addr", c.Conn.RemoteAddr().String())
+	}
+	if c.RoomID != "" {
+		attrs = append(attrs, "room", c.RoomID)
+	}
+	return slog.With(attrs...)
 }
 
 // ReadPump pumps messages from the websocket connection to the hub.
@@ -49,7 +77,10 @@ type Client struct {
 func (c *Client) ReadPump() {
 	// When this function exits (e.g., connection closes), unregister the client
 	defer func() {
-		c.Hub.Unregister <- c
+		select {
+		case c.Hub.Unregister <- c:
+		case <-c.Hub.Done():
+		}
 		c.Conn.Close()
 	}()
 
@@ -64,11 +95,12 @@ func (c *Client) ReadPump() {
 	for {
 		// Read a message as JSON
 		var msg Message
-		err := c.Conn.ReadJSON(&msg)
+		err := readJSON(c.Conn, &msg)
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("error: %v", err)
+				c.logger().Warn("Unexpected close", "error", err)
 			}
+			c.closedCleanly = websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway)
 			break // Break the loop on error
 		}
 
@@ -76,7 +108,11 @@ func (c *Client) ReadPump() {
 		msg.client = c
 
 		// Send the message to the hub's broadcast channel for processing
-		c.Hub.Broadcast <- &msg
+		select {
+		case c.Hub.Broadcast <- &msg:
+		case <-c.Hub.Done():
+			return
+		}
 	}
 }
 
@@ -92,6 +128,7 @@ func (c *Client) WritePump() {
 	defer func() {
 		ticker.Stop()
 		c.Conn.Close()
+		c.Hub.writers.Done()
 	}()
 
 	for {
@@ -108,7 +145,7 @@ func (c *Client) WritePump() {
 			// Write the message to the websocket
 			err := c.Conn.WriteJSON(message) // Write the Message struct as JSON
 			if err != nil {
-				log.Printf("error writing json: %v", err)
+				c.logger().Warn("Failed to write message", "type", message.Type, "error", err)
 				return // Exit on write error
 			}
 
@@ -121,3 +158,20 @@ func (c *Client) WritePump() {
 		}
 	}
 }
+
+// readJSON decodes the next message into v. The connection's read limit
+// counts compressed bytes, so the decompressed message is bounded here.
+func readJSON(conn *websocket.Conn, v any) error {
+	_, r, err := conn.NextReader()
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(io.LimitReader(r, maxMessageSize+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > maxMessageSize {
+		return websocket.ErrReadLimit
+	}
+	return json.Unmarshal(data, v)
+}
@@ -2,12 +2,71 @@ package signaling
 
 import (
 	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"math/big"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/BioHazard786/Warpdrop/backend/internal/metrics"
 )
 
+// DefaultReconnectGrace is how long a dropped peer's slot is held for it to
+// rejoin with its reconnect token.
+const DefaultReconnectGrace = 30 * time.Second
+
+// DefaultRoomTTL is how long a room may wait for a receiver before it is
+// deleted.
+const DefaultRoomTTL = time.Hour
+
+// DefaultRoomIDWords is how many words make up a room ID unless the hub is
+// configured otherwise.
+const DefaultRoomIDWords = 4
+
+// MinRoomIDWords and MaxRoomIDWords bound the configurable room ID length.
+// The CLI accepts the same range when checking room IDs for typos.
+const (
+	MinRoomIDWords = 2
+	MaxRoomIDWords = 10
+)
+
+// CodeModeNumeric is the "create_room" code mode that issues a short code.
+const CodeModeNumeric = "numeric"
+
+// maxResumeTokenLen bounds the resume token relayed from "join_room".
+// Longer tokens are dropped rather than passed on.
+const maxResumeTokenLen = 64
+
+// maxRelayPayloadLen bounds the payload of a "relay" message. Relays are for
+// small app messages such as capability negotiation, not file data.
+const maxRelayPayloadLen = 4 * 1024
+
+// maxDataPayloadLen bounds the payload of a "data" message, one chunk of a
+// file relayed through the server. It leaves room in maxMessageSize for
+// the rest of the message.
+const maxDataPayloadLen = 48 * 1024
+
+// maxProtocols and maxProtocolLen bound the protocol list a client may
+// advertise. A list over either limit is dropped rather than passed on.
+const (
+	maxProtocols   = 8
+	maxProtocolLen = 32
+)
+
+// ShortCodeDigits is the length of numeric short codes.
+const ShortCodeDigits = 6
+
+// ShortCodeTTL is how long a short code can be used to join its room. The
+// code space is small, so codes are not kept for the room's whole life.
+const ShortCodeTTL = 10 * time.Minute
+
+// roomSweepInterval is how often the hub looks for expired rooms.
+const roomSweepInterval = time.Minute
+
 // Hub is the central brain of the signaling server.
 // It manages all active rooms and clients.
 type Hub struct {
@@ -23,52 +82,172 @@ type Hub struct {
 	// broadcast is a channel for clients to broadcast messages to.
 	// The hub will process these messages.
 	Broadcast chan *Message
+
+	// Webhooks receives room lifecycle events. Nil disables webhooks.
+	Webhooks *WebhookDispatcher
+
+	// ReconnectGrace is how long a dropped peer may take to rejoin. Zero
+	// releases slots as soon as the connection closes.
+	ReconnectGrace time.Duration
+
+	// RoomTTL is how long a room without a receiver may live. Zero keeps
+	// rooms until their peers leave.
+	RoomTTL time.Duration
+
+	// RoomIDWords is how many words are joined into each new room ID.
+	RoomIDWords int
+
+	// DataRelay lets peers that can't connect directly send file data
+	// through the server in "data" messages. It is off unless enabled,
+	// since relayed transfers cost the server their full bandwidth.
+	DataRelay bool
+
+	// MaxRooms and MaxClients cap how many rooms may be open and how many
+	// websocket connections may be open at once. Zero is unlimited.
+	MaxRooms   int
+	MaxClients int
+
+	// TURN issues short-lived TURN credentials to clients as they create
+	// or join a room. Nil leaves clients to their own TURN configuration.
+	TURN *TURNIssuer
+
+	// rooms and connections count open rooms and connections for Usage.
+	// rooms mirrors len(Rooms) for readers off the hub goroutine;
+	// connections is reserved by AcquireConnection before the upgrade.
+	rooms       atomic.Int64
+	connections atomic.Int64
+
+	// reconnects maps outstanding reconnect tokens to their room IDs.
+	reconnects map[string]string
+
+	// shortCodes maps numeric short codes to the rooms they join.
+	shortCodes map[string]*shortCode
+
+	// expired receives reconnect tokens whose grace period has run out.
+	expired chan string
+
+	// clients holds every registered connection, in a room or not.
+	clients map[*Client]bool
+
+	// stop asks Run to shut down; done is closed once it has.
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+
+	// writers tracks write pumps so Stop can wait for queued messages
+	// to be flushed.
+	writers sync.WaitGroup
 }
 
 // NewHub creates a new Hub instance.
 func NewHub() *Hub {
 	return &Hub{
-		Rooms:      make(map[string]*Room),
-		Register:   make(chan *Client),
-		Unregister: make(chan *Client),
-		Broadcast:  make(chan *Message),
+		Rooms:          make(map[string]*Room),
+		Register:       make(chan *Client),
+		Unregister:     make(chan *Client),
+		Broadcast:      make(chan *Message),
+		ReconnectGrace: DefaultReconnectGrace,
+		RoomTTL:        DefaultRoomTTL,
+		RoomIDWords:    DefaultRoomIDWords,
+		reconnects:     make(map[string]string),
+		shortCodes:     make(map[string]*shortCode),
+		expired:        make(chan string),
+		clients:        make(map[*Client]bool),
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+}
+
+// AcquireConnection reserves a connection for a new client, reporting false
+// when MaxClients are already connected. The client's unregistration frees
+// it; callers that don't register the client must ReleaseConnection.
+func (h *Hub) AcquireConnection() bool {
+	if n := h.connections.Add(1); h.MaxClients > 0 && n > int64(h.MaxClients) {
+		h.connections.Add(-1)
+		return false
+	}
+	return true
+}
+
+// ReleaseConnection frees a connection reserved by AcquireConnection.
+func (h *Hub) ReleaseConnection() {
+	h.connections.Add(-1)
+}
+
+// Usage returns how many rooms and websocket connections are open. It is
+// safe to call from any goroutine.
+func (h *Hub) Usage() (rooms, clients int) {
+	return int(h.rooms.Load()), int(h.connections.Load())
+}
+
+// Done is closed once the hub has stopped. Clients select on it so they
+// don't block on a hub that is no longer listening.
+func (h *Hub) Done() <-chan struct{} {
+	return h.done
+}
+
+// Stop tells every client the server is shutting down, exits Run and waits
+// for the clients' pending messages to be written. Run must be running.
+func (h *Hub) Stop() {
+	h.stopOnce.Do(func() { close(h.stop) })
+	<-h.done
+	h.writers.Wait()
+}
+
+// shutdown sends server_shutdown to every client and closes their send
+// channels so their write pumps flush and close the connection.
+func (h *Hub) shutdown() {
+	for client := range h.clients {
+		select {
+		case client.Send <- &Message{Type: "server_shutdown"}:
+		default:
+			client.logger().Warn("Send buffer full, dropping server_shutdown")
+		}
+		close(client.Send)
+		delete(h.clients, client)
+		h.ReleaseConnection()
+	}
+
+	for _, room := range h.Rooms {
+		for _, away := range room.Away {
+			away.timer.Stop()
+		}
 	}
 }
 
 // generateRoomID creates a random, memorable room ID using word combinations.
 // Format: word-word-word-word (e.g., "kitten-waffle-stardust-happy")
-// Randomly picks 4 words from all available word lists.
+// Each word comes from a different list while unused lists remain; longer
+// IDs reuse lists but never repeat a word.
 func (h *Hub) generateRoomID() string {
-	// Combine all word lists into one pool
-	allWords := [][]string{animals, dishes, names, randomWords, adjectives, extras}
+	count := h.RoomIDWords
+	if count < MinRoomIDWords {
+		count = DefaultRoomIDWords
+	}
 
 	// Keep generating until we find one that's not in use
 	for {
-		// Pick 4 random word lists (without replacement)
-		selectedLists := make([][]string, 4)
-		usedIndices := make(map[int]bool)
-
-		for i := 0; i < 4; i++ {
-			// Pick a random list index that hasn't been used yet
-			var listIndex int
-			for {
-				listIndex = randomIndex(len(allWords))
-				if !usedIndices[listIndex] {
-					usedIndices[listIndex] = true
-					break
-				}
+		words := make([]string, count)
+		used := make(map[string]bool)
+		var lists []int
+
+		for i := range words {
+			// Visit the lists in a fresh random order each time they run out
+			if len(lists) == 0 {
+				lists = randomPermutation(len(WordLists))
 			}
-			selectedLists[i] = allWords[listIndex]
-		}
+			list := WordLists[lists[0]]
+			lists = lists[1:]
 
-		// Pick a random word from each selected list
-		word1 := selectedLists[0][randomIndex(len(selectedLists[0]))]
-		word2 := selectedLists[1][randomIndex(len(selectedLists[1]))]
-		word3 := selectedLists[2][randomIndex(len(selectedLists[2]))]
-		word4 := selectedLists[3][randomIndex(len(selectedLists[3]))]
+			word := list[randomIndex(len(list))]
+			for used[word] {
+				word = list[randomIndex(len(list))]
+			}
+			used[word] = true
+			words[i] = word
+		}
 
-		// Combine them with hyphens
-		id := fmt.Sprintf("%s-%s-%s-%s", word1, word2, word3, word4)
+		id := strings.Join(words, "-")
 
 		// Check if room already exists
 		if _, ok := h.Rooms[id]; !ok {
@@ -77,105 +256,391 @@ func (h *Hub) generateRoomID() string {
 	}
 }
 
+// shortCode is a numeric code that joins a room until it expires.
+type shortCode struct {
+	roomID  string
+	expires time.Time
+}
+
+// issueShortCode assigns the room a numeric code that isn't in use.
+func (h *Hub) issueShortCode(room *Room) string {
+	limit := 1
+	for range ShortCodeDigits {
+		limit *= 10
+	}
+
+	now := time.Now()
+	for {
+		code := fmt.Sprintf("%0*d", ShortCodeDigits, randomIndex(limit))
+		if existing, ok := h.shortCodes[code]; ok && now.Before(existing.expires) {
+			continue
+		}
+		h.shortCodes[code] = &shortCode{roomID: room.ID, expires: now.Add(ShortCodeTTL)}
+		room.ShortCode = code
+		return code
+	}
+}
+
+// resolveRoomID returns the room ID a short code stands for, or id itself
+// when it isn't a live short code.
+func (h *Hub) resolveRoomID(id string) string {
+	code, ok := h.shortCodes[id]
+	if !ok {
+		return id
+	}
+	if time.Now().After(code.expires) {
+		delete(h.shortCodes, id)
+		return id
+	}
+	return code.roomID
+}
+
+// releaseShortCode frees a deleted room's short code for reuse.
+func (h *Hub) releaseShortCode(room *Room) {
+	if code, ok := h.shortCodes[room.ShortCode]; ok && code.roomID == room.ID {
+		delete(h.shortCodes, room.ShortCode)
+	}
+}
+
+// randomPermutation returns 0..n-1 in a cryptographically random order.
+func randomPermutation(n int) []int {
+	perm := make([]int, n)
+	for i := range perm {
+		perm[i] = i
+	}
+	for i := n - 1; i > 0; i-- {
+		j := randomIndex(i + 1)
+		perm[i], perm[j] = perm[j], perm[i]
+	}
+	return perm
+}
+
 // randomIndex returns a cryptographically secure random index for a slice of given length.
 func randomIndex(max int) int {
 	n, err := rand.Int(rand.Reader, big.NewInt(int64(max)))
 	if err != nil {
-		log.Panic("Failed to generate random index:", err)
+		panic("failed to generate random index: " + err.Error())
 	}
 	return int(n.Int64())
 }
 
+// newPeerID returns a random identifier for a client.
+func newPeerID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic("failed to generate peer ID: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
+
+// newReconnectToken returns a secret a client can reclaim its slot with.
+func newReconnectToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic("failed to generate reconnect token: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
+
+// holdSlot keeps a dropped client's place in the room for ReconnectGrace.
+func (h *Hub) holdSlot(room *Room, client *Client, sender bool) {
+	token := client.ReconnectToken
+	if room.Away == nil {
+		room.Away = make(map[string]*awayPeer)
+	}
+	room.Away[token] = &awayPeer{
+		client: client,
+		sender: sender,
+		timer: time.AfterFunc(h.ReconnectGrace, func() {
+			// Run may have stopped since the timer fired
+			select {
+			case h.expired <- token:
+			case <-h.done:
+			}
+		}),
+	}
+	h.reconnects[token] = room.ID
+	client.logger().Info("Holding slot", "grace", h.ReconnectGrace.String())
+}
+
+// releasePeer finishes a peer's departure: the room is deleted once empty,
+// otherwise the remaining peers that cared about it are told it left.
+func (h *Hub) releasePeer(room *Room, client *Client, sender bool) {
+	otherPeer := room.Sender
+	if sender {
+		otherPeer = room.Receiver
+	}
+
+	if room.isEmpty() {
+		delete(h.Rooms, room.ID)
+		h.releaseShortCode(room)
+		h.rooms.Add(-1)
+		metrics.ActiveRooms.Dec()
+		slog.Info("Room deleted", "room", room.ID)
+		h.emitEvent(WebhookRoomClosed, room)
+		return
+	}
+
+	client.logger().Info("Peer left room")
+	if otherPeer != nil {
+		otherPeer.Send <- &Message{Type: "peer_left"}
+	}
+}
+
+// expireRooms deletes rooms that have waited longer than RoomTTL without a
+// receiver, telling a still-connected sender why.
+func (h *Hub) expireRooms(now time.Time) {
+	for id, room := range h.Rooms {
+		if !room.idle() || now.Sub(room.CreatedAt) < h.RoomTTL {
+			continue
+		}
+
+		// A sender waiting to rejoin has nothing left to come back to
+		for token, away := range room.Away {
+			away.timer.Stop()
+			delete(h.reconnects, token)
+		}
+
+		if room.Sender != nil {
+			room.Sender.Send <- &Message{
+				Type:    "error",
+				RoomID:  id,
+				Payload: json.RawMessage(`{"error": "Room expired"}`),
+			}
+			room.Sender.RoomID = ""
+		}
+
+		slog.Info("Room expired", "room", id, "age", now.Sub(room.CreatedAt).Round(time.Second).String())
+		h.emitEvent(WebhookRoomClosed, room)
+		delete(h.Rooms, id)
+		h.releaseShortCode(room)
+		h.rooms.Add(-1)
+		metrics.ActiveRooms.Dec()
+	}
+}
+
+// messageTypes are the message types the hub handles. Anything else is
+// counted as "unknown" so clients can't create arbitrary metric labels.
+var messageTypes = map[string]bool{
+	"create_room": true,
+	"join_room":   true,
+	"signal":      true,
+	"relay":       true,
+	"data":        true,
+	"room_status": true,
+	"rejoin_room": true,
+}
+
+// validProtocols returns the advertised protocols, or nil when the list is
+// longer than the server relays.
+func validProtocols(protocols []string) []string {
+	if len(protocols) > maxProtocols {
+		return nil
+	}
+	for _, p := range protocols {
+		if len(p) > maxProtocolLen {
+			return nil
+		}
+	}
+	return protocols
+}
+
+// countMessage records a handled message in the metrics.
+func countMessage(msgType string) {
+	if !messageTypes[msgType] {
+		msgType = "unknown"
+	}
+	metrics.Messages.WithLabelValues(msgType).Inc()
+}
+
+// emitEvent queues a webhook event for the room, if webhooks are enabled.
+func (h *Hub) emitEvent(event string, room *Room) {
+	if h.Webhooks == nil {
+		return
+	}
+
+	ev := WebhookEvent{
+		Event:     event,
+		RoomHash:  hashRoomID(room.ID),
+		Timestamp: time.Now().UTC(),
+	}
+	if room.Sender != nil {
+		ev.SenderType = room.Sender.ClientType
+	}
+	if room.Receiver != nil {
+		ev.ReceiverType = room.Receiver.ClientType
+	}
+
+	h.Webhooks.Dispatch(ev)
+}
+
 // Run starts the hub's main processing loop.
 // This is the single goroutine that safely manages all state (rooms, clients).
 func (h *Hub) Run() {
+	// Periodically sweep abandoned rooms. A nil channel never fires, which
+	// keeps the sweeper off when RoomTTL is zero.
+	var sweep <-chan time.Time
+	if h.RoomTTL > 0 {
+		ticker := time.NewTicker(min(h.RoomTTL, roomSweepInterval))
+		defer ticker.Stop()
+		sweep = ticker.C
+	}
+
+	defer close(h.done)
+
 	// Start an infinite loop to listen for messages on our channels
 	for {
 		select {
+		// --- Shutdown ---
+		case <-h.stop:
+			slog.Info("Hub stopping", "clients", len(h.clients), "rooms", len(h.Rooms))
+			h.shutdown()
+			return
+
 		// --- Client Register ---
 		case client := <-h.Register:
-			// For now, we just log the registration.
 			// The client is not in a room yet. They need to send a
 			// "create_room" or "join_room" message first.
-			log.Printf("Client registered: %s", client.Conn.RemoteAddr())
+			client.ID = newPeerID()
+			h.clients[client] = true
+			h.writers.Add(1)
+			metrics.ConnectedClients.Inc()
+			client.logger().Info("Client registered")
 
 		// --- Client Unregister ---
 		case client := <-h.Unregister:
-			log.Printf("Client unregistered: %s", client.Conn.RemoteAddr())
+			delete(h.clients, client)
+			h.ReleaseConnection()
+			metrics.ConnectedClients.Dec()
+			client.logger().Info("Client unregistered")
 
 			// Clean up:
 			// 1. Find the room the client was in
 			if client.RoomID != "" {
 				if room, ok := h.Rooms[client.RoomID]; ok {
 
-					var otherPeer *Client
-
 					// 2. See if they were the sender or receiver and remove them
-					if room.Sender == client {
+					sender := room.Sender == client
+					receiver := room.Receiver == client
+					if sender {
 						room.Sender = nil
-						otherPeer = room.Receiver
-					} else if room.Receiver == client {
+					} else if receiver {
 						room.Receiver = nil
-						otherPeer = room.Sender
 					}
-
-					// 3. If the room is now empty, delete it
-					if room.Sender == nil && room.Receiver == nil {
-						delete(h.Rooms, room.ID)
-						log.Printf("Room deleted: %s", room.ID)
-					} else {
-						// 4. If the room is not empty, notify the other peer
-						log.Printf("Peer left room: %s", room.ID)
-						if otherPeer != nil {
-							otherPeer.Send <- &Message{Type: "peer_left"}
+					if sender || receiver {
+						// 3. Hold the slot of a peer that dropped off unexpectedly
+						// so it can rejoin; otherwise release it right away
+						if h.ReconnectGrace > 0 && client.ReconnectToken != "" && !client.closedCleanly {
+							h.holdSlot(room, client, sender)
+						} else {
+							h.releasePeer(room, client, sender)
 						}
 					}
 				}
 			}
 
-			// 5. Close the client's send channel to stop its writePump
+			// 4. Close the client's send channel to stop its writePump
 			close(client.Send)
 
+		// --- Reconnect Window Expired ---
+		case token := <-h.expired:
+			roomID, ok := h.reconnects[token]
+			if !ok {
+				// The peer rejoined just before the timer fired
+				continue
+			}
+			delete(h.reconnects, token)
+
+			if room, ok := h.Rooms[roomID]; ok {
+				if away, ok := room.Away[token]; ok {
+					delete(room.Away, token)
+					away.client.logger().Info("Reconnect window expired")
+					h.releasePeer(room, away.client, away.sender)
+				}
+			}
+
+		// --- Room TTL Sweep ---
+		case now := <-sweep:
+			h.expireRooms(now)
+
 		// --- Broadcast Message ---
 		case message := <-h.Broadcast:
 			// Log the incoming message
-			log.Printf("Broadcast received: Type=%s from %s", message.Type, message.client.Conn.RemoteAddr())
+			logger := message.client.logger().With("type", message.Type)
+			logger.Info("Broadcast received")
+			countMessage(message.Type)
 
 			// This is the core signaling logic
 			switch message.Type {
 
 			// Case 1: A client wants to create a new room
 			case "create_room":
+				// A second room would orphan the first one
+				if message.client.RoomID != "" {
+					logger.Warn("Room create failed: client is already in a room")
+					metrics.RoomFailures.WithLabelValues("create", "already_in_room").Inc()
+					message.client.Send <- &Message{
+						Type:    "error",
+						Payload: json.RawMessage(`{"error": "You are already in a room"}`),
+					}
+					continue
+				}
+
+				if h.MaxRooms > 0 && len(h.Rooms) >= h.MaxRooms {
+					logger.Warn("Room create failed: server is at capacity", "rooms", len(h.Rooms))
+					metrics.RoomFailures.WithLabelValues("create", "capacity").Inc()
+					message.client.Send <- &Message{
+						Type:    "error",
+						Payload: json.RawMessage(`{"error": "Server has too many open rooms, try again later"}`),
+					}
+					continue
+				}
+
 				// Store client metadata
 				message.client.ClientType = message.ClientType
+				message.client.Protocols = validProtocols(message.Protocols)
 
 				roomID := h.generateRoomID()
 				room := &Room{
-					ID:     roomID,
-					Sender: message.client,
+					ID:        roomID,
+					CreatedAt: time.Now(),
+					Sender:    message.client,
 				}
 				h.Rooms[roomID] = room
+				h.rooms.Add(1)
+				metrics.ActiveRooms.Inc()
 				message.client.RoomID = roomID
+				message.client.ReconnectToken = newReconnectToken()
+				if message.CodeMode == CodeModeNumeric {
+					h.issueShortCode(room)
+				}
 
-				log.Printf("Room created: %s by %s (type=%s)", roomID, message.client.Conn.RemoteAddr(), message.client.ClientType)
+				logger.Info("Room created", "room", roomID, "client_type", message.client.ClientType, "short_code", room.ShortCode != "")
+				h.emitEvent(WebhookRoomCreated, room)
 
 				// Send the "room_created" message back to the sender
+				h.sendTURNCredentials(message.client)
 				message.client.Send <- &Message{
-					Type:   "room_created",
-					RoomID: roomID,
+					Type:           "room_created",
+					RoomID:         roomID,
+					ShortCode:      room.ShortCode,
+					ReconnectToken: message.client.ReconnectToken,
 				}
 
 			// Case 2: A client wants to join an existing room
 			case "join_room":
 				// Store client metadata
 				message.client.ClientType = message.ClientType
+				message.client.Protocols = validProtocols(message.Protocols)
 
-				roomID := message.RoomID
+				// Receivers may join with the room's short code
+				roomID := h.resolveRoomID(message.RoomID)
 				room, ok := h.Rooms[roomID]
 
 				// Check if room exists
 				if !ok {
-					log.Printf("Room join failed: Room %s not found", roomID)
+					logger.Warn("Room join failed: room not found", "room", roomID)
+					metrics.RoomFailures.WithLabelValues("join", "not_found").Inc()
 					message.client.Send <- &Message{
 						Type:    "error",
 						Payload: json.RawMessage(`{"error": "Room not found"}`),
@@ -183,9 +648,22 @@ func (h *Hub) Run() {
 					continue // Use 'continue' to skip to the next 'select' iteration
 				}
 
-				// Check if room is full
-				if room.Receiver != nil {
-					log.Printf("Room join failed: Room %s is full", roomID)
+				// A receiver joining now would never be announced to the
+				// sender, so wait until it is back
+				if room.senderAway() {
+					logger.Warn("Room join failed: sender is reconnecting", "room", roomID)
+					metrics.RoomFailures.WithLabelValues("join", "sender_away").Inc()
+					message.client.Send <- &Message{
+						Type:    "error",
+						Payload: json.RawMessage(`{"error": "Sender is reconnecting, try again shortly"}`),
+					}
+					continue
+				}
+
+				// Check if room is full, counting a slot held for a reconnecting receiver
+				if room.Receiver != nil || room.receiverAway() {
+					logger.Warn("Room join failed: room is full", "room", roomID)
+					metrics.RoomFailures.WithLabelValues("join", "full").Inc()
 					message.client.Send <- &Message{
 						Type:    "error",
 						Payload: json.RawMessage(`{"error": "Room is full"}`),
@@ -196,14 +674,23 @@ func (h *Hub) Run() {
 				// Room is valid and has space. Add the client as the receiver.
 				room.Receiver = message.client
 				message.client.RoomID = roomID
+				message.client.ReconnectToken = newReconnectToken()
 
-				log.Printf("Client %s joined room %s (type=%s)", message.client.Conn.RemoteAddr(), roomID, message.client.ClientType)
+				resumeToken := message.ResumeToken
+				if len(resumeToken) > maxResumeTokenLen {
+					resumeToken = ""
+				}
+
+				logger.Info("Client joined room", "room", roomID, "client_type", message.client.ClientType, "resume", resumeToken != "")
+				h.emitEvent(WebhookRoomJoined, room)
 
 				// Notify the *sender* (Peer A) that the receiver has joined
 				// Include receiver's peer info for protocol negotiation
 				if room.Sender != nil {
 					peerInfo := PeerInfo{
-						ClientType: message.client.ClientType,
+						ClientType:  message.client.ClientType,
+						ResumeToken: resumeToken,
+						Protocols:   message.client.Protocols,
 					}
 					peerInfoBytes, _ := json.Marshal(peerInfo)
 
@@ -215,23 +702,58 @@ func (h *Hub) Run() {
 
 				// Notify the *receiver* (Peer B) that they successfully joined
 				// Include sender's peer info for protocol negotiation
-				peerInfo := PeerInfo{
-					ClientType: room.Sender.ClientType,
+				peerInfo := PeerInfo{ResumeToken: resumeToken}
+				if room.Sender != nil {
+					peerInfo.ClientType = room.Sender.ClientType
+					peerInfo.Protocols = room.Sender.Protocols
 				}
 				peerInfoBytes, _ := json.Marshal(peerInfo)
 
+				h.sendTURNCredentials(message.client)
 				message.client.Send <- &Message{
-					Type:    "join_success",
-					RoomID:  roomID,
-					Payload: peerInfoBytes,
+					Type:           "join_success",
+					RoomID:         roomID,
+					Payload:        peerInfoBytes,
+					ReconnectToken: message.client.ReconnectToken,
 				}
 
-			// Case 3: A client is sending a WebRTC signal (offer, answer, or ICE candidate)
-			case "signal":
+			// Case 3: A client is sending a WebRTC signal (offer, answer, or ICE
+			// candidate), a "relay" with an opaque app payload for its peer, or
+			// "data" carrying file data for peers that can't connect directly.
+			// All are forwarded the same way without being interpreted.
+			case "signal", "relay", "data":
 				roomID := message.client.RoomID
 
+				if message.Type == "relay" && len(message.Payload) > maxRelayPayloadLen {
+					logger.Warn("Relay failed: payload too large", "size", len(message.Payload))
+					message.client.Send <- &Message{
+						Type:    "error",
+						Payload: json.RawMessage(fmt.Sprintf(`{"error": "Relay payload is larger than %d bytes"}`, maxRelayPayloadLen)),
+					}
+					continue
+				}
+
+				if message.Type == "data" && !h.DataRelay {
+					logger.Warn("Data relay failed: disabled on this server")
+					metrics.RoomFailures.WithLabelValues("data", "disabled").Inc()
+					message.client.Send <- &Message{
+						Type:    "error",
+						Payload: json.RawMessage(`{"error": "This server does not relay file data"}`),
+					}
+					continue
+				}
+
+				if message.Type == "data" && len(message.Payload) > maxDataPayloadLen {
+					logger.Warn("Data relay failed: payload too large", "size", len(message.Payload))
+					message.client.Send <- &Message{
+						Type:    "error",
+						Payload: json.RawMessage(fmt.Sprintf(`{"error": "Data payload is larger than %d bytes"}`, maxDataPayloadLen)),
+					}
+					continue
+				}
+
 				if roomID == "" {
-					log.Printf("Signal failed: Client %s is not in any room", message.client.Conn.RemoteAddr())
+					logger.Warn("Signal failed: client is not in any room")
 					message.client.Send <- &Message{
 						Type:    "error",
 						Payload: json.RawMessage(`{"error": "You must join a room first"}`),
@@ -241,7 +763,7 @@ func (h *Hub) Run() {
 
 				room, ok := h.Rooms[roomID]
 				if !ok {
-					log.Printf("Signal failed: Room %s not found", roomID)
+					logger.Warn("Signal failed: room not found")
 					message.client.Send <- &Message{
 						Type:    "error",
 						Payload: json.RawMessage(`{"error": "Room not found"}`),
@@ -249,27 +771,144 @@ func (h *Hub) Run() {
 					continue
 				}
 
-				// Find the *other* peer to relay the signal to
-				var targetClient *Client
+				// Find the *other* peer to relay the message to
+				target := room.Sender
 				if message.client == room.Sender {
-					targetClient = room.Receiver
-				} else {
-					targetClient = room.Sender
+					target = room.Receiver
 				}
 
 				// Relay the message only if the other peer exists
-				if targetClient != nil {
-					log.Printf("Relaying signal from %s to %s in room %s", message.client.Conn.RemoteAddr(), targetClient.Conn.RemoteAddr(), roomID)
-					// We can just forward the original message, as it already
-					// has the correct type ("signal") and payload.
-					targetClient.Send <- message
+				if target == nil {
+					logger.Warn("Signal failed: no other peer in room")
+					continue
+				}
+
+				// Forward the original message, minus the sender's secret
+				message.ReconnectToken = ""
+
+				// File data is too much to log per message, and a peer that
+				// can't keep up must not stall the hub. Clients limit how much
+				// they have in flight, so a full queue means the peer is stuck.
+				if message.Type == "data" {
+					select {
+					case target.Send <- message:
+						metrics.DataRelayedBytes.Add(float64(len(message.Payload)))
+					default:
+						logger.Warn("Data relay failed: peer is not keeping up", "target", target.ID)
+						// The data sender may be just as backed up, and
+						// waiting on it would stall the hub all the same
+						select {
+						case message.client.Send <- &Message{
+							Type:    "error",
+							Payload: json.RawMessage(`{"error": "Peer is not keeping up with relayed data"}`),
+						}:
+						default:
+							logger.Warn("Send buffer full, dropping error")
+						}
+					}
+					continue
+				}
+
+				logger.Info("Relaying "+message.Type, "target", target.ID)
+				target.Send <- message
+				if message.Type == "signal" {
+					metrics.SignalsRelayed.Inc()
+				}
+
+			// Case 4: A client asks whether a room exists and how full it is.
+			// This does not join the room, so it works from any connection.
+			case "room_status":
+				status := RoomStatus{}
+				if room, ok := h.Rooms[h.resolveRoomID(message.RoomID)]; ok {
+					status = RoomStatus{
+						Exists: true,
+						Peers:  room.peerCount(),
+					}
+				}
+				statusBytes, _ := json.Marshal(status)
+
+				message.client.Send <- &Message{
+					Type:    "room_status",
+					RoomID:  message.RoomID,
+					Payload: statusBytes,
+				}
+
+			// Case 5: A client that lost its connection reclaims its slot
+			case "rejoin_room":
+				// A client already in a room would be in two at once
+				if message.client.RoomID != "" {
+					logger.Warn("Rejoin failed: client is already in a room")
+					metrics.RoomFailures.WithLabelValues("rejoin", "already_in_room").Inc()
+					message.client.Send <- &Message{
+						Type:    "error",
+						Payload: json.RawMessage(`{"error": "You are already in a room"}`),
+					}
+					continue
+				}
+
+				token := message.ReconnectToken
+				room, ok := h.Rooms[h.reconnects[token]]
+				var away *awayPeer
+				if ok && token != "" {
+					away = room.Away[token]
+				}
+				if away == nil {
+					logger.Warn("Rejoin failed: invalid or expired token")
+					metrics.RoomFailures.WithLabelValues("rejoin", "invalid_token").Inc()
+					message.client.Send <- &Message{
+						Type:    "error",
+						Payload: json.RawMessage(`{"error": "Reconnect token is invalid or expired"}`),
+					}
+					continue
+				}
+
+				away.timer.Stop()
+				delete(room.Away, token)
+				delete(h.reconnects, token)
+
+				// The new connection takes over the old identity. The token
+				// is single use.
+				client := message.client
+				client.ID = away.client.ID
+				client.ClientType = away.client.ClientType
+				client.Protocols = away.client.Protocols
+				client.RoomID = room.ID
+				client.ReconnectToken = newReconnectToken()
+
+				otherPeer := room.Receiver
+				role := "receiver"
+				if away.sender {
+					role = "sender"
+					room.Sender = client
 				} else {
-					log.Printf("Signal failed: No other peer in room %s", roomID)
+					room.Receiver = client
+					otherPeer = room.Sender
+				}
+
+				client.logger().Info("Client rejoined room", "type", message.Type, "role", role)
+
+				rejoinBytes, _ := json.Marshal(RejoinInfo{Role: role})
+				client.Send <- &Message{
+					Type:           "rejoin_success",
+					RoomID:         room.ID,
+					Payload:        rejoinBytes,
+					ReconnectToken: client.ReconnectToken,
+				}
+
+				peerInfoBytes, _ := json.Marshal(PeerInfo{
+					ClientType: client.ClientType,
+					Protocols:  client.Protocols,
+				})
+				if otherPeer != nil {
+					otherPeer.Send <- &Message{
+						Type:    "peer_reconnected",
+						Payload: peerInfoBytes,
+					}
 				}
 
 			// Default case: Unknown message type
 			default:
-				log.Printf("Unknown message type: %s", message.Type)
+				logger.Warn("Unknown message type")
 			}
 		}
 	}
@@ -4,12 +4,37 @@ import "encoding/json"
 
 // Message defines the structure for all C2S (Client to Server)
 // and S2C (Server to Client) websocket messages.
+//
+// A "relay" message carries an opaque Payload for the room's other peer, for
+// app messages exchanged before the peers connect. It is forwarded like a
+// "signal" but the server never reads it. A "data" message is the same for
+// file data relayed through the server, when the peers can't connect
+// directly.
 type Message struct {
 	Type       string          `json:"type"`
 	Payload    json.RawMessage `json:"payload,omitempty"`
 	RoomID     string          `json:"room_id,omitempty"`
 	ClientType string          `json:"client_type,omitempty"` // "cli" or "web"  // ["multi-channel", "msgpack"]
 
+	// ReconnectToken lets a client that lost its connection reclaim its
+	// slot with "rejoin_room". The server hands one out on create and join.
+	ReconnectToken string `json:"reconnect_token,omitempty"`
+
+	// CodeMode "numeric" on "create_room" asks for a short numeric code
+	// that receivers can join with instead of the room ID. The code is
+	// returned in ShortCode on "room_created".
+	CodeMode  string `json:"code_mode,omitempty"`
+	ShortCode string `json:"short_code,omitempty"`
+
+	// ResumeToken on "join_room" says the receiver has partial files from
+	// an earlier transfer. It is relayed to the sender in "peer_joined".
+	ResumeToken string `json:"resume_token,omitempty"`
+
+	// Protocols on "create_room" and "join_room" lists the transfer
+	// protocols the client supports. It is passed to the other peer in
+	// PeerInfo.
+	Protocols []string `json:"protocols,omitempty"`
+
 	// client is the client that sent the message.
 	// It's used internally by the Hub and not sent over JSON.
 	client *Client `json:"-"`
@@ -18,4 +43,22 @@ type Message struct {
 // PeerInfo contains information about a connected peer
 type PeerInfo struct {
 	ClientType string `json:"client_type"`
+
+	// ResumeToken is the joining receiver's resume token. It is echoed in
+	// "join_success" so the receiver knows the sender was told.
+	ResumeToken string `json:"resume_token,omitempty"`
+
+	// Protocols are the transfer protocols the peer advertised.
+	Protocols []string `json:"protocols,omitempty"`
+}
+
+// RoomStatus answers a "room_status" query.
+type RoomStatus struct {
+	Exists bool `json:"exists"`
+	Peers  int  `json:"peers"`
+}
+
+// RejoinInfo answers a successful "rejoin_room" with the role restored.
+type RejoinInfo struct {
+	Role string `json:"role"` // "sender" or "receiver"
 }
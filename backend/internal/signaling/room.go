@@ -1,13 +1,75 @@
 package signaling
 
+import "time"
+
 // Room represents a single room where two peers (sender and receiver) can connect.
 type Room struct {
 	// ID is the unique identifier for the room.
 	ID string
 
+	// CreatedAt is when the sender created the room.
+	CreatedAt time.Time
+
+	// ShortCode is the numeric code that also joins the room, if the
+	// sender asked for one.
+	ShortCode string
+
 	// Sender is the client who initiated the room (Peer A).
 	Sender *Client
 
 	// Receiver is the client who joined the room (Peer B).
 	Receiver *Client
+
+	// Away holds peers whose connection dropped, keyed by reconnect token.
+	// Their slots stay reserved until they rejoin or the grace period ends.
+	Away map[string]*awayPeer
+}
+
+// awayPeer is a disconnected peer that may still rejoin its room.
+type awayPeer struct {
+	client *Client
+	sender bool
+	timer  *time.Timer
+}
+
+// isEmpty reports whether every peer has left the room for good.
+func (r *Room) isEmpty() bool {
+	return r.Sender == nil && r.Receiver == nil && len(r.Away) == 0
+}
+
+// senderAway reports whether the sender's slot is held for a rejoin.
+func (r *Room) senderAway() bool {
+	for _, away := range r.Away {
+		if away.sender {
+			return true
+		}
+	}
+	return false
+}
+
+// receiverAway reports whether the receiver's slot is held for a rejoin.
+func (r *Room) receiverAway() bool {
+	for _, away := range r.Away {
+		if !away.sender {
+			return true
+		}
+	}
+	return false
+}
+
+// idle reports whether no receiver is in the room or holding a slot.
+func (r *Room) idle() bool {
+	return r.Receiver == nil && !r.receiverAway()
+}
+
+// peerCount returns how many peers are currently in the room.
+func (r *Room) peerCount() int {
+	n := 0
+	if r.Sender != nil {
+		n++
+	}
+	if r.Receiver != nil {
+		n++
+	}
+	return n
 }
@@ -0,0 +1,102 @@
+package signaling
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTURNTTL is how long issued TURN credentials stay valid. TURN
+// allocations are refreshed with the same credentials, so it must outlast
+// the longest transfer expected to go through the relay.
+const DefaultTURNTTL = 12 * time.Hour
+
+// TURNCredentials are sent to clients in a "turn_credentials" message. The
+// fields follow RTCIceServer so web clients can use them as they are.
+type TURNCredentials struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username"`
+	Credential string   `json:"credential"`
+
+	// TTL is how many seconds the credentials are valid for.
+	TTL int `json:"ttl"`
+}
+
+// TURNIssuer mints time-limited credentials for TURN servers sharing its
+// secret, in the form coturn's use-auth-secret option checks: the username
+// is the expiry as a Unix timestamp and the peer ID, and the credential is
+// the base64 HMAC-SHA1 of the username keyed with the secret.
+type TURNIssuer struct {
+	Secret []byte
+	URLs   []string
+	TTL    time.Duration
+}
+
+// NewTURNIssuer creates an issuer for the comma-separated servers, each a
+// turn: or turns: URL or a hostname on the standard ports.
+func NewTURNIssuer(secret, servers string, ttl time.Duration) (*TURNIssuer, error) {
+	if secret == "" {
+		return nil, fmt.Errorf("TURN secret is empty")
+	}
+	urls := turnURLs(servers)
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no TURN servers given")
+	}
+	if ttl <= 0 {
+		ttl = DefaultTURNTTL
+	}
+	return &TURNIssuer{Secret: []byte(secret), URLs: urls, TTL: ttl}, nil
+}
+
+// Issue mints credentials for the peer that expire TTL after now.
+func (t *TURNIssuer) Issue(peerID string, now time.Time) TURNCredentials {
+	username := strconv.FormatInt(now.Add(t.TTL).Unix(), 10) + ":" + peerID
+	mac := hmac.New(sha1.New, t.Secret)
+	mac.Write([]byte(username))
+	return TURNCredentials{
+		URLs:       t.URLs,
+		Username:   username,
+		Credential: base64.StdEncoding.EncodeToString(mac.Sum(nil)),
+		TTL:        int(t.TTL / time.Second),
+	}
+}
+
+// turnURLs expands hostnames to the TURN URLs clients use by default and
+// keeps URLs as they are.
+func turnURLs(servers string) []string {
+	var urls []string
+	for _, server := range strings.Split(servers, ",") {
+		server = strings.TrimSpace(server)
+		switch {
+		case server == "":
+		case strings.HasPrefix(server, "turn:"), strings.HasPrefix(server, "turns:"):
+			urls = append(urls, server)
+		default:
+			urls = append(urls,
+				fmt.Sprintf("turn:%s:3478?transport=udp", server),
+				fmt.Sprintf("turn:%s:3478?transport=tcp", server),
+				fmt.Sprintf("turns:%s:5349?transport=tcp", server),
+			)
+		}
+	}
+	return urls
+}
+
+// sendTURNCredentials gives client fresh TURN credentials, if the hub
+// issues them. It is sent ahead of "room_created" and "join_success" so
+// clients have it before they set up a peer connection.
+func (h *Hub) sendTURNCredentials(client *Client) {
+	if h.TURN == nil {
+		return
+	}
+	payload, _ := json.Marshal(h.TURN.Issue(client.ID, time.Now()))
+	client.Send <- &Message{
+		Type:    "turn_credentials",
+		Payload: payload,
+	}
+}
@@ -0,0 +1,148 @@
+package signaling
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	// Maximum number of events waiting to be delivered.
+	// When the queue is full, new events are dropped so the hub never blocks.
+	webhookQueueSize = 256
+
+	// Number of delivery attempts per event before giving up.
+	webhookMaxAttempts = 4
+
+	// Delay before the first retry. Doubles after each failed attempt.
+	webhookBaseBackoff = 500 * time.Millisecond
+
+	// Time allowed for a single webhook HTTP request.
+	webhookTimeout = 5 * time.Second
+)
+
+// Webhook event names.
+const (
+	WebhookRoomCreated = "room_created"
+	WebhookRoomJoined  = "room_joined"
+	WebhookRoomClosed  = "room_closed"
+)
+
+// WebhookEvent is the JSON body POSTed to the webhook URL.
+type WebhookEvent struct {
+	// Event is one of the Webhook* event names.
+	Event string `json:"event"`
+
+	// RoomHash is a SHA-256 hash of the room ID.
+	// The raw room ID is never sent, since knowing it is enough to join the room.
+	RoomHash string `json:"room_hash"`
+
+	// Client types of the peers in the room at the time of the event.
+	SenderType   string `json:"sender_type,omitempty"`
+	ReceiverType string `json:"receiver_type,omitempty"`
+
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// WebhookDispatcher delivers room events to an HTTP endpoint.
+// It runs in its own goroutine so slow endpoints never stall the hub.
+type WebhookDispatcher struct {
+	url    string
+	client *http.Client
+	queue  chan WebhookEvent
+
+	// done is closed when Run returns.
+	done chan struct{}
+}
+
+// NewWebhookDispatcher creates a dispatcher that posts events to url.
+// Call Run in a separate goroutine to start delivering.
+func NewWebhookDispatcher(url string) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		url:    url,
+		client: &http.Client{Timeout: webhookTimeout},
+		queue:  make(chan WebhookEvent, webhookQueueSize),
+		done:   make(chan struct{}),
+	}
+}
+
+// Dispatch queues an event for delivery without blocking.
+// The event is dropped if the queue is full.
+func (d *WebhookDispatcher) Dispatch(event WebhookEvent) {
+	select {
+	case d.queue <- event:
+	default:
+		slog.Warn("Webhook queue full, dropping event", "event", event.Event)
+	}
+}
+
+// Run delivers queued events until the queue is closed.
+func (d *WebhookDispatcher) Run() {
+	defer close(d.done)
+	for event := range d.queue {
+		d.deliver(event)
+	}
+}
+
+// Close stops the dispatcher and waits for Run to deliver the remaining
+// events, giving up when ctx is done.
+func (d *WebhookDispatcher) Close(ctx context.Context) error {
+	close(d.queue)
+
+	select {
+	case <-d.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// deliver posts a single event, retrying with exponential backoff.
+func (d *WebhookDispatcher) deliver(event WebhookEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("Webhook marshal failed", "event", event.Event, "error", err)
+		return
+	}
+
+	backoff := webhookBaseBackoff
+	for attempt := 1; attempt <= webhookMaxAttempts; attempt++ {
+		err = d.post(body)
+		if err == nil {
+			return
+		}
+
+		if attempt < webhookMaxAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+
+	slog.Warn("Webhook delivery failed", "event", event.Event, "attempts", webhookMaxAttempts, "error", err)
+}
+
+// post sends the encoded event once.
+func (d *WebhookDispatcher) post(body []byte) error {
+	resp, err := d.client.Post(d.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// hashRoomID returns a hex-encoded SHA-256 hash of a room ID.
+func hashRoomID(roomID string) string {
+	sum := sha256.Sum256([]byte(roomID))
+	return hex.EncodeToString(sum[:])
+}
@@ -37,3 +37,8 @@ var extras = []string{
 	"hobbit", "otterly", "purr", "meow", "woof", "chirp", "splash", "drizzle", "thimble", "button",
 	"lantern", "puddle", "pebble", "cottage", "rocket", "comet", "orbit", "nebula", "canyon", "ridge",
 }
+
+// WordLists are the lists room ID words are drawn from, one word per list.
+// The CLI keeps a copy in cli/internal/signaling/words.go to suggest
+// corrections for mistyped room IDs, so update both together.
+var WordLists = [][]string{animals, dishes, names, randomWords, adjectives, extras}
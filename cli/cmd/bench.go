@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/config"
+	"github.com/BioHazard786/Warpdrop/cli/internal/files"
+	"github.com/BioHazard786/Warpdrop/cli/internal/transfer"
+	"github.com/BioHazard786/Warpdrop/cli/internal/ui"
+	"github.com/BioHazard786/Warpdrop/cli/internal/utils"
+	"github.com/BioHazard786/Warpdrop/cli/internal/webrtc"
+	"github.com/spf13/cobra"
+)
+
+var (
+	flagBenchSize      string
+	flagBenchDomain    string
+	flagBenchRelay     bool
+	flagBenchNoTURN    bool
+	flagBenchTCP       bool
+	flagBenchIPVersion string
+	flagBenchUnordered bool
+	flagBenchLimit     string
+)
+
+// benchFileName is the name the bench's test data is offered under
+const benchFileName = "warpdrop-bench.bin"
+
+var benchCmd = &cobra.Command{
+	Use:     "bench [room-id]",
+	Aliases: []string{"speedtest"},
+	Short:   "Measure peer-to-peer throughput between two machines",
+	Long: `Send random test data between two WarpDrop CLIs the way files are sent,
+and report the achieved throughput, how it and the chunk size evolved, the
+round trip time, and whether the connection is direct or relayed through
+TURN.
+
+Run without arguments to create a room, then run 'warpdrop bench <room-id>'
+on the other machine. Nothing is read from or written to disk.
+
+Examples:
+  warpdrop bench
+  warpdrop bench --size 1GB
+  warpdrop bench lantern-poppy-brave-peter
+  warpdrop bench --relay lantern-poppy-brave-peter
+  warpdrop bench --tcp lantern-poppy-brave-peter
+  warpdrop bench --unordered`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 1 {
+			roomID, err := parseRoomInput(args[0])
+			if err != nil {
+				return err
+			}
+			return benchReceive(cmd.Context(), roomID)
+		}
+		return benchSend(cmd.Context())
+	},
+}
+
+func benchConfig() (*config.Config, error) {
+	return LoadConfig(config.Options{
+		Domain:     flagBenchDomain,
+		ForceRelay: flagBenchRelay,
+		NoTURN:     flagBenchNoTURN,
+		ForceTCP:   flagBenchTCP,
+		IPVersion:  flagBenchIPVersion,
+		Unordered:  flagBenchUnordered,
+	})
+}
+
+func benchSend(runCtx context.Context) error {
+	size, err := utils.ParseBytes(flagBenchSize)
+	if err != nil {
+		return err
+	}
+	info, err := files.NewSyntheticFile(benchFileName, size)
+	if err != nil {
+		return fmt.Errorf("--size: %w", err)
+	}
+
+	var rateLimit int
+	if flagBenchLimit != "" {
+		if rateLimit, err = utils.ParseRate(flagBenchLimit); err != nil {
+			return err
+		}
+	}
+
+	cfg, err := benchConfig()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	spinner := ui.NewConnectionSpinner("Connecting to server...")
+	spinner.Start()
+	defer spinner.Stop()
+	client, err := DialServer(cfg, spinner)
+	if err != nil {
+		return err
+	}
+	ctx := NewConnectionContext(client, cfg)
+	defer ctx.Close()
+	spinner.Stop()
+
+	// Only single-channel transfers use an unordered channel, so offering
+	// nothing else makes the receiver use one too
+	if flagBenchUnordered {
+		ctx.Protocols = []webrtc.ProtocolType{webrtc.SingleChannelProtocol}
+	}
+
+	roomID, _, err := ctx.CreateRoom(runCtx, "")
+	if err != nil {
+		return err
+	}
+	ui.Println()
+	ui.PrintInfof("Room: %s", roomID)
+	ui.PrintInfof("On the other machine run: warpdrop bench %s", roomID)
+
+	peerInfo, err := waitForPeer(runCtx, ctx, utils.FormatSize(size)+" of test data", 0)
+	if err != nil {
+		return err
+	}
+	if peerInfo.ClientType != "cli" {
+		return fmt.Errorf("bench needs the WarpDrop CLI on both ends, got a %s peer", peerInfo.ClientType)
+	}
+
+	session, err := ctx.NewSender([]*files.FileInfo{&info})
+	if err != nil {
+		return transfer.NewError("create session", err)
+	}
+	stats := &transfer.StatsRecorder{}
+	err = RunSenderSession(runCtx, session, &transfer.TransferOptions{
+		RateLimit:        int64(rateLimit),
+		RoomID:           roomID,
+		HeartbeatTimeout: transfer.DefaultHeartbeatTimeout,
+		Bench:            true,
+		Stats:            stats,
+	})
+	if err != nil {
+		return err
+	}
+	renderBenchSamples(stats.Samples())
+	return nil
+}
+
+// renderBenchSamples prints how throughput and the adaptive chunk size
+// changed over the run
+func renderBenchSamples(samples []transfer.StatsSample) {
+	if len(samples) == 0 {
+		return
+	}
+	start := samples[0].Time
+	ui.Println()
+	ui.PrintInfo("Throughput over time:")
+	for _, sample := range samples {
+		ui.Printf("  %6.1fs  %12s  chunk %s\n", sample.Time.Sub(start).Seconds(),
+			utils.FormatSpeed(sample.Speed), utils.FormatSize(int64(sample.ChunkSize)))
+	}
+}
+
+func benchReceive(runCtx context.Context, roomID string) error {
+	cfg, err := benchConfig()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	spinner := ui.NewConnectionSpinner("Connecting to server...")
+	spinner.Start()
+	client, err := DialServer(cfg, spinner)
+	if err != nil {
+		spinner.Stop()
+		return err
+	}
+	ctx := NewConnectionContext(client, cfg)
+	defer ctx.Close()
+	spinner.Stop()
+
+	peerInfo, err := ctx.JoinRoom(runCtx, roomID)
+	if err != nil {
+		return err
+	}
+	if peerInfo.ClientType != "cli" {
+		return fmt.Errorf("bench needs the WarpDrop CLI on both ends, got a %s peer", peerInfo.ClientType)
+	}
+
+	session, err := ctx.NewReceiver()
+	if err != nil {
+		return transfer.NewError("create session", err)
+	}
+	return RunReceiverSession(runCtx, session, &transfer.TransferOptions{
+		AutoAccept:       true,
+		RoomID:           roomID,
+		HeartbeatTimeout: transfer.DefaultHeartbeatTimeout,
+		Bench:            true,
+	})
+}
+
+func init() {
+	rootCmd.AddCommand(benchCmd)
+
+	benchCmd.Flags().StringVar(&flagBenchSize, "size", "256MB", "How much test data to send, e.g. 1GB")
+	benchCmd.Flags().StringVarP(&flagBenchDomain, "domain", "d", "", "Custom domain")
+	benchCmd.Flags().BoolVarP(&flagBenchRelay, "relay", "r", false, "Force relay mode")
+	benchCmd.Flags().BoolVar(&flagBenchNoTURN, "no-turn", false, "Disable TURN relay and require a direct connection")
+	benchCmd.Flags().BoolVar(&flagBenchTCP, "tcp", false, "Use only TCP for the connection, for networks that block UDP")
+	benchCmd.Flags().StringVar(&flagBenchIPVersion, "ip-version", "auto", "Gather only IPv4 (4) or IPv6 (6) candidates, or both (auto)")
+	benchCmd.Flags().BoolVar(&flagBenchUnordered, "unordered", false, "Send over a single unordered channel, to compare with the default ordered ones")
+	benchCmd.Flags().StringVar(&flagBenchLimit, "limit", "", "Cap the send rate, e.g. 2MB/s")
+}
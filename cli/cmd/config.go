@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/config"
+	"github.com/BioHazard786/Warpdrop/cli/internal/transfer"
+	"github.com/BioHazard786/Warpdrop/cli/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "View or change persistent settings",
+	Long: fmt.Sprintf(`Read and write settings stored in the WarpDrop config file.
+
+Saved settings apply to every run. Flags and environment variables still
+take priority over them.
+
+Keys: %s
+
+Examples:
+  warpdrop config set domain=drop.example.com
+  warpdrop config set turn_server=turn.example.com turn_user=me turn_pass=secret
+  warpdrop config get domain
+  warpdrop config path`, strings.Join(config.FileKeys, ", ")),
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <key=value>...",
+	Short: "Save one or more settings (an empty value removes a key)",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, file, warnings, err := loadConfigFile()
+		if err != nil {
+			return err
+		}
+		if len(warnings) > 0 {
+			// Saving would drop the lines that were skipped
+			printWarnings(warnings)
+			return fmt.Errorf("%s has lines warpdrop can't rewrite, edit it by hand instead", path)
+		}
+
+		for _, arg := range args {
+			key, value, ok := strings.Cut(arg, "=")
+			if !ok {
+				return fmt.Errorf("expected key=value, got %q", arg)
+			}
+			if err := file.Set(strings.TrimSpace(key), strings.TrimSpace(value)); err != nil {
+				return err
+			}
+		}
+
+		if err := file.Save(path); err != nil {
+			return transfer.NewError("save config", err)
+		}
+		ui.PrintSuccessf("Saved to %s", path)
+		return nil
+	},
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get [key]",
+	Short: "Print saved settings",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, file, warnings, err := loadConfigFile()
+		if err != nil {
+			return err
+		}
+		printWarnings(warnings)
+
+		if len(args) == 1 {
+			key := args[0]
+			if !slices.Contains(config.FileKeys, key) {
+				return fmt.Errorf("unknown config key %q (valid keys: %s)", key, strings.Join(config.FileKeys, ", "))
+			}
+			fmt.Println(file[key])
+			return nil
+		}
+
+		for _, key := range config.FileKeys {
+			if value, ok := file[key]; ok {
+				fmt.Printf("%s = %s\n", key, value)
+			}
+		}
+		return nil
+	},
+}
+
+var configPathCmd = &cobra.Command{
+	Use:   "path",
+	Short: "Print the location of the config file",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := config.FilePath()
+		if err != nil {
+			return transfer.NewError("locate config", err)
+		}
+		fmt.Println(path)
+		return nil
+	},
+}
+
+func loadConfigFile() (string, config.File, []string, error) {
+	path, err := config.FilePath()
+	if err != nil {
+		return "", nil, nil, transfer.NewError("locate config", err)
+	}
+	file, warnings, err := config.LoadFile(path)
+	if err != nil {
+		return "", nil, nil, transfer.NewError("read config", err)
+	}
+	return path, file, warnings, nil
+}
+
+// printWarnings prints the lines of the config file that were skipped
+func printWarnings(warnings []string) {
+	for _, warning := range warnings {
+		ui.PrintWarning(warning)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configSetCmd, configGetCmd, configPathCmd)
+}
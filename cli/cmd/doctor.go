@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/config"
+	"github.com/BioHazard786/Warpdrop/cli/internal/doctor"
+	"github.com/BioHazard786/Warpdrop/cli/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+var (
+	flagDoctorDomain   string
+	flagDoctorSTUN     string
+	flagDoctorTURN     string
+	flagDoctorTURNUser string
+	flagDoctorTURNPass string
+	flagDoctorNoTURN   bool
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Diagnose why transfers can't connect",
+	Long: `Check everything a transfer depends on and report pass, warn or fail for
+each: resolving the server's domain, its health endpoint and WebSocket,
+this machine's public address and NAT type from STUN, VPN or CGNAT
+interfaces that force relaying, and a relay allocation on every TURN
+server, which also proves the TURN credentials work.
+
+It uses the same settings as send and receive, so run it with the flags
+that fail there.
+
+Examples:
+  warpdrop doctor
+  warpdrop doctor --domain custom.example.com
+  warpdrop doctor --turn turn.example.com --turn-user me --turn-pass secret`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runDoctor()
+	},
+}
+
+func runDoctor() error {
+	cfg, err := LoadConfig(config.Options{
+		Domain:     flagDoctorDomain,
+		STUNServer: flagDoctorSTUN,
+		TURNServer: flagDoctorTURN,
+		TURNUser:   flagDoctorTURNUser,
+		TURNPass:   flagDoctorTURNPass,
+		NoTURN:     flagDoctorNoTURN,
+	})
+	if err != nil {
+		return err
+	}
+
+	ui.Println()
+	stopSpinner := ui.RunSpinner("Running checks...")
+	var passed, warned, failed int
+	doctor.Run(cfg, func(c doctor.Check) {
+		stopSpinner()
+		switch c.Status {
+		case doctor.Pass:
+			passed++
+			ui.Printf("%s %s %s\n", ui.IconSuccess, ui.BoldStyle.Render(c.Name), c.Detail)
+		case doctor.Warn:
+			warned++
+			ui.Printf("%s %s %s\n", ui.IconWarning, ui.BoldStyle.Render(c.Name), ui.WarningStyle.Render(c.Detail))
+		case doctor.Fail:
+			failed++
+			ui.Printf("%s %s %s\n", ui.IconError, ui.BoldStyle.Render(c.Name), ui.ErrorStyle.Render(c.Detail))
+		}
+		stopSpinner = ui.RunSpinner("Running checks...")
+	})
+	stopSpinner()
+
+	ui.Println()
+	summary := fmt.Sprintf("%d passed, %d warning(s), %d failed", passed, warned, failed)
+	if failed > 0 {
+		return fmt.Errorf("%s", summary)
+	}
+	if warned > 0 {
+		ui.PrintWarning(summary)
+		return nil
+	}
+	ui.PrintSuccess(summary)
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+
+	doctorCmd.Flags().StringVarP(&flagDoctorDomain, "domain", "d", "", "Custom domain")
+	doctorCmd.Flags().StringVarP(&flagDoctorSTUN, "stun", "s", "", "Custom STUN servers, comma-separated stun: URLs")
+	doctorCmd.Flags().StringVarP(&flagDoctorTURN, "turn", "t", "", "Custom TURN servers, comma-separated hostnames or turn:/turns: URLs")
+	doctorCmd.Flags().StringVarP(&flagDoctorTURNUser, "turn-user", "u", "", "TURN username")
+	doctorCmd.Flags().StringVarP(&flagDoctorTURNPass, "turn-pass", "p", "", "TURN password")
+	doctorCmd.Flags().BoolVar(&flagDoctorNoTURN, "no-turn", false, "Skip the TURN checks")
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/history"
+	"github.com/BioHazard786/Warpdrop/cli/internal/transfer"
+	"github.com/BioHazard786/Warpdrop/cli/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+var flagHistoryLimit int
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show recently completed transfers",
+	Long: `Print the most recent transfers recorded in the history file.
+
+Every completed send or receive is appended to
+~/.local/share/warpdrop/history.jsonl ($XDG_DATA_HOME is honored).
+
+Examples:
+  warpdrop history
+  warpdrop history -n 50`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if flagHistoryLimit < 1 {
+			return fmt.Errorf("--limit must be at least 1")
+		}
+
+		entries, err := history.Last(flagHistoryLimit)
+		if err != nil {
+			return transfer.NewError("read history", err)
+		}
+
+		items := make([]ui.HistoryTableItem, len(entries))
+		for i, e := range entries {
+			items[i] = ui.HistoryTableItem{
+				Time:      e.Time,
+				Direction: e.Direction,
+				Files:     e.Files,
+				Size:      e.Bytes,
+				Duration:  e.Duration(),
+				PeerType:  e.PeerType,
+				RoomID:    e.RoomID,
+			}
+		}
+
+		fmt.Println()
+		ui.RenderHistoryTable(items)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+
+	historyCmd.Flags().IntVarP(&flagHistoryLimit, "limit", "n", 20, "Number of entries to show")
+}
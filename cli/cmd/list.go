@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/config"
+	"github.com/BioHazard786/Warpdrop/cli/internal/sessions"
+	"github.com/BioHazard786/Warpdrop/cli/internal/signaling"
+	"github.com/BioHazard786/Warpdrop/cli/internal/transfer"
+	"github.com/BioHazard786/Warpdrop/cli/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+var flagListDomain string
+
+var listCmd = &cobra.Command{
+	Use:     "list [room-id|url]",
+	Aliases: []string{"ls"},
+	Short:   "Show active local transfers and check whether a room is alive",
+	Long: `List sends and receives currently running on this machine.
+
+When a room ID or link is given, the signaling server is also asked whether
+the room still exists and how many peers are in it.
+
+Examples:
+  warpdrop list
+  warpdrop list kitten-waffle-stardust-happy
+  warpdrop list https://warpdrop.qzz.io/r/kitten-waffle-stardust-happy`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := listLocalSessions(); err != nil {
+			return err
+		}
+		if len(args) == 0 {
+			return nil
+		}
+
+		roomID, err := parseRoomInput(args[0])
+		if err != nil {
+			return err
+		}
+		return checkRoomStatus(roomID)
+	},
+}
+
+func listLocalSessions() error {
+	list, err := sessions.List()
+	if err != nil {
+		return transfer.NewError("list sessions", err)
+	}
+
+	fmt.Println()
+	if len(list) == 0 {
+		ui.PrintInfo("No active transfers on this machine")
+		return nil
+	}
+
+	fmt.Println(ui.TitleStyle.Render("Active transfers"))
+	for _, s := range list {
+		icon := ui.IconSend
+		if s.Role == sessions.RoleReceive {
+			icon = ui.IconReceive
+		}
+
+		details := fmt.Sprintf("started %s ago, pid %d", time.Since(s.StartedAt).Round(time.Second), s.PID)
+		if s.Files > 0 {
+			details = fmt.Sprintf("%d file(s), %s", s.Files, details)
+		}
+
+		fmt.Printf("%s %-8s %s %s\n", icon, s.Role, ui.BoldStyle.Render(s.RoomID), ui.MutedStyle.Render(details))
+	}
+	return nil
+}
+
+func checkRoomStatus(roomID string) error {
+	cfg, err := LoadConfig(config.Options{Domain: flagListDomain})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	spinner := ui.NewConnectionSpinner("Checking room...")
+	spinner.Start()
+	defer spinner.Stop()
+	client, err := DialServer(cfg, spinner)
+	if err != nil {
+		return err
+	}
+	ctx := NewConnectionContext(client, cfg)
+	defer ctx.Close()
+
+	ctx.Client.SendMessage(&signaling.Message{
+		Type:   signaling.MessageTypeRoomStatus,
+		RoomID: roomID,
+	})
+
+	var status *signaling.RoomStatusPayload
+	select {
+	case status = <-ctx.Handler.RoomStatus:
+	case errMsg := <-ctx.Handler.Error:
+		return transfer.WrapError("room status", transfer.ErrSignalingError, errMsg)
+	case <-time.After(time.Duration(transfer.SignalTimeout) * time.Second):
+		return transfer.WrapError("room status", transfer.ErrTimeout, "waiting for server")
+	}
+	spinner.Stop()
+
+	if !status.Exists {
+		ui.PrintWarningf("Room %s does not exist or has already closed", roomID)
+		return nil
+	}
+
+	ui.PrintSuccessf("Room %s is alive with %d peer(s) present", roomID, status.Peers)
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+
+	listCmd.Flags().StringVarP(&flagListDomain, "domain", "d", "", "Custom domain")
+}
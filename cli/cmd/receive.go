@@ -1,15 +1,19 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/BioHazard786/Warpdrop/cli/internal/config"
-	"github.com/BioHazard786/Warpdrop/cli/internal/signaling"
+	"github.com/BioHazard786/Warpdrop/cli/internal/sessions"
 	"github.com/BioHazard786/Warpdrop/cli/internal/transfer"
 	"github.com/BioHazard786/Warpdrop/cli/internal/ui"
 	"github.com/BioHazard786/Warpdrop/cli/internal/utils"
@@ -23,31 +27,189 @@ var (
 	flagReceiverTURNUser string
 	flagReceiverTURNPass string
 	flagReceiverRelay    bool
+	flagReceiverNoTURN   bool
+	flagReceiverTCP      bool
+	flagReceiverIPVer    string
+	flagReceiverVia      bool
+	flagReceiverNATCheck bool
 	flagReceiverZip      bool
 	flagReceiverDir      string
+	flagReceiverVerify   bool
+	flagReceiverPassword string
+	flagReceiverZipName  string
+	flagReceiverFlatten  bool
+	flagReceiverZipLevel string
+	flagReceiverForce    bool
+	flagReceiverYes      bool
+	flagReceiverTimeout  int
+	flagReceiverTrusted  string
+	flagReceiverJSON     bool
+	flagReceiverStdout   bool
+	flagReceiverMaxSize  string
+	flagReceiverMaxFiles int
+	flagReceiverStall    int
+	flagReceiverBeat     int
+	flagReceiverDirMode  string
+	flagReceiverNoMkdir  bool
+	flagReceiverPreserve bool
+	flagReceiverConflict string
+	flagReceiverAccept   []string
+	flagReceiverReject   []string
+	flagReceiverPaste    bool
 )
 
 var receiveCmd = &cobra.Command{
-	Use:     "receive <room-id|url>",
+	Use:     "receive [room-id|url]",
 	Aliases: []string{"r"},
 	Short:   "Receive files from a sender",
 	Long: `Receive files directly from a sender using WebRTC technology.
 
 Examples:
-  warpdrop receive ABC123
-  warpdrop receive https://warpdrop.qzz.io/r/ABC123
-  warpdrop receive ABC123 --relay`,
-	Args: cobra.ExactArgs(1),
+  warpdrop receive lantern-poppy-brave-peter
+  warpdrop receive https://warpdrop.qzz.io/r/lantern-poppy-brave-peter
+  warpdrop receive lantern-poppy-brave-peter --relay
+  warpdrop receive lantern-poppy-brave-peter --tcp --relay
+  warpdrop receive lantern-poppy-brave-peter --zip-name 'photos-{date}.zip'
+  warpdrop receive lantern-poppy-brave-peter --zip --flatten
+  warpdrop receive lantern-poppy-brave-peter --zip-level store
+  warpdrop receive lantern-poppy-brave-peter --yes
+  warpdrop receive lantern-poppy-brave-peter --accept-timeout 30
+  warpdrop receive lantern-poppy-brave-peter --stall-timeout 120
+  warpdrop receive lantern-poppy-brave-peter -d ~/private --dir-mode 0700
+  warpdrop receive lantern-poppy-brave-peter --preserve
+  warpdrop receive lantern-poppy-brave-peter --on-conflict skip
+  warpdrop receive lantern-poppy-brave-peter --max-size 2GB --max-files 100
+  warpdrop receive lantern-poppy-brave-peter --accept-type 'image/*' --accept-type pdf
+  warpdrop receive lantern-poppy-brave-peter --reject-type '*.exe,application/x-msdownload'
+  warpdrop receive lantern-poppy-brave-peter --trusted-peers ~/team-trusted.json
+  warpdrop receive lantern-poppy-brave-peter --yes --json
+  warpdrop receive lantern-poppy-brave-peter --stdout > backup.tar.gz
+  warpdrop receive lantern-poppy-brave-peter --zip --stdout > files.zip
+  warpdrop receive --from-clipboard
+
+The --zip-name template may use {date}, {time}, {count} (number of files)
+and {room}. Folders sent by the peer are kept inside the zip unless
+--flatten is given; flattened files with the same name are numbered.
+--zip-level store skips compression, which is much faster for photos and
+videos that are already compressed; best shrinks text further.
+
+Use --tcp on networks that block UDP. Only TCP candidates are gathered, so
+a direct connection needs one side to accept incoming TCP; add --relay to
+go through TURN over TCP or TLS instead, which works behind most firewalls.
+
+Use --ip-version 4 or 6 to gather only IPv4 or IPv6 candidates, which can
+help when one family is firewalled or broken on your network.
+
+Use --via-server as a last resort when no WebRTC connection gets through,
+even over TURN. Files go through the signaling server instead, which is
+slow, uses the server's bandwidth and lets it read them unless --password
+is set. It takes effect when either side gives it, and only on servers
+that enable it with DATA_RELAY.
+
+Senders whose fingerprint was added with 'warpdrop trust' are accepted
+without a prompt. The fingerprint is checked against the certificate the
+sender connects with, so it can't be claimed by another device.
+
+Directories created for received files get --dir-mode, given in octal
+(default 0755); use 0700 for downloads other users shouldn't read. With
+--no-create-dirs a missing --dir is an error instead of being created.
+
+A transfer that gets no data for --stall-timeout seconds is stopped and the
+sender told why. Time the sender spends paused doesn't count; use 0 to
+wait forever.
+
+Answering no at the prompt asks for an optional reason, which is shown to
+the sender along with the decline.
+
+Offers over --max-size in total or with more than --max-files files are
+declined without asking, and the sender is told which limit was hit.
+Sizes take KB, MB, GB or TB, which are binary multiples.
+
+--accept-type and --reject-type filter the offer file by file. Patterns
+with a slash match the MIME type (image/*), others the file name (*.pdf);
+a bare extension such as pdf means *.pdf. With --accept-type only matching
+files are received, and --reject-type skips matches on top of that.
+Filtered files are marked in the file table and the sender doesn't send
+them. An offer with nothing left after filtering is declined.
+
+--json replaces the terminal UI with one JSON event per line on stdout, as
+for send. It needs --yes.
+
+--stdout writes the received file to stdout, with progress and prompts on
+stderr. Offers of more than one file are declined unless --zip is given,
+in which case the zip archive is written to stdout instead.
+
+--from-clipboard reads the room ID or link from the clipboard instead of
+the command line, such as after copying it from a chat.`,
+	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		roomID, err := parseRoomInput(args[0])
+		roomID, err := receiveRoomInput(args)
 		if err != nil {
 			return err
 		}
-		return receiveFiles(roomID)
+		if flagReceiverTimeout < 0 {
+			return fmt.Errorf("--accept-timeout must not be negative")
+		}
+		if flagReceiverStall < 0 {
+			return fmt.Errorf("--stall-timeout must not be negative")
+		}
+		if flagReceiverBeat < 0 {
+			return fmt.Errorf("--heartbeat-timeout must not be negative")
+		}
+		if flagReceiverNoMkdir && flagReceiverDir != "" {
+			// Fail now rather than after the sender has been accepted
+			if err := transfer.PrepareOutputDir(&transfer.TransferOptions{}, flagReceiverDir); err != nil {
+				return err
+			}
+		}
+		if !slices.Contains(transfer.ConflictPolicies, flagReceiverConflict) {
+			return fmt.Errorf("invalid --on-conflict %q: use rename, overwrite or skip", flagReceiverConflict)
+		}
+		if err := transfer.CheckTypePatterns(slices.Concat(flagReceiverAccept, flagReceiverReject)); err != nil {
+			return err
+		}
+		if flagReceiverMaxFiles < 0 {
+			return fmt.Errorf("--max-files must not be negative")
+		}
+		if flagReceiverJSON && !flagReceiverYes {
+			return fmt.Errorf("--json needs --yes since there is no prompt to answer")
+		}
+		if flagReceiverStdout {
+			if flagReceiverJSON {
+				return fmt.Errorf("--stdout and --json both write to stdout")
+			}
+			if flagReceiverDir != "" || flagReceiverZipName != "" {
+				return fmt.Errorf("--stdout can't be combined with --dir or --zip-name")
+			}
+			ui.SetOutput(os.Stderr)
+		}
+		ui.SetJSONMode(flagReceiverJSON)
+		if err := utils.ValidateZipLevel(flagReceiverZipLevel); err != nil {
+			return err
+		}
+		if flagReceiverZipName != "" || flagReceiverFlatten || flagReceiverZipLevel != "" {
+			flagReceiverZip = true
+		}
+		return receiveFiles(cmd.Context(), roomID)
 	},
 }
 
-func receiveFiles(roomID string) error {
+func receiveFiles(runCtx context.Context, roomID string) error {
+	var maxSize int64
+	if flagReceiverMaxSize != "" {
+		var err error
+		if maxSize, err = utils.ParseBytes(flagReceiverMaxSize); err != nil {
+			return err
+		}
+	}
+	var dirMode uint64
+	if flagReceiverDirMode != "" {
+		var err error
+		if dirMode, err = strconv.ParseUint(flagReceiverDirMode, 8, 32); err != nil || dirMode > 0777 {
+			return fmt.Errorf("invalid --dir-mode %q: use octal permissions such as 0700", flagReceiverDirMode)
+		}
+	}
+
 	cfg, err := LoadConfig(config.Options{
 		Domain:     flagReceiverDomain,
 		STUNServer: flagReceiverSTUN,
@@ -55,125 +217,224 @@ func receiveFiles(roomID string) error {
 		TURNUser:   flagReceiverTURNUser,
 		TURNPass:   flagReceiverTURNPass,
 		ForceRelay: flagReceiverRelay,
+		NoTURN:     flagReceiverNoTURN,
+		ForceTCP:   flagReceiverTCP,
+		IPVersion:  flagReceiverIPVer,
+		ViaServer:  flagReceiverVia,
 	})
 	if err != nil {
 		return err
 	}
 
-	fmt.Println()
-	stopSpinner := ui.RunConnectionSpinner("Connecting to server...")
-	ctx, err := NewConnectionContext(cfg)
+	ui.Println()
+	spinner := ui.NewConnectionSpinner("Connecting to server...")
+	spinner.Start()
+	client, err := DialServer(cfg, spinner)
 	if err != nil {
+		spinner.Stop()
 		return err
 	}
+	ctx := NewConnectionContext(client, cfg)
 	defer ctx.Close()
-	stopSpinner()
+	spinner.Stop()
 
-	peerInfo, err := joinRoom(ctx, roomID)
+	// Stdout and zip receives never resume, so only a plain receive asks to
+	if !flagReceiverStdout && !flagReceiverZip {
+		ctx.ResumeToken = transfer.LoadResumeState(flagReceiverDir).Token()
+	}
+	peerInfo, err := ctx.JoinRoom(runCtx, roomID)
 	if err != nil {
 		return err
 	}
-	ctx.PeerInfo = peerInfo
+	ui.Emit(ui.Event{Type: ui.EventPeerJoined, RoomID: roomID, PeerType: peerInfo.ClientType})
+
+	// Listing is best effort, so a failure to record the session is ignored
+	unregister, _ := sessions.Register(sessions.Session{
+		Role:   sessions.RoleReceive,
+		RoomID: roomID,
+	})
+	defer unregister()
 
-	session, err := CreateReceiverSession(ctx)
+	session, err := ctx.NewReceiver()
 	if err != nil {
 		return transfer.NewError("create session", err)
 	}
 
-	opts, tempDir, cleanup, err := prepareTransferOptions(flagReceiverZip, flagReceiverDir)
-	if err != nil {
+	opts := &transfer.TransferOptions{OutputDir: flagReceiverDir}
+	opts.Verify = flagReceiverVerify
+	opts.Password = flagReceiverPassword
+	opts.RoomID = roomID
+	opts.AutoAccept = flagReceiverYes
+	opts.AcceptTimeout = time.Duration(flagReceiverTimeout) * time.Second
+	opts.Stdout = flagReceiverStdout && !flagReceiverZip
+	opts.MaxSize = uint64(maxSize)
+	opts.MaxFiles = flagReceiverMaxFiles
+	opts.StallTimeout = time.Duration(flagReceiverStall) * time.Second
+	opts.HeartbeatTimeout = time.Duration(flagReceiverBeat) * time.Second
+	opts.NATCheck = flagReceiverNATCheck
+	opts.DirMode = os.FileMode(dirMode)
+	opts.CreateDirs = !flagReceiverNoMkdir
+	opts.Preserve = flagReceiverPreserve
+	opts.OnConflict = flagReceiverConflict
+	opts.AcceptTypes = flagReceiverAccept
+	opts.RejectTypes = flagReceiverReject
+	if opts.TrustedPeers, err = loadTrustedPeers(flagReceiverTrusted); err != nil {
 		return err
 	}
+
+	var part *os.File
+	var cleanup func()
+	if flagReceiverZip {
+		if part, cleanup, err = openZipArchive(opts, roomID); err != nil {
+			return err
+		}
+	}
+
+	// The archive is kept when it can't be renamed over an existing zip
+	keepPart := false
 	if cleanup != nil {
-		defer cleanup()
+		defer func() {
+			if !keepPart {
+				cleanup()
+			}
+		}()
 	}
 
-	if err := RunReceiverSession(session, opts); err != nil {
+	if err := RunReceiverSession(runCtx, session, opts); err != nil {
 		return err
 	}
 
-	return finalizeTransfer(flagReceiverZip, flagReceiverDir, tempDir)
+	err = finalizeTransfer(opts, flagReceiverDir, part, roomID)
+	if errors.Is(err, transfer.ErrZipExists) {
+		keepPart = true
+		ui.PrintWarningf("The zip was left at %s", part.Name())
+	}
+	return err
 }
 
-func prepareTransferOptions(zipMode bool, outputDir string) (*transfer.TransferOptions, string, func(), error) {
-	opts := &transfer.TransferOptions{
-		ZipMode:   zipMode,
-		OutputDir: outputDir,
+// openZipArchive opens the archive received files stream into. It is
+// written to stdout, or to a partial file next to where the zip will end up
+// that finalizeTransfer renames once the name is known.
+func openZipArchive(opts *transfer.TransferOptions, roomID string) (*os.File, func(), error) {
+	zipOpts := utils.ZipOptions{
+		Flatten: flagReceiverFlatten,
+		Level:   flagReceiverZipLevel,
 	}
-
-	var tempDir string
-	var cleanup func()
-
-	if zipMode {
-		var err error
-		tempDir, err = os.MkdirTemp("", "warpdrop-receive-*")
+	if flagReceiverStdout {
+		archive, err := transfer.NewZipArchive(os.Stdout, zipOpts)
 		if err != nil {
-			return nil, "", nil, transfer.NewError("create temp dir", err)
-		}
-		opts.OutputDir = tempDir
-		cleanup = func() {
-			os.RemoveAll(tempDir)
+			return nil, nil, transfer.NewError("create zip", err)
 		}
+		opts.Zip = archive
+		return nil, nil, nil
 	}
 
-	return opts, tempDir, cleanup, nil
-}
+	if err := transfer.PrepareOutputDir(opts, opts.OutputDir); err != nil {
+		return nil, nil, err
+	}
+	part, err := os.CreateTemp(filepath.Dir(zipPath(opts.OutputDir, 0, roomID)), ".warpdrop-*.zip.part")
+	if err != nil {
+		return nil, nil, transfer.NewError("create zip", err)
+	}
+	cleanup := func() {
+		part.Close()
+		os.Remove(part.Name())
+	}
+	// Temp files are private, but the zip should be created like any other
+	part.Chmod(0644)
 
-func finalizeTransfer(zipMode bool, outputDir, tempDir string) error {
-	if !zipMode {
-		return nil
+	archive, err := transfer.NewZipArchive(part, zipOpts)
+	if err != nil {
+		cleanup()
+		return nil, nil, transfer.NewError("create zip", err)
 	}
+	opts.Zip = archive
+	return part, cleanup, nil
+}
 
+// zipPath returns where the zip of count files is saved
+func zipPath(outputDir string, count int, roomID string) string {
 	zipName := fmt.Sprintf("warpdrop-download-%d.zip", time.Now().UnixMilli())
-	if outputDir != "" {
-		if err := os.MkdirAll(outputDir, 0755); err != nil {
-			return transfer.NewError("create output dir", err)
-		}
+	if flagReceiverZipName != "" {
+		zipName = utils.ExpandZipName(flagReceiverZipName, time.Now(), count, roomID)
+	}
+	if outputDir != "" && !filepath.IsAbs(zipName) {
 		zipName = filepath.Join(outputDir, zipName)
 	}
+	return zipName
+}
+
+func finalizeTransfer(opts *transfer.TransferOptions, outputDir string, part *os.File, roomID string) error {
+	if opts.Zip == nil {
+		return nil
+	}
+	if err := opts.Zip.Close(); err != nil {
+		return transfer.NewError("zip files", err)
+	}
+
+	if part == nil {
+		ui.PrintSuccess("Files zipped to stdout")
+		return nil
+	}
+	if err := part.Close(); err != nil {
+		return transfer.NewError("zip files", err)
+	}
 
-	fmt.Println()
-	s := ui.NewWaitingSpinner("Zipping files...")
-	s.Start()
-	if err := utils.ZipDirectory(tempDir, zipName); err != nil {
-		s.Stop()
+	zipName := zipPath(outputDir, opts.Zip.Count(), roomID)
+	if _, err := os.Stat(zipName); err == nil && !flagReceiverForce {
+		return transfer.WrapError("zip files", transfer.ErrZipExists, zipName)
+	}
+	if err := os.Rename(part.Name(), zipName); err != nil {
 		return transfer.NewError("zip files", err)
 	}
-	s.Success(fmt.Sprintf("Files zipped to %s", zipName))
+	ui.Println()
+	ui.PrintSuccessf("Files zipped to %s", zipName)
 
 	return nil
 }
 
-func joinRoom(ctx *ConnectionContext, roomID string) (*signaling.PeerInfo, error) {
-	ctx.Client.SendMessage(&signaling.Message{
-		Type:       signaling.MessageTypeJoinRoom,
-		RoomID:     roomID,
-		ClientType: "cli",
-	})
+// receiveRoomInput returns the room to join, given on the command line or,
+// with --from-clipboard, read from the clipboard
+func receiveRoomInput(args []string) (string, error) {
+	switch {
+	case len(args) == 1 && flagReceiverPaste:
+		return "", fmt.Errorf("give either a room ID or --from-clipboard, not both")
+	case len(args) == 1:
+		return parseRoomInput(args[0])
+	case !flagReceiverPaste:
+		return "", fmt.Errorf("missing room ID or link (or use --from-clipboard)")
+	}
 
-	select {
-	case peerInfo := <-ctx.Handler.JoinSuccess:
-		return peerInfo, nil
-	case errMsg := <-ctx.Handler.Error:
-		return nil, transfer.WrapError("join room", transfer.ErrSignalingError, errMsg)
+	text, err := utils.ReadClipboard()
+	if err != nil {
+		return "", transfer.NewError("read clipboard", err)
+	}
+	if strings.TrimSpace(text) == "" {
+		return "", fmt.Errorf("the clipboard is empty")
 	}
+	roomID, err := parseRoomInput(text)
+	if err != nil {
+		return "", fmt.Errorf("the clipboard doesn't hold a valid room ID or link: %w", err)
+	}
+	return roomID, nil
 }
 
 func parseRoomInput(input string) (string, error) {
-	if input == "" {
-		return "", fmt.Errorf("room ID cannot be empty")
-	}
+	input = strings.TrimSpace(input)
 
 	if strings.Contains(input, "://") || strings.Contains(input, ".") {
 		roomID, err := extractRoomIDFromURL(input)
 		if err != nil {
 			return "", err
 		}
+		if roomID, err = utils.ValidateRoomID(roomID); err != nil {
+			return "", err
+		}
 		ui.PrintSuccessf("Extracted room ID: %s", roomID)
 		return roomID, nil
 	}
 
-	return input, nil
+	return utils.ValidateRoomID(input)
 }
 
 func extractRoomIDFromURL(urlStr string) (string, error) {
@@ -198,11 +459,38 @@ func init() {
 	rootCmd.AddCommand(receiveCmd)
 
 	receiveCmd.Flags().StringVar(&flagReceiverDomain, "domain", "", "Custom domain")
-	receiveCmd.Flags().StringVarP(&flagReceiverSTUN, "stun", "s", "", "Custom STUN server")
-	receiveCmd.Flags().StringVarP(&flagReceiverTURN, "turn", "t", "", "Custom TURN server")
+	receiveCmd.Flags().StringVarP(&flagReceiverSTUN, "stun", "s", "", "Custom STUN servers, comma-separated stun: URLs")
+	receiveCmd.Flags().StringVarP(&flagReceiverTURN, "turn", "t", "", "Custom TURN servers, comma-separated hostnames or turn:/turns: URLs")
 	receiveCmd.Flags().StringVar(&flagReceiverTURNUser, "turn-user", "", "TURN username")
 	receiveCmd.Flags().StringVar(&flagReceiverTURNPass, "turn-pass", "", "TURN password")
 	receiveCmd.Flags().BoolVarP(&flagReceiverRelay, "relay", "r", false, "Force relay mode")
+	receiveCmd.Flags().BoolVar(&flagReceiverNoTURN, "no-turn", false, "Disable TURN relay and require a direct connection")
+	receiveCmd.Flags().BoolVar(&flagReceiverTCP, "tcp", false, "Use only TCP for the connection, for networks that block UDP")
+	receiveCmd.Flags().StringVar(&flagReceiverIPVer, "ip-version", "auto", "Gather only IPv4 (4) or IPv6 (6) candidates, or both (auto)")
+	receiveCmd.Flags().BoolVar(&flagReceiverVia, "via-server", false, "Receive files through the signaling server when no WebRTC connection works (slow)")
+	receiveCmd.Flags().BoolVar(&flagReceiverNATCheck, "nat-check", false, "Probe the NAT type while connecting and warn when both peers need a relay")
 	receiveCmd.Flags().BoolVarP(&flagReceiverZip, "zip", "z", false, "Zip received files")
 	receiveCmd.Flags().StringVarP(&flagReceiverDir, "dir", "d", "", "Directory to save received files")
+	receiveCmd.Flags().StringVar(&flagReceiverDirMode, "dir-mode", "", "Permissions for created directories in octal, e.g. 0700 (default 0755)")
+	receiveCmd.Flags().BoolVar(&flagReceiverNoMkdir, "no-create-dirs", false, "Fail if the --dir directory doesn't exist instead of creating it")
+	receiveCmd.Flags().StringVar(&flagReceiverConflict, "on-conflict", transfer.ConflictRename, "When a file already exists: rename, overwrite or skip")
+	receiveCmd.Flags().BoolVar(&flagReceiverPreserve, "preserve", false, "Keep the sender's modification times and permissions on received files")
+	receiveCmd.Flags().BoolVar(&flagReceiverVerify, "verify", false, "Verify SHA-256 checksums of received files")
+	receiveCmd.Flags().StringVar(&flagReceiverZipName, "zip-name", "", "Name or template for the zip file, e.g. photos-{date}.zip (implies --zip)")
+	receiveCmd.Flags().BoolVar(&flagReceiverFlatten, "flatten", false, "Put every file in the root of the zip instead of keeping folders (implies --zip)")
+	receiveCmd.Flags().StringVar(&flagReceiverZipLevel, "zip-level", "", "Zip compression: store, fast or best (implies --zip; default deflates normally)")
+	receiveCmd.Flags().BoolVar(&flagReceiverForce, "force", false, "Overwrite an existing zip file")
+	receiveCmd.Flags().BoolVarP(&flagReceiverYes, "yes", "y", false, "Accept the offered files without asking")
+	receiveCmd.Flags().IntVar(&flagReceiverTimeout, "accept-timeout", 0, "Decline the offer if it isn't answered within N seconds (0 waits forever)")
+	receiveCmd.Flags().IntVar(&flagReceiverStall, "stall-timeout", int(transfer.DefaultStallTimeout/time.Second), "Stop the transfer if no data arrives for N seconds (0 waits forever)")
+	receiveCmd.Flags().IntVar(&flagReceiverBeat, "heartbeat-timeout", int(transfer.DefaultHeartbeatTimeout/time.Second), "Stop the transfer if the sender stops answering pings for N seconds (0 turns pings off)")
+	receiveCmd.Flags().StringVar(&flagReceiverMaxSize, "max-size", "", "Decline offers larger than this in total, e.g. 2GB")
+	receiveCmd.Flags().IntVar(&flagReceiverMaxFiles, "max-files", 0, "Decline offers of more than N files (0 is unlimited)")
+	receiveCmd.Flags().StringSliceVar(&flagReceiverAccept, "accept-type", nil, "Only receive files matching these MIME types or extensions, e.g. image/*,pdf")
+	receiveCmd.Flags().StringSliceVar(&flagReceiverReject, "reject-type", nil, "Skip files matching these MIME types or extensions, e.g. *.exe")
+	receiveCmd.Flags().StringVar(&flagReceiverTrusted, "trusted-peers", "", "Trusted peers file to accept senders from without asking (default trusted.json next to the config)")
+	receiveCmd.Flags().BoolVar(&flagReceiverJSON, "json", false, "Write newline-delimited JSON events to stdout instead of the terminal UI (needs --yes)")
+	receiveCmd.Flags().BoolVar(&flagReceiverStdout, "stdout", false, "Write the received file, or the zip with --zip, to stdout")
+	receiveCmd.Flags().BoolVar(&flagReceiverPaste, "from-clipboard", false, "Read the room ID or link from the clipboard")
+	receiveCmd.Flags().StringVar(&flagReceiverPassword, "password", "", "Password for a protected transfer (prompted for if omitted)")
 }
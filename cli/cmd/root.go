@@ -1,20 +1,45 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 
+	"github.com/BioHazard786/Warpdrop/cli/internal/config"
+	"github.com/BioHazard786/Warpdrop/cli/internal/transfer"
 	"github.com/BioHazard786/Warpdrop/cli/internal/ui"
 	"github.com/BioHazard786/Warpdrop/cli/internal/version"
 	"github.com/spf13/cobra"
 )
 
+// Connection flags shared by every command that reaches the signaling server
+var (
+	flagServer     string
+	flagInsecure   bool
+	flagReconnects int
+)
+
+// Output flags shared by every command
+var (
+	flagNoColor bool
+	flagTheme   string
+)
+
+// exitDeclined is the exit status when the receiver declines the transfer,
+// which is their choice rather than a failure
+const exitDeclined = 2
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:     "warpdrop",
 	Short:   "Peer-to-peer file transfer tool using WebRTC, with webapp support and cross-functional design",
 	Long:    `WarpDrop is a command-line tool for transferring files directly between devices using WebRTC technology. It eliminates the need for intermediaries, ensuring fast and secure file sharing. WarpDrop also includes a webapp interface for browser-based transfers and is designed to be cross-functional across different platforms and environments.`,
 	Version: version.Version,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		ui.SetNoColor(flagNoColor)
+		return ui.SetTheme(flagTheme)
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -23,15 +48,39 @@ func Execute() {
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, os.Interrupt)
 	go func() {
-		<-sig
-		os.Exit(0)
+		// A running transfer gets the first interrupt to cancel cleanly
+		for range sig {
+			if !ui.Interrupt() {
+				os.Exit(0)
+			}
+		}
 	}()
 
 	rootCmd.SilenceErrors = true
 	rootCmd.SilenceUsage = true
 
-	if err := rootCmd.Execute(); err != nil {
+	cmd, err := rootCmd.ExecuteC()
+	if reason, ok := transfer.Declined(err); ok {
+		msg := "Receiver declined the transfer"
+		if reason != "" {
+			msg = fmt.Sprintf("%s: %s", msg, reason)
+		}
+		ui.PrintWarning(msg)
+		ui.Emit(ui.Event{Type: ui.EventDeclined, Error: reason})
+		os.Exit(exitDeclined)
+	}
+	if err != nil {
 		ui.PrintError(err.Error())
+		ui.Emit(ui.Event{Type: ui.EventError, Error: err.Error()})
 		os.Exit(1)
 	}
+	notifyUpgrade(cmd)
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&flagServer, "server", "", "Signaling server WebSocket URL, used instead of the one built from --domain (e.g. ws://localhost:8080/ws)")
+	rootCmd.PersistentFlags().BoolVar(&flagInsecure, "insecure", false, "Skip TLS certificate verification of the signaling server (for self-signed certificates)")
+	rootCmd.PersistentFlags().IntVar(&flagReconnects, "reconnects", config.DefaultReconnects, "Re-establish a signaling connection that drops mid-transfer up to N times, rejoining the room (0 turns it off)")
+	rootCmd.PersistentFlags().BoolVar(&flagNoColor, "no-color", false, "Disable colors in the terminal output (also set by the NO_COLOR environment variable)")
+	rootCmd.PersistentFlags().StringVar(&flagTheme, "theme", "dark", "Color theme: "+strings.Join(ui.ThemeNames, " or "))
 }
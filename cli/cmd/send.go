@@ -1,97 +1,342 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"os"
+	"time"
 
 	"github.com/BioHazard786/Warpdrop/cli/internal/config"
+	"github.com/BioHazard786/Warpdrop/cli/internal/engine"
 	"github.com/BioHazard786/Warpdrop/cli/internal/files"
+	"github.com/BioHazard786/Warpdrop/cli/internal/sessions"
 	"github.com/BioHazard786/Warpdrop/cli/internal/signaling"
 	"github.com/BioHazard786/Warpdrop/cli/internal/transfer"
 	"github.com/BioHazard786/Warpdrop/cli/internal/ui"
+	"github.com/BioHazard786/Warpdrop/cli/internal/utils"
 	"github.com/spf13/cobra"
 )
 
 var (
-	flagDomain   string
-	flagSTUN     string
-	flagTURN     string
-	flagTURNUser string
-	flagTURNPass string
-	flagRelay    bool
+	flagDomain    string
+	flagSTUN      string
+	flagTURN      string
+	flagTURNUser  string
+	flagTURNPass  string
+	flagRelay     bool
+	flagNoTURN    bool
+	flagTCP       bool
+	flagIPVersion string
+	flagViaServer bool
+	flagUnordered bool
+	flagNATCheck  bool
+	flagDash      bool
+	flagConfirm   bool
+	flagMaxChunk  string
+	flagHighWater string
+	flagLimit     string
+	flagPassword  string
+	flagQR        bool
+	flagPipeline  int
+	flagChannels  int
+	flagCompress  bool
+	flagDryRun    bool
+	flagNoCopy    bool
+	flagJSON      bool
+	flagNumeric   bool
+	flagHeartbeat int
+	flagConfirmTO int
+	flagRetries   int
+	flagWaitTO    int
+	flagAllowZero bool
+	flagExclude   []string
+	flagStatsOut  string
+	flagName      string
+	flagText      string
 )
 
 var sendCmd = &cobra.Command{
 	Use:     "send",
 	Aliases: []string{"s"},
-	Short:   "Send files to a receiver",
+	Short:   "Send files or directories to a receiver",
 	Long: `Send files directly to a receiver using WebRTC technology.
 
+Quoted glob patterns are expanded by WarpDrop, and @file reads one path
+per line from a list file. Paths given more than once are sent once.
+
+Use --exclude to leave files out of directories, in .gitignore style:
+'node_modules/' skips that folder at any depth and '/build' only at the
+top. It can be repeated. A .warpdropignore file in the root of a directory
+being sent adds its patterns too.
+
+Use --tcp on networks that block UDP. Only TCP candidates are gathered, so
+a direct connection needs one side to accept incoming TCP; add --relay to
+go through TURN over TCP or TLS instead, which works behind most firewalls.
+
+Use --ip-version 4 or 6 to gather only IPv4 or IPv6 candidates, which can
+help when one family is firewalled or broken on your network.
+
+Between CLIs each file has its own data channel, and at most --max-channels
+files (default 32) are sent at once; the rest start as those finish.
+
+Use --via-server as a last resort when no WebRTC connection gets through,
+even over TURN. Files go through the signaling server instead, which is
+slow, uses the server's bandwidth and lets it read them unless --password
+is set. It takes effect when either side gives it, and only on servers
+that enable it with DATA_RELAY.
+
 Examples:
   warpdrop send file1.txt file2.pdf
+  warpdrop send ./myproject
+  warpdrop send '*.jpg'
+  warpdrop send @list.txt
+  warpdrop send --exclude .git --exclude '*.tmp' ./myproject
   warpdrop send --domain custom.example.com file.txt
-  warpdrop send --relay file.txt`,
+  warpdrop send --relay file.txt
+  warpdrop send --no-turn file.txt
+  warpdrop send --tcp --relay file.txt
+  warpdrop send --stun stun:stun.example.com:3478,stun:stun.l.google.com:19302 file.txt
+  warpdrop send --dashboard file.txt
+  warpdrop send --qr file.txt
+  warpdrop send --no-copy file.txt
+  warpdrop send --numeric-code file.txt
+  warpdrop send --max-chunk 128KB --high-water 8MB file.txt
+  warpdrop send --max-channels 8 ./photos
+  warpdrop send --limit 2MB/s file.txt
+  warpdrop send --stats-out stats.csv file.txt
+  warpdrop send --password "correct horse" file.txt
+  warpdrop send --dry-run '*.jpg'
+  warpdrop send --name report.pdf /tmp/tmpa8f3k2
+  warpdrop send --text "https://example.com/some/long/link"
+  git diff | warpdrop send --text - --name changes.diff
+  warpdrop send --json file.txt | jq .
+
+--numeric-code also gets a 6-digit code from the server, which is easier
+to type on a phone or TV than the room ID. It works for joining for ten
+minutes.
+
+--text sends a snippet such as a note or link without making a file. It is
+offered as text.txt, or under --name, and receivers print short ones to
+the terminal. Use --text - to read it from stdin.
+
+--name offers a single file under another name, such as a generated file
+with a temporary name, without renaming it on disk. It must be a plain
+filename.
+
+--wait-timeout gives up with an error when no receiver joins within N
+seconds, for scripts that shouldn't wait forever.
+
+--retries sends a file again on a fresh channel when its channel fails
+partway, on multi-channel transfers between CLIs. Failed files are retried
+after the rest of the batch, and the summary lists the files that needed it.
+
+--stats-out writes a CSV of throughput samples once the transfer completes:
+timestamp, bytes sent so far, speed over the last interval in bytes per
+second and the adaptive chunk size, taken every half second.
+
+--json replaces the terminal UI with one JSON event per line on stdout:
+room_created, peer_joined, progress (throttled per file), complete,
+declined and error.
+
+When the receiver declines the transfer, send says so and exits with
+status 2 instead of 1, which is kept for failures.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if len(args) == 0 {
+		if len(args) == 0 && flagText == "" {
 			return fmt.Errorf("no files specified")
 		}
-		return sendFiles(args)
+		if len(args) > 0 && flagText != "" {
+			return fmt.Errorf("cannot combine --text with files")
+		}
+		if flagJSON && flagDash {
+			return fmt.Errorf("cannot combine --json with --dashboard")
+		}
+		if flagHeartbeat < 0 {
+			return fmt.Errorf("--heartbeat-timeout must not be negative")
+		}
+		if flagConfirmTO < 0 {
+			return fmt.Errorf("--confirm-timeout must not be negative")
+		}
+		if flagWaitTO < 0 {
+			return fmt.Errorf("--wait-timeout must not be negative")
+		}
+		if flagRetries < 0 {
+			return fmt.Errorf("--retries must not be negative")
+		}
+		ui.SetJSONMode(flagJSON)
+		return sendFiles(cmd.Context(), args)
 	},
 }
 
-func sendFiles(filePaths []string) error {
-	stopSpinner := ui.RunSpinner("Validating files...")
-	defer stopSpinner()
-	fileInfos, err := files.ValidateFiles(filePaths)
+func sendFiles(runCtx context.Context, filePaths []string) error {
+	var rateLimit int
+	if flagLimit != "" {
+		var err error
+		if rateLimit, err = utils.ParseRate(flagLimit); err != nil {
+			return err
+		}
+	}
+
+	fileInfos, skipped, err := loadFiles(filePaths)
 	if err != nil {
 		return err
 	}
-	stopSpinner()
 
 	displayFileTable(fileInfos)
+	displaySkipped(skipped)
+	displayExcluded(skipped)
+
+	if flagDryRun {
+		displayDryRunSummary(fileInfos)
+		return nil
+	}
 
 	cfg, err := LoadConfig(config.Options{
-		Domain:     flagDomain,
-		STUNServer: flagSTUN,
-		TURNServer: flagTURN,
-		TURNUser:   flagTURNUser,
-		TURNPass:   flagTURNPass,
-		ForceRelay: flagRelay,
+		Domain:      flagDomain,
+		STUNServer:  flagSTUN,
+		TURNServer:  flagTURN,
+		TURNUser:    flagTURNUser,
+		TURNPass:    flagTURNPass,
+		ForceRelay:  flagRelay,
+		NoTURN:      flagNoTURN,
+		ForceTCP:    flagTCP,
+		IPVersion:   flagIPVersion,
+		ViaServer:   flagViaServer,
+		Unordered:   flagUnordered,
+		MaxChunk:    flagMaxChunk,
+		HighWater:   flagHighWater,
+		MaxChannels: flagChannels,
 	})
 	if err != nil {
 		return err
 	}
 
-	fmt.Println()
-	stopSpinner = ui.RunConnectionSpinner("Connecting to server...")
-	defer stopSpinner()
-	ctx, err := NewConnectionContext(cfg)
+	ui.Println()
+	spinner := ui.NewConnectionSpinner("Connecting to server...")
+	spinner.Start()
+	defer spinner.Stop()
+	client, err := DialServer(cfg, spinner)
 	if err != nil {
 		return err
 	}
+	ctx := NewConnectionContext(client, cfg)
 	defer ctx.Close()
-	stopSpinner()
+	spinner.Stop()
 
-	roomID, err := createRoom(ctx)
+	codeMode := ""
+	if flagNumeric {
+		codeMode = signaling.CodeModeNumeric
+	}
+	roomID, shortCode, err := ctx.CreateRoom(runCtx, codeMode)
 	if err != nil {
 		return err
 	}
 
-	displayRoomInfo(roomID, cfg)
+	// Listing is best effort, so a failure to record the session is ignored
+	unregister, _ := sessions.Register(sessions.Session{
+		Role:   sessions.RoleSend,
+		RoomID: roomID,
+		Files:  len(fileInfos),
+	})
+	defer unregister()
+
+	ui.Emit(ui.Event{Type: ui.EventRoomCreated, RoomID: roomID, RoomLink: cfg.GetRoomLink(roomID), Code: shortCode})
 
-	peerInfo, err := waitForPeer(ctx)
+	var dashboard *ui.Dashboard
+	if flagDash {
+		dashboard = ui.StartDashboard(roomID, shortCode, cfg.GetRoomLink(roomID))
+		defer dashboard.Stop()
+		if flagQR {
+			dashboard.ShowQR()
+		}
+	} else {
+		displayRoomInfo(roomID, shortCode, cfg)
+		if flagQR {
+			ui.RenderRoomQR(cfg.GetRoomLink(roomID))
+		}
+	}
+	if !flagNoCopy {
+		copyRoomLink(cfg.GetRoomLink(roomID))
+	}
+
+	peerInfo, err := waitForPeer(runCtx, ctx, fileSummary(fileInfos), time.Duration(flagWaitTO)*time.Second)
 	if err != nil {
 		return err
 	}
-	ctx.PeerInfo = peerInfo
+	ui.Emit(ui.Event{Type: ui.EventPeerJoined, RoomID: roomID, PeerType: peerInfo.ClientType})
+
+	if flagPassword != "" && peerInfo.ClientType != "cli" {
+		return transfer.ErrNoEncryption
+	}
+	if peerInfo.ResumeToken != "" {
+		ui.PrintInfo("Receiver is resuming an earlier transfer")
+	}
+
+	if dashboard != nil {
+		dashboard.SetPeer(fmt.Sprintf("connected (%s)", peerInfo.ClientType))
+	}
 
 	fileInfoPtrs := prepareFileData(fileInfos)
 
-	session, err := CreateSenderSession(ctx, fileInfoPtrs)
+	session, err := ctx.NewSender(fileInfoPtrs)
 	if err != nil {
 		return transfer.NewError("create session", err)
 	}
 
-	return RunSenderSession(session, nil)
+	return RunSenderSession(runCtx, session, &transfer.TransferOptions{
+		ConfirmProgress:  flagConfirm,
+		RateLimit:        int64(rateLimit),
+		Password:         flagPassword,
+		RoomID:           roomID,
+		PipelineDepth:    flagPipeline,
+		Compress:         flagCompress,
+		HeartbeatTimeout: time.Duration(flagHeartbeat) * time.Second,
+		ConfirmTimeout:   time.Duration(flagConfirmTO) * time.Second,
+		NATCheck:         flagNATCheck,
+		Retries:          flagRetries,
+		StatsOut:         flagStatsOut,
+	})
+}
+
+// loadFiles returns the files to send: the text given with --text, or the
+// files and directories at filePaths
+func loadFiles(filePaths []string) ([]files.FileInfo, files.Skipped, error) {
+	if flagText != "" {
+		text, err := readText(flagText)
+		if err != nil {
+			return nil, files.Skipped{}, err
+		}
+		info, err := files.NewTextFile(text, flagName)
+		if err != nil {
+			return nil, files.Skipped{}, err
+		}
+		return []files.FileInfo{info}, files.Skipped{}, nil
+	}
+
+	filePaths, err := files.ExpandPaths(filePaths)
+	if err != nil {
+		return nil, files.Skipped{}, err
+	}
+
+	stopSpinner := ui.RunSpinner("Validating files...")
+	defer stopSpinner()
+	return files.ValidateFilesSkipped(filePaths, files.ValidateOptions{
+		AllowEmpty: flagAllowZero,
+		Exclude:    flagExclude,
+		Name:       flagName,
+	})
+}
+
+// readText returns the --text value, reading it from stdin when it is "-"
+func readText(value string) (string, error) {
+	if value != "-" {
+		return value, nil
+	}
+	data, err := io.ReadAll(io.LimitReader(os.Stdin, files.MaxTextSize+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read text from stdin: %w", err)
+	}
+	return string(data), nil
 }
 
 func displayFileTable(fileInfos []files.FileInfo) {
@@ -99,39 +344,72 @@ func displayFileTable(fileInfos []files.FileInfo) {
 	for i, f := range fileInfos {
 		items[i] = ui.FileTableItem{Index: i + 1, Name: f.Name, Size: f.Size, Type: f.Type}
 	}
-	fmt.Println()
+	ui.Println()
 	ui.RenderFileTable(items)
 }
 
-func displayRoomInfo(roomID string, cfg *config.Config) {
-	ui.RenderRoomInfo(roomID, cfg.GetRoomLink(roomID))
+// displayDryRunSummary prints what a --dry-run would have sent
+func displayDryRunSummary(fileInfos []files.FileInfo) {
+	ui.Println()
+	ui.PrintInfof("%s total", fileSummary(fileInfos))
+	ui.PrintSuccess("Dry run: nothing was sent")
 }
 
-func createRoom(ctx *ConnectionContext) (string, error) {
-	ctx.Client.SendMessage(&signaling.Message{
-		Type:       signaling.MessageTypeCreateRoom,
-		ClientType: "cli",
-	})
+// displaySkipped says what was left out of folders because it can't be sent
+func displaySkipped(skipped files.Skipped) {
+	if skipped.Unsendable > 0 {
+		ui.PrintWarningf("Skipped %d empty or non-regular file(s)", skipped.Unsendable)
+	}
+	if skipped.EmptyDirs > 0 {
+		ui.PrintWarningf("Skipped %d empty folder(s)", skipped.EmptyDirs)
+	}
+}
 
-	select {
-	case roomID := <-ctx.Handler.RoomCreated:
-		return roomID, nil
-	case errMsg := <-ctx.Handler.Error:
-		return "", transfer.WrapError("create room", transfer.ErrSignalingError, errMsg)
+// displayExcluded says what --exclude and ignore files left out
+func displayExcluded(skipped files.Skipped) {
+	if !skipped.Excluded() {
+		return
 	}
+	msg := fmt.Sprintf("Excluded %d file(s), %s", skipped.ExcludedFiles, utils.FormatSize(skipped.ExcludedBytes))
+	if skipped.ExcludedDirs > 0 {
+		msg += fmt.Sprintf(", and %d folder(s)", skipped.ExcludedDirs)
+	}
+	ui.PrintInfo(msg)
 }
 
-func waitForPeer(ctx *ConnectionContext) (*signaling.PeerInfo, error) {
-	fmt.Println()
-	stopSpinner := ui.RunWaitingSpinner("Waiting for receiver to join...")
-	defer stopSpinner()
+func displayRoomInfo(roomID, shortCode string, cfg *config.Config) {
+	ui.RenderRoomInfo(roomID, shortCode, cfg.GetRoomLink(roomID))
+}
 
-	select {
-	case peerInfo := <-ctx.Handler.PeerJoined:
-		return peerInfo, nil
-	case errMsg := <-ctx.Handler.Error:
-		return nil, transfer.WrapError("wait for peer", transfer.ErrSignalingError, errMsg)
+// copyRoomLink puts the room link on the clipboard. Machines without one,
+// like headless servers, just get a note.
+func copyRoomLink(link string) {
+	if err := utils.CopyToClipboard(link); err != nil {
+		ui.Println(ui.MutedStyle.Render("Clipboard unavailable, copy the link above to share it"))
+		return
 	}
+	ui.Printf("%s %s\n", ui.IconCopy, ui.MutedStyle.Render("Room link copied to clipboard"))
+}
+
+// fileSummary describes what is being sent in one line, e.g.
+// "3 file(s), 1.2 MB"
+func fileSummary(fileInfos []files.FileInfo) string {
+	return fmt.Sprintf("%d file(s), %s", len(fileInfos), utils.FormatSize(files.GetTotalSize(fileInfos)))
+}
+
+// waitForPeer shows a spinner while waiting for the receiver to join,
+// followed by summary when it isn't empty. A zero timeout waits forever.
+func waitForPeer(ctx context.Context, conn *engine.Connection, summary string, timeout time.Duration) (*signaling.PeerInfo, error) {
+	message := "Waiting for receiver to join..."
+	if summary != "" {
+		message += " " + ui.MutedStyle.Render("("+summary+")")
+	}
+
+	ui.Println()
+	stopSpinner := ui.RunWaitingSpinner(message)
+	defer stopSpinner()
+
+	return conn.WaitForPeer(ctx, timeout)
 }
 
 func prepareFileData(fileInfos []files.FileInfo) []*files.FileInfo {
@@ -148,9 +426,38 @@ func init() {
 	rootCmd.AddCommand(sendCmd)
 
 	sendCmd.Flags().StringVarP(&flagDomain, "domain", "d", "", "Custom domain")
-	sendCmd.Flags().StringVarP(&flagSTUN, "stun", "s", "", "Custom STUN server")
-	sendCmd.Flags().StringVarP(&flagTURN, "turn", "t", "", "Custom TURN server")
+	sendCmd.Flags().StringVarP(&flagSTUN, "stun", "s", "", "Custom STUN servers, comma-separated stun: URLs")
+	sendCmd.Flags().StringVarP(&flagTURN, "turn", "t", "", "Custom TURN servers, comma-separated hostnames or turn:/turns: URLs")
 	sendCmd.Flags().StringVarP(&flagTURNUser, "turn-user", "u", "", "TURN username")
 	sendCmd.Flags().StringVarP(&flagTURNPass, "turn-pass", "p", "", "TURN password")
 	sendCmd.Flags().BoolVarP(&flagRelay, "relay", "r", false, "Force relay mode")
+	sendCmd.Flags().BoolVar(&flagNoTURN, "no-turn", false, "Disable TURN relay and require a direct connection")
+	sendCmd.Flags().BoolVar(&flagTCP, "tcp", false, "Use only TCP for the connection, for networks that block UDP")
+	sendCmd.Flags().StringVar(&flagIPVersion, "ip-version", "auto", "Gather only IPv4 (4) or IPv6 (6) candidates, or both (auto)")
+	sendCmd.Flags().BoolVar(&flagViaServer, "via-server", false, "Send files through the signaling server when no WebRTC connection works (slow)")
+	sendCmd.Flags().BoolVar(&flagNATCheck, "nat-check", false, "Probe the NAT type while connecting and warn when both peers need a relay")
+	sendCmd.Flags().BoolVar(&flagUnordered, "unordered", false, "Let chunks arrive out of order on single-channel transfers to CLI receivers, so a lost one doesn't stall the rest")
+	sendCmd.Flags().BoolVar(&flagJSON, "json", false, "Write newline-delimited JSON events to stdout instead of the terminal UI")
+	sendCmd.Flags().BoolVar(&flagDash, "dashboard", false, "Show a full-screen dashboard with room info and progress")
+	sendCmd.Flags().BoolVar(&flagQR, "qr", false, "Show a QR code of the room link")
+	sendCmd.Flags().BoolVar(&flagNumeric, "numeric-code", false, "Also get a 6-digit code receivers can join with instead of the room ID")
+	sendCmd.Flags().BoolVar(&flagNoCopy, "no-copy", false, "Don't copy the room link to the clipboard")
+	sendCmd.Flags().BoolVar(&flagConfirm, "confirm-progress", false, "Show progress confirmed by the receiver")
+	sendCmd.Flags().StringVar(&flagMaxChunk, "max-chunk", "", "Largest chunk size to send, e.g. 128KB, at most 240KB (default 64KB)")
+	sendCmd.Flags().StringVar(&flagHighWater, "high-water", "", "Send buffer size that pauses sending, e.g. 8MB (default 2MB), shared by files sent at once")
+	sendCmd.Flags().StringVar(&flagLimit, "limit", "", "Cap the upload rate, e.g. 2MB/s")
+	sendCmd.Flags().StringVar(&flagStatsOut, "stats-out", "", "Write throughput and chunk size samples to a CSV file when the transfer completes")
+	sendCmd.Flags().BoolVar(&flagCompress, "compress", false, "Compress files with zstd on the wire when the receiver supports it")
+	sendCmd.Flags().IntVar(&flagHeartbeat, "heartbeat-timeout", int(transfer.DefaultHeartbeatTimeout/time.Second), "Stop the transfer if the receiver stops answering pings for N seconds (0 turns pings off)")
+	sendCmd.Flags().IntVar(&flagConfirmTO, "confirm-timeout", 0, "Wait N seconds after the last chunk for the receiver to confirm it saved everything (default: as long as it answers pings)")
+	sendCmd.Flags().IntVar(&flagWaitTO, "wait-timeout", 0, "Give up if no receiver joins within N seconds (default: wait forever)")
+	sendCmd.Flags().IntVar(&flagRetries, "retries", transfer.DefaultRetries, "Send a file again on a fresh channel up to N times when its channel fails (0 turns retries off)")
+	sendCmd.Flags().IntVar(&flagChannels, "max-channels", config.DefaultMaxChannels, "Send at most N files at once between CLIs, each on its own data channel")
+	sendCmd.Flags().IntVar(&flagPipeline, "pipeline", 1, "Let the receiver request up to N files ahead on single-channel transfers, sent interleaved when it supports that (max 16)")
+	sendCmd.Flags().StringArrayVar(&flagExclude, "exclude", nil, "Leave out entries of directories matching a .gitignore-style pattern (repeatable)")
+	sendCmd.Flags().BoolVar(&flagAllowZero, "allow-empty", false, "Send empty files instead of rejecting them, or skipping them inside folders")
+	sendCmd.Flags().StringVar(&flagText, "text", "", "Send this text as a plain text file instead of files, or text read from stdin with -")
+	sendCmd.Flags().StringVar(&flagName, "name", "", "Offer a single file under this name instead of its own")
+	sendCmd.Flags().BoolVar(&flagDryRun, "dry-run", false, "List the files that would be sent and exit without creating a room")
+	sendCmd.Flags().StringVar(&flagPassword, "password", "", "Encrypt the transfer end to end with a password the receiver must enter")
 }
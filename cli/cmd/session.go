@@ -1,138 +1,81 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/BioHazard786/Warpdrop/cli/internal/config"
-	"github.com/BioHazard786/Warpdrop/cli/internal/files"
+	"github.com/BioHazard786/Warpdrop/cli/internal/engine"
 	"github.com/BioHazard786/Warpdrop/cli/internal/signaling"
 	"github.com/BioHazard786/Warpdrop/cli/internal/transfer"
-	"github.com/BioHazard786/Warpdrop/cli/internal/webrtc"
-	"github.com/BioHazard786/Warpdrop/cli/internal/webrtc/multichannel"
-	"github.com/BioHazard786/Warpdrop/cli/internal/webrtc/singlechannel"
+	"github.com/BioHazard786/Warpdrop/cli/internal/ui"
 )
 
-type SenderSession interface {
-	SetProgressUI()
-	SetOptions(opts *transfer.TransferOptions)
-	Start() error
-	Transfer() error
-	Close() error
-}
-
-type ReceiverSession interface {
-	SetProgressUI()
-	SetOptions(opts *transfer.TransferOptions)
-	Start() error
-	Transfer() error
-	Close() error
-}
-
-type ConnectionContext struct {
-	Client   *signaling.Client
-	Handler  *signaling.Handler
-	Config   *config.Config
-	PeerInfo *signaling.PeerInfo
-}
-
-func NewConnectionContext(cfg *config.Config) (*ConnectionContext, error) {
-	client := signaling.NewClient(cfg.WebSocketURL)
-	if err := client.Connect(); err != nil {
-		return nil, transfer.NewError("connect to server", err)
+// DialServer connects to the signaling server, retrying with backoff while
+// it is unreachable. Retries are shown on spinner if set.
+func DialServer(cfg *config.Config, spinner *ui.SimpleSpinner) (*signaling.Client, error) {
+	var onRetry func(int, time.Duration, error)
+	if spinner != nil {
+		onRetry = func(attempt int, delay time.Duration, err error) {
+			spinner.UpdateMessage(fmt.Sprintf("Server unreachable, retrying in %s (attempt %d/%d)...", delay, attempt, engine.ConnectAttempts))
+		}
 	}
-
-	handler := signaling.NewHandler(client)
-	go handler.Start()
-
-	return &ConnectionContext{
-		Client:  client,
-		Handler: handler,
-		Config:  cfg,
-	}, nil
+	return engine.Dial(cfg, onRetry)
 }
 
-func (c *ConnectionContext) Close() {
-	if c.Handler != nil {
-		c.Handler.Close()
-	}
-	if c.Client != nil {
-		c.Client.Close()
-	}
+// NewConnectionContext sets up a session's connection over t, the client
+// from DialServer or one end of a signaling.Pipe in tests
+func NewConnectionContext(t signaling.Transport, cfg *config.Config) *engine.Connection {
+	return engine.NewConnection(t, cfg)
 }
 
 func LoadConfig(opts config.Options) (*config.Config, error) {
+	opts.Server = flagServer
+	opts.Insecure = flagInsecure
+	opts.Reconnects = flagReconnects
 	cfg, err := config.Load(opts)
 	if err != nil {
 		return nil, transfer.NewError("load config", err)
 	}
+	printWarnings(cfg.FileWarnings)
 
-	if cfg.ForceRelay && cfg.GetTURNServers() == nil {
-		return nil, fmt.Errorf("cannot force relay mode without TURN server configured")
-	}
-
-	return cfg, nil
-}
-
-func CreateSenderSession(ctx *ConnectionContext, fileInfos []*files.FileInfo) (SenderSession, error) {
-	protocol := webrtc.SelectProtocol(ctx.PeerInfo.ClientType)
-
-	switch protocol {
-	case webrtc.MultiChannelProtocol:
-		return multichannel.NewSenderSession(ctx.Client, ctx.Handler, ctx.Config, fileInfos, ctx.PeerInfo)
-	case webrtc.SingleChannelProtocol:
-		return singlechannel.NewSenderSession(ctx.Client, ctx.Handler, ctx.Config, fileInfos, ctx.PeerInfo)
-	default:
-		return nil, fmt.Errorf("unsupported protocol: %s", protocol)
-	}
-}
-
-func CreateReceiverSession(ctx *ConnectionContext) (ReceiverSession, error) {
-	protocol := webrtc.SelectProtocol(ctx.PeerInfo.ClientType)
-
-	switch protocol {
-	case webrtc.MultiChannelProtocol:
-		return multichannel.NewReceiverSession(ctx.Client, ctx.Handler, ctx.Config, ctx.PeerInfo)
-	case webrtc.SingleChannelProtocol:
-		return singlechannel.NewReceiverSession(ctx.Client, ctx.Handler, ctx.Config, ctx.PeerInfo)
-	default:
-		return nil, fmt.Errorf("unsupported protocol: %s", protocol)
+	if cfg.Insecure {
+		ui.PrintWarning("--insecure: the server's TLS certificate is not verified, so anyone on the network path can impersonate it")
 	}
-}
-
-func RunSenderSession(session SenderSession, opts *transfer.TransferOptions) error {
-	defer session.Close()
 
-	session.SetProgressUI()
-	if opts != nil {
-		session.SetOptions(opts)
+	if cfg.Reconnects < 0 {
+		return nil, fmt.Errorf("--reconnects must not be negative")
 	}
 
-	if err := session.Start(); err != nil {
-		return transfer.NewError("start connection", err)
+	if cfg.ForceRelay && cfg.NoTURN {
+		return nil, fmt.Errorf("cannot combine --relay with --no-turn")
 	}
 
-	if err := session.Transfer(); err != nil {
-		return transfer.NewError("transfer files", err)
+	if cfg.ForceRelay && cfg.GetTURNServers() == nil {
+		return nil, fmt.Errorf("cannot force relay mode without TURN server configured")
 	}
 
-	return nil
+	return cfg, nil
 }
 
-func RunReceiverSession(session ReceiverSession, opts *transfer.TransferOptions) error {
-	defer session.Close()
-
-	if err := session.Start(); err != nil {
-		return transfer.NewError("start connection", err)
-	}
+// RunSenderSession connects and runs the transfer. Ctrl+C or cancelling ctx
+// stops it and tells the receiver instead of dropping the connection.
+func RunSenderSession(ctx context.Context, session engine.Sender, opts *transfer.TransferOptions) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := ui.OnInterrupt(cancel)
+	defer stop()
 
-	session.SetProgressUI()
-	if opts != nil {
-		session.SetOptions(opts)
-	}
+	return engine.RunSender(ctx, session, opts)
+}
 
-	if err := session.Transfer(); err != nil {
-		return transfer.NewError("receive files", err)
-	}
+// RunReceiverSession is the receiving counterpart of RunSenderSession
+func RunReceiverSession(ctx context.Context, session engine.Receiver, opts *transfer.TransferOptions) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := ui.OnInterrupt(cancel)
+	defer stop()
 
-	return nil
+	return engine.RunReceiver(ctx, session, opts)
 }
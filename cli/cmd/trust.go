@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/transfer"
+	"github.com/BioHazard786/Warpdrop/cli/internal/trust"
+	"github.com/BioHazard786/Warpdrop/cli/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+var trustCmd = &cobra.Command{
+	Use:   "trust [fingerprint]",
+	Short: "Accept transfers from a device without asking",
+	Long: `Add a sender's fingerprint to the trusted peers file, or list the
+trusted fingerprints when none is given.
+
+The receiver shows the sender's fingerprint above the consent prompt.
+Later transfers from a trusted device skip the prompt. A fingerprint is
+the hash of the certificate a device keeps in identity.pem next to its
+config file, and the connection only succeeds if the sender holds that
+certificate's key, so it can't be copied from an earlier transfer.
+Transfers through the signaling server (--via-server) have no fingerprint.
+
+Devices get their certificate the first time they run this command, which
+also shows this device's fingerprint. Until then a device connects with a
+throwaway certificate and can't be trusted.
+
+Examples:
+  warpdrop trust 3f9a1c0d27b4e8516a02d9c4e7f1b385
+  warpdrop trust`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		identity, err := trust.EnsureIdentity()
+		if err != nil {
+			return transfer.NewError("load device certificate", err)
+		}
+
+		path, err := trust.FilePath()
+		if err != nil {
+			return transfer.NewError("locate trusted peers", err)
+		}
+		list, err := trust.Load(path)
+		if err != nil {
+			return transfer.NewError("read trusted peers", err)
+		}
+
+		if len(args) == 0 {
+			ui.PrintInfof("This device: %s", identity.Fingerprint)
+			for _, peer := range list.Peers {
+				fmt.Printf("%s  added %s\n", peer.Fingerprint, peer.AddedAt.Format("2006-01-02"))
+			}
+			return nil
+		}
+
+		fingerprint, err := trust.NormalizeFingerprint(args[0])
+		if err != nil {
+			return err
+		}
+		if !list.Add(fingerprint) {
+			ui.PrintInfof("%s is already trusted", fingerprint)
+			return nil
+		}
+		if err := list.Save(path); err != nil {
+			return transfer.NewError("save trusted peers", err)
+		}
+		ui.PrintSuccessf("Trusted %s (saved to %s)", fingerprint, path)
+		return nil
+	},
+}
+
+// loadTrustedPeers reads the trusted peers file at path, or the default one
+func loadTrustedPeers(path string) (*trust.List, error) {
+	if path == "" {
+		var err error
+		if path, err = trust.FilePath(); err != nil {
+			// Without a home directory nobody is trusted
+			return nil, nil
+		}
+	}
+	list, err := trust.Load(path)
+	if err != nil {
+		return nil, transfer.NewError("read trusted peers", err)
+	}
+	return list, nil
+}
+
+func init() {
+	rootCmd.AddCommand(trustCmd)
+}
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/transfer"
+	"github.com/BioHazard786/Warpdrop/cli/internal/ui"
+	"github.com/BioHazard786/Warpdrop/cli/internal/update"
+	"github.com/BioHazard786/Warpdrop/cli/internal/version"
+	"github.com/spf13/cobra"
+)
+
+// releasesURL is where Windows users download new versions by hand
+const releasesURL = "https://github.com/BioHazard786/Warpdrop/releases/latest"
+
+// noticeTimeout bounds the version check run after other commands, so an
+// unreachable installer delays them at most this long once a day
+const noticeTimeout = 2 * time.Second
+
+var (
+	flagUpgradeCheck bool
+	flagUpgradeForce bool
+)
+
+var upgradeCmd = &cobra.Command{
+	Use:   "upgrade",
+	Short: "Upgrade WarpDrop to the latest release",
+	Long: `Check for a newer release and install it over the running binary.
+
+The install script is downloaded from the installer service and run with
+the directory of the current binary as its prefix, so it may ask for sudo.
+On Windows, run the PowerShell one-liner it suggests instead.
+
+Other commands check for a new release at most once a day and mention it
+when one is out. Set WARPDROP_NO_UPDATE_CHECK=1 to turn that off.
+
+Examples:
+  warpdrop upgrade
+  warpdrop upgrade --check
+  warpdrop upgrade --force`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return upgrade(cmd.Context())
+	},
+}
+
+func upgrade(ctx context.Context) error {
+	checkCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	latest, err := update.Latest(checkCtx)
+	if err != nil {
+		return transfer.NewError("check latest version", err)
+	}
+
+	if !update.Newer(latest, version.Version) && !flagUpgradeForce {
+		ui.PrintSuccessf("WarpDrop v%s is up to date (latest v%s)", version.Version, latest)
+		return nil
+	}
+	if flagUpgradeCheck {
+		ui.PrintInfof("WarpDrop v%s is available (you have v%s)", latest, version.Version)
+		return nil
+	}
+	if runtime.GOOS == "windows" {
+		return fmt.Errorf("upgrade can't replace the binary on Windows; run 'irm %s/install.ps1 | iex' in PowerShell or download v%s from %s",
+			update.InstallerURL, latest, releasesURL)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return transfer.NewError("locate binary", err)
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return transfer.NewError("locate binary", err)
+	}
+
+	script, err := downloadInstallScript(ctx)
+	if err != nil {
+		return transfer.NewError("download install script", err)
+	}
+	defer os.Remove(script)
+
+	ui.PrintInfof("Installing WarpDrop v%s to %s", latest, filepath.Dir(exe))
+	install := exec.CommandContext(ctx, "bash", script, "-p", filepath.Dir(exe))
+	install.Stdin = os.Stdin
+	install.Stdout = ui.Output()
+	install.Stderr = os.Stderr
+	if err := install.Run(); err != nil {
+		return transfer.NewError("run install script", err)
+	}
+	return nil
+}
+
+// downloadInstallScript saves install.sh to a temporary file and returns its path
+func downloadInstallScript(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, update.InstallerURL+"/install.sh", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("installer returned %s", resp.Status)
+	}
+
+	f, err := os.CreateTemp("", "warpdrop-install-*.sh")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// notifyUpgrade mentions a newer release after cmd has run. The check is
+// cached for a day and skipped for upgrade itself and for dev builds.
+func notifyUpgrade(cmd *cobra.Command) {
+	if cmd == upgradeCmd || version.Version == "dev" || os.Getenv("WARPDROP_NO_UPDATE_CHECK") != "" || ui.JSONMode() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), noticeTimeout)
+	defer cancel()
+	if latest := update.CachedLatest(ctx); update.Newer(latest, version.Version) {
+		ui.Println()
+		ui.PrintInfof("WarpDrop v%s is available (you have v%s). Run 'warpdrop upgrade' to update.", latest, version.Version)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(upgradeCmd)
+
+	upgradeCmd.Flags().BoolVar(&flagUpgradeCheck, "check", false, "Only report whether a newer release is available")
+	upgradeCmd.Flags().BoolVar(&flagUpgradeForce, "force", false, "Reinstall the latest release even if this one is up to date")
+}
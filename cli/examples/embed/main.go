@@ -0,0 +1,57 @@
+// Command embed shows WarpDrop used as a library, without the CLI. It
+// prints each event as a plain line.
+//
+//	go run ./examples/embed send report.pdf
+//	go run ./examples/embed receive <room-id>
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/BioHazard786/Warpdrop/cli/pkg/warpdrop"
+)
+
+func main() {
+	if len(os.Args) < 3 {
+		fmt.Fprintln(os.Stderr, "usage: embed send FILE... | embed receive ROOM")
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// WARPDROP_SERVER points at a local signaling server when set
+	cfg := warpdrop.Config{Server: os.Getenv("WARPDROP_SERVER")}
+
+	var err error
+	switch os.Args[1] {
+	case "send":
+		err = warpdrop.Send(ctx, cfg, os.Args[2:], warpdrop.SendOptions{OnEvent: printEvent})
+	case "receive":
+		err = warpdrop.Receive(ctx, cfg, os.Args[2], warpdrop.ReceiveOptions{OnEvent: printEvent})
+	default:
+		err = fmt.Errorf("unknown command %q", os.Args[1])
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func printEvent(e warpdrop.Event) {
+	switch e.Type {
+	case warpdrop.EventRoomCreated:
+		fmt.Printf("room %s, share %s\n", e.RoomID, e.RoomLink)
+	case warpdrop.EventPeerJoined:
+		fmt.Printf("%s peer joined\n", e.PeerType)
+	case warpdrop.EventProgress:
+		fmt.Printf("%s: %d/%d bytes\n", e.File, e.Bytes, e.Total)
+	case warpdrop.EventComplete:
+		fmt.Printf("done: %d file(s), %d bytes in %.1fs\n", e.Files, e.Total, e.Duration)
+	case warpdrop.EventError:
+		fmt.Printf("%s: %s\n", e.File, e.Error)
+	}
+}
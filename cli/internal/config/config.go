@@ -2,7 +2,11 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"strings"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/utils"
 )
 
 // Default configuration values (production)
@@ -12,6 +16,19 @@ const (
 	DefaultTURN     = "" // TURN server hostname
 	DefaultTURNUser = ""
 	DefaultTURNPass = ""
+
+	// IP versions ICE gathers candidates for; see Config.IPVersion
+	IPVersionAuto = 0
+	IPVersion4    = 4
+	IPVersion6    = 6
+
+	// DefaultReconnects is how many times a signaling connection that
+	// drops mid-session is re-established
+	DefaultReconnects = 5
+
+	// DefaultMaxChannels is how many files a multichannel sender sends at
+	// once, each on its own data channel
+	DefaultMaxChannels = 32
 )
 
 // Config holds application configuration
@@ -19,67 +36,160 @@ type Config struct {
 	// Domain is the backend server domain
 	Domain string
 
-	// WebSocketURL is constructed from domain
+	// WebSocketURL is wss://<domain>/ws unless a server URL was given
 	WebSocketURL string
 
-	// ICE servers for WebRTC
-	STUNServer string
-	TURNServer string
-	TURNUser   string
-	TURNPass   string
+	// ICE servers for WebRTC. TURN hostnames are already expanded to URLs.
+	STUNServers []string
+	TURNServers []string
+	TURNUser    string
+	TURNPass    string
 
 	// ForceRelay forces all connections through TURN relay servers
 	// Use this when behind restrictive networks (e.g., DNS changers like 1.1.1.1)
 	ForceRelay bool
+
+	// NoTURN omits TURN servers entirely so only direct connections are attempted
+	NoTURN bool
+
+	// ForceTCP gathers only TCP candidates and TCP or TLS TURN servers, for
+	// networks that block UDP
+	ForceTCP bool
+
+	// IPVersion limits ICE candidates to IPv4 or IPv6, for networks where
+	// the other family is firewalled or broken. IPVersionAuto uses both.
+	IPVersion int
+
+	// ViaServer sends files through the signaling server instead of a
+	// WebRTC connection, for networks where neither STUN nor TURN works
+	ViaServer bool
+
+	// Unordered lets single-channel chunks arrive out of order, so one being
+	// retransmitted doesn't hold up the rest. Receivers that place chunks by
+	// offset are the only ones that get it.
+	Unordered bool
+
+	// Chunk bounds chunk sizes and send buffering
+	Chunk utils.ChunkSizeConfig
+
+	// MaxChannels caps how many file channels a multichannel sender has
+	// open at once; the other files wait for one to finish
+	MaxChannels int
+
+	// Insecure skips TLS certificate verification of the signaling server
+	Insecure bool
+
+	// Reconnects is how many times a signaling connection that drops after
+	// joining a room is re-established; zero lets it stay down
+	Reconnects int
+
+	// FileWarnings describes lines of the config file that were skipped
+	FileWarnings []string
+
+	// turnConfigured is set when TURN servers came from a flag, the
+	// environment or the config file rather than the defaults
+	turnConfigured bool
 }
 
 // Options for loading config with CLI flag overrides
 type Options struct {
 	Domain     string
+	Server     string // e.g. "ws://localhost:8080/ws"
 	STUNServer string
 	TURNServer string
 	TURNUser   string
 	TURNPass   string
 	ForceRelay bool
+	NoTURN     bool
+	ForceTCP   bool
+	IPVersion  string // "4", "6" or "auto"; empty is auto
+	ViaServer  bool
+	Unordered  bool
+	Insecure   bool
+	Reconnects int
+	MaxChunk   string // e.g. "128KB"
+	HighWater  string // e.g. "8MB"
+
+	// MaxChannels caps open file channels; zero uses DefaultMaxChannels
+	MaxChannels int
 }
 
 // Load reads configuration with the following priority:
 // 1. CLI flags (passed via Options) - highest priority
 // 2. Environment variables
-// 3. Hardcoded defaults - lowest priority
+// 3. Config file (see FilePath)
+// 4. Hardcoded defaults - lowest priority
 func Load(opts Options) (*Config, error) {
-	// Load domain: CLI flag > env > default
+	file, fileWarnings, err := loadDefaultFile()
+	if err != nil {
+		return nil, err
+	}
+
+	// Load domain: CLI flag > env > file > default
 	domain := opts.Domain
 	if domain == "" {
 		domain = os.Getenv("DOMAIN")
 	}
+	if domain == "" {
+		domain = file[KeyDomain]
+	}
+
+	// Load server URL: CLI flag > env > file. It is used as the WebSocket
+	// URL as is, and its host stands in for a domain that isn't set.
+	server := opts.Server
+	if server == "" {
+		server = os.Getenv("WEBSOCKET_URL")
+	}
+	if server == "" {
+		server = file[KeyServer]
+	}
+	if server != "" {
+		host, err := parseServerURL(server)
+		if err != nil {
+			return nil, err
+		}
+		if domain == "" {
+			domain = host
+		}
+	}
+
 	if domain == "" {
 		domain = DefaultDomain
 	}
 
-	// Load STUN server: CLI flag > env > default
+	// Load STUN servers (comma-separated): CLI flag > env > file > default
 	stunServer := opts.STUNServer
 	if stunServer == "" {
 		stunServer = os.Getenv("STUN_SERVER")
 	}
+	if stunServer == "" {
+		stunServer = file[KeySTUNServer]
+	}
 	if stunServer == "" {
 		stunServer = DefaultSTUN
 	}
 
-	// Load TURN server: CLI flag > env > default
+	// Load TURN servers (comma-separated): CLI flag > env > file > default
 	turnServer := opts.TURNServer
 	if turnServer == "" {
 		turnServer = os.Getenv("TURN_SERVER")
 	}
+	if turnServer == "" {
+		turnServer = file[KeyTURNServer]
+	}
+	turnConfigured := turnServer != ""
 	if turnServer == "" {
 		turnServer = DefaultTURN
 	}
 
-	// Load TURN credentials: CLI flag > env > default
+	// Load TURN credentials: CLI flag > env > file > default
 	turnUser := opts.TURNUser
 	if turnUser == "" {
 		turnUser = os.Getenv("TURN_USERNAME")
 	}
+	if turnUser == "" {
+		turnUser = file[KeyTURNUser]
+	}
 	if turnUser == "" {
 		turnUser = DefaultTURNUser
 	}
@@ -88,24 +198,130 @@ func Load(opts Options) (*Config, error) {
 	if turnPass == "" {
 		turnPass = os.Getenv("TURN_PASSWORD")
 	}
+	if turnPass == "" {
+		turnPass = file[KeyTURNPass]
+	}
 	if turnPass == "" {
 		turnPass = DefaultTURNPass
 	}
 
-	// Construct WebSocket URL
-	wsURL := fmt.Sprintf("wss://%s/ws", domain)
+	ipVersion, err := ParseIPVersion(opts.IPVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	chunk, err := loadChunkConfig(opts, file)
+	if err != nil {
+		return nil, err
+	}
+
+	maxChannels := opts.MaxChannels
+	if maxChannels < 0 {
+		return nil, fmt.Errorf("max channels must be at least 1")
+	}
+	if maxChannels == 0 {
+		maxChannels = DefaultMaxChannels
+	}
+
+	stunServers, err := parseSTUNServers(stunServer)
+	if err != nil {
+		return nil, err
+	}
+	turnServers, err := parseTURNServers(turnServer)
+	if err != nil {
+		return nil, err
+	}
+
+	// Construct WebSocket URL unless one was given
+	wsURL := server
+	if wsURL == "" {
+		wsURL = fmt.Sprintf("wss://%s/ws", domain)
+	}
 
 	return &Config{
 		Domain:       domain,
 		WebSocketURL: wsURL,
-		STUNServer:   stunServer,
-		TURNServer:   turnServer,
+		STUNServers:  stunServers,
+		TURNServers:  turnServers,
 		TURNUser:     turnUser,
 		TURNPass:     turnPass,
 		ForceRelay:   opts.ForceRelay,
+		NoTURN:       opts.NoTURN,
+		ForceTCP:     opts.ForceTCP,
+		IPVersion:    ipVersion,
+		ViaServer:    opts.ViaServer,
+		Unordered:    opts.Unordered,
+		Chunk:        chunk,
+		MaxChannels:  maxChannels,
+		Insecure:     opts.Insecure,
+		Reconnects:   opts.Reconnects,
+		FileWarnings: fileWarnings,
+
+		turnConfigured: turnConfigured,
 	}, nil
 }
 
+// parseServerURL checks a server URL is a ws or wss URL with a host, and
+// returns the host
+func parseServerURL(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("server: %w", err)
+	}
+	if u.Scheme != "ws" && u.Scheme != "wss" {
+		return "", fmt.Errorf("server: %q must start with ws:// or wss://", raw)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("server: %q has no host", raw)
+	}
+	return u.Host, nil
+}
+
+// loadChunkConfig applies max chunk and high water overrides: CLI flag > env > file > default.
+// The default and minimum chunk sizes are lowered to fit a smaller max, and the
+// low water mark follows the high water mark at the default 1:4 ratio.
+func loadChunkConfig(opts Options, file File) (utils.ChunkSizeConfig, error) {
+	chunk := utils.DefaultChunkSizeConfig()
+
+	maxChunk := opts.MaxChunk
+	if maxChunk == "" {
+		maxChunk = os.Getenv("MAX_CHUNK_SIZE")
+	}
+	if maxChunk == "" {
+		maxChunk = file[KeyMaxChunk]
+	}
+	if maxChunk != "" {
+		size, err := utils.ParseSize(maxChunk)
+		if err != nil {
+			return chunk, fmt.Errorf("max chunk: %w", err)
+		}
+		chunk.MaxChunk = size
+		chunk.DefaultChunk = min(chunk.DefaultChunk, size)
+		chunk.MinChunk = min(chunk.MinChunk, size)
+	}
+
+	highWater := opts.HighWater
+	if highWater == "" {
+		highWater = os.Getenv("HIGH_WATER_MARK")
+	}
+	if highWater == "" {
+		highWater = file[KeyHighWater]
+	}
+	if highWater != "" {
+		size, err := utils.ParseSize(highWater)
+		if err != nil {
+			return chunk, fmt.Errorf("high water mark: %w", err)
+		}
+		chunk.HighWaterMark = size
+		chunk.LowWaterMark = size / 4
+	}
+
+	if err := chunk.Validate(); err != nil {
+		return chunk, err
+	}
+	return chunk, nil
+}
+
 // GetRoomLink returns the webapp URL for a room ID
 func (c *Config) GetRoomLink(roomID string) string {
 	return fmt.Sprintf("https://%s/r/%s", c.Domain, roomID)
@@ -113,22 +329,49 @@ func (c *Config) GetRoomLink(roomID string) string {
 
 // GetSTUNServers returns STUN server URLs as strings
 func (c *Config) GetSTUNServers() []string {
-	return []string{c.STUNServer}
+	return c.STUNServers
 }
 
-// GetTURNServers returns TURN server URLs if configured
+// GetTURNServers returns TURN server URLs if configured and not disabled
 func (c *Config) GetTURNServers() []string {
-	if c.TURNServer == "" {
+	if len(c.TURNServers) == 0 || c.NoTURN {
 		return nil
 	}
-	return []string{
-		fmt.Sprintf("turn:%s:3478?transport=udp", c.TURNServer),
-		fmt.Sprintf("turn:%s:3478?transport=tcp", c.TURNServer),
-		fmt.Sprintf("turns:%s:5349?transport=tcp", c.TURNServer),
+	return c.TURNServers
+}
+
+// UseServerTURN switches to TURN servers with short-lived credentials
+// issued by the signaling server, unless TURN servers were configured. It
+// reports whether they are used.
+func (c *Config) UseServerTURN(urls []string, username, credential string) bool {
+	if c.turnConfigured {
+		return false
 	}
+	servers, err := parseTURNServers(strings.Join(urls, ","))
+	if err != nil || len(servers) == 0 {
+		return false
+	}
+	c.TURNServers = servers
+	c.TURNUser = username
+	c.TURNPass = credential
+	return true
 }
 
 // GetTURNCredentials returns TURN username and password
 func (c *Config) GetTURNCredentials() (string, string) {
 	return c.TURNUser, c.TURNPass
 }
+
+// ParseIPVersion reads an --ip-version value: "4", "6", or "auto" or empty
+// for both
+func ParseIPVersion(value string) (int, error) {
+	switch value {
+	case "", "auto":
+		return IPVersionAuto, nil
+	case "4":
+		return IPVersion4, nil
+	case "6":
+		return IPVersion6, nil
+	}
+	return 0, fmt.Errorf("invalid IP version %q: use 4, 6 or auto", value)
+}
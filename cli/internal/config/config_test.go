@@ -0,0 +1,45 @@
+package config
+
+import "testing"
+
+// isolate keeps the user's config file and environment out of Load
+func isolate(t *testing.T) {
+	t.Helper()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	for _, key := range []string{"DOMAIN", "WEBSOCKET_URL", "STUN_SERVER", "TURN_SERVER", "TURN_USERNAME", "TURN_PASSWORD"} {
+		t.Setenv(key, "")
+	}
+}
+
+func TestNoTURNLeavesNoTURNServer(t *testing.T) {
+	isolate(t)
+
+	cfg, err := Load(Options{TURNServer: "turn:turn.example.com:3478", NoTURN: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if servers := cfg.GetTURNServers(); servers != nil {
+		t.Errorf("configured TURN server kept with NoTURN: %v", servers)
+	}
+
+	cfg, err = Load(Options{NoTURN: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.UseServerTURN([]string{"turn:relay.example.com:3478"}, "user", "pass")
+	if servers := cfg.GetTURNServers(); servers != nil {
+		t.Errorf("server issued TURN server kept with NoTURN: %v", servers)
+	}
+}
+
+func TestTURNServerWithoutNoTURN(t *testing.T) {
+	isolate(t)
+
+	cfg, err := Load(Options{TURNServer: "turn:turn.example.com:3478"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.GetTURNServers()) != 1 {
+		t.Errorf("got TURN servers %v, want the configured one", cfg.GetTURNServers())
+	}
+}
@@ -0,0 +1,229 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Keys that may be stored in the config file
+const (
+	KeyDomain     = "domain"
+	KeyServer     = "server"
+	KeySTUNServer = "stun_server"
+	KeyTURNServer = "turn_server"
+	KeyTURNUser   = "turn_user"
+	KeyTURNPass   = "turn_pass"
+	KeyMaxChunk   = "max_chunk"
+	KeyHighWater  = "high_water"
+)
+
+// FileKeys lists every supported config file key
+var FileKeys = []string{
+	KeyDomain,
+	KeyServer,
+	KeySTUNServer,
+	KeyTURNServer,
+	KeyTURNUser,
+	KeyTURNPass,
+	KeyMaxChunk,
+	KeyHighWater,
+}
+
+// File holds the settings persisted by `warpdrop config`. It is a flat
+// TOML document of string values.
+type File map[string]string
+
+// FilePath returns where the config file lives:
+// $XDG_CONFIG_HOME/warpdrop/config.toml, falling back to ~/.config
+func FilePath() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "warpdrop", "config.toml"), nil
+}
+
+// LoadFile reads the config file at path. A missing file is not an error
+// and yields an empty File. Only top-level string and bare values are
+// read; lines it can't use, and keys in tables, are skipped and described
+// in the warnings it returns rather than failing every command.
+func LoadFile(path string) (File, []string, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return File{}, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	file := File{}
+	var warnings []string
+	skip := func(lineNo int, reason string) {
+		warnings = append(warnings, fmt.Sprintf("%s:%d: %s, skipped", path, lineNo, reason))
+	}
+
+	inTable := false
+	multiline := ""
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if multiline != "" {
+			if strings.Contains(line, multiline) {
+				multiline = ""
+			}
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			// Everything up to the next table belongs to this one
+			inTable = true
+			skip(lineNo, "tables are not supported")
+			continue
+		}
+		if inTable {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			skip(lineNo, "expected key = value")
+			continue
+		}
+		key, err := parseValue(strings.TrimSpace(key))
+		if err != nil || key == "" {
+			skip(lineNo, "invalid key")
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if delim := value[:min(3, len(value))]; delim == `"""` || delim == "'''" {
+			if !strings.Contains(value[3:], delim) {
+				multiline = delim
+			}
+			skip(lineNo, "multi-line strings are not supported")
+			continue
+		}
+		value, err = parseValue(value)
+		if err != nil {
+			skip(lineNo, err.Error())
+			continue
+		}
+		file[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return file, warnings, nil
+}
+
+// parseValue accepts a quoted TOML string or a bare word, either of which
+// may be followed by a comment
+func parseValue(raw string) (string, error) {
+	var value, rest string
+	switch {
+	case strings.HasPrefix(raw, `"`):
+		end := closingQuote(raw)
+		if end < 0 {
+			return "", fmt.Errorf("unterminated string %s", raw)
+		}
+		unquoted, err := strconv.Unquote(raw[:end+1])
+		if err != nil {
+			return "", fmt.Errorf("invalid string %s", raw[:end+1])
+		}
+		value, rest = unquoted, raw[end+1:]
+
+	case strings.HasPrefix(raw, "'"):
+		end := strings.Index(raw[1:], "'")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated string %s", raw)
+		}
+		value, rest = raw[1:end+1], raw[end+2:]
+
+	case strings.HasPrefix(raw, "["), strings.HasPrefix(raw, "{"):
+		return "", errors.New("arrays and inline tables are not supported")
+
+	default:
+		value, _, _ = strings.Cut(raw, "#")
+		return strings.TrimSpace(value), nil
+	}
+
+	if rest = strings.TrimSpace(rest); rest != "" && !strings.HasPrefix(rest, "#") {
+		return "", fmt.Errorf("unexpected %s after string", rest)
+	}
+	return value, nil
+}
+
+// closingQuote returns the index of the quote ending the basic string
+// raw starts with, or -1
+func closingQuote(raw string) int {
+	for i := 1; i < len(raw); i++ {
+		switch raw[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// Save writes the file to path, creating its directory. The file may hold
+// TURN credentials, so it is only readable by the owner.
+func (f File) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(f))
+	for key := range f {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	var b strings.Builder
+	b.WriteString("# WarpDrop CLI configuration, managed by `warpdrop config`\n")
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%s = %s\n", key, strconv.Quote(f[key]))
+	}
+	return os.WriteFile(path, []byte(b.String()), 0600)
+}
+
+// Set validates key and stores value. An empty value removes the key.
+func (f File) Set(key, value string) error {
+	if !slices.Contains(FileKeys, key) {
+		return fmt.Errorf("unknown config key %q (valid keys: %s)", key, strings.Join(FileKeys, ", "))
+	}
+	if value == "" {
+		delete(f, key)
+		return nil
+	}
+	f[key] = value
+	return nil
+}
+
+// loadDefaultFile reads the config file from its default location
+func loadDefaultFile() (File, []string, error) {
+	path, err := FilePath()
+	if err != nil {
+		// Without a home directory there is simply no file to read
+		return File{}, nil, nil
+	}
+	file, warnings, err := LoadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read config file: %w", err)
+	}
+	return file, warnings, nil
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	content := `# Settings
+domain = "drop.example.com" # my server
+turn_user = 'me' # literal string
+max_chunk = 128KB  # bare value
+turn_pass = "p#ss\"word"
+server=ws://localhost:8080/ws
+ports = [1, 2]
+note = """
+spans = "lines"
+"""
+stun_server = "unterminated
+garbage
+
+[profile.work]
+domain = "work.example.com"
+`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	file, warnings, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := File{
+		KeyDomain:   "drop.example.com",
+		KeyTURNUser: "me",
+		KeyMaxChunk: "128KB",
+		KeyTURNPass: `p#ss"word`,
+		KeyServer:   "ws://localhost:8080/ws",
+	}
+	if !maps.Equal(file, want) {
+		t.Errorf("got %v, want %v", file, want)
+	}
+	// The array, the multi-line string, the unterminated string, the line
+	// without = and the table
+	if len(warnings) != 5 {
+		t.Errorf("got warnings %q, want 5", warnings)
+	}
+}
+
+func TestLoadFileMissing(t *testing.T) {
+	file, warnings, err := LoadFile(filepath.Join(t.TempDir(), "config.toml"))
+	if err != nil || len(file) != 0 || len(warnings) != 0 {
+		t.Errorf("got %v, %v, %v for a missing file", file, warnings, err)
+	}
+}
+
+func TestFileSaveRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "warpdrop", "config.toml")
+	file := File{KeyDomain: "drop.example.com", KeyTURNPass: `quote" # hash \ slash`}
+	if err := file.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, warnings, err := LoadFile(path)
+	if err != nil || len(warnings) != 0 {
+		t.Fatalf("LoadFile: %v, %q", err, warnings)
+	}
+	if !maps.Equal(loaded, file) {
+		t.Errorf("got %v, want %v", loaded, file)
+	}
+}
+
+func TestLoadSkipsUnsupportedLines(t *testing.T) {
+	isolate(t)
+	path, err := FilePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.MkdirAll(filepath.Dir(path), 0755)
+	os.WriteFile(path, []byte("domain = \"drop.example.com\" # comment\n[extra]\nkey = 1\n"), 0600)
+
+	cfg, err := Load(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Domain != "drop.example.com" {
+		t.Errorf("got domain %q, want drop.example.com", cfg.Domain)
+	}
+	if len(cfg.FileWarnings) != 1 {
+		t.Errorf("got warnings %q, want one for the table", cfg.FileWarnings)
+	}
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pion/stun/v3"
+)
+
+// splitList splits a comma-separated setting, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseSTUNServers parses a comma-separated list of stun: or stuns: URLs
+func parseSTUNServers(value string) ([]string, error) {
+	var servers []string
+	for _, raw := range splitList(value) {
+		uri, err := stun.ParseURI(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid STUN server %q: %w", raw, err)
+		}
+		if uri.Scheme != stun.SchemeTypeSTUN && uri.Scheme != stun.SchemeTypeSTUNS {
+			return nil, fmt.Errorf("invalid STUN server %q: must start with stun: or stuns:", raw)
+		}
+		servers = append(servers, raw)
+	}
+	return servers, nil
+}
+
+// parseTURNServers parses a comma-separated list of TURN servers. Entries
+// may be turn: or turns: URLs, or a bare hostname, which expands to the
+// standard UDP, TCP and TLS ports of a coturn server.
+func parseTURNServers(value string) ([]string, error) {
+	var servers []string
+	for _, raw := range splitList(value) {
+		if !isSchemeURL(raw) {
+			if strings.Contains(raw, ":") {
+				return nil, fmt.Errorf("invalid TURN server %q: use a turn: URL to give a port", raw)
+			}
+			servers = append(servers,
+				fmt.Sprintf("turn:%s:3478?transport=udp", raw),
+				fmt.Sprintf("turn:%s:3478?transport=tcp", raw),
+				fmt.Sprintf("turns:%s:5349?transport=tcp", raw),
+			)
+			continue
+		}
+
+		uri, err := stun.ParseURI(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TURN server %q: %w", raw, err)
+		}
+		if uri.Scheme != stun.SchemeTypeTURN && uri.Scheme != stun.SchemeTypeTURNS {
+			return nil, fmt.Errorf("invalid TURN server %q: must start with turn: or turns:, or be a hostname", raw)
+		}
+		servers = append(servers, raw)
+	}
+	return servers, nil
+}
+
+// isSchemeURL reports whether raw starts with an ICE or URL scheme rather
+// than being a host or host:port
+func isSchemeURL(raw string) bool {
+	scheme, _, _ := strings.Cut(raw, ":")
+	switch strings.ToLower(scheme) {
+	case "stun", "stuns", "turn", "turns":
+		return true
+	}
+	return strings.Contains(raw, "://")
+}
@@ -0,0 +1,84 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// attemptDelay is how long a connection attempt gets before the next
+// address is tried alongside it (RFC 8305 recommends 250ms)
+const attemptDelay = 250 * time.Millisecond
+
+// DialContext connects to addr ("host:port") with Happy Eyeballs: the host
+// is resolved with Lookup and its addresses are dialed in ranked order,
+// each started attemptDelay after the previous one or as soon as it fails.
+// The first connection to succeed is returned and the rest are closed.
+func DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	ips, err := Lookup(host)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan dialResult, len(ips))
+	dialer := &net.Dialer{}
+
+	started, failed := 0, 0
+	var lastErr error
+	for {
+		if started < len(ips) {
+			ip := ips[started]
+			started++
+			go func() {
+				conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+				results <- dialResult{conn, err}
+			}()
+		}
+
+		// Wait for a result, moving on to the next address after attemptDelay
+		var next <-chan time.Time
+		if started < len(ips) {
+			next = time.After(attemptDelay)
+		}
+
+		select {
+		case res := <-results:
+			if res.err == nil {
+				go closeLosers(results, started-failed-1)
+				return res.conn, nil
+			}
+			lastErr = res.err
+			failed++
+			if failed == len(ips) {
+				return nil, lastErr
+			}
+		case <-next:
+		case <-ctx.Done():
+			go closeLosers(results, started-failed)
+			return nil, ctx.Err()
+		}
+	}
+}
+
+type dialResult struct {
+	conn net.Conn
+	err  error
+}
+
+// closeLosers closes connections from attempts still running after another
+// one won the race
+func closeLosers(results <-chan dialResult, pending int) {
+	for range pending {
+		if res := <-results; res.err == nil {
+			res.conn.Close()
+		}
+	}
+}
@@ -31,51 +31,98 @@ var publicDNS = []string{
 	"[2620:119:53::53]",      // Cisco OpenDNS
 }
 
-// Lookup resolves a hostname to an IP address.
+// SystemResolver is the source LookupSource reports when the system's own
+// resolver answered
+const SystemResolver = "system"
+
+// Lookup resolves a hostname to its IP addresses, ranked for dialing.
 // It first attempts to use the system's default resolver.
 // If that fails, it falls back to using public DNS providers directly.
-func Lookup(address string) (string, error) {
+func Lookup(address string) ([]string, error) {
+	ips, _, err := LookupSource(address)
+	return ips, err
+}
+
+// LookupSource is Lookup that also reports which resolver answered:
+// SystemResolver, or the address of the public DNS server that won the
+// race. IP literals have no source.
+func LookupSource(address string) ([]string, string, error) {
+	// IP literals need no lookup
+	if net.ParseIP(address) != nil {
+		return []string{address}, "", nil
+	}
+
 	// 1. Try Local/System DNS first
-	ip, err := localLookupIP(address)
-	if err == nil && ip != "" {
-		return ip, nil
+	ips, err := localLookupIPs(address)
+	if err == nil && len(ips) > 0 {
+		return rankIPs(ips), SystemResolver, nil
 	}
 
 	// 2. Fallback to Internal/Public DNS
 	// ui.PrintWarning(fmt.Sprintf("System DNS lookup failed for %s, falling back to public DNS...", address))
-	return remoteLookupWithRace(address)
+	ips, server, err := remoteLookupWithRace(address)
+	if err != nil {
+		return nil, "", err
+	}
+	return rankIPs(ips), server, nil
+}
+
+// rankIPs orders addresses for Happy Eyeballs (RFC 8305): IPv6 and IPv4
+// alternate, starting with IPv6, so a dead path on one family is quickly
+// covered by the other. Duplicates are dropped.
+func rankIPs(ips []string) []string {
+	var v4, v6 []string
+	seen := make(map[string]bool, len(ips))
+	for _, ip := range ips {
+		parsed := net.ParseIP(ip)
+		if parsed == nil || seen[ip] {
+			continue
+		}
+		seen[ip] = true
+		if parsed.To4() != nil {
+			v4 = append(v4, ip)
+		} else {
+			v6 = append(v6, ip)
+		}
+	}
+
+	ranked := make([]string, 0, len(v4)+len(v6))
+	for i := 0; i < max(len(v4), len(v6)); i++ {
+		if i < len(v6) {
+			ranked = append(ranked, v6[i])
+		}
+		if i < len(v4) {
+			ranked = append(ranked, v4[i])
+		}
+	}
+	return ranked
 }
 
-// localLookupIP returns a host's IP address using the local DNS configuration.
-func localLookupIP(address string) (string, error) {
+// localLookupIPs returns a host's IP addresses using the local DNS configuration.
+func localLookupIPs(address string) ([]string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	defer cancel()
 
 	r := &net.Resolver{}
 	ips, err := r.LookupHost(ctx, address)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	if len(ips) == 0 {
-		return "", errors.New("no IP addresses found")
+		return nil, errors.New("no IP addresses found")
 	}
 
-	// Prefer IPv4
-	for _, ip := range ips {
-		if net.ParseIP(ip).To4() != nil {
-			return ip, nil
-		}
-	}
-
-	return ips[0], nil
+	return ips, nil
 }
 
-// remoteLookupWithRace returns a host's IP address by racing multiple public DNS servers.
-func remoteLookupWithRace(address string) (string, error) {
+// remoteLookupWithRace returns a host's IP addresses by racing multiple
+// public DNS servers, and the server that answered first.
+func remoteLookupWithRace(address string) ([]string, string, error) {
 	// Create a buffered channel to receive the first successful result
 	type result struct {
-		ip  string
-		err error
+		ips    []string
+		server string
+		err    error
 	}
 
 	// We'll limit concurrency to avoid spamming too many connections if list grows,
@@ -86,8 +133,8 @@ func remoteLookupWithRace(address string) (string, error) {
 
 	for _, dnsServer := range publicDNS {
 		go func(server string) {
-			ip, err := remoteLookupIP(ctx, address, server)
-			results <- result{ip: ip, err: err}
+			ips, err := remoteLookupIPs(ctx, address, server)
+			results <- result{ips: ips, server: server, err: err}
 		}(dnsServer)
 	}
 
@@ -96,20 +143,20 @@ func remoteLookupWithRace(address string) (string, error) {
 	for range publicDNS {
 		select {
 		case res := <-results:
-			if res.err == nil && res.ip != "" {
-				return res.ip, nil
+			if res.err == nil && len(res.ips) > 0 {
+				return res.ips, res.server, nil
 			}
 			failureCount++
 		case <-ctx.Done():
-			return "", fmt.Errorf("DNS lookup timed out during public DNS race")
+			return nil, "", fmt.Errorf("DNS lookup timed out during public DNS race")
 		}
 	}
 
-	return "", fmt.Errorf("failed to resolve %s: all %d public DNS servers failed or exhausted", address, failureCount)
+	return nil, "", fmt.Errorf("failed to resolve %s: all %d public DNS servers failed or exhausted", address, failureCount)
 }
 
-// remoteLookupIP queries a specific DNS server for the address.
-func remoteLookupIP(ctx context.Context, address, dnsServer string) (string, error) {
+// remoteLookupIPs queries a specific DNS server for the address.
+func remoteLookupIPs(ctx context.Context, address, dnsServer string) ([]string, error) {
 	// Use a custom dialer to force connection to the specific DNS server
 	r := &net.Resolver{
 		PreferGo: true,
@@ -122,18 +169,26 @@ func remoteLookupIP(ctx context.Context, address, dnsServer string) (string, err
 
 	ips, err := r.LookupHost(ctx, address)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	if len(ips) == 0 {
-		return "", errors.New("no IPs returned")
+		return nil, errors.New("no IPs returned")
 	}
 
-	// Prefer IPv4
+	return ips, nil
+}
+
+// LookupIPv4 resolves host with Lookup and returns its first IPv4 address,
+// for sockets that only speak IPv4
+func LookupIPv4(host string) (net.IP, error) {
+	ips, err := Lookup(host)
+	if err != nil {
+		return nil, err
+	}
 	for _, ip := range ips {
-		if net.ParseIP(ip).To4() != nil {
-			return ip, nil
+		if parsed := net.ParseIP(ip); parsed.To4() != nil {
+			return parsed, nil
 		}
 	}
-
-	return ips[0], nil
+	return nil, fmt.Errorf("%s has no IPv4 address", host)
 }
@@ -0,0 +1,288 @@
+// Package doctor runs the connectivity checks behind 'warpdrop doctor':
+// resolving the server, reaching it, discovering the NAT and allocating on
+// the TURN servers.
+package doctor
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/config"
+	"github.com/BioHazard786/Warpdrop/cli/internal/dns"
+	"github.com/BioHazard786/Warpdrop/cli/internal/signaling"
+	"github.com/BioHazard786/Warpdrop/cli/internal/transfer"
+	"github.com/BioHazard786/Warpdrop/cli/internal/utils"
+	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4"
+)
+
+// Status is the outcome of a check
+type Status int
+
+const (
+	Pass Status = iota
+	Warn
+	Fail
+)
+
+// Check is one line of the report
+type Check struct {
+	Name   string
+	Status Status
+	Detail string
+}
+
+// checkTimeout bounds each network check
+const checkTimeout = 5 * time.Second
+
+// healthReply is what the signaling server's /health endpoint answers
+const healthReply = "Signaling server is healthy."
+
+// Run runs every check against cfg, calling report as each one finishes
+func Run(cfg *config.Config, report func(Check)) []Check {
+	var checks []Check
+	add := func(c Check) {
+		checks = append(checks, c)
+		report(c)
+	}
+
+	add(checkDNS(cfg))
+	add(checkHealth(cfg))
+	add(checkWebSocket(cfg))
+	for _, c := range checkSTUN(cfg) {
+		add(c)
+	}
+	add(checkVPN(cfg))
+	for _, c := range checkTURN(cfg) {
+		add(c)
+	}
+	return checks
+}
+
+// serverHost returns the host the WebSocket URL points at
+func serverHost(cfg *config.Config) string {
+	u, err := url.Parse(cfg.WebSocketURL)
+	if err != nil {
+		return cfg.Domain
+	}
+	return u.Hostname()
+}
+
+func checkDNS(cfg *config.Config) Check {
+	c := Check{Name: "DNS"}
+	host := serverHost(cfg)
+	ips, source, err := dns.LookupSource(host)
+	switch {
+	case err != nil:
+		c.Status, c.Detail = Fail, fmt.Sprintf("could not resolve %s: %v", host, err)
+	case source == "":
+		c.Status, c.Detail = Pass, fmt.Sprintf("%s is an IP address", host)
+	case source == dns.SystemResolver:
+		c.Status, c.Detail = Pass, fmt.Sprintf("%s → %s (system resolver)", host, strings.Join(ips, ", "))
+	default:
+		c.Status, c.Detail = Warn, fmt.Sprintf("%s → %s (system resolver failed, answered by %s)", host, strings.Join(ips, ", "), source)
+	}
+	return c
+}
+
+// checkHealth asks the server's /health endpoint, next to /ws. Proxies in
+// front of the server don't always route it, so a failure only warns.
+func checkHealth(cfg *config.Config) Check {
+	c := Check{Name: "Health endpoint"}
+	u, err := url.Parse(cfg.WebSocketURL)
+	if err != nil {
+		c.Status, c.Detail = Fail, err.Error()
+		return c
+	}
+	u.Scheme = strings.Replace(u.Scheme, "ws", "http", 1)
+	u.Path = strings.TrimSuffix(u.Path, "/ws") + "/health"
+
+	transport := &http.Transport{DialContext: dns.DialContext}
+	if cfg.Insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	client := &http.Client{Transport: transport, Timeout: checkTimeout}
+
+	resp, err := client.Get(u.String())
+	if err != nil {
+		c.Status, c.Detail = Warn, fmt.Sprintf("%s: %v", u, err)
+		return c
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+
+	if resp.StatusCode == http.StatusOK && strings.TrimSpace(string(body)) == healthReply {
+		c.Status, c.Detail = Pass, u.String()
+	} else {
+		c.Status, c.Detail = Warn, fmt.Sprintf("%s answered %s, not the signaling server's health reply", u, resp.Status)
+	}
+	return c
+}
+
+func checkWebSocket(cfg *config.Config) Check {
+	c := Check{Name: "Signaling server"}
+	client := signaling.NewClient(cfg.WebSocketURL)
+	client.SetInsecure(cfg.Insecure)
+
+	start := time.Now()
+	if err := client.Connect(); err != nil {
+		c.Status, c.Detail = Fail, fmt.Sprintf("%s: %v", cfg.WebSocketURL, err)
+		return c
+	}
+	client.Close()
+
+	c.Status, c.Detail = Pass, fmt.Sprintf("%s connected in %s", cfg.WebSocketURL, time.Since(start).Round(time.Millisecond))
+	return c
+}
+
+// checkSTUN reports this machine's public address and NAT type
+func checkSTUN(cfg *config.Config) []Check {
+	external := Check{Name: "External address"}
+	probe := transfer.ProbeNAT(cfg.GetSTUNServers(), checkTimeout)
+	if probe.External == nil {
+		external.Status, external.Detail = Fail, fmt.Sprintf("no STUN server answered (%v); UDP may be blocked, try --tcp --relay", probe.Err)
+		return []Check{external}
+	}
+	external.Status, external.Detail = Pass, probe.External.String()
+
+	nat := Check{Name: "NAT type"}
+	switch probe.Type {
+	case transfer.NATOpen:
+		nat.Status, nat.Detail = Pass, "none, this machine has a public address"
+	case transfer.NATCone:
+		nat.Status, nat.Detail = Pass, "endpoint-independent (cone), direct connections should work"
+	case transfer.NATSymmetric:
+		nat.Status, nat.Detail = Warn, "symmetric, direct connections often fail and need a TURN relay"
+	default:
+		nat.Status, nat.Detail = Warn, fmt.Sprintf("unknown, only one STUN server answered (%v)", probe.Err)
+	}
+	return []Check{external, nat}
+}
+
+// checkVPN reports the VPN and CGNAT heuristic that makes transfers go
+// through TURN
+func checkVPN(cfg *config.Config) Check {
+	c := Check{Name: "VPN / CGNAT"}
+	switch {
+	case !utils.ShouldForceRelay():
+		c.Status, c.Detail = Pass, "none detected"
+	case cfg.GetTURNServers() == nil:
+		c.Status, c.Detail = Warn, "detected, and with no TURN server configured direct connections may fail"
+	default:
+		c.Status, c.Detail = Warn, "detected, transfers will be relayed through TURN"
+	}
+	return c
+}
+
+// checkTURN allocates a relay on each TURN server, which proves it is
+// reachable and takes the configured credentials
+func checkTURN(cfg *config.Config) []Check {
+	servers := cfg.GetTURNServers()
+	if servers == nil {
+		detail := "none configured, peers behind strict NATs or firewalls can't connect"
+		if cfg.NoTURN {
+			detail = "disabled by --no-turn"
+		}
+		return []Check{{Name: "TURN", Status: Warn, Detail: detail}}
+	}
+
+	username, password := cfg.GetTURNCredentials()
+	checks := make([]Check, 0, len(servers))
+	for _, server := range servers {
+		c := Check{Name: "TURN " + server}
+		relayed, err := withTimeout(func() (net.Addr, error) { return allocate(server, username, password) })
+		if err != nil {
+			c.Status, c.Detail = Fail, err.Error()
+		} else {
+			c.Status, c.Detail = Pass, "allocated relay "+relayed.String()
+		}
+		checks = append(checks, c)
+	}
+	return checks
+}
+
+// allocate requests a relay from a TURN server and releases it again
+func allocate(raw, username, password string) (net.Addr, error) {
+	uri, err := stun.ParseURI(raw)
+	if err != nil {
+		return nil, err
+	}
+	ip, err := dns.LookupIPv4(uri.Host)
+	if err != nil {
+		return nil, err
+	}
+	addr := net.JoinHostPort(ip.String(), fmt.Sprint(uri.Port))
+
+	// TCP and TLS servers carry STUN framed over the stream
+	var conn net.PacketConn
+	switch {
+	case uri.Scheme == stun.SchemeTypeTURNS:
+		tlsConn, err := tls.DialWithDialer(&net.Dialer{Timeout: checkTimeout}, "tcp", addr, &tls.Config{ServerName: uri.Host})
+		if err != nil {
+			return nil, err
+		}
+		conn = turn.NewSTUNConn(tlsConn)
+	case uri.Proto == stun.ProtoTypeTCP:
+		tcpConn, err := net.DialTimeout("tcp", addr, checkTimeout)
+		if err != nil {
+			return nil, err
+		}
+		conn = turn.NewSTUNConn(tcpConn)
+	default:
+		if conn, err = net.ListenPacket("udp4", "0.0.0.0:0"); err != nil {
+			return nil, err
+		}
+	}
+	defer conn.Close()
+
+	client, err := turn.NewClient(&turn.ClientConfig{
+		STUNServerAddr: addr,
+		TURNServerAddr: addr,
+		Username:       username,
+		Password:       password,
+		Conn:           conn,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	if err := client.Listen(); err != nil {
+		return nil, err
+	}
+
+	// The server answered, so a refusal is most likely the credentials
+	relay, err := client.Allocate()
+	if err != nil {
+		return nil, fmt.Errorf("allocation refused, check the TURN username and password (%w)", err)
+	}
+	relayed := relay.LocalAddr()
+	relay.Close()
+	return relayed, nil
+}
+
+// withTimeout gives up on fn after checkTimeout. fn keeps running in the
+// background until its own retries run out.
+func withTimeout(fn func() (net.Addr, error)) (net.Addr, error) {
+	type result struct {
+		addr net.Addr
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		addr, err := fn()
+		done <- result{addr, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.addr, r.err
+	case <-time.After(checkTimeout):
+		return nil, fmt.Errorf("no answer within %s", checkTimeout)
+	}
+}
@@ -0,0 +1,313 @@
+// Package engine runs transfers without any terminal UI of its own. The
+// cmd package wraps it with spinners and prompts, and pkg/warpdrop exposes
+// it to programs embedding WarpDrop.
+package engine
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/config"
+	"github.com/BioHazard786/Warpdrop/cli/internal/files"
+	"github.com/BioHazard786/Warpdrop/cli/internal/signaling"
+	"github.com/BioHazard786/Warpdrop/cli/internal/transfer"
+	"github.com/BioHazard786/Warpdrop/cli/internal/webrtc"
+	"github.com/BioHazard786/Warpdrop/cli/internal/webrtc/multichannel"
+	"github.com/BioHazard786/Warpdrop/cli/internal/webrtc/serverrelay"
+	"github.com/BioHazard786/Warpdrop/cli/internal/webrtc/singlechannel"
+)
+
+// Sender and Receiver are the two ends of a transfer over either protocol
+type Sender interface {
+	SetProgressUI()
+	SetOptions(opts *transfer.TransferOptions)
+	Start(ctx context.Context) error
+	Transfer(ctx context.Context) error
+	Close() error
+}
+
+type Receiver interface {
+	SetProgressUI()
+	SetOptions(opts *transfer.TransferOptions)
+	Start(ctx context.Context) error
+	Transfer(ctx context.Context) error
+	Close() error
+}
+
+// Connection is a signaling server connection and, once one has joined, the
+// peer on the other side of the room
+type Connection struct {
+	Client   signaling.Transport
+	Handler  *signaling.Handler
+	Config   *config.Config
+	PeerInfo *signaling.PeerInfo
+
+	// ResumeToken is sent with join_room when the receiver has partial
+	// files to resume; see transfer.ResumeState.Token
+	ResumeToken string
+
+	// Protocols, when set, are offered instead of every supported
+	// protocol, such as by a bench over a single unordered channel
+	Protocols []webrtc.ProtocolType
+}
+
+// Retry policy for reaching the signaling server
+const (
+	ConnectAttempts  = 5
+	connectBaseDelay = 500 * time.Millisecond
+)
+
+// Connect connects to the signaling server, retrying with backoff while it
+// is unreachable. onRetry, if set, is called before each retry.
+func Connect(cfg *config.Config, onRetry func(attempt int, delay time.Duration, err error)) (*Connection, error) {
+	client, err := Dial(cfg, onRetry)
+	if err != nil {
+		return nil, err
+	}
+	return NewConnection(client, cfg), nil
+}
+
+// Dial opens the websocket to the signaling server that Connect wraps
+func Dial(cfg *config.Config, onRetry func(attempt int, delay time.Duration, err error)) (*signaling.Client, error) {
+	client := signaling.NewClient(cfg.WebSocketURL)
+	client.SetInsecure(cfg.Insecure)
+	client.SetReconnects(cfg.Reconnects)
+	if onRetry != nil {
+		client.OnRetry(onRetry)
+	}
+	if err := client.ConnectWithRetry(ConnectAttempts, connectBaseDelay); err != nil {
+		return nil, transfer.NewError("connect to server", err)
+	}
+	return client, nil
+}
+
+// NewConnection starts routing the messages arriving on t, a connected
+// Client or one end of a signaling.Pipe, which lets both ends of a
+// transfer run in one process without a server
+func NewConnection(t signaling.Transport, cfg *config.Config) *Connection {
+	handler := signaling.NewHandler(t)
+	go handler.Start()
+
+	return &Connection{
+		Client:  t,
+		Handler: handler,
+		Config:  cfg,
+	}
+}
+
+func (c *Connection) Close() {
+	if c.Handler != nil {
+		c.Handler.Close()
+	}
+	if c.Client != nil {
+		c.Client.Close()
+	}
+}
+
+// CreateRoom returns the new room's ID and the short code requested by
+// codeMode, if any
+func (c *Connection) CreateRoom(ctx context.Context, codeMode string) (string, string, error) {
+	c.Client.SendMessage(&signaling.Message{
+		Type:       signaling.MessageTypeCreateRoom,
+		ClientType: "cli",
+		CodeMode:   codeMode,
+		Protocols:  webrtc.ProtocolNames(c.protocols()),
+	})
+
+	select {
+	case created := <-c.Handler.RoomCreated:
+		c.useServerTURN()
+		return created.RoomID, created.ShortCode, nil
+	case errMsg := <-c.Handler.Error:
+		return "", "", transfer.WrapError("create room", transfer.ErrSignalingError, errMsg)
+	case <-ctx.Done():
+		return "", "", transfer.NewError("create room", ctx.Err())
+	}
+}
+
+// WaitForPeer blocks until a receiver joins the room and records it as the
+// connection's peer. It gives up after timeout, or never when it is zero.
+func (c *Connection) WaitForPeer(ctx context.Context, timeout time.Duration) (*signaling.PeerInfo, error) {
+	select {
+	case peerInfo := <-c.Handler.PeerJoined:
+		c.PeerInfo = peerInfo
+		return peerInfo, nil
+	case errMsg := <-c.Handler.Error:
+		return nil, transfer.WrapError("wait for peer", transfer.ErrSignalingError, errMsg)
+	case <-transfer.StallTimer(timeout):
+		return nil, transfer.WrapError("wait for peer", transfer.ErrTimeout, fmt.Sprintf("no receiver joined within %s", timeout))
+	case <-ctx.Done():
+		return nil, transfer.NewError("wait for peer", ctx.Err())
+	}
+}
+
+// JoinRoom joins roomID and records the sender as the connection's peer
+func (c *Connection) JoinRoom(ctx context.Context, roomID string) (*signaling.PeerInfo, error) {
+	c.Client.SendMessage(&signaling.Message{
+		Type:        signaling.MessageTypeJoinRoom,
+		RoomID:      roomID,
+		ClientType:  "cli",
+		ResumeToken: c.ResumeToken,
+		Protocols:   webrtc.ProtocolNames(c.protocols()),
+	})
+
+	select {
+	case peerInfo := <-c.Handler.JoinSuccess:
+		c.PeerInfo = peerInfo
+		c.useServerTURN()
+		return peerInfo, nil
+	case errMsg := <-c.Handler.Error:
+		if strings.EqualFold(errMsg, "room not found") {
+			if suggestion := transfer.SuggestRoomID(roomID); suggestion != "" {
+				errMsg += ". Did you mean " + suggestion + "?"
+			}
+		}
+		return nil, transfer.WrapError("join room", transfer.ErrSignalingError, errMsg)
+	case <-ctx.Done():
+		return nil, transfer.NewError("join room", ctx.Err())
+	}
+}
+
+// useServerTURN prefers TURN credentials the server issued with the room
+// over the built-in defaults
+func (c *Connection) useServerTURN() {
+	if creds := c.Handler.TURNCredentials(); creds != nil {
+		c.Config.UseServerTURN(creds.URLs, creds.Username, creds.Credential)
+	}
+}
+
+// protocols are the protocols this side offers. --via-server offers only
+// the server relay, which every other protocol outranks.
+func (c *Connection) protocols() []webrtc.ProtocolType {
+	if c.Config.ViaServer {
+		return []webrtc.ProtocolType{webrtc.ServerRelayProtocol}
+	}
+	if c.Protocols != nil {
+		return c.Protocols
+	}
+	return webrtc.SupportedProtocols
+}
+
+// protocol picks the protocol for the joined peer, the most preferred one
+// both sides support. Only single-channel receivers resume partial files,
+// so a resume both sides know about uses it even between CLIs, unless
+// either side asked to go through the server.
+func (c *Connection) protocol() (webrtc.ProtocolType, error) {
+	remote := webrtc.PeerProtocols(c.PeerInfo.ClientType, c.PeerInfo.Protocols)
+	viaServer := c.Config.ViaServer || slices.Equal(remote, []webrtc.ProtocolType{webrtc.ServerRelayProtocol})
+	if c.PeerInfo.ResumeToken != "" && !viaServer {
+		return webrtc.SingleChannelProtocol, nil
+	}
+
+	protocol, ok := webrtc.Negotiate(c.protocols(), remote)
+	if !ok {
+		return "", transfer.WrapError("select protocol", transfer.ErrNoCommonProtocol,
+			"peer offers "+strings.Join(c.PeerInfo.Protocols, ", "))
+	}
+	return protocol, nil
+}
+
+// NewSender creates a sender for the protocol the joined peer speaks. A
+// multichannel send falls back to a single channel once if the file
+// channels never open.
+func (c *Connection) NewSender(fileInfos []*files.FileInfo) (Sender, error) {
+	protocol, err := c.protocol()
+	if err != nil {
+		return nil, err
+	}
+
+	switch protocol {
+	case webrtc.MultiChannelProtocol:
+		session, err := multichannel.NewSenderSession(c.Client, c.Handler, c.Config, fileInfos, c.PeerInfo)
+		if err != nil {
+			return nil, err
+		}
+		return &fallbackSender{Sender: session, conn: c, fileInfos: fileInfos}, nil
+	case webrtc.SingleChannelProtocol:
+		return singlechannel.NewSenderSession(c.Client, c.Handler, c.Config, fileInfos, c.PeerInfo)
+	case webrtc.ServerRelayProtocol:
+		return serverrelay.NewSenderSession(c.Client, c.Handler, c.Config, fileInfos, c.PeerInfo), nil
+	default:
+		return nil, fmt.Errorf("unsupported protocol: %s", protocol)
+	}
+}
+
+// NewReceiver creates a receiver for the protocol the sender speaks
+func (c *Connection) NewReceiver() (Receiver, error) {
+	protocol, err := c.protocol()
+	if err != nil {
+		return nil, err
+	}
+
+	switch protocol {
+	case webrtc.MultiChannelProtocol:
+		session, err := multichannel.NewReceiverSession(c.Client, c.Handler, c.Config, c.PeerInfo)
+		if err != nil {
+			return nil, err
+		}
+		return &fallbackReceiver{Receiver: session, conn: c}, nil
+	case webrtc.SingleChannelProtocol:
+		return singlechannel.NewReceiverSession(c.Client, c.Handler, c.Config, c.PeerInfo)
+	case webrtc.ServerRelayProtocol:
+		return serverrelay.NewReceiverSession(c.Client, c.Handler, c.Config, c.PeerInfo), nil
+	default:
+		return nil, fmt.Errorf("unsupported protocol: %s", protocol)
+	}
+}
+
+// RunSender connects to the peer and runs the transfer. Cancelling ctx
+// stops it and tells the receiver instead of dropping the connection.
+// A transfer that otherwise succeeded fails with Close's error, such as
+// ErrNoFinalAck when the receiver never confirmed it has every file.
+func RunSender(ctx context.Context, session Sender, opts *transfer.TransferOptions) (err error) {
+	defer closeSession(session, &err)
+
+	// Options pick where progress is reported
+	if opts != nil {
+		session.SetOptions(opts)
+	}
+	session.SetProgressUI()
+
+	if err := session.Start(ctx); err != nil {
+		return transfer.NewError("start connection", err)
+	}
+
+	if err := session.Transfer(ctx); err != nil {
+		return transfer.NewError("transfer files", err)
+	}
+
+	return nil
+}
+
+// RunReceiver is the receiving counterpart of RunSender
+func RunReceiver(ctx context.Context, session Receiver, opts *transfer.TransferOptions) (err error) {
+	defer closeSession(session, &err)
+
+	// Options are needed during Start to answer a password challenge
+	if opts != nil {
+		session.SetOptions(opts)
+	}
+
+	if err := session.Start(ctx); err != nil {
+		return transfer.NewError("start connection", err)
+	}
+
+	session.SetProgressUI()
+
+	if err := session.Transfer(ctx); err != nil {
+		return transfer.NewError("receive files", err)
+	}
+
+	return nil
+}
+
+// closeSession closes session, reporting its error in *err unless the
+// session already failed
+func closeSession(session interface{ Close() error }, err *error) {
+	if closeErr := session.Close(); closeErr != nil && *err == nil {
+		*err = transfer.NewError("close connection", closeErr)
+	}
+}
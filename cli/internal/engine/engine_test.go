@@ -0,0 +1,39 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/config"
+	"github.com/BioHazard786/Warpdrop/cli/internal/signaling"
+	"github.com/BioHazard786/Warpdrop/cli/internal/transfer"
+	"github.com/BioHazard786/Warpdrop/cli/internal/webrtc"
+)
+
+func TestConnectionProtocol(t *testing.T) {
+	tests := []struct {
+		name      string
+		viaServer bool
+		peer      signaling.PeerInfo
+		want      webrtc.ProtocolType
+		err       error
+	}{
+		{"new CLI", false, signaling.PeerInfo{ClientType: "cli", Protocols: []string{"multi-channel", "single-channel", "server-relay"}}, webrtc.MultiChannelProtocol, nil},
+		{"older CLI", false, signaling.PeerInfo{ClientType: "cli"}, webrtc.MultiChannelProtocol, nil},
+		{"web peer", false, signaling.PeerInfo{ClientType: "web"}, webrtc.SingleChannelProtocol, nil},
+		{"resume", false, signaling.PeerInfo{ClientType: "cli", ResumeToken: "token"}, webrtc.SingleChannelProtocol, nil},
+		{"peer via server", false, signaling.PeerInfo{ClientType: "cli", Protocols: []string{"server-relay"}}, webrtc.ServerRelayProtocol, nil},
+		{"resume via server", true, signaling.PeerInfo{ClientType: "cli", ResumeToken: "token", Protocols: []string{"multi-channel", "single-channel", "server-relay"}}, webrtc.ServerRelayProtocol, nil},
+		{"via server with an older CLI", true, signaling.PeerInfo{ClientType: "cli"}, "", transfer.ErrNoCommonProtocol},
+		{"via server with a web peer", true, signaling.PeerInfo{ClientType: "web"}, "", transfer.ErrNoCommonProtocol},
+		{"unknown protocols", false, signaling.PeerInfo{ClientType: "cli", Protocols: []string{"quantum-tunnel"}}, "", transfer.ErrNoCommonProtocol},
+	}
+	for _, tt := range tests {
+		peer := tt.peer
+		conn := &Connection{Config: &config.Config{ViaServer: tt.viaServer}, PeerInfo: &peer}
+		got, err := conn.protocol()
+		if got != tt.want || !errors.Is(err, tt.err) || (err != nil) != (tt.err != nil) {
+			t.Errorf("%s: got %q, %v, want %q, %v", tt.name, got, err, tt.want, tt.err)
+		}
+	}
+}
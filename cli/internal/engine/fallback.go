@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/files"
+	"github.com/BioHazard786/Warpdrop/cli/internal/signaling"
+	"github.com/BioHazard786/Warpdrop/cli/internal/transfer"
+	"github.com/BioHazard786/Warpdrop/cli/internal/webrtc/singlechannel"
+)
+
+// fallbackReady is the relay a receiver sends once its multichannel
+// session is closed, so the sender's next offer can't reach it
+const fallbackReady = "fallback_ready"
+
+type relayMessage struct {
+	Type string `json:"type"`
+}
+
+// fallbackSender runs a multichannel send and, when the receiver's file
+// channels never open, runs it again over a single channel on a fresh peer
+// connection. The single-channel session never falls back, so it happens
+// at most once.
+type fallbackSender struct {
+	Sender
+	conn      *Connection
+	fileInfos []*files.FileInfo
+	opts      *transfer.TransferOptions
+}
+
+func (s *fallbackSender) SetOptions(opts *transfer.TransferOptions) {
+	s.opts = opts
+	s.Sender.SetOptions(opts)
+}
+
+func (s *fallbackSender) Transfer(ctx context.Context) error {
+	err := s.Sender.Transfer(ctx)
+	if !errors.Is(err, transfer.ErrFallback) {
+		return err
+	}
+
+	// The receiver's old session would answer an offer sent any sooner
+	if err := s.conn.awaitFallbackReady(ctx); err != nil {
+		return err
+	}
+	s.Sender.Close()
+
+	session, err := singlechannel.NewSenderSession(s.conn.Client, s.conn.Handler, s.conn.Config, s.fileInfos, s.conn.PeerInfo)
+	if err != nil {
+		return err
+	}
+	s.Sender = session
+
+	if s.opts != nil {
+		session.SetOptions(s.opts)
+	}
+	session.SetProgressUI()
+	if err := session.Start(ctx); err != nil {
+		return transfer.NewError("start connection", err)
+	}
+	return session.Transfer(ctx)
+}
+
+// fallbackReceiver is the receiving counterpart of fallbackSender
+type fallbackReceiver struct {
+	Receiver
+	conn *Connection
+	opts *transfer.TransferOptions
+}
+
+func (r *fallbackReceiver) SetOptions(opts *transfer.TransferOptions) {
+	r.opts = opts
+	r.Receiver.SetOptions(opts)
+}
+
+func (r *fallbackReceiver) Transfer(ctx context.Context) error {
+	err := r.Receiver.Transfer(ctx)
+	if !errors.Is(err, transfer.ErrFallback) {
+		return err
+	}
+	r.Receiver.Close()
+
+	session, err := singlechannel.NewReceiverSession(r.conn.Client, r.conn.Handler, r.conn.Config, r.conn.PeerInfo)
+	if err != nil {
+		return err
+	}
+	r.Receiver = session
+
+	// The offer was already accepted, so it isn't asked about again
+	var roomID string
+	if r.opts != nil {
+		opts := *r.opts
+		opts.AutoAccept = true
+		session.SetOptions(&opts)
+		roomID = opts.RoomID
+	}
+	if err := signaling.SendRelay(r.conn.Client, roomID, relayMessage{Type: fallbackReady}); err != nil {
+		return transfer.NewError("fall back", err)
+	}
+
+	if err := session.Start(ctx); err != nil {
+		return transfer.NewError("start connection", err)
+	}
+	session.SetProgressUI()
+	return session.Transfer(ctx)
+}
+
+// awaitFallbackReady waits for the receiver to say it is ready for a new
+// peer connection
+func (c *Connection) awaitFallbackReady(ctx context.Context) error {
+	timeout := time.After(time.Duration(transfer.SignalTimeout) * time.Second)
+	for {
+		select {
+		case raw, ok := <-c.Handler.Relay:
+			if !ok {
+				return transfer.ErrSignalingError
+			}
+			var msg relayMessage
+			if json.Unmarshal(raw, &msg) == nil && msg.Type == fallbackReady {
+				return nil
+			}
+		case <-c.Handler.PeerLeft:
+			return transfer.ErrPeerDisconnected
+		case <-ctx.Done():
+			return transfer.ErrTransferCancelled
+		case <-timeout:
+			return transfer.WrapError("fall back", transfer.ErrTimeout, "receiver did not start over")
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/config"
+	"github.com/BioHazard786/Warpdrop/cli/internal/files"
+	"github.com/BioHazard786/Warpdrop/cli/internal/signaling"
+	"github.com/BioHazard786/Warpdrop/cli/internal/transfer"
+	"github.com/BioHazard786/Warpdrop/cli/internal/ui"
+	"github.com/BioHazard786/Warpdrop/cli/internal/webrtc"
+)
+
+// testConfig loads a config that connects over loopback only, without the
+// user's config file
+func testConfig(t *testing.T, viaServer bool) *config.Config {
+	t.Helper()
+	cfg, err := config.Load(config.Options{Server: "ws://localhost/ws", NoTURN: true, ViaServer: viaServer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.STUNServers = nil
+	return cfg
+}
+
+// writeTestFiles fills dir with files of assorted sizes, some in a folder
+func writeTestFiles(t *testing.T, dir string) {
+	t.Helper()
+	sizes := map[string]int{
+		"small.txt":            5,
+		"chunks.bin":           3*64*1024 + 17,
+		"folder/nested.bin":    200 * 1024,
+		"folder/deeper/a.bin":  1,
+		"folder/deeper/b.bin":  1024*1024 + 3,
+		"folder/another.bin":   64 * 1024,
+		"folder/deeper/zz.bin": 4096,
+	}
+	for name, size := range sizes {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		data := make([]byte, size)
+		rand.Read(data)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// assertSameFiles checks every file under want has an identical copy under got
+func assertSameFiles(t *testing.T, want, got string) {
+	t.Helper()
+	count := 0
+	filepath.WalkDir(want, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(want, path)
+		expected, _ := os.ReadFile(path)
+		actual, err := os.ReadFile(filepath.Join(got, rel))
+		if err != nil {
+			t.Errorf("%s not received: %v", rel, err)
+		} else if !bytes.Equal(expected, actual) {
+			t.Errorf("%s received with %d bytes, want %d intact", rel, len(actual), len(expected))
+		}
+		count++
+		return nil
+	})
+	if count == 0 {
+		t.Fatal("no files to compare")
+	}
+}
+
+// TestTransferOverPipe runs a sender and a receiver in one process, joined
+// by a signaling pipe instead of a server, with each protocol
+func TestTransferOverPipe(t *testing.T) {
+	tests := []struct {
+		name        string
+		viaServer   bool
+		resumeToken string
+		want        webrtc.ProtocolType
+	}{
+		{"multichannel", false, "", webrtc.MultiChannelProtocol},
+		// A receiver with partial files to resume gets a single channel
+		{"singlechannel", false, "resume", webrtc.SingleChannelProtocol},
+		{"server relay", true, "", webrtc.ServerRelayProtocol},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := t.TempDir()
+			t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "config"))
+			t.Setenv("XDG_DATA_HOME", filepath.Join(home, "data"))
+
+			src := filepath.Join(t.TempDir(), "in")
+			writeTestFiles(t, src)
+			out := t.TempDir()
+
+			fileInfos, err := files.ValidateFiles([]string{src})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ptrs := make([]*files.FileInfo, len(fileInfos))
+			for i := range fileInfos {
+				ptrs[i] = &fileInfos[i]
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+			defer cancel()
+
+			sendEnd, recvEnd := signaling.NewPipe()
+			sender := NewConnection(sendEnd, testConfig(t, tt.viaServer))
+			receiver := NewConnection(recvEnd, testConfig(t, tt.viaServer))
+			defer sender.Close()
+			defer receiver.Close()
+
+			roomID, _, err := sender.CreateRoom(ctx, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			received := make(chan error, 1)
+			go func() {
+				defer receiver.Close()
+				receiver.ResumeToken = tt.resumeToken
+				if _, err := receiver.JoinRoom(ctx, roomID); err != nil {
+					received <- err
+					return
+				}
+				session, err := receiver.NewReceiver()
+				if err != nil {
+					received <- err
+					return
+				}
+				received <- RunReceiver(ctx, session, &transfer.TransferOptions{
+					OutputDir:  out,
+					AutoAccept: true,
+					Verify:     true,
+					RoomID:     roomID,
+					Reporter:   ui.NewReporter(nil),
+				})
+			}()
+
+			if _, err := sender.WaitForPeer(ctx, 0); err != nil {
+				t.Fatal(err)
+			}
+			if protocol, err := sender.protocol(); err != nil || protocol != tt.want {
+				t.Fatalf("negotiated %q, %v, want %q", protocol, err, tt.want)
+			}
+			session, err := sender.NewSender(ptrs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sendErr := RunSender(ctx, session, &transfer.TransferOptions{
+				RoomID:   roomID,
+				Reporter: ui.NewReporter(nil),
+			})
+
+			if err := <-received; err != nil {
+				t.Fatalf("receive: %v", err)
+			}
+			if sendErr != nil {
+				t.Fatalf("send: %v", sendErr)
+			}
+			assertSameFiles(t, src, filepath.Join(out, "in"))
+		})
+	}
+}
+
+// TestBenchOverPipe sends a synthetic file to a receiver that throws it
+// away, offering only the protocols a bench asks for
+func TestBenchOverPipe(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "config"))
+	t.Setenv("XDG_DATA_HOME", filepath.Join(home, "data"))
+	out := t.TempDir()
+	t.Chdir(out)
+
+	info, err := files.NewSyntheticFile("bench.bin", 3*1024*1024+5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	sendEnd, recvEnd := signaling.NewPipe()
+	sender := NewConnection(sendEnd, testConfig(t, false))
+	receiver := NewConnection(recvEnd, testConfig(t, false))
+	defer sender.Close()
+	defer receiver.Close()
+	sender.Protocols = []webrtc.ProtocolType{webrtc.SingleChannelProtocol}
+
+	roomID, _, err := sender.CreateRoom(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(chan error, 1)
+	go func() {
+		defer receiver.Close()
+		if _, err := receiver.JoinRoom(ctx, roomID); err != nil {
+			received <- err
+			return
+		}
+		session, err := receiver.NewReceiver()
+		if err != nil {
+			received <- err
+			return
+		}
+		received <- RunReceiver(ctx, session, &transfer.TransferOptions{
+			AutoAccept: true,
+			Verify:     true,
+			RoomID:     roomID,
+			Bench:      true,
+			Reporter:   ui.NewReporter(nil),
+		})
+	}()
+
+	if _, err := sender.WaitForPeer(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if protocol, err := sender.protocol(); err != nil || protocol != webrtc.SingleChannelProtocol {
+		t.Fatalf("negotiated %q, %v, want %q", protocol, err, webrtc.SingleChannelProtocol)
+	}
+	session, err := sender.NewSender([]*files.FileInfo{&info})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := &transfer.StatsRecorder{}
+	sendErr := RunSender(ctx, session, &transfer.TransferOptions{
+		RoomID:   roomID,
+		Bench:    true,
+		Stats:    stats,
+		Reporter: ui.NewReporter(nil),
+	})
+
+	if err := <-received; err != nil {
+		t.Fatalf("receive: %v", err)
+	}
+	if sendErr != nil {
+		t.Fatalf("send: %v", sendErr)
+	}
+	if samples := stats.Samples(); len(samples) == 0 || samples[len(samples)-1].Bytes != info.Size {
+		t.Errorf("stats recorded %v, want samples up to %d bytes", samples, info.Size)
+	}
+	if entries, _ := os.ReadDir(out); len(entries) != 0 {
+		t.Errorf("bench left %d files in the working directory", len(entries))
+	}
+	if _, err := os.Stat(filepath.Join(home, "data")); err == nil {
+		t.Error("bench wrote to the data directory")
+	}
+}
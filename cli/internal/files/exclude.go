@@ -0,0 +1,147 @@
+package files
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFileName is the file in the root of a directory being sent that
+// lists patterns to leave out, one per line in .gitignore style
+const IgnoreFileName = ".warpdropignore"
+
+// excludePattern is one parsed gitignore-style pattern
+type excludePattern struct {
+	// segments are matched against the slash-separated path relative to the
+	// directory being sent; "**" matches any number of segments
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+// Excluder decides which entries of a directory walk are left out. Later
+// patterns win, so a "!" pattern can bring back what an earlier one
+// excluded, but not files inside an excluded directory.
+type Excluder struct {
+	patterns []excludePattern
+}
+
+// NewExcluder parses patterns in .gitignore style: a pattern without a "/"
+// matches a name at any depth, one with a "/" matches from the root, a
+// trailing "/" matches only directories and a leading "!" negates it.
+func NewExcluder(patterns []string) (*Excluder, error) {
+	e := &Excluder{}
+	for _, p := range patterns {
+		if err := e.add(p); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// add parses one pattern; blank lines and "#" comments are ignored
+func (e *Excluder) add(line string) error {
+	p := strings.TrimSpace(line)
+	if p == "" || strings.HasPrefix(p, "#") {
+		return nil
+	}
+
+	var pattern excludePattern
+	p, pattern.negate = strings.CutPrefix(p, "!")
+	p, pattern.dirOnly = strings.CutSuffix(p, "/")
+	anchored := strings.Contains(p, "/")
+	p = strings.TrimPrefix(p, "/")
+	if p == "" {
+		return fmt.Errorf("%q: empty exclude pattern", line)
+	}
+
+	pattern.segments = strings.Split(p, "/")
+	for _, seg := range pattern.segments {
+		if seg == "**" {
+			continue
+		}
+		if _, err := path.Match(seg, ""); err != nil {
+			return fmt.Errorf("%q: invalid exclude pattern: %w", line, err)
+		}
+	}
+	if !anchored {
+		pattern.segments = append([]string{"**"}, pattern.segments...)
+	}
+
+	e.patterns = append(e.patterns, pattern)
+	return nil
+}
+
+// withIgnoreFile returns an Excluder with the patterns of root's ignore
+// file added after e's own
+func (e *Excluder) withIgnoreFile(root string) (*Excluder, error) {
+	name := filepath.Join(root, IgnoreFileName)
+	f, err := os.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return e, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: cannot read ignore file: %w", name, err)
+	}
+	defer f.Close()
+
+	merged := &Excluder{patterns: append([]excludePattern(nil), e.patterns...)}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if err := merged.add(scanner.Text()); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: cannot read ignore file: %w", name, err)
+	}
+	return merged, nil
+}
+
+// Excluded reports whether the entry at rel, a slash-separated path relative
+// to the directory being sent, is left out
+func (e *Excluder) Excluded(rel string, isDir bool) bool {
+	if e == nil {
+		return false
+	}
+
+	excluded := false
+	parts := strings.Split(rel, "/")
+	for _, p := range e.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		if matchSegments(p.segments, parts) {
+			excluded = !p.negate
+		}
+	}
+	return excluded
+}
+
+// matchSegments matches path segments against pattern segments, with "**"
+// standing for zero or more segments
+func matchSegments(pattern, parts []string) bool {
+	if len(pattern) == 0 {
+		return len(parts) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(parts); i++ {
+			if matchSegments(pattern[1:], parts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], parts[1:])
+}
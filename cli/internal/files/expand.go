@@ -0,0 +1,115 @@
+package files
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ExpandPaths resolves send arguments into concrete paths. Arguments
+// starting with "@" name a file listing one path per line (blank lines and
+// lines starting with "#" are ignored). Glob patterns the shell left
+// unexpanded, such as a quoted '*.jpg', are matched with filepath.Glob. The
+// result has duplicates removed, keeping the first occurrence.
+func ExpandPaths(args []string) ([]string, error) {
+	var paths []string
+	var errors []string
+
+	for _, arg := range args {
+		candidates := []string{arg}
+		if listFile, ok := strings.CutPrefix(arg, "@"); ok {
+			lines, err := readFileList(listFile)
+			if err != nil {
+				errors = append(errors, err.Error())
+				continue
+			}
+			candidates = lines
+		}
+
+		for _, candidate := range candidates {
+			matches, err := expandGlob(candidate)
+			if err != nil {
+				errors = append(errors, err.Error())
+				continue
+			}
+			paths = append(paths, matches...)
+		}
+	}
+
+	if len(errors) > 0 {
+		return nil, fmt.Errorf("could not expand file arguments:\n  - %s", joinErrors(errors))
+	}
+
+	return dedupePaths(paths), nil
+}
+
+// readFileList returns the paths listed in an @file
+func readFileList(path string) ([]string, error) {
+	if path == "" {
+		return nil, fmt.Errorf("@: missing file list name")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("@%s: cannot read file list: %w", path, err)
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("@%s: cannot read file list: %w", path, err)
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("@%s: file list is empty", path)
+	}
+	return lines, nil
+}
+
+// expandGlob matches path as a glob pattern. Paths without pattern
+// characters, or that name an existing file verbatim, are returned as is so
+// ValidateFiles can report on them.
+func expandGlob(path string) ([]string, error) {
+	if !strings.ContainsAny(path, "*?[") {
+		return []string{path}, nil
+	}
+	if _, err := os.Lstat(path); err == nil {
+		return []string{path}, nil
+	}
+
+	matches, err := filepath.Glob(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid pattern: %w", path, err)
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("%s: pattern matched no files", path)
+	}
+	return matches, nil
+}
+
+// dedupePaths drops paths that resolve to a file already in the list
+func dedupePaths(paths []string) []string {
+	seen := make(map[string]bool, len(paths))
+	unique := make([]string, 0, len(paths))
+	for _, path := range paths {
+		key := filepath.Clean(path)
+		if abs, err := filepath.Abs(path); err == nil {
+			key = abs
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, path)
+	}
+	return unique
+}
@@ -0,0 +1,67 @@
+package files
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestSyntheticFile(t *testing.T) {
+	size := int64(2*syntheticBlockSize + 100)
+	info, err := NewSyntheticFile("bench.bin", size)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := info.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(data)) != size {
+		t.Fatalf("read %d bytes, want %d", len(data), size)
+	}
+
+	// Every open reads the same data, or a checksum would never match
+	again, err := info.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tail := make([]byte, 200)
+	n, err := again.ReadAt(tail, size-100)
+	if n != 100 || err != io.EOF {
+		t.Fatalf("ReadAt past the end = %d, %v, want 100, EOF", n, err)
+	}
+	if !bytes.Equal(tail[:n], data[size-100:]) {
+		t.Error("a second open read different data")
+	}
+}
+
+func TestSyntheticFileReadEOF(t *testing.T) {
+	info, err := NewSyntheticFile("bench.bin", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := info.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Like an os.File, the short read at the end returns no error
+	buf := make([]byte, 64)
+	if n, err := file.Read(buf); n != 10 || err != nil {
+		t.Fatalf("Read = %d, %v, want 10, nil", n, err)
+	}
+	if n, err := file.Read(buf); n != 0 || err != io.EOF {
+		t.Fatalf("Read at the end = %d, %v, want 0, EOF", n, err)
+	}
+}
+
+func TestNewSyntheticFileRejectsEmpty(t *testing.T) {
+	if _, err := NewSyntheticFile("bench.bin", 0); err == nil {
+		t.Error("empty synthetic file accepted")
+	}
+}
@@ -0,0 +1,72 @@
+package files
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/utils"
+)
+
+const (
+	// TextFileName is the name text is sent under unless another is given
+	TextFileName = "text.txt"
+
+	// MaxTextSize bounds text sent with NewTextFile, which is held in memory
+	MaxTextSize = 10 * 1024 * 1024
+)
+
+// File is an opened file being sent, on disk or in memory
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Closer
+}
+
+// Open opens the file for reading from the start
+func (f *FileInfo) Open() (File, error) {
+	if f.Synthetic {
+		return newSyntheticFile(f.Size)
+	}
+	if f.Content != nil {
+		return memoryFile{bytes.NewReader(f.Content)}, nil
+	}
+	return os.Open(f.Path)
+}
+
+// memoryFile is the File for Content
+type memoryFile struct {
+	*bytes.Reader
+}
+
+func (memoryFile) Close() error {
+	return nil
+}
+
+// NewTextFile makes an in-memory plain text file of text, named name or
+// TextFileName when name is empty
+func NewTextFile(text, name string) (FileInfo, error) {
+	if text == "" {
+		return FileInfo{}, fmt.Errorf("no text to send")
+	}
+	if len(text) > MaxTextSize {
+		return FileInfo{}, fmt.Errorf("text is larger than %s, send it as a file instead", utils.FormatSize(MaxTextSize))
+	}
+	if name == "" {
+		name = TextFileName
+	} else if err := ValidateName(name); err != nil {
+		return FileInfo{}, err
+	}
+
+	return FileInfo{
+		Name:       name,
+		Size:       int64(len(text)),
+		Type:       "text/plain; charset=utf-8",
+		IsReadable: true,
+		ModTime:    time.Now(),
+		Mode:       0644,
+		Content:    []byte(text),
+	}, nil
+}
@@ -2,10 +2,14 @@ package files
 
 import (
 	"fmt"
+	"io/fs"
 	"mime"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/utils"
 )
 
 // FileInfo holds information about a file to be sent
@@ -24,20 +28,98 @@ type FileInfo struct {
 
 	// IsReadable indicates if the file can be read
 	IsReadable bool
+
+	// RelPath is the slash-separated path of the file relative to the parent
+	// of a directory being sent (e.g. "project/src/main.go").
+	// Empty for files passed directly on the command line.
+	RelPath string
+
+	// ModTime and Mode are the file's modification time and permissions,
+	// which receivers may restore with --preserve
+	ModTime time.Time
+	Mode    os.FileMode
+
+	// Content holds the data of a file made in memory, such as the text
+	// from send --text, which has no Path
+	Content []byte
+
+	// Synthetic is set for Size bytes of random data made up as the file
+	// is read, such as the test data bench sends, which has no Path
+	Synthetic bool
+}
+
+// ValidateOptions controls which files ValidateFilesSkipped accepts
+type ValidateOptions struct {
+	// AllowEmpty keeps empty files instead of rejecting or skipping them
+	AllowEmpty bool
+
+	// Exclude lists patterns for entries inside directories to leave out,
+	// as in NewExcluder. A directory's IgnoreFileName adds to them.
+	Exclude []string
+
+	// Name, when set, is the name a single file given directly is offered
+	// under instead of its own. It must be a plain, safe filename.
+	Name string
+}
+
+// Skipped counts the entries inside directories that weren't sent
+type Skipped struct {
+	// Unsendable are symlinks, special files and empty files
+	Unsendable int
+
+	// EmptyDirs are folders with nothing in them. Only files are sent, so
+	// the receiver doesn't get them.
+	EmptyDirs int
+
+	// ExcludedFiles and ExcludedBytes count the files an exclude pattern
+	// matched. ExcludedDirs counts matched directories, which aren't
+	// walked, so their contents aren't counted.
+	ExcludedFiles int
+	ExcludedBytes int64
+	ExcludedDirs  int
+}
+
+// Excluded reports whether any exclude pattern matched
+func (s Skipped) Excluded() bool {
+	return s.ExcludedFiles > 0 || s.ExcludedDirs > 0
 }
 
 // ValidateFiles checks if all files exist and are readable
 // Returns a list of FileInfo for valid files and an error if any file is invalid
 func ValidateFiles(filePaths []string) ([]FileInfo, error) {
+	fileInfos, _, err := ValidateFilesSkipped(filePaths, ValidateOptions{})
+	return fileInfos, err
+}
+
+// ValidateFilesSkipped is ValidateFiles that also reports what was left out
+// of directories: symlinks, special and empty files, empty folders, and
+// entries matching the exclude patterns in opts.
+func ValidateFilesSkipped(filePaths []string, opts ValidateOptions) ([]FileInfo, Skipped, error) {
 	if len(filePaths) == 0 {
-		return nil, fmt.Errorf("no files specified")
+		return nil, Skipped{}, fmt.Errorf("no files specified")
+	}
+
+	excluder, err := NewExcluder(opts.Exclude)
+	if err != nil {
+		return nil, Skipped{}, err
 	}
 
 	var fileInfos []FileInfo
 	var errors []string
+	var skipped Skipped
 
 	for _, path := range filePaths {
-		fileInfo, err := validateSingleFile(path)
+		if stat, err := os.Stat(path); err == nil && stat.IsDir() {
+			dirInfos, err := walkDirectory(path, opts.AllowEmpty, excluder, &skipped)
+			if err != nil {
+				errors = append(errors, err.Error())
+				continue
+			}
+			fileInfos = append(fileInfos, dirInfos...)
+			continue
+		}
+
+		fileInfo, err := validateSingleFile(path, opts.AllowEmpty)
 		if err != nil {
 			errors = append(errors, err.Error())
 			continue
@@ -47,14 +129,49 @@ func ValidateFiles(filePaths []string) ([]FileInfo, error) {
 
 	// If any file validation failed, return all errors
 	if len(errors) > 0 {
-		return nil, fmt.Errorf("file validation failed:\n  - %s", joinErrors(errors))
+		return nil, Skipped{}, fmt.Errorf("file validation failed:\n  - %s", joinErrors(errors))
 	}
 
-	return fileInfos, nil
+	if opts.Name != "" {
+		if err := rename(fileInfos, opts.Name); err != nil {
+			return nil, Skipped{}, err
+		}
+	}
+
+	return fileInfos, skipped, nil
+}
+
+// rename offers the only file in fileInfos as name, keeping its path on
+// disk. The MIME type follows name's extension when it has a known one.
+func rename(fileInfos []FileInfo, name string) error {
+	if len(fileInfos) != 1 || fileInfos[0].RelPath != "" {
+		return fmt.Errorf("a name can only be given when sending exactly one file")
+	}
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+
+	fileInfos[0].Name = name
+	if mimeType := mime.TypeByExtension(filepath.Ext(name)); mimeType != "" {
+		fileInfos[0].Type = mimeType
+	}
+	return nil
+}
+
+// ValidateName checks that name is a plain filename a receiver would save
+// as is: no directories, control characters or surrounding spaces
+func ValidateName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("%q: name must be a filename without directories", name)
+	}
+	if name != utils.SanitizeFilename(name) {
+		return fmt.Errorf("%q: name contains characters that are not allowed in a filename", name)
+	}
+	return nil
 }
 
 // validateSingleFile checks a single file and returns its info
-func validateSingleFile(path string) (FileInfo, error) {
+func validateSingleFile(path string, allowEmpty bool) (FileInfo, error) {
 	// Get absolute path
 	absPath, err := filepath.Abs(path)
 	if err != nil {
@@ -70,14 +187,20 @@ func validateSingleFile(path string) (FileInfo, error) {
 		return FileInfo{}, fmt.Errorf("%s: failed to stat file: %w", path, err)
 	}
 
-	// Check if it's a directory
+	// Directories are expanded by WalkDirectory
 	if stat.IsDir() {
-		return FileInfo{}, fmt.Errorf("%s: is a directory (directories not yet supported)", path)
+		return FileInfo{}, fmt.Errorf("%s: is a directory", path)
+	}
+
+	// Pipes, sockets and devices have no size to announce up front, and
+	// opening a pipe would block until something writes to it
+	if !stat.Mode().IsRegular() {
+		return FileInfo{}, fmt.Errorf("%s: not a regular file", path)
 	}
 
-	// Check if file is empty
-	if stat.Size() == 0 {
-		return FileInfo{}, fmt.Errorf("%s: file is empty", path)
+	// Empty files are usually a mistake, so they need --allow-empty
+	if stat.Size() == 0 && !allowEmpty {
+		return FileInfo{}, fmt.Errorf("%s: file is empty (use --allow-empty to send it)", path)
 	}
 
 	// Check if file is readable
@@ -88,8 +211,123 @@ func validateSingleFile(path string) (FileInfo, error) {
 	file.Close()
 
 	// Get just the filename (without directory)
-	name := filepath.Base(absPath)
+	return newFileInfo(absPath, filepath.Base(absPath), stat), nil
+}
+
+// WalkDirectory expands a directory into a flat list of the regular files
+// beneath it. Each file's RelPath (and Name, which must stay unique for the
+// transfer protocol) is rooted at the directory's own name so the receiver
+// can recreate the tree. Symlinks, empty files and empty subfolders are
+// skipped and counted in the Skipped it returns. Entries matching the
+// directory's IgnoreFileName are left out.
+func WalkDirectory(root string) ([]FileInfo, Skipped, error) {
+	var skipped Skipped
+	fileInfos, err := walkDirectory(root, false, nil, &skipped)
+	return fileInfos, skipped, err
+}
+
+// walkDirectory is WalkDirectory that adds what it left out to skipped,
+// keeping empty files when allowEmpty is set and leaving out what excluder
+// or the directory's ignore file matches
+func walkDirectory(root string, allowEmpty bool, excluder *Excluder, skipped *Skipped) ([]FileInfo, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to get absolute path: %w", root, err)
+	}
+	parent := filepath.Dir(absRoot)
+
+	if excluder == nil {
+		excluder = &Excluder{}
+	}
+	excluder, err = excluder.withIgnoreFile(absRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	var fileInfos []FileInfo
+	// empty tracks the subfolders nothing has been found in yet
+	empty := make(map[string]bool)
+	err = filepath.WalkDir(absRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		if path != absRoot {
+			delete(empty, filepath.Dir(path))
+
+			rel, err := filepath.Rel(absRoot, path)
+			if err == nil && excluder.Excluded(filepath.ToSlash(rel), d.IsDir()) {
+				return exclude(d, skipped)
+			}
+		}
+
+		if d.IsDir() {
+			if path != absRoot {
+				empty[path] = true
+			}
+			return nil
+		}
+
+		// Skip symlinks and other non-regular entries
+		if !d.Type().IsRegular() {
+			skipped.Unsendable++
+			return nil
+		}
+
+		stat, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("%s: failed to stat file: %w", path, err)
+		}
+		if stat.Size() == 0 && !allowEmpty {
+			skipped.Unsendable++
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("%s: cannot open file (check permissions): %w", path, err)
+		}
+		file.Close()
+
+		rel, err := filepath.Rel(parent, path)
+		if err != nil {
+			return fmt.Errorf("%s: failed to get relative path: %w", path, err)
+		}
+		relPath := filepath.ToSlash(rel)
+
+		info := newFileInfo(path, relPath, stat)
+		info.RelPath = relPath
+		fileInfos = append(fileInfos, info)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	skipped.EmptyDirs += len(empty)
 
+	if len(fileInfos) == 0 {
+		return nil, fmt.Errorf("%s: directory contains no files", root)
+	}
+
+	return fileInfos, nil
+}
+
+// exclude counts an excluded entry and keeps the walk out of it if it is a
+// directory
+func exclude(d fs.DirEntry, skipped *Skipped) error {
+	if d.IsDir() {
+		skipped.ExcludedDirs++
+		return filepath.SkipDir
+	}
+	skipped.ExcludedFiles++
+	if info, err := d.Info(); err == nil && info.Mode().IsRegular() {
+		skipped.ExcludedBytes += info.Size()
+	}
+	return nil
+}
+
+// newFileInfo builds a FileInfo for a validated, readable file
+func newFileInfo(absPath, name string, stat fs.FileInfo) FileInfo {
 	// Detect MIME type from file extension
 	mimeType := mime.TypeByExtension(filepath.Ext(absPath))
 	if mimeType == "" {
@@ -103,7 +341,9 @@ func validateSingleFile(path string) (FileInfo, error) {
 		Size:       stat.Size(),
 		Type:       mimeType,
 		IsReadable: true,
-	}, nil
+		ModTime:    stat.ModTime(),
+		Mode:       stat.Mode().Perm(),
+	}
 }
 
 // joinErrors joins multiple error messages with newlines
@@ -0,0 +1,100 @@
+package files
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// makeTree creates the files and folders in entries under dir; names
+// ending in a slash are folders, files hold their own name
+func makeTree(t *testing.T, dir string, entries []string) {
+	t.Helper()
+	for _, entry := range entries {
+		path := filepath.Join(dir, filepath.FromSlash(entry))
+		if entry[len(entry)-1] == '/' {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		content := entry
+		if filepath.Base(entry) == "empty.txt" {
+			content = ""
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWalkDirectoryReportsSkipped(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "project")
+	makeTree(t, root, []string{
+		"main.go",
+		"src/lib.go",
+		"src/empty.txt",
+		"docs/",
+		"build/out/",
+		"assets/empty.txt",
+	})
+	if err := os.Symlink("main.go", filepath.Join(root, "link.go")); err != nil {
+		t.Fatal(err)
+	}
+
+	fileInfos, skipped, err := WalkDirectory(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var relPaths []string
+	for _, info := range fileInfos {
+		relPaths = append(relPaths, info.RelPath)
+	}
+	slices.Sort(relPaths)
+	if want := []string{"project/main.go", "project/src/lib.go"}; !slices.Equal(relPaths, want) {
+		t.Errorf("got files %v, want %v", relPaths, want)
+	}
+	// Two empty files and the symlink
+	if skipped.Unsendable != 3 {
+		t.Errorf("got %d unsendable entries, want 3", skipped.Unsendable)
+	}
+	// docs and build/out; build has a folder in it and assets a file
+	if skipped.EmptyDirs != 2 {
+		t.Errorf("got %d empty folders, want 2", skipped.EmptyDirs)
+	}
+}
+
+func TestValidateFilesAllowEmpty(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "project")
+	makeTree(t, root, []string{"main.go", "empty.txt", "docs/"})
+
+	fileInfos, skipped, err := ValidateFilesSkipped([]string{root}, ValidateOptions{AllowEmpty: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fileInfos) != 2 || skipped.Unsendable != 0 {
+		t.Errorf("got %d files and %d unsendable with AllowEmpty, want 2 and 0", len(fileInfos), skipped.Unsendable)
+	}
+	if skipped.EmptyDirs != 1 {
+		t.Errorf("got %d empty folders, want 1", skipped.EmptyDirs)
+	}
+}
+
+func TestValidateFilesExcludedFolderNotEmpty(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "project")
+	makeTree(t, root, []string{"main.go", "cache/data.bin", "logs/debug.log"})
+
+	_, skipped, err := ValidateFilesSkipped([]string{root}, ValidateOptions{Exclude: []string{"cache/", "*.log"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// logs only held an excluded file, which is counted as excluded
+	if skipped.EmptyDirs != 0 || skipped.ExcludedDirs != 1 || skipped.ExcludedFiles != 1 {
+		t.Errorf("got %+v", skipped)
+	}
+}
@@ -0,0 +1,111 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Transfer directions
+const (
+	DirectionSent     = "sent"
+	DirectionReceived = "received"
+)
+
+// Entry records one completed transfer
+type Entry struct {
+	Time       time.Time `json:"time"`
+	Direction  string    `json:"direction"`
+	Files      []string  `json:"files"`
+	Bytes      int64     `json:"bytes"`
+	DurationMS int64     `json:"duration_ms"`
+	PeerType   string    `json:"peer_type,omitempty"`
+	RoomID     string    `json:"room_id,omitempty"`
+}
+
+// Duration returns how long the transfer took
+func (e Entry) Duration() time.Duration {
+	return time.Duration(e.DurationMS) * time.Millisecond
+}
+
+// FilePath returns where the history lives:
+// $XDG_DATA_HOME/warpdrop/history.jsonl, falling back to ~/.local/share
+func FilePath() (string, error) {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, "warpdrop", "history.jsonl"), nil
+}
+
+// Append adds e as one JSON line at the end of the history file
+func Append(e Entry) error {
+	path, err := FilePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	// File names may be private, so the history is only readable by the owner
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// Last returns up to n of the most recent entries, oldest first. Lines that
+// cannot be parsed are skipped, and a missing file yields no entries.
+func Last(n int) ([]Entry, error) {
+	path, err := FilePath()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		entries = append(entries, e)
+		if n > 0 && len(entries) > n {
+			entries = entries[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
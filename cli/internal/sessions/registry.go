@@ -0,0 +1,122 @@
+package sessions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Session roles
+const (
+	RoleSend    = "send"
+	RoleReceive = "receive"
+)
+
+// Session describes a running send or receive on this machine
+type Session struct {
+	PID       int       `json:"pid"`
+	Role      string    `json:"role"`
+	RoomID    string    `json:"room_id"`
+	Files     int       `json:"files,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// dir returns the directory holding one file per running session
+func dir() (string, error) {
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cache, "warpdrop", "sessions"), nil
+}
+
+// Register records s for the current process. The returned function removes
+// the record and should be deferred by the caller.
+func Register(s Session) (func(), error) {
+	d, err := dir()
+	if err != nil {
+		return func() {}, err
+	}
+	if err := os.MkdirAll(d, 0755); err != nil {
+		return func() {}, err
+	}
+
+	s.PID = os.Getpid()
+	if s.StartedAt.IsZero() {
+		s.StartedAt = time.Now()
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return func() {}, err
+	}
+
+	path := filepath.Join(d, fmt.Sprintf("%d.json", s.PID))
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return func() {}, err
+	}
+	return func() { os.Remove(path) }, nil
+}
+
+// List returns the sessions of processes that are still running, oldest
+// first. Records left behind by processes that exited without cleaning up
+// are removed.
+func List() ([]Session, error) {
+	d, err := dir()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(d)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Session
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		path := filepath.Join(d, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		var s Session
+		if err := json.Unmarshal(data, &s); err != nil || !processAlive(s.PID) {
+			os.Remove(path)
+			continue
+		}
+		list = append(list, s)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].StartedAt.Before(list[j].StartedAt)
+	})
+	return list, nil
+}
+
+// processAlive reports whether pid refers to a running process. Platforms
+// that cannot probe a process with signal 0 are assumed to be running.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = p.Signal(syscall.Signal(0))
+	return !errors.Is(err, os.ErrProcessDone) && !errors.Is(err, syscall.ESRCH)
+}
@@ -1,10 +1,19 @@
 package signaling
 
 import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"net/url"
+	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
+	"github.com/BioHazard786/Warpdrop/cli/internal/dns"
 	"github.com/gorilla/websocket"
 )
 
@@ -13,16 +22,42 @@ const (
 	pongWait       = 60 * time.Second
 	pingPeriod     = (pongWait * 9) / 10
 	maxMessageSize = 64 * 1024
+
+	// maxRefusalLen bounds how much of a refused upgrade's body is shown
+	maxRefusalLen = 256
+
+	// Backoff bounds for ConnectWithRetry
+	maxRetryDelay     = 8 * time.Second
+	maxConnectElapsed = 30 * time.Second
+
+	// reconnectBaseDelay is the first wait before re-establishing a
+	// dropped connection. Reconnects give up after maxConnectElapsed too,
+	// which is how long the server holds a dropped peer's slot by default.
+	reconnectBaseDelay = 250 * time.Millisecond
 )
 
 // Client manages the WebSocket connection to the signaling server.
 type Client struct {
-	conn      *websocket.Conn
 	serverURL string
 	incoming  chan *Message
 	outgoing  chan *Message
 	done      chan struct{}
 	closed    bool
+	onRetry   func(attempt int, delay time.Duration, err error)
+
+	// insecure accepts any TLS certificate from the server
+	insecure bool
+
+	// reconnects is how many times a connection that drops after joining
+	// a room is re-established; see SetReconnects
+	reconnects int
+
+	// mu guards token and unsent. token is the latest reconnect token from
+	// the server; unsent is a message whose write failed when the
+	// connection dropped, sent again once it is back.
+	mu     sync.Mutex
+	token  string
+	unsent *Message
 }
 
 // NewClient creates a new signaling client
@@ -37,81 +72,328 @@ func NewClient(serverURL string) *Client {
 
 // Connect establishes WebSocket connection to the server.
 func (c *Client) Connect() error {
-	u, err := url.Parse(c.serverURL)
+	conn, err := c.dial()
 	if err != nil {
-		return fmt.Errorf("invalid server URL: %w", err)
+		return err
 	}
+	c.start(conn)
+	return nil
+}
 
-	conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+// dial opens a new WebSocket connection to the server
+func (c *Client) dial() (*websocket.Conn, error) {
+	u, err := url.Parse(c.serverURL)
 	if err != nil {
-		return fmt.Errorf("failed to connect: %w", err)
+		return nil, fmt.Errorf("invalid server URL: %w", err)
 	}
 
-	c.conn = conn
+	// Resolve through our DNS fallback and race the server's addresses
+	dialer := *websocket.DefaultDialer
+	dialer.NetDialContext = dns.DialContext
+	// Offer permessage-deflate; SDP offers and answers shrink well
+	dialer.EnableCompression = true
+	if c.insecure {
+		dialer.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
 
-	c.conn.SetReadLimit(maxMessageSize)
+	conn, resp, err := dialer.Dial(u.String(), nil)
+	if err != nil {
+		if reason := refusalReason(err, resp); reason != "" {
+			err = fmt.Errorf("failed to connect: %s", reason)
+		} else {
+			err = fmt.Errorf("failed to connect: %w", err)
+		}
+		if refusedForGood(resp) {
+			return nil, refusedError{err}
+		}
+		return nil, err
+	}
 
-	c.conn.SetPongHandler(func(string) error {
-		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetReadLimit(maxMessageSize)
+
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(pongWait))
 		return nil
 	})
+	return conn, nil
+}
 
-	go c.readPump()
-	go c.writePump()
+// refusalReason is the explanation the server gave for refusing the
+// websocket upgrade, such as being at capacity, or empty when it gave none
+func refusalReason(err error, resp *http.Response) string {
+	if !errors.Is(err, websocket.ErrBadHandshake) || resp == nil || resp.Body == nil {
+		return ""
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxRefusalLen))
+	reason := strings.TrimSpace(string(body))
+	if reason == "" || !utf8.ValidString(reason) {
+		return ""
+	}
+	return fmt.Sprintf("%s (%s)", reason, resp.Status)
+}
 
-	return nil
+// refusedError is a handshake the server turned down in a way that retrying
+// won't change, such as a 403 for a disallowed origin
+type refusedError struct {
+	error
 }
 
-// readPump reads messages from the WebSocket connection.
-func (c *Client) readPump() {
-	defer func() {
-		c.conn.Close()
-		close(c.incoming)
-	}()
+func (e refusedError) Unwrap() error {
+	return e.error
+}
 
-	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+// refusedForGood reports whether the server refused the upgrade with a
+// client error. Timeouts and rate limiting may pass, as may the 503 a
+// server at capacity answers with.
+func refusedForGood(resp *http.Response) bool {
+	if resp == nil {
+		return false
+	}
+	switch resp.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	}
+	return resp.StatusCode >= 400 && resp.StatusCode < 500
+}
+
+// start runs the read and write pumps on conn. lost is closed when the
+// connection fails, and writerDone once the write pump has stopped using it.
+func (c *Client) start(conn *websocket.Conn) {
+	lost := make(chan struct{})
+	writerDone := make(chan struct{})
+	go c.readPump(conn, lost, writerDone)
+	go c.writePump(conn, lost, writerDone)
+}
+
+// SetInsecure skips verifying the server's TLS certificate, for self-hosted
+// servers with self-signed certificates
+func (c *Client) SetInsecure(insecure bool) {
+	c.insecure = insecure
+}
+
+// OnRetry sets a callback run before each ConnectWithRetry retry with the
+// attempt about to be made, the wait before it and the error that caused it.
+func (c *Client) OnRetry(fn func(attempt int, delay time.Duration, err error)) {
+	c.onRetry = fn
+}
+
+// ConnectWithRetry calls Connect up to attempts times, doubling the wait
+// after each failure starting from baseDelay. It gives up early rather than
+// keep trying past maxConnectElapsed, and at once when the server refuses
+// the connection for good.
+func (c *Client) ConnectWithRetry(attempts int, baseDelay time.Duration) error {
+	// A malformed URL will never connect, so fail without retrying
+	if _, err := url.Parse(c.serverURL); err != nil {
+		return fmt.Errorf("invalid server URL: %w", err)
+	}
+
+	start := time.Now()
+	delay := baseDelay
+	for attempt := 1; ; attempt++ {
+		err := c.Connect()
+		if err == nil {
+			return nil
+		}
+		if errors.As(err, new(refusedError)) {
+			return err
+		}
+
+		if attempt >= attempts {
+			return fmt.Errorf("server unreachable after %d attempts: %w", attempt, err)
+		}
+		if time.Since(start)+delay > maxConnectElapsed {
+			return fmt.Errorf("server unreachable after %d attempts in %s: %w", attempt, maxConnectElapsed, err)
+		}
+
+		if c.onRetry != nil {
+			c.onRetry(attempt+1, delay, err)
+		}
+		time.Sleep(delay)
+		delay = min(delay*2, maxRetryDelay)
+	}
+}
+
+// readPump reads messages from the WebSocket connection. When it drops
+// mid-session the connection is re-established with the room rejoined, and
+// Incoming carries on as if nothing happened; otherwise Incoming is closed.
+func (c *Client) readPump(conn *websocket.Conn, lost, writerDone chan struct{}) {
+	conn.SetReadDeadline(time.Now().Add(pongWait))
 
 	for {
 		var msg Message
-		if err := c.conn.ReadJSON(&msg); err != nil {
-			return
+		if err := readJSON(conn, &msg); err != nil {
+			break
 		}
 
+		if msg.ReconnectToken != "" {
+			c.setToken(msg.ReconnectToken)
+		}
 		c.incoming <- &msg
 	}
+
+	conn.Close()
+	close(lost)
+	<-writerDone
+
+	if conn := c.reconnect(); conn != nil {
+		c.start(conn)
+		return
+	}
+	close(c.incoming)
 }
 
 // writePump writes messages to the WebSocket connection and sends periodic pings.
-func (c *Client) writePump() {
+func (c *Client) writePump(conn *websocket.Conn, lost, writerDone chan struct{}) {
 	ticker := time.NewTicker(pingPeriod)
 
 	defer func() {
 		ticker.Stop()
-		c.conn.Close()
+		conn.Close()
+		close(writerDone)
 	}()
 
+	if message := c.takeUnsent(); message != nil {
+		conn.SetWriteDeadline(time.Now().Add(writeWait))
+		if err := conn.WriteJSON(message); err != nil {
+			c.setUnsent(message)
+			return
+		}
+	}
+
 	for {
 		select {
-		case message := <-c.outgoing:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := c.conn.WriteJSON(message); err != nil {
+		case message, ok := <-c.outgoing:
+			if !ok {
+				writeClose(conn)
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteJSON(message); err != nil {
+				c.setUnsent(message)
 				return
 			}
 
 		case <-ticker.C:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
 
+		case <-lost:
+			return
+
 		case <-c.done:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+			writeClose(conn)
 			return
 		}
 	}
 }
 
+// writeClose tells the server the connection is closing on purpose
+func writeClose(conn *websocket.Conn) {
+	conn.SetWriteDeadline(time.Now().Add(writeWait))
+	conn.WriteMessage(websocket.CloseMessage, []byte{})
+}
+
+// SetReconnects sets how many times a connection that drops after the
+// room was created or joined is re-established, rejoining the room with the
+// server's reconnect token so late signals still get through. Zero, the
+// default, lets Incoming close instead.
+func (c *Client) SetReconnects(attempts int) {
+	c.reconnects = attempts
+}
+
+// reconnect re-establishes a dropped connection and rejoins the room,
+// backing off between attempts. It returns nil when reconnecting is off,
+// the client was closed, or the server no longer holds our slot.
+func (c *Client) reconnect() *websocket.Conn {
+	start := time.Now()
+	delay := reconnectBaseDelay
+	for attempt := 1; attempt <= c.reconnects; attempt++ {
+		token := c.getToken()
+		if token == "" {
+			return nil
+		}
+
+		select {
+		case <-c.done:
+			return nil
+		case <-time.After(delay):
+		}
+
+		conn, err := c.dial()
+		if err == nil {
+			var rejoined bool
+			rejoined, err = c.rejoin(conn, token)
+			if rejoined {
+				return conn
+			}
+			conn.Close()
+			if err == nil {
+				// The server turned the token down, so trying again won't help
+				return nil
+			}
+		}
+
+		if time.Since(start)+delay > maxConnectElapsed {
+			return nil
+		}
+		delay = min(delay*2, maxRetryDelay)
+	}
+	return nil
+}
+
+// rejoin reclaims our slot in the room over conn. It reports false with a
+// nil error when the server refused, such as after the slot expired.
+func (c *Client) rejoin(conn *websocket.Conn, token string) (bool, error) {
+	conn.SetWriteDeadline(time.Now().Add(writeWait))
+	if err := conn.WriteJSON(&Message{Type: MessageTypeRejoinRoom, ReconnectToken: token}); err != nil {
+		return false, err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(writeWait))
+	for {
+		var msg Message
+		if err := readJSON(conn, &msg); err != nil {
+			return false, err
+		}
+		switch msg.Type {
+		case MessageTypeRejoinSuccess:
+			c.setToken(msg.ReconnectToken)
+			return true, nil
+		case MessageTypeError:
+			c.setToken("")
+			return false, nil
+		}
+	}
+}
+
+func (c *Client) getToken() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token
+}
+
+func (c *Client) setToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+}
+
+func (c *Client) takeUnsent() *Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	message := c.unsent
+	c.unsent = nil
+	return message
+}
+
+func (c *Client) setUnsent(message *Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.unsent = message
+}
+
 // SendMessage sends a message to the server.
 func (c *Client) SendMessage(msg *Message) {
 	c.outgoing <- msg
@@ -132,3 +414,20 @@ func (c *Client) Close() {
 	close(c.done)
 	close(c.outgoing)
 }
+
+// readJSON decodes the next message into v. The connection's read limit
+// counts compressed bytes, so the decompressed message is bounded here.
+func readJSON(conn *websocket.Conn, v any) error {
+	_, r, err := conn.NextReader()
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(io.LimitReader(r, maxMessageSize+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > maxMessageSize {
+		return websocket.ErrReadLimit
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,53 @@
+package signaling
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// refusingServer answers every websocket upgrade with status
+func refusingServer(t *testing.T, status int) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "go away", status)
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+}
+
+func TestConnectWithRetryGivesUpOnClientErrors(t *testing.T) {
+	for _, status := range []int{http.StatusForbidden, http.StatusNotFound} {
+		client := NewClient(refusingServer(t, status))
+		retries := 0
+		client.OnRetry(func(int, time.Duration, error) { retries++ })
+
+		err := client.ConnectWithRetry(3, time.Millisecond)
+		if err == nil {
+			t.Fatalf("connected to a server answering %d", status)
+		}
+		if retries != 0 {
+			t.Errorf("retried %d times after a %d", retries, status)
+		}
+		if !strings.Contains(err.Error(), "go away") {
+			t.Errorf("error %q doesn't say why the server refused", err)
+		}
+	}
+}
+
+func TestConnectWithRetryRetriesServerErrors(t *testing.T) {
+	for _, status := range []int{http.StatusServiceUnavailable, http.StatusTooManyRequests} {
+		client := NewClient(refusingServer(t, status))
+		retries := 0
+		client.OnRetry(func(int, time.Duration, error) { retries++ })
+
+		if err := client.ConnectWithRetry(3, time.Millisecond); err == nil {
+			t.Fatalf("connected to a server answering %d", status)
+		}
+		if retries != 2 {
+			t.Errorf("retried %d times after a %d, want 2", retries, status)
+		}
+	}
+}
@@ -1,40 +1,84 @@
 package signaling
 
-import "encoding/json"
+import (
+	"encoding/base64"
+	"encoding/json"
+	"sync"
+)
 
 // PeerInfo contains information about the connected peer
 type PeerInfo struct {
 	ClientType string `json:"client_type"`
+
+	// ResumeToken is the receiver's resume token: relayed to the sender in
+	// peer_joined, and echoed to the receiver in join_success once the
+	// server has passed it on
+	ResumeToken string `json:"resume_token,omitempty"`
+
+	// Protocols are the transfer protocols the peer advertised. Web peers
+	// and older CLIs leave it empty.
+	Protocols []string `json:"protocols,omitempty"`
 }
 
 // Handler routes incoming signaling messages to appropriate channels.
 type Handler struct {
-	client      *Client
-	RoomCreated chan string
+	client      Transport
+	RoomCreated chan *Message
 	PeerJoined  chan *PeerInfo
 	JoinSuccess chan *PeerInfo
 	PeerLeft    chan struct{}
+	RoomStatus  chan *RoomStatusPayload
 	Signal      chan *SignalPayload
+	Relay       chan json.RawMessage
+	Data        chan []byte
 	Error       chan string
-	closed      bool
+
+	// done is closed by Close. Start is the only one to send on the
+	// channels, so it closes them too once done is closed.
+	done chan struct{}
+	once sync.Once
+
+	turnMu sync.Mutex
+	turn   *TURNCredentialsPayload
 }
 
 // NewHandler creates a new message handler.
-func NewHandler(client *Client) *Handler {
+func NewHandler(client Transport) *Handler {
 	return &Handler{
 		client:      client,
-		RoomCreated: make(chan string, 1),
+		RoomCreated: make(chan *Message, 1),
 		PeerJoined:  make(chan *PeerInfo, 1),
 		JoinSuccess: make(chan *PeerInfo, 1),
 		PeerLeft:    make(chan struct{}, 1),
+		RoomStatus:  make(chan *RoomStatusPayload, 1),
 		Signal:      make(chan *SignalPayload, 32),
+		Relay:       make(chan json.RawMessage, 8),
+		Data:        make(chan []byte, 64),
 		Error:       make(chan string, 1),
+		done:        make(chan struct{}),
 	}
 }
 
-// Start begins listening to incoming messages and routing them.
+// Start begins listening to incoming messages and routing them. It returns
+// once the handler is closed, closing the channels behind it.
 func (h *Handler) Start() {
-	for msg := range h.client.Incoming() {
+	defer h.closeChannels()
+
+	incoming := h.client.Incoming()
+	for {
+		var msg *Message
+		select {
+		case m, ok := <-incoming:
+			if !ok {
+				// The connection is gone, but the channels stay open
+				// until Close like they would if it were still there
+				<-h.done
+				return
+			}
+			msg = m
+		case <-h.done:
+			return
+		}
 
 		switch msg.Type {
 
@@ -48,23 +92,45 @@ func (h *Handler) Start() {
 			h.handlePeerJoined(msg)
 
 		case MessageTypePeerLeft:
-			h.PeerLeft <- struct{}{}
+			select {
+			case h.PeerLeft <- struct{}{}:
+			case <-h.done:
+			}
 
 		case MessageTypeSignal:
 			h.handleSignal(msg)
 
+		case MessageTypeRoomStatus:
+			h.handleRoomStatus(msg)
+
+		case MessageTypeRelay:
+			h.handleRelay(msg)
+
+		case MessageTypeData:
+			h.handleData(msg)
+
 		case MessageTypeError:
 			h.handleError(msg)
 
+		case MessageTypeServerShutdown:
+			h.handleServerShutdown()
+
+		case MessageTypeTURNCredentials:
+			h.handleTURNCredentials(msg)
+
 		default:
 
 		}
 	}
 }
 
-// handleRoomCreated extracts the room ID and sends it through the channel.
+// handleRoomCreated passes on the message, which carries the room ID and
+// any short code.
 func (h *Handler) handleRoomCreated(msg *Message) {
-	h.RoomCreated <- msg.RoomID
+	select {
+	case h.RoomCreated <- msg:
+	case <-h.done:
+	}
 }
 
 // handleJoinSuccess is called when we successfully joined a room.
@@ -78,7 +144,10 @@ func (h *Handler) handleJoinSuccess(msg *Message) {
 		}
 	}
 
-	h.JoinSuccess <- &peerInfo
+	select {
+	case h.JoinSuccess <- &peerInfo:
+	case <-h.done:
+	}
 }
 
 // handlePeerJoined is called when a peer joins our room (sender receives this).
@@ -92,7 +161,26 @@ func (h *Handler) handlePeerJoined(msg *Message) {
 		}
 	}
 
-	h.PeerJoined <- &peerInfo
+	select {
+	case h.PeerJoined <- &peerInfo:
+	case <-h.done:
+	}
+}
+
+// handleRoomStatus is called with the server's answer to a room status query.
+func (h *Handler) handleRoomStatus(msg *Message) {
+	var status RoomStatusPayload
+	if msg.Payload != nil {
+		payloadBytes, err := json.Marshal(msg.Payload)
+		if err == nil {
+			json.Unmarshal(payloadBytes, &status)
+		}
+	}
+
+	select {
+	case h.RoomStatus <- &status:
+	case <-h.done:
+	}
 }
 
 // handleSignal parses the WebRTC signaling payload and sends it.
@@ -101,16 +189,53 @@ func (h *Handler) handleSignal(msg *Message) {
 
 	payloadBytes, err := json.Marshal(msg.Payload)
 	if err != nil {
-		h.Error <- "Failed to parse signal payload"
+		h.sendError("Failed to parse signal payload")
 		return
 	}
 
 	if err := json.Unmarshal(payloadBytes, &payload); err != nil {
-		h.Error <- "Failed to parse signal payload"
+		h.sendError("Failed to parse signal payload")
 		return
 	}
 
-	h.Signal <- &payload
+	select {
+	case h.Signal <- &payload:
+	case <-h.done:
+	}
+}
+
+// handleRelay passes on a relay payload from the other peer as raw JSON.
+// Relays nobody is reading are dropped once the channel is full rather
+// than holding up signaling.
+func (h *Handler) handleRelay(msg *Message) {
+	payload, err := json.Marshal(msg.Payload)
+	if err != nil {
+		return
+	}
+
+	select {
+	case h.Relay <- payload:
+	default:
+	}
+}
+
+// handleData decodes the data in a data message from the other peer. The
+// peers limit how much they have in flight, so the channel only fills up
+// when nobody is reading and the data is dropped.
+func (h *Handler) handleData(msg *Message) {
+	encoded, ok := msg.Payload.(string)
+	if !ok {
+		return
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return
+	}
+
+	select {
+	case h.Data <- data:
+	default:
+	}
 }
 
 // handleError parses the error message and sends it through the Error channel.
@@ -119,29 +244,74 @@ func (h *Handler) handleError(msg *Message) {
 
 	payloadBytes, err := json.Marshal(msg.Payload)
 	if err != nil {
-		h.Error <- "Unknown error from server"
+		h.sendError("Unknown error from server")
 		return
 	}
 
 	if err := json.Unmarshal(payloadBytes, &errPayload); err != nil {
-		h.Error <- "Unknown error from server"
+		h.sendError("Unknown error from server")
 		return
 	}
 
-	h.Error <- errPayload.Error
+	h.sendError(errPayload.Error)
 }
 
-// Close closes all handler channels.
-func (h *Handler) Close() {
-	if h.closed {
+// sendError passes on an error unless the handler is closed first
+func (h *Handler) sendError(message string) {
+	select {
+	case h.Error <- message:
+	case <-h.done:
+	}
+}
+
+// handleServerShutdown reports a server restart to whoever is still waiting
+// on signaling. A transfer already connected peer to peer carries on, so
+// nothing blocks when no one is listening.
+func (h *Handler) handleServerShutdown() {
+	select {
+	case h.Error <- "Signaling server is shutting down, try again shortly":
+	default:
+	}
+}
+
+// handleTURNCredentials keeps the TURN credentials the server issued. They
+// come before room_created and join_success, so they are kept by the time
+// either is passed on.
+func (h *Handler) handleTURNCredentials(msg *Message) {
+	var creds TURNCredentialsPayload
+	payloadBytes, err := json.Marshal(msg.Payload)
+	if err != nil || json.Unmarshal(payloadBytes, &creds) != nil || len(creds.URLs) == 0 {
 		return
 	}
-	h.closed = true
 
+	h.turnMu.Lock()
+	defer h.turnMu.Unlock()
+	h.turn = &creds
+}
+
+// TURNCredentials returns the TURN credentials the server issued, or nil
+// when it issued none
+func (h *Handler) TURNCredentials() *TURNCredentialsPayload {
+	h.turnMu.Lock()
+	defer h.turnMu.Unlock()
+	return h.turn
+}
+
+// Close stops the handler, and Start closes all handler channels as it
+// returns. It is safe to call more than once.
+func (h *Handler) Close() {
+	h.once.Do(func() { close(h.done) })
+}
+
+// closeChannels closes all handler channels
+func (h *Handler) closeChannels() {
 	close(h.RoomCreated)
 	close(h.PeerJoined)
 	close(h.JoinSuccess)
 	close(h.PeerLeft)
+	close(h.RoomStatus)
 	close(h.Signal)
+	close(h.Relay)
+	close(h.Data)
 	close(h.Error)
 }
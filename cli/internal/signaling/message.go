@@ -6,29 +6,102 @@ type Message struct {
 	Payload    any    `json:"payload,omitempty"`
 	RoomID     string `json:"room_id,omitempty"`
 	ClientType string `json:"client_type,omitempty"`
+
+	// CodeMode asks create_room for a numeric short code, which is
+	// returned in ShortCode on room_created
+	CodeMode  string `json:"code_mode,omitempty"`
+	ShortCode string `json:"short_code,omitempty"`
+
+	// ResumeToken on join_room tells the sender the receiver has partial
+	// files from an earlier transfer to resume
+	ResumeToken string `json:"resume_token,omitempty"`
+
+	// Protocols on create_room and join_room lists the transfer protocols
+	// this client supports; the server passes them to the peer in PeerInfo
+	Protocols []string `json:"protocols,omitempty"`
+
+	// ReconnectToken comes with room_created, join_success and
+	// rejoin_success, and reclaims our place in the room with rejoin_room
+	// after the connection drops
+	ReconnectToken string `json:"reconnect_token,omitempty"`
 }
 
+// CodeModeNumeric requests a numeric short code that joins the room
+const CodeModeNumeric = "numeric"
+
 // Message type constants.
 const (
 	MessageTypeCreateRoom = "create_room"
 	MessageTypeJoinRoom   = "join_room"
 	MessageTypeSignal     = "signal"
+	MessageTypeRoomStatus = "room_status"
+
+	// MessageTypeRelay passes an opaque payload to the other peer through
+	// the server, for app messages exchanged before the peers connect.
+	// The server caps its size at MaxRelayPayload.
+	MessageTypeRelay = "relay"
+
+	// MessageTypeData carries file data to the other peer through the
+	// server, for peers that can't connect directly. The server caps its
+	// size at MaxDataPayload and may be set up to refuse it.
+	MessageTypeData = "data"
 
 	MessageTypeRoomCreated = "room_created"
 	MessageTypeJoinSuccess = "join_success"
 	MessageTypePeerJoined  = "peer_joined"
 	MessageTypePeerLeft    = "peer_left"
 	MessageTypeError       = "error"
+
+	MessageTypeServerShutdown = "server_shutdown"
+
+	// MessageTypeTURNCredentials carries short-lived TURN credentials,
+	// which servers that issue them send ahead of room_created and
+	// join_success
+	MessageTypeTURNCredentials = "turn_credentials"
+
+	// MessageTypeRejoinRoom reclaims a dropped client's place in its room,
+	// answered by MessageTypeRejoinSuccess. The other peer gets
+	// MessageTypePeerReconnected.
+	MessageTypeRejoinRoom      = "rejoin_room"
+	MessageTypeRejoinSuccess   = "rejoin_success"
+	MessageTypePeerReconnected = "peer_reconnected"
 )
 
+// MaxRelayPayload is the largest relay payload the server forwards, in
+// bytes of JSON
+const MaxRelayPayload = 4 * 1024
+
+// MaxDataPayload is the largest data payload the server forwards, in bytes
+// of JSON
+const MaxDataPayload = 48 * 1024
+
 // SignalPayload represents the WebRTC signaling data (SDP offer/answer or ICE candidate).
 type SignalPayload struct {
 	Type         string `json:"type,omitempty"`
 	SDP          string `json:"sdp,omitempty"`
 	ICECandidate any    `json:"ice_candidate,omitempty"`
+
+	// NAT is the signalling peer's NAT type from a STUN probe. CLI peers
+	// send it in a signal of its own, alongside the offer and answer.
+	NAT string `json:"nat,omitempty"`
 }
 
 // ErrorPayload represents error messages from server.
 type ErrorPayload struct {
 	Error string `json:"error"`
 }
+
+// TURNCredentialsPayload is a TURN server list with credentials that are
+// valid for TTL seconds
+type TURNCredentialsPayload struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username"`
+	Credential string   `json:"credential"`
+	TTL        int      `json:"ttl"`
+}
+
+// RoomStatusPayload reports whether a room exists and how many peers are in it.
+type RoomStatusPayload struct {
+	Exists bool `json:"exists"`
+	Peers  int  `json:"peers"`
+}
@@ -0,0 +1,132 @@
+package signaling
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// PipeRoomID is the room both ends of a Pipe are in
+const PipeRoomID = "pipe"
+
+// Pipe is one end of an in-memory Transport made by NewPipe, which stands
+// in for the signaling server between two peers in the same process. It
+// answers create_room and join_room the way the server does, and passes
+// everything else to the other end as it would arrive over the websocket.
+type Pipe struct {
+	peer     *Pipe
+	queue    chan *Message
+	incoming chan *Message
+	done     chan struct{}
+	once     sync.Once
+
+	// mu guards what the end said about itself in create_room or
+	// join_room, which the other end gets as PeerInfo
+	mu         sync.Mutex
+	clientType string
+	protocols  []string
+}
+
+// NewPipe returns the two ends of an in-memory signaling connection. One
+// creates the room and the other joins it, as with the server.
+func NewPipe() (*Pipe, *Pipe) {
+	a, b := newPipeEnd(), newPipeEnd()
+	a.peer, b.peer = b, a
+	go a.run()
+	go b.run()
+	return a, b
+}
+
+func newPipeEnd() *Pipe {
+	return &Pipe{
+		queue:    make(chan *Message, 64),
+		incoming: make(chan *Message, 1),
+		done:     make(chan struct{}),
+	}
+}
+
+// run hands queued messages to Incoming until the end is closed
+func (p *Pipe) run() {
+	defer close(p.incoming)
+	for {
+		select {
+		case msg := <-p.queue:
+			select {
+			case p.incoming <- msg:
+			case <-p.done:
+				return
+			}
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// SendMessage sends msg to the other end, or answers it as the server
+// would for create_room and join_room
+func (p *Pipe) SendMessage(msg *Message) {
+	switch msg.Type {
+	case MessageTypeCreateRoom:
+		p.introduce(msg)
+		p.deliver(&Message{Type: MessageTypeRoomCreated, RoomID: PipeRoomID})
+
+	case MessageTypeJoinRoom:
+		p.introduce(msg)
+		p.peer.deliver(&Message{Type: MessageTypePeerJoined, Payload: p.peerInfo(msg.ResumeToken)})
+		p.deliver(&Message{Type: MessageTypeJoinSuccess, RoomID: PipeRoomID, Payload: p.peer.peerInfo(msg.ResumeToken)})
+
+	default:
+		p.peer.deliver(msg)
+	}
+}
+
+// Incoming returns the channel for receiving messages
+func (p *Pipe) Incoming() <-chan *Message {
+	return p.incoming
+}
+
+// Close closes this end and tells the other one the peer left
+func (p *Pipe) Close() {
+	p.once.Do(func() {
+		close(p.done)
+		p.peer.deliver(&Message{Type: MessageTypePeerLeft})
+	})
+}
+
+// introduce keeps the client type and protocols from create_room or
+// join_room
+func (p *Pipe) introduce(msg *Message) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clientType = msg.ClientType
+	p.protocols = msg.Protocols
+}
+
+// peerInfo describes this end to the other one
+func (p *Pipe) peerInfo(resumeToken string) PeerInfo {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return PeerInfo{
+		ClientType:  p.clientType,
+		ResumeToken: resumeToken,
+		Protocols:   p.protocols,
+	}
+}
+
+// deliver queues msg for this end after a round trip through JSON, so it
+// arrives in the same form as one read from the websocket. Messages for a
+// closed end are dropped.
+func (p *Pipe) deliver(msg *Message) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	var wire Message
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return
+	}
+
+	select {
+	case p.queue <- &wire:
+	case <-p.done:
+	}
+}
@@ -0,0 +1,58 @@
+package signaling
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Transport carries signaling messages between this client and the other
+// peer. Client does it through the signaling server; a Pipe does it in
+// memory.
+type Transport interface {
+	// SendMessage sends a message
+	SendMessage(msg *Message)
+
+	// Incoming returns the channel messages arrive on, which is closed
+	// once the transport is closed
+	Incoming() <-chan *Message
+
+	// Close closes the transport
+	Close()
+}
+
+// SendRelay sends payload to the other peer in a relay message. Payloads
+// over MaxRelayPayload are refused here rather than by the server.
+func SendRelay(t Transport, roomID string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if len(data) > MaxRelayPayload {
+		return fmt.Errorf("relay payload is %d bytes, over the %d byte limit", len(data), MaxRelayPayload)
+	}
+
+	t.SendMessage(&Message{
+		Type:    MessageTypeRelay,
+		RoomID:  roomID,
+		Payload: json.RawMessage(data),
+	})
+	return nil
+}
+
+// SendData sends data to the other peer in a data message, base64 encoded.
+// Data that would make the payload larger than MaxDataPayload is refused.
+func SendData(t Transport, data []byte) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if len(payload) > MaxDataPayload {
+		return fmt.Errorf("data payload is %d bytes, over the %d byte limit", len(payload), MaxDataPayload)
+	}
+
+	t.SendMessage(&Message{
+		Type:    MessageTypeData,
+		Payload: json.RawMessage(payload),
+	})
+	return nil
+}
@@ -0,0 +1,35 @@
+package transfer
+
+import (
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/webrtc"
+)
+
+// preservedModeMask keeps the permission bits a received file may get from
+// the sender. Setuid, setgid, sticky and group or world write never carry over.
+const preservedModeMask os.FileMode = 0755
+
+// chmodSupported is false where os.Chmod only toggles the read-only flag
+var chmodSupported = runtime.GOOS != "windows" && runtime.GOOS != "plan9"
+
+// restoreAttributes applies the modification time and permissions in meta
+// to path. It is best effort: the file is already written, so a failure
+// here leaves the fresh attributes rather than failing the transfer.
+func restoreAttributes(path string, meta webrtc.FileMetadata) {
+	if meta.ModTime > 0 {
+		modTime := time.UnixMilli(meta.ModTime)
+		os.Chtimes(path, modTime, modTime)
+	}
+	if meta.Mode != 0 && chmodSupported {
+		os.Chmod(path, preservedMode(meta.Mode))
+	}
+}
+
+// preservedMode clamps a mode from the sender to plain permission bits the
+// receiving user can still read and write
+func preservedMode(mode uint32) os.FileMode {
+	return os.FileMode(mode)&preservedModeMask | 0600
+}
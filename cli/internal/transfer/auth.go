@@ -0,0 +1,194 @@
+package transfer
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/ui"
+	"github.com/BioHazard786/Warpdrop/cli/internal/webrtc"
+	pion "github.com/pion/webrtc/v4"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/term"
+)
+
+// Argon2id parameters for deriving keys from a room password
+const (
+	kdfTime    = 1
+	kdfMemory  = 64 * 1024 // KiB
+	kdfThreads = 4
+	kdfSaltLen = 16
+	kdfKeyLen  = 32
+)
+
+// PasswordKey holds the keys derived from a room password. The encryption
+// key never leaves this process; peers only exchange the salt, a verifier
+// and a proof, which are computed from a separate authentication key.
+type PasswordKey struct {
+	salt    []byte
+	authKey []byte
+	cipher  *Cipher
+}
+
+// NewPasswordKey derives keys from password with a fresh random salt
+func NewPasswordKey(password string) *PasswordKey {
+	salt := make([]byte, kdfSaltLen)
+	rand.Read(salt)
+	key, _ := DerivePasswordKey(password, salt)
+	return key
+}
+
+// DerivePasswordKey derives keys from password and the sender's salt
+func DerivePasswordKey(password string, salt []byte) (*PasswordKey, error) {
+	derived := argon2.IDKey([]byte(password), salt, kdfTime, kdfMemory, kdfThreads, 2*kdfKeyLen)
+
+	block, err := aes.NewCipher(derived[:kdfKeyLen])
+	if err != nil {
+		return nil, NewError("create cipher", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, NewError("create cipher", err)
+	}
+
+	return &PasswordKey{
+		salt:    salt,
+		authKey: derived[kdfKeyLen:],
+		cipher:  &Cipher{aead: aead},
+	}, nil
+}
+
+func (k *PasswordKey) mac(label string) []byte {
+	m := hmac.New(sha256.New, k.authKey)
+	m.Write([]byte(label))
+	return m.Sum(nil)
+}
+
+// Challenge returns what the sender publishes so a receiver can check its password
+func (k *PasswordKey) Challenge() webrtc.AuthChallengePayload {
+	return webrtc.AuthChallengePayload{Salt: k.salt, Verifier: k.mac("verifier")}
+}
+
+// Matches reports whether k was derived from the same password as verifier
+func (k *PasswordKey) Matches(verifier []byte) bool {
+	return hmac.Equal(k.mac("verifier"), verifier)
+}
+
+// Proof shows the sender that the receiver knows the password
+func (k *PasswordKey) Proof() []byte {
+	return k.mac("proof")
+}
+
+// CheckProof reports whether proof was computed from the same password
+func (k *PasswordKey) CheckProof(proof []byte) bool {
+	return hmac.Equal(k.Proof(), proof)
+}
+
+// Cipher returns the chunk cipher, or nil for a nil key so unencrypted
+// transfers need no special casing
+func (k *PasswordKey) Cipher() *Cipher {
+	if k == nil {
+		return nil
+	}
+	return k.cipher
+}
+
+// Cipher encrypts chunk payloads with AES-256-GCM. Each sealed chunk is a
+// random nonce followed by the ciphertext and tag.
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// Seal encrypts data, returning it unchanged on a nil cipher
+func (c *Cipher) Seal(data []byte) []byte {
+	if c == nil {
+		return data
+	}
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(data)+c.aead.Overhead())
+	rand.Read(nonce)
+	return c.aead.Seal(nonce, nonce, data, nil)
+}
+
+// Open decrypts a sealed chunk, returning it unchanged on a nil cipher
+func (c *Cipher) Open(data []byte) ([]byte, error) {
+	if c == nil {
+		return data, nil
+	}
+	size := c.aead.NonceSize()
+	if len(data) < size {
+		return nil, ErrDecryptFailed
+	}
+	plain, err := c.aead.Open(nil, data[:size], data[size:], nil)
+	if err != nil {
+		return nil, ErrDecryptFailed
+	}
+	return plain, nil
+}
+
+// AnswerAuthChallenge checks the password against the sender's challenge,
+// prompting for it when none was given, and replies with a proof. A wrong
+// password is reported to the sender and fails before any file is offered.
+func AnswerAuthChallenge(dc *pion.DataChannel, challenge webrtc.AuthChallengePayload, password string, out *ui.Reporter) (*Cipher, error) {
+	key, err := CheckAuthChallenge(challenge, password, out)
+	if errors.Is(err, ErrPasswordRequired) || errors.Is(err, ErrWrongPassword) {
+		SendAuthResponse(dc, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := SendAuthResponse(dc, key.Proof()); err != nil {
+		return nil, err
+	}
+	return key.Cipher(), nil
+}
+
+// CheckAuthChallenge derives the key for the sender's challenge from
+// password, prompting for it when none was given unless out is embedded,
+// and checks it matches. The caller answers the sender with the key's
+// proof, or an empty one on ErrPasswordRequired or ErrWrongPassword.
+func CheckAuthChallenge(challenge webrtc.AuthChallengePayload, password string, out *ui.Reporter) (*PasswordKey, error) {
+	if password == "" && out.Embedded() {
+		return nil, ErrPasswordRequired
+	}
+	if password == "" {
+		password = PromptPassword()
+	}
+
+	key, err := DerivePasswordKey(password, challenge.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	if !key.Matches(challenge.Verifier) {
+		return nil, ErrWrongPassword
+	}
+	return key, nil
+}
+
+// PromptPassword asks for the room password without echoing it. In JSON
+// mode the prompt goes to stderr to keep stdout to events.
+func PromptPassword() string {
+	out := ui.Output()
+	if ui.JSONMode() {
+		out = os.Stderr
+	}
+	fmt.Fprint(out, "\n🔒 This transfer is password protected. Password: ")
+	defer fmt.Fprintln(out)
+
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		password, _ := term.ReadPassword(fd)
+		return string(password)
+	}
+
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.TrimRight(line, "\r\n")
+}
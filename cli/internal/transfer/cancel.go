@@ -0,0 +1,124 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/webrtc"
+	pion "github.com/pion/webrtc/v4"
+)
+
+// Cancellation tracks the ways a running transfer stops early: the local
+// user interrupting it, or the peer announcing that it was interrupted or
+// failed
+type Cancellation struct {
+	peerCancelled chan struct{}
+	peerOnce      sync.Once
+	acked         chan struct{}
+	ackOnce       sync.Once
+
+	// peerErr is set before peerCancelled closes when the peer failed
+	peerErr error
+}
+
+func NewCancellation() *Cancellation {
+	return &Cancellation{
+		peerCancelled: make(chan struct{}),
+		acked:         make(chan struct{}),
+	}
+}
+
+// HandleMessage acknowledges a cancel from the peer and records the ack for
+// our own
+func (c *Cancellation) HandleMessage(dc *pion.DataChannel, msgType string) {
+	switch msgType {
+	case MessageTypeCancelled:
+		SendSimpleMessage(dc, MessageTypeCancelAck)
+		c.peerOnce.Do(func() { close(c.peerCancelled) })
+	case MessageTypeCancelAck:
+		c.ackOnce.Do(func() { close(c.acked) })
+	}
+}
+
+// HandleError stops the transfer with the failure the peer reported. Unlike
+// a cancel it needs no ack.
+func (c *Cancellation) HandleError(message *webrtc.Message) {
+	var payload webrtc.ErrorPayload
+	if err := message.DecodePayload(&payload); err != nil {
+		return
+	}
+	c.peerOnce.Do(func() {
+		c.peerErr = RemoteError(payload)
+		close(c.peerCancelled)
+	})
+}
+
+// Watch returns a context that is also cancelled when the peer cancels, so
+// transfer goroutines only need to watch one thing
+func (c *Cancellation) Watch(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	go func() {
+		select {
+		case <-c.peerCancelled:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// PeerCancelled reports whether the peer has cancelled the transfer
+func (c *Cancellation) PeerCancelled() bool {
+	select {
+	case <-c.peerCancelled:
+		return true
+	default:
+		return false
+	}
+}
+
+// Resolve decides how a transfer watched by ctx ended. A peer cancel yields
+// peerErr, or the failure the peer reported. A local cancel is announced to the peer, waiting up to
+// CancelTimeout for its ack, and yields ErrTransferCancelled. Otherwise it
+// returns nil.
+func (c *Cancellation) Resolve(ctx context.Context, dc *pion.DataChannel, peerErr error) error {
+	if c.PeerCancelled() {
+		if c.peerErr != nil {
+			return c.peerErr
+		}
+		return peerErr
+	}
+	if ctx.Err() == nil {
+		return nil
+	}
+
+	if err := SendSimpleMessage(dc, MessageTypeCancelled); err == nil {
+		WaitForAck(c.acked, nil, time.Duration(CancelTimeout)*time.Second)
+	}
+	return ErrTransferCancelled
+}
+
+// errReadCancelled is what a cancelled ContextReader returns; SendChunks
+// shows its text on the file's progress line
+var errReadCancelled = errors.New("cancelled")
+
+// ContextReader stops reading once ctx is cancelled, which ends a
+// SendChunks loop at the next chunk
+func ContextReader(ctx context.Context, r io.Reader) io.Reader {
+	return &contextReader{ctx: ctx, r: r}
+}
+
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if r.ctx.Err() != nil {
+		return 0, errReadCancelled
+	}
+	return r.r.Read(p)
+}
@@ -0,0 +1,168 @@
+package transfer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/ui"
+	"github.com/BioHazard786/Warpdrop/cli/internal/webrtc"
+	pion "github.com/pion/webrtc/v4"
+)
+
+// NewHasher returns the hash used for file integrity checks
+func NewHasher() hash.Hash {
+	return sha256.New()
+}
+
+// HashPrefix feeds the first n bytes of r into h. Used when a transfer
+// resumes part way through a file so the checksum still covers all of it.
+func HashPrefix(h hash.Hash, r io.Reader, n uint64) error {
+	_, err := io.CopyN(h, r, int64(n))
+	return err
+}
+
+// FormatChecksum returns the hex encoding of h's current sum
+func FormatChecksum(h hash.Hash) string {
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ChecksumStore collects checksums announced by the sender so the receiver
+// can wait for a file's checksum once it has finished writing it
+type ChecksumStore struct {
+	mu       sync.Mutex
+	sums     map[string]string
+	notify   chan struct{}
+	expected bool
+}
+
+func NewChecksumStore() *ChecksumStore {
+	return &ChecksumStore{
+		sums:   make(map[string]string),
+		notify: make(chan struct{}),
+	}
+}
+
+func (c *ChecksumStore) Set(meta webrtc.FileMetadata) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sums[meta.Name] = meta.Checksum
+	close(c.notify)
+	c.notify = make(chan struct{})
+}
+
+// Expect records that the sender sends checksums, as its device info says.
+// Until then Wait doesn't wait for checksums that would never come.
+func (c *ChecksumStore) Expect() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expected = true
+}
+
+// Has reports whether the checksum for fileName has arrived. The sender
+// announces it once every chunk of the file is sent.
+func (c *ChecksumStore) Has(fileName string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.sums[fileName]
+	return ok
+}
+
+// Wait returns the checksum for fileName, waiting up to timeout for it if
+// the sender is expected to send one
+func (c *ChecksumStore) Wait(fileName string, timeout time.Duration) (string, bool) {
+	deadline := time.After(timeout)
+	for {
+		c.mu.Lock()
+		sum, ok := c.sums[fileName]
+		notify := c.notify
+		expected := c.expected
+		c.mu.Unlock()
+
+		if ok {
+			return sum, true
+		}
+		if !expected {
+			return "", false
+		}
+
+		select {
+		case <-notify:
+		case <-deadline:
+			return "", false
+		}
+	}
+}
+
+// VerifyFile compares a completed file against the sender's checksum.
+// It returns ErrChecksumMissing if the sender sends none or none arrived
+// within CloseTimeout, and ErrChecksumMismatch if the hashes differ.
+func VerifyFile(writer *FileWriter, store *ChecksumStore) (expected, actual string, err error) {
+	expected, ok := store.Wait(writer.Metadata.Name, time.Duration(CloseTimeout)*time.Second)
+	if !ok || expected == "" {
+		return "", "", ErrChecksumMissing
+	}
+
+	actual, err = writer.Checksum()
+	if err != nil {
+		return expected, "", err
+	}
+
+	if !strings.EqualFold(expected, actual) {
+		return expected, actual, ErrChecksumMismatch
+	}
+	return expected, actual, nil
+}
+
+// VerificationResult tracks files that failed or could not be verified
+type VerificationResult struct {
+	mu         sync.Mutex
+	Mismatched []string
+	Unverified []string
+}
+
+func (v *VerificationResult) Record(fileName string, err error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	switch err {
+	case ErrChecksumMismatch:
+		v.Mismatched = append(v.Mismatched, fileName)
+	case nil:
+	default:
+		v.Unverified = append(v.Unverified, fileName)
+	}
+}
+
+// Err returns an error listing mismatched files, if any
+func (v *VerificationResult) Err() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if len(v.Mismatched) == 0 {
+		return nil
+	}
+	return WrapError("verify", ErrChecksumMismatch, strings.Join(v.Mismatched, ", "))
+}
+
+// Warn prints a warning for files the sender did not provide checksums for
+func (v *VerificationResult) Warn(out *ui.Reporter) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if len(v.Unverified) > 0 {
+		out.PrintWarningf("Could not verify: %s", strings.Join(v.Unverified, ", "))
+	}
+}
+
+// Check verifies a completed file and records the outcome. On a mismatch the
+// sender is told over dc so both sides fail the transfer.
+func (v *VerificationResult) Check(dc *pion.DataChannel, writer *FileWriter, store *ChecksumStore) error {
+	expected, actual, err := VerifyFile(writer, store)
+	v.Record(writer.Metadata.Name, err)
+	if err == ErrChecksumMismatch {
+		SendChecksumMismatch(dc, writer.Metadata.Name, expected, actual)
+	}
+	return err
+}
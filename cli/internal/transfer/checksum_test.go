@@ -0,0 +1,41 @@
+package transfer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/webrtc"
+)
+
+func TestChecksumWaitWithoutChecksums(t *testing.T) {
+	store := NewChecksumStore()
+
+	start := time.Now()
+	if _, ok := store.Wait("a.txt", 5*time.Second); ok {
+		t.Fatal("got a checksum nobody sent")
+	}
+	if waited := time.Since(start); waited > time.Second {
+		t.Errorf("waited %v for a sender that sends no checksums", waited)
+	}
+}
+
+func TestChecksumWaitExpected(t *testing.T) {
+	store := NewChecksumStore()
+	store.Expect()
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		store.Set(webrtc.FileMetadata{Name: "a.txt", Checksum: "abc"})
+	}()
+	if sum, ok := store.Wait("a.txt", 5*time.Second); !ok || sum != "abc" {
+		t.Errorf("Wait = %q, %v, want abc", sum, ok)
+	}
+
+	start := time.Now()
+	if _, ok := store.Wait("b.txt", 100*time.Millisecond); ok {
+		t.Fatal("got a checksum nobody sent")
+	}
+	if waited := time.Since(start); waited < 100*time.Millisecond {
+		t.Errorf("gave up after %v, want the whole timeout", waited)
+	}
+}
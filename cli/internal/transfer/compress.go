@@ -0,0 +1,93 @@
+package transfer
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/utils"
+	"github.com/klauspost/compress/zstd"
+)
+
+// CompressionZstd compresses each chunk independently with zstd
+const CompressionZstd = "zstd"
+
+var (
+	zstdEncoder = sync.OnceValue(func() *zstd.Encoder {
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest))
+		return enc
+	})
+	// No chunk decodes to more than the largest chunk a sender may use,
+	// so a sender can't make the receiver decode a bomb into memory
+	zstdDecoder = sync.OnceValue(func() *zstd.Decoder {
+		dec, _ := zstd.NewReader(nil,
+			zstd.WithDecoderConcurrency(0),
+			zstd.WithDecoderMaxMemory(utils.ChunkSizeLimit))
+		return dec
+	})
+)
+
+// incompressibleTypes are MIME types whose contents are already compressed
+var incompressibleTypes = map[string]bool{
+	"application/zip":              true,
+	"application/gzip":             true,
+	"application/x-gzip":           true,
+	"application/x-bzip2":          true,
+	"application/x-xz":             true,
+	"application/x-7z-compressed":  true,
+	"application/x-rar-compressed": true,
+	"application/vnd.rar":          true,
+	"application/zstd":             true,
+	"application/pdf":              true,
+	"application/epub+zip":         true,
+	"application/java-archive":     true,
+}
+
+// ShouldCompress reports whether a file of the given MIME type is worth
+// compressing. Most images, audio and video are compressed already.
+func ShouldCompress(mimeType string) bool {
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	mimeType = strings.ToLower(strings.TrimSpace(mimeType))
+
+	if incompressibleTypes[mimeType] {
+		return false
+	}
+	switch mimeType {
+	case "image/svg+xml", "image/bmp", "image/x-ms-bmp", "image/tiff", "audio/wav", "audio/x-wav":
+		return true
+	}
+	for _, prefix := range []string{"image/", "audio/", "video/"} {
+		if strings.HasPrefix(mimeType, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// PickCompression returns the offered codec if this build can decode it,
+// otherwise "" for no compression
+func PickCompression(offered string) string {
+	if offered == CompressionZstd {
+		return offered
+	}
+	return ""
+}
+
+// Compress encodes a chunk with codec. An empty codec returns data as is.
+func Compress(codec string, data []byte) []byte {
+	if codec != CompressionZstd {
+		return data
+	}
+	return zstdEncoder().EncodeAll(data, nil)
+}
+
+// Decompress reverses Compress
+func Decompress(codec string, data []byte) ([]byte, error) {
+	switch codec {
+	case "":
+		return data, nil
+	case CompressionZstd:
+		return zstdDecoder().DecodeAll(data, nil)
+	default:
+		return nil, WrapError("decompress", ErrUnsupportedCompression, codec)
+	}
+}
@@ -0,0 +1,35 @@
+package transfer
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/utils"
+)
+
+func TestDecompressRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("warpdrop "), utils.ChunkSizeLimit/9)
+	got, err := Decompress(CompressionZstd, Compress(CompressionZstd, data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("decompressed chunk differs")
+	}
+}
+
+func TestDecompressRejectsBomb(t *testing.T) {
+	// 64 MB of zeros compresses to a few KB, well under a chunk
+	bomb := Compress(CompressionZstd, make([]byte, 64*1024*1024))
+	if len(bomb) > utils.ChunkSizeLimit {
+		t.Fatalf("bomb is %d bytes, expected it to fit in a chunk", len(bomb))
+	}
+	if _, err := Decompress(CompressionZstd, bomb); err == nil {
+		t.Error("decoded a chunk larger than the chunk size limit")
+	}
+
+	justOver := Compress(CompressionZstd, make([]byte, utils.ChunkSizeLimit+1))
+	if _, err := Decompress(CompressionZstd, justOver); err == nil {
+		t.Error("decoded a chunk one byte over the limit")
+	}
+}
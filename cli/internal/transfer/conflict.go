@@ -0,0 +1,62 @@
+package transfer
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/utils"
+	"github.com/BioHazard786/Warpdrop/cli/internal/webrtc"
+)
+
+// What to do when a received file's name is already taken
+const (
+	// ConflictRename writes to "name (1).ext" and so on instead
+	ConflictRename = "rename"
+
+	// ConflictOverwrite replaces the existing file
+	ConflictOverwrite = "overwrite"
+
+	// ConflictSkip asks the sender not to send the file at all
+	ConflictSkip = "skip"
+)
+
+// ConflictPolicies lists the accepted values of --on-conflict
+var ConflictPolicies = []string{ConflictRename, ConflictOverwrite, ConflictSkip}
+
+func conflictPolicy(opts *TransferOptions) string {
+	if opts == nil || opts.OnConflict == "" {
+		return ConflictRename
+	}
+	return opts.OnConflict
+}
+
+// conflicts reports whether meta would land on an existing file under the
+// skip policy. A partial file the resume sidecar can continue doesn't count.
+func conflicts(opts *TransferOptions, meta webrtc.FileMetadata) bool {
+	if conflictPolicy(opts) != ConflictSkip || opts.Stdout || opts.Bench || opts.Zip != nil {
+		return false
+	}
+
+	target, err := outputPath(opts.OutputDir, meta)
+	if err != nil {
+		return false
+	}
+	if _, err := os.Stat(target); errors.Is(err, fs.ErrNotExist) {
+		return false
+	}
+
+	entry, ok := LoadResumeState(opts.OutputDir).Lookup(meta)
+	return !ok || entry.Path != target
+}
+
+// createTarget creates the file meta is written to, resolving a name that is
+// already taken by the policy in opts. Under the skip policy, files that
+// turn up after the offer was filtered are renamed.
+func createTarget(opts *TransferOptions, target string) (*os.File, string, error) {
+	if conflictPolicy(opts) != ConflictOverwrite {
+		target = utils.GetUniqueFilename(target)
+	}
+	file, err := os.Create(target)
+	return file, target, err
+}
@@ -1,27 +1,186 @@
 package transfer
 
 import (
+	"os"
+	"time"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/trust"
+	"github.com/BioHazard786/Warpdrop/cli/internal/ui"
 	"github.com/BioHazard786/Warpdrop/cli/internal/utils"
 )
 
 const (
-	MessageTypeFilesMetadata   = "files_metadata"
-	MessageTypeDeviceInfo      = "device_info"
-	MessageTypeReadyToReceive  = "ready_to_receive"
-	MessageTypeChunk           = "chunk"
-	MessageTypeDownloadingDone = "downloading_done"
-	MessageTypeDeclineReceive  = "decline_receive"
+	MessageTypeFilesMetadata    = "files_metadata"
+	MessageTypeDeviceInfo       = "device_info"
+	MessageTypeReadyToReceive   = "ready_to_receive"
+	MessageTypeChunk            = "chunk"
+	MessageTypeDownloadingDone  = "downloading_done"
+	MessageTypeDeclineReceive   = "decline_receive"
+	MessageTypeProgressRequest  = "progress_request"
+	MessageTypeReceiveProgress  = "receive_progress"
+	MessageTypeFileChecksum     = "file_checksum"
+	MessageTypeChecksumMismatch = "checksum_mismatch"
+	MessageTypeAuthChallenge    = "auth_challenge"
+	MessageTypeAuthResponse     = "auth_response"
+	MessageTypeCancelled        = "transfer_cancelled"
+	MessageTypeCancelAck        = "cancel_ack"
+	MessageTypePipelineDepth    = "pipeline_depth"
+	MessageTypeFileCancelled    = "file_cancelled"
+	MessageTypeTransferError    = "transfer_error"
+	MessageTypeFilesSkipped     = "files_skipped"
+	MessageTypeRequestRange     = "request_range"
+	MessageTypeRetryFiles       = "retry_files"
+	MessageTypePing             = "ping"
+	MessageTypePong             = "pong"
+	MessageTypeFallback         = "protocol_fallback"
+	MessageTypePaused           = "transfer_paused"
+	MessageTypeResumed          = "transfer_resumed"
 )
 
 var (
-	HighWaterMark = utils.HighWaterMark
-	LowWaterMark  = utils.LowWaterMark
 	SendTimeout   = utils.SendTimeout
 	DrainTimeout  = utils.DrainTimeout
+	CloseTimeout  = utils.CloseTimeout
 	SignalTimeout = utils.SignalTimeout
+	CancelTimeout = utils.CancelTimeout
+
+	RangeRetryInterval = utils.RangeRetryInterval
+
+	ProgressReportInterval = utils.ProgressReportInterval
+	MaxPipelineDepth       = utils.MaxPipelineDepth
 )
 
 type TransferOptions struct {
 	OutputDir string
-	ZipMode   bool
+
+	// Zip receives every file into this archive instead of OutputDir
+	Zip *ZipArchive
+
+	// DirMode is the permission mode of directories created for received
+	// files; zero uses DefaultDirMode
+	DirMode os.FileMode
+
+	// CreateDirs creates OutputDir when it is missing. Without it a missing
+	// OutputDir fails the transfer. Folders sent by the peer are created
+	// inside OutputDir either way.
+	CreateDirs bool
+
+	// Stdout writes the single received file to stdout instead of OutputDir
+	Stdout bool
+
+	// Bench runs a transfer to measure throughput: received data is thrown
+	// away instead of saved, and nothing is added to the transfer history
+	Bench bool
+
+	// ConfirmProgress asks the receiver to report bytes written so the
+	// sender can display confirmed progress alongside bytes sent
+	ConfirmProgress bool
+
+	// Verify compares each received file against the sender's SHA-256
+	Verify bool
+
+	// RateLimit caps the upload rate in bytes per second; zero is unlimited
+	RateLimit int64
+
+	// Password encrypts chunks end to end. Receivers prompt when it is empty
+	// and the sender asks for one.
+	Password string
+
+	// RoomID is recorded in the transfer history
+	RoomID string
+
+	// Compress offers to zstd-compress chunks of files that aren't already
+	// compressed. It is only used when the receiver accepts.
+	Compress bool
+
+	// PipelineDepth is how many ready_to_receive requests a single-channel
+	// receiver may have outstanding. Zero or one sends files one at a time.
+	PipelineDepth int
+
+	// AutoAccept receives offered files without asking
+	AutoAccept bool
+
+	// AcceptTimeout declines the offer when the consent prompt gets no
+	// answer in time. Zero waits indefinitely.
+	AcceptTimeout time.Duration
+
+	// TrustedPeers are accepted without asking, matched by fingerprint
+	TrustedPeers *trust.List
+
+	// MaxSize and MaxFiles decline offers over the total size or file
+	// count without asking. Zero is unlimited.
+	MaxSize  uint64
+	MaxFiles int
+
+	// StallTimeout fails a receive that gets no data for this long and
+	// tells the sender. Zero never gives up.
+	StallTimeout time.Duration
+
+	// HeartbeatTimeout fails a transfer when nothing is heard from the peer
+	// for this long, though pings go out every few seconds. Zero turns the
+	// heartbeat off.
+	HeartbeatTimeout time.Duration
+
+	// ConfirmTimeout is how long a sender waits after the last chunk for
+	// the receiver to confirm it wrote everything. Zero picks a timeout
+	// from the size, or none while the heartbeat is on.
+	ConfirmTimeout time.Duration
+
+	// NATCheck probes the NAT type during connection setup and warns when
+	// both peers are symmetric, which needs a relay
+	NATCheck bool
+
+	// OnConflict is what to do when a received file's name is taken: one of
+	// ConflictRename, ConflictOverwrite or ConflictSkip. Empty renames.
+	OnConflict string
+
+	// Preserve gives received files the sender's modification time and
+	// permissions instead of fresh ones
+	Preserve bool
+
+	// AcceptTypes and RejectTypes filter the offered files by MIME type or
+	// extension glob. Filtered files are skipped rather than received.
+	AcceptTypes []string
+	RejectTypes []string
+
+	// Retries is how many times a multi-channel sender sends a file again
+	// on a fresh channel after the receiver lost it. Zero turns retries off.
+	Retries int
+
+	// StatsOut is a CSV file a sender writes throughput samples to once
+	// the transfer completes. Empty records nothing.
+	StatsOut string
+
+	// Stats, when set, records the sender's throughput samples instead of
+	// a recorder for StatsOut, for callers that show them themselves
+	Stats *StatsRecorder
+
+	// Reporter receives the transfer's output. Nil draws it on the
+	// terminal, or writes JSON events in --json mode.
+	Reporter *ui.Reporter
+}
+
+// Out returns where the transfer reports to; opts may be nil
+func (opts *TransferOptions) Out() *ui.Reporter {
+	if opts == nil {
+		return nil
+	}
+	return opts.Reporter
+}
+
+// StatsRecorder returns the recorder a sender records throughput samples
+// with, nil when none are wanted; opts may be nil
+func (opts *TransferOptions) StatsRecorder() *StatsRecorder {
+	if opts == nil {
+		return nil
+	}
+	if opts.Stats != nil {
+		return opts.Stats
+	}
+	return NewStatsRecorder(opts.StatsOut)
+}
+
+// ClampPipelineDepth limits a requested pipeline depth to 1..MaxPipelineDepth
+func ClampPipelineDepth(depth int) int {
+	return max(1, min(depth, MaxPipelineDepth))
 }
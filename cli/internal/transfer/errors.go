@@ -3,27 +3,73 @@ package transfer
 import (
 	"errors"
 	"fmt"
+	"io/fs"
 
 	"github.com/BioHazard786/Warpdrop/cli/internal/ui"
+	"github.com/BioHazard786/Warpdrop/cli/internal/utils"
+	"github.com/BioHazard786/Warpdrop/cli/internal/webrtc"
 )
 
 var (
-	ErrPeerDisconnected  = errors.New("peer disconnected")
-	ErrSignalingError    = errors.New("signaling server error")
-	ErrTimeout           = errors.New("timeout")
-	ErrChannelClosed     = errors.New("channel closed")
-	ErrChannelNotOpen    = errors.New("channel not open")
-	ErrTransferDeclined  = errors.New("receiver declined the transfer")
-	ErrTransferCancelled = errors.New("transfer cancelled by user")
-	ErrBufferTimeout     = errors.New("buffer drain timeout")
-	ErrInvalidFile       = errors.New("invalid file")
-	ErrFilenameMismatch  = errors.New("filename mismatch")
-	ErrUnexpectedSignal  = errors.New("unexpected signal type")
-	ErrMetadataFailed    = errors.New("failed to process metadata")
-	ErrConnectionFailed  = errors.New("connection failed")
-	ErrChannelsNotReady  = errors.New("channels not ready")
+	ErrPeerDisconnected       = errors.New("peer disconnected")
+	ErrSignalingError         = errors.New("signaling server error")
+	ErrTimeout                = errors.New("timeout")
+	ErrChannelClosed          = errors.New("channel closed")
+	ErrChannelNotOpen         = errors.New("channel not open")
+	ErrTransferDeclined       = errors.New("receiver declined the transfer")
+	ErrTransferCancelled      = errors.New("transfer cancelled by user")
+	ErrSenderCancelled        = errors.New("sender cancelled the transfer")
+	ErrReceiverCancelled      = errors.New("receiver cancelled the transfer")
+	ErrBufferTimeout          = errors.New("buffer drain timeout")
+	ErrInvalidFile            = errors.New("invalid file")
+	ErrFilenameMismatch       = errors.New("filename mismatch")
+	ErrUnexpectedSignal       = errors.New("unexpected signal type")
+	ErrMetadataFailed         = errors.New("failed to process metadata")
+	ErrConnectionFailed       = errors.New("connection failed")
+	ErrChannelsNotReady       = errors.New("channels not ready")
+	ErrChecksumMismatch       = errors.New("checksum mismatch")
+	ErrChecksumMissing        = errors.New("sender did not provide a checksum")
+	ErrUnsafePath             = errors.New("unsafe file path")
+	ErrNoFinalAck             = errors.New("receiver did not confirm completion")
+	ErrDirectFailed           = errors.New("direct connection could not be established (TURN disabled by --no-turn)")
+	ErrWrongPassword          = errors.New("incorrect password")
+	ErrPasswordRequired       = errors.New("transfer is password protected but no password was given")
+	ErrDecryptFailed          = errors.New("could not decrypt data (wrong password or corrupted transfer)")
+	ErrNoEncryption           = errors.New("password-protected transfers need the WarpDrop CLI on the receiving side")
+	ErrZipExists              = errors.New("zip file already exists (use --force to overwrite)")
+	ErrUnsupportedCompression = errors.New("unsupported compression")
+	ErrDiskFull               = errors.New("not enough disk space")
+	ErrPermissionDenied       = errors.New("permission denied")
+	ErrFileMissing            = errors.New("file no longer exists")
+	ErrPeerFailed             = errors.New("peer reported an error")
+	ErrStdoutMultipleFiles    = errors.New("--stdout takes a single file (add --zip to pipe an archive of several)")
+	ErrStdoutSeek             = errors.New("data arrived out of order, which stdout can't take")
+	ErrZipOutOfOrder          = errors.New("too much data arrived out of order to stream into the zip")
+	ErrOfferTooLarge          = errors.New("offer is over the size limit")
+	ErrOfferTooManyFiles      = errors.New("offer is over the file count limit")
+	ErrOutputDirMissing       = errors.New("output directory does not exist")
+	ErrOfferFiltered          = errors.New("no offered files match the type filters")
+	ErrPeerUnresponsive       = errors.New("peer stopped responding")
+	ErrNoCommonProtocol       = errors.New("peer supports no transfer protocol this version can run")
+	ErrRetriesExhausted       = errors.New("file failed and has no retries left")
+	ErrFallback               = errors.New("file channels did not open, falling back to a single channel")
 )
 
+// Codes sent in transfer_error messages. They are part of the protocol, so
+// existing values must not change.
+const (
+	ErrorCodeDiskFull         = "disk_full"
+	ErrorCodePermissionDenied = "permission_denied"
+	ErrorCodeFileMissing      = "file_missing"
+	ErrorCodeFailed           = "failed"
+)
+
+var errorsByCode = map[string]error{
+	ErrorCodeDiskFull:         ErrDiskFull,
+	ErrorCodePermissionDenied: ErrPermissionDenied,
+	ErrorCodeFileMissing:      ErrFileMissing,
+}
+
 type TransferError struct {
 	Op      string
 	File    string
@@ -61,6 +107,91 @@ func WrapError(op string, err error, details string) *TransferError {
 	return &TransferError{Op: op, Err: err, Details: details}
 }
 
+// declinedError is ErrTransferDeclined with the receiver's reason
+type declinedError struct {
+	reason string
+}
+
+func (e *declinedError) Error() string {
+	return fmt.Sprintf("%v (%s)", ErrTransferDeclined, e.reason)
+}
+
+func (e *declinedError) Unwrap() error {
+	return ErrTransferDeclined
+}
+
+// DeclinedError is the sender's error for a declined offer, with the
+// receiver's reason when it gave one. The reason may have been typed by
+// the receiver, so it is made safe to print.
+func DeclinedError(reason string) error {
+	reason = utils.SanitizeDisplayName(reason)
+	if reason == "" {
+		return ErrTransferDeclined
+	}
+	return &declinedError{reason: reason}
+}
+
+// Declined reports whether err is a declined offer, and the receiver's
+// reason when it gave one
+func Declined(err error) (string, bool) {
+	var declined *declinedError
+	if errors.As(err, &declined) {
+		return declined.reason, true
+	}
+	return "", errors.Is(err, ErrTransferDeclined)
+}
+
+// DeclineReason describes why an offer was refused for the sender, without
+// the local operation name
+func DeclineReason(err error) string {
+	var transferErr *TransferError
+	if errors.As(err, &transferErr) && transferErr.Details != "" {
+		return fmt.Sprintf("%v: %s", transferErr.Err, transferErr.Details)
+	}
+	return err.Error()
+}
+
+// ErrorCode classifies err for a transfer_error message
+func ErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrDiskFull), utils.IsDiskFull(err):
+		return ErrorCodeDiskFull
+	case errors.Is(err, ErrPermissionDenied), errors.Is(err, fs.ErrPermission):
+		return ErrorCodePermissionDenied
+	case errors.Is(err, ErrFileMissing), errors.Is(err, fs.ErrNotExist):
+		return ErrorCodeFileMissing
+	}
+	return ErrorCodeFailed
+}
+
+// NewErrorPayload describes err for the peer. Local paths are left out of
+// the message since they mean nothing on the other machine.
+func NewErrorPayload(err error) webrtc.ErrorPayload {
+	payload := webrtc.ErrorPayload{Code: ErrorCode(err), Message: err.Error()}
+
+	var transferErr *TransferError
+	if errors.As(err, &transferErr) {
+		payload.FileName = transferErr.File
+	}
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		payload.Message = pathErr.Err.Error()
+	}
+	return payload
+}
+
+// RemoteError turns a failure reported by the peer into an error
+func RemoteError(payload webrtc.ErrorPayload) error {
+	err, ok := errorsByCode[payload.Code]
+	if !ok {
+		return WrapError("transfer", ErrPeerFailed, payload.Message)
+	}
+	if payload.FileName != "" {
+		return NewFileError("peer", payload.FileName, err)
+	}
+	return NewError("peer", err)
+}
+
 func PrintErr(err error) {
 	ui.PrintError(err.Error())
 }
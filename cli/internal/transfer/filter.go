@@ -0,0 +1,91 @@
+package transfer
+
+import (
+	"path"
+	"strings"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/webrtc"
+)
+
+// CheckTypePatterns reports the first malformed --accept-type or
+// --reject-type pattern
+func CheckTypePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(typePattern(pattern), ""); err != nil {
+			return WrapError("parse type filter", err, pattern)
+		}
+	}
+	return nil
+}
+
+// Why a file was skipped, as shown in its progress row
+const (
+	SkipFiltered = "filtered by type"
+	SkipExists   = "already exists"
+)
+
+// FilterOffer splits the offered files into those to receive and those to
+// skip, mapped to the reason. A file is skipped when it matches a reject
+// pattern, when accept patterns are set and it matches none, or when it
+// already exists and OnConflict is skip. opts may be nil.
+func FilterOffer(opts *TransferOptions, metas []webrtc.FileMetadata) ([]webrtc.FileMetadata, map[string]string) {
+	if opts == nil {
+		return metas, nil
+	}
+
+	keep := make([]webrtc.FileMetadata, 0, len(metas))
+	skipped := make(map[string]string)
+	for _, meta := range metas {
+		switch {
+		case matchesType(opts.RejectTypes, meta),
+			len(opts.AcceptTypes) > 0 && !matchesType(opts.AcceptTypes, meta):
+			skipped[meta.Name] = SkipFiltered
+		case conflicts(opts, meta):
+			skipped[meta.Name] = SkipExists
+		default:
+			keep = append(keep, meta)
+		}
+	}
+	return keep, skipped
+}
+
+// SkippedNames lists the skipped files in offer order
+func SkippedNames(metas []webrtc.FileMetadata, skipped map[string]string) []string {
+	names := make([]string, 0, len(skipped))
+	for _, meta := range metas {
+		if skipped[meta.Name] != "" {
+			names = append(names, meta.Name)
+		}
+	}
+	return names
+}
+
+// matchesType reports whether meta matches any pattern. Patterns with a
+// slash are matched against the MIME type, such as image/*; others against
+// the file name, such as *.pdf. A bare extension like pdf means *.pdf.
+func matchesType(patterns []string, meta webrtc.FileMetadata) bool {
+	mimeType, _, _ := strings.Cut(strings.ToLower(meta.Type), ";")
+	mimeType = strings.TrimSpace(mimeType)
+	name := strings.ToLower(path.Base(meta.Name))
+
+	for _, pattern := range patterns {
+		pattern = typePattern(pattern)
+		subject := name
+		if strings.Contains(pattern, "/") {
+			subject = mimeType
+		}
+		if ok, _ := path.Match(pattern, subject); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// typePattern normalises a pattern for matching
+func typePattern(pattern string) string {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if !strings.Contains(pattern, "/") && !strings.ContainsAny(pattern, "*?[") {
+		return "*." + strings.TrimPrefix(pattern, ".")
+	}
+	return pattern
+}
@@ -0,0 +1,100 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	pion "github.com/pion/webrtc/v4"
+)
+
+// DefaultHeartbeatTimeout is how long a transfer goes without hearing from
+// the peer before the connection is given up as dead
+const DefaultHeartbeatTimeout = 15 * time.Second
+
+// maxPingInterval bounds the time between pings, so long timeouts still
+// notice a dead peer soon after they expire
+const maxPingInterval = 5 * time.Second
+
+// HeartbeatTimeout returns the heartbeat timeout set in opts. Zero turns the
+// heartbeat off.
+func HeartbeatTimeout(opts *TransferOptions) time.Duration {
+	if opts == nil {
+		return DefaultHeartbeatTimeout
+	}
+	return opts.HeartbeatTimeout
+}
+
+// Heartbeat pings the peer over a data channel and notices when it goes
+// quiet. Any message counts as a sign of life, since a pong can queue
+// behind chunks on a busy channel.
+type Heartbeat struct {
+	// last is when the peer was last heard from, in Unix nanoseconds
+	last atomic.Int64
+
+	// answered is set by the first pong. Peers that never answer pings,
+	// like older versions, are never timed out.
+	answered atomic.Bool
+}
+
+func NewHeartbeat() *Heartbeat {
+	h := &Heartbeat{}
+	h.Alive()
+	return h
+}
+
+// Alive records that a message arrived from the peer
+func (h *Heartbeat) Alive() {
+	h.last.Store(time.Now().UnixNano())
+}
+
+// HandleMessage answers a ping with a pong and notes pongs
+func (h *Heartbeat) HandleMessage(dc *pion.DataChannel, msgType string) {
+	switch msgType {
+	case MessageTypePing:
+		SendSimpleMessage(dc, MessageTypePong)
+	case MessageTypePong:
+		h.answered.Store(true)
+	}
+}
+
+// Watch returns a context that is cancelled with an ErrPeerUnresponsive
+// error once the peer has been quiet for timeout, pinging it over dc in the
+// meantime. A zero timeout never cancels it.
+func (h *Heartbeat) Watch(parent context.Context, dc *pion.DataChannel, timeout time.Duration) (context.Context, context.CancelCauseFunc) {
+	ctx, cancel := context.WithCancelCause(parent)
+	if timeout <= 0 {
+		return ctx, cancel
+	}
+
+	h.Alive()
+	go func() {
+		ticker := time.NewTicker(min(timeout/3, maxPingInterval))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				quiet := now.Sub(time.Unix(0, h.last.Load()))
+				if h.answered.Load() && quiet >= timeout {
+					cancel(WrapError("transfer", ErrPeerUnresponsive, fmt.Sprintf("nothing heard for %s", quiet.Round(time.Second))))
+					return
+				}
+				SendSimpleMessage(dc, MessageTypePing)
+			}
+		}
+	}()
+	return ctx, cancel
+}
+
+// HeartbeatError returns the heartbeat failure that cancelled ctx, or err
+// when it was something else
+func HeartbeatError(ctx context.Context, err error) error {
+	if cause := context.Cause(ctx); errors.Is(cause, ErrPeerUnresponsive) {
+		return cause
+	}
+	return err
+}
@@ -0,0 +1,49 @@
+package transfer
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimitBurst is how much unused budget may accumulate while idle
+const rateLimitBurst = 100 * time.Millisecond
+
+// RateLimiter is a token bucket capping the bytes sent per second across
+// every channel that shares it. Callers reserve budget in the order they
+// arrive, so concurrent file senders take turns and split the rate evenly.
+// A nil limiter does not limit.
+type RateLimiter struct {
+	mu       sync.Mutex
+	rate     float64 // bytes per second
+	nextFree time.Time
+}
+
+// NewRateLimiter returns a limiter for bytesPerSecond, or nil if it is not positive
+func NewRateLimiter(bytesPerSecond int64) *RateLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &RateLimiter{
+		rate: float64(bytesPerSecond),
+	}
+}
+
+// Wait blocks until n bytes may be sent
+func (l *RateLimiter) Wait(n int) {
+	if l == nil || n <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	if earliest := now.Add(-rateLimitBurst); l.nextFree.Before(earliest) {
+		l.nextFree = earliest
+	}
+	l.nextFree = l.nextFree.Add(time.Duration(float64(n) / l.rate * float64(time.Second)))
+	wait := l.nextFree.Sub(now)
+	l.mu.Unlock()
+
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
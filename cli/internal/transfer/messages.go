@@ -1,8 +1,10 @@
 package transfer
 
 import (
+	"fmt"
 	"strings"
 
+	"github.com/BioHazard786/Warpdrop/cli/internal/utils"
 	"github.com/BioHazard786/Warpdrop/cli/internal/version"
 	"github.com/BioHazard786/Warpdrop/cli/internal/webrtc"
 	pion "github.com/pion/webrtc/v4"
@@ -32,16 +34,65 @@ func SendTypedMessage(dc *pion.DataChannel, msgType string, payload any) error {
 }
 
 func SendDeviceInfo(dc *pion.DataChannel) error {
-	return SendTypedMessage(dc, MessageTypeDeviceInfo, webrtc.DeviceInfoPayload{
-		DeviceName:    "CLI",
-		DeviceVersion: strings.TrimPrefix(version.Version, "v"),
-	})
+	return SendTypedMessage(dc, MessageTypeDeviceInfo, DeviceInfo())
+}
+
+// DeviceInfo describes this device to the peer
+func DeviceInfo() webrtc.DeviceInfoPayload {
+	return webrtc.DeviceInfoPayload{
+		DeviceName:     "CLI",
+		DeviceVersion:  strings.TrimPrefix(version.Version, "v"),
+		Interleave:     true,
+		QueuedChannels: true,
+		Controls:       true,
+		Checksums:      true,
+	}
+}
+
+// DeviceLabel is how a peer's device is shown, as "name vversion". Both come
+// from the peer, so they are sanitized like received filenames.
+func DeviceLabel(info webrtc.DeviceInfoPayload) string {
+	return fmt.Sprintf("%s v%s", utils.SanitizeDisplayName(info.DeviceName), utils.SanitizeDisplayName(info.DeviceVersion))
 }
 
-func SendReadyToReceive(dc *pion.DataChannel, fileName string, offset uint64) error {
+func SendReadyToReceive(dc *pion.DataChannel, fileName string, offset uint64, compression string) error {
 	return SendTypedMessage(dc, MessageTypeReadyToReceive, webrtc.ReadyToReceivePayload{
+		FileName:    fileName,
+		Offset:      offset,
+		Compression: compression,
+	})
+}
+
+func SendPipelineDepth(dc *pion.DataChannel, depth int) error {
+	return SendTypedMessage(dc, MessageTypePipelineDepth, webrtc.PipelineDepthPayload{Depth: depth})
+}
+
+func SendFileCancelled(dc *pion.DataChannel, fileName string) error {
+	return SendTypedMessage(dc, MessageTypeFileCancelled, webrtc.FileCancelledPayload{FileName: fileName})
+}
+
+// SendPause tells the receiver the sender paused or resumed, so it doesn't
+// take the quiet for a stall
+func SendPause(dc *pion.DataChannel, paused bool) error {
+	return SendSimpleMessage(dc, PauseMessageType(paused))
+}
+
+// SendFilesSkipped names offered files the receiver won't request
+func SendFilesSkipped(dc *pion.DataChannel, fileNames []string) error {
+	return SendTypedMessage(dc, MessageTypeFilesSkipped, webrtc.FilesSkippedPayload{FileNames: fileNames})
+}
+
+// SendRetryFiles asks the sender to send fileNames again on fresh channels
+func SendRetryFiles(dc *pion.DataChannel, fileNames []string) error {
+	return SendTypedMessage(dc, MessageTypeRetryFiles, webrtc.RetryFilesPayload{FileNames: fileNames})
+}
+
+// SendRequestRange asks the sender to resend the span r of fileName
+func SendRequestRange(dc *pion.DataChannel, fileName string, r ByteRange) error {
+	return SendTypedMessage(dc, MessageTypeRequestRange, webrtc.RequestRangePayload{
 		FileName: fileName,
-		Offset:   offset,
+		Offset:   r.Offset,
+		Length:   r.Length,
 	})
 }
 
@@ -53,6 +104,14 @@ func SendFilesMetadata(dc *pion.DataChannel, metadata []webrtc.FileMetadata) err
 	return SendTypedMessage(dc, MessageTypeFilesMetadata, metadata)
 }
 
+func SendAuthChallenge(dc *pion.DataChannel, key *PasswordKey) error {
+	return SendTypedMessage(dc, MessageTypeAuthChallenge, key.Challenge())
+}
+
+func SendAuthResponse(dc *pion.DataChannel, proof []byte) error {
+	return SendTypedMessage(dc, MessageTypeAuthResponse, webrtc.AuthResponsePayload{Proof: proof})
+}
+
 func ParseMessage(data []byte) (*webrtc.Message, error) {
 	var msg webrtc.Message
 	if err := msgpack.Unmarshal(data, &msg); err != nil {
@@ -60,3 +119,32 @@ func ParseMessage(data []byte) (*webrtc.Message, error) {
 	}
 	return &msg, nil
 }
+
+func SendReceiveProgress(dc *pion.DataChannel, fileName string, received uint64) error {
+	return SendTypedMessage(dc, MessageTypeReceiveProgress, webrtc.ReceiveProgressPayload{
+		FileName: fileName,
+		Received: received,
+	})
+}
+
+func SendFileChecksum(dc *pion.DataChannel, meta webrtc.FileMetadata, checksum string) error {
+	meta.Checksum = checksum
+	return SendTypedMessage(dc, MessageTypeFileChecksum, meta)
+}
+
+func SendChecksumMismatch(dc *pion.DataChannel, fileName, expected, actual string) error {
+	return SendTypedMessage(dc, MessageTypeChecksumMismatch, webrtc.ChecksumMismatchPayload{
+		FileName: fileName,
+		Expected: expected,
+		Actual:   actual,
+	})
+}
+
+// SendDecline declines the offer, telling the sender why when reason is set
+func SendDecline(dc *pion.DataChannel, reason string) error {
+	return SendTypedMessage(dc, MessageTypeDeclineReceive, webrtc.DeclinePayload{Reason: reason})
+}
+
+func SendTransferError(dc *pion.DataChannel, err error) error {
+	return SendTypedMessage(dc, MessageTypeTransferError, NewErrorPayload(err))
+}
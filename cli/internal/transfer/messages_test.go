@@ -0,0 +1,23 @@
+package transfer
+
+import (
+	"testing"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/webrtc"
+)
+
+func TestDeviceLabel(t *testing.T) {
+	tests := []struct {
+		info webrtc.DeviceInfoPayload
+		want string
+	}{
+		{webrtc.DeviceInfoPayload{DeviceName: "CLI", DeviceVersion: "1.2.0"}, "CLI v1.2.0"},
+		// A peer could otherwise clear the screen or recolour the prompt
+		{webrtc.DeviceInfoPayload{DeviceName: "\x1b[2J\x1b[HTrusted\u202e", DeviceVersion: "1.0\n\rOK"}, "[2J[HTrusted v1.0OK"},
+	}
+	for _, tt := range tests {
+		if got := DeviceLabel(tt.info); got != tt.want {
+			t.Errorf("DeviceLabel(%q, %q) = %q, want %q", tt.info.DeviceName, tt.info.DeviceVersion, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package transfer
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/config"
+	"github.com/BioHazard786/Warpdrop/cli/internal/dns"
+	"github.com/BioHazard786/Warpdrop/cli/internal/signaling"
+	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4"
+)
+
+// NATType is how this machine's NAT maps its addresses, as seen by STUN
+type NATType string
+
+const (
+	NATUnknown   NATType = ""
+	NATOpen      NATType = "open"      // a public address, no NAT
+	NATCone      NATType = "cone"      // the same mapping for every peer
+	NATSymmetric NATType = "symmetric" // a new mapping per peer, which defeats hole punching
+)
+
+// natProbeSTUN is asked alongside the configured STUN server when only one
+// is set, since telling NAT types apart needs two
+const natProbeSTUN = "stun:stun1.l.google.com:19302"
+
+// natCheckTimeout bounds each STUN request of the probe run during
+// connection setup
+const natCheckTimeout = 2 * time.Second
+
+// NATProbe is the result of ProbeNAT
+type NATProbe struct {
+	// External is the public address STUN saw, nil when no server answered
+	External net.IP
+	Type     NATType
+	// Err is the last server's failure, which leaves Type unknown when
+	// fewer than two servers answered
+	Err error
+}
+
+// ProbeNAT asks the stun: servers, plus a second one when only one is
+// given, for this machine's public address from a single socket. Every
+// server seeing the same address and port means a cone NAT; different
+// ports mean a symmetric one.
+func ProbeNAT(stunServers []string, timeout time.Duration) NATProbe {
+	var servers []string
+	for _, raw := range stunServers {
+		if uri, err := stun.ParseURI(raw); err == nil && uri.Scheme == stun.SchemeTypeSTUN {
+			servers = append(servers, raw)
+		}
+	}
+	if len(servers) == 0 {
+		return NATProbe{Err: fmt.Errorf("no stun: server over UDP is configured")}
+	}
+	if len(servers) == 1 && servers[0] != natProbeSTUN {
+		servers = append(servers, natProbeSTUN)
+	}
+
+	conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+	if err != nil {
+		return NATProbe{Err: err}
+	}
+	defer conn.Close()
+
+	client, err := turn.NewClient(&turn.ClientConfig{Conn: conn, RTO: timeout / 8})
+	if err != nil {
+		return NATProbe{Err: err}
+	}
+	defer client.Close()
+	if err := client.Listen(); err != nil {
+		return NATProbe{Err: err}
+	}
+
+	var probe NATProbe
+	var mapped []*net.UDPAddr
+	for _, server := range servers {
+		addr, err := bindingRequest(client, server, timeout)
+		if err != nil {
+			probe.Err = fmt.Errorf("%s: %w", server, err)
+			continue
+		}
+		mapped = append(mapped, addr)
+	}
+	if len(mapped) == 0 {
+		return probe
+	}
+	probe.External = mapped[0].IP
+
+	switch {
+	case isLocalIP(mapped[0].IP):
+		probe.Type = NATOpen
+	case len(mapped) < 2:
+	case sameMapping(mapped):
+		probe.Type = NATCone
+	default:
+		probe.Type = NATSymmetric
+	}
+	return probe
+}
+
+// bindingRequest asks one STUN server for the address it sees, giving up
+// after timeout
+func bindingRequest(client *turn.Client, server string, timeout time.Duration) (*net.UDPAddr, error) {
+	uri, err := stun.ParseURI(server)
+	if err != nil {
+		return nil, err
+	}
+	ip, err := dns.LookupIPv4(uri.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		addr net.Addr
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		addr, err := client.SendBindingRequestTo(&net.UDPAddr{IP: ip, Port: uri.Port})
+		done <- result{addr, err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return nil, r.err
+		}
+		return r.addr.(*net.UDPAddr), nil
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("no answer within %s", timeout)
+	}
+}
+
+func sameMapping(mapped []*net.UDPAddr) bool {
+	for _, addr := range mapped[1:] {
+		if !addr.IP.Equal(mapped[0].IP) || addr.Port != mapped[0].Port {
+			return false
+		}
+	}
+	return true
+}
+
+func isLocalIP(ip net.IP) bool {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// NATCheck probes the NAT while a connection is set up and trades the
+// result with a CLI peer over signaling. When both ends are symmetric,
+// which hole punching can't get through, warn is called once with a note
+// that the connection needs a relay.
+type NATCheck struct {
+	client signaling.Transport
+	cfg    *config.Config
+	warn   func(string)
+
+	mu      sync.Mutex
+	local   NATType
+	remote  NATType
+	warned  bool
+	stopped bool
+}
+
+// StartNATCheck starts probing when opts asks for it and returns nil
+// otherwise. All methods are no-ops on a nil NATCheck.
+func StartNATCheck(opts *TransferOptions, cfg *config.Config, client signaling.Transport, peerInfo *signaling.PeerInfo, warn func(string)) *NATCheck {
+	if opts == nil || !opts.NATCheck {
+		return nil
+	}
+
+	n := &NATCheck{client: client, cfg: cfg, warn: warn}
+	// Web peers neither send nor expect the NAT signal
+	share := peerInfo != nil && peerInfo.ClientType == "cli"
+	go func() {
+		probe := ProbeNAT(cfg.GetSTUNServers(), natCheckTimeout)
+
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		if n.stopped {
+			return
+		}
+		n.local = probe.Type
+		if share && probe.Type != NATUnknown {
+			client.SendMessage(&signaling.Message{
+				Type:    signaling.MessageTypeSignal,
+				Payload: signaling.SignalPayload{NAT: string(probe.Type)},
+			})
+		}
+		n.check()
+	}()
+	return n
+}
+
+// HandleSignal records the NAT type a peer sent
+func (n *NATCheck) HandleSignal(payload *signaling.SignalPayload) {
+	if n == nil || payload.NAT == "" {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.remote = NATType(payload.NAT)
+	n.check()
+}
+
+// Stop ends the check once the connection is up, after which nothing is
+// sent or warned
+func (n *NATCheck) Stop() {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	n.stopped = true
+	n.mu.Unlock()
+}
+
+// check warns when both ends are known to be symmetric. n.mu must be held.
+func (n *NATCheck) check() {
+	if n.warned || n.stopped || n.local != NATSymmetric || n.remote != NATSymmetric {
+		return
+	}
+	n.warned = true
+	if n.cfg.GetTURNServers() == nil {
+		n.warn("Both peers are behind symmetric NATs and no TURN server is configured, this may not connect...")
+		return
+	}
+	n.warn("Both peers are behind symmetric NATs, connecting through the TURN relay...")
+}
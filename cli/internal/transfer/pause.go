@@ -0,0 +1,128 @@
+package transfer
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// PauseGate lets the user pause sending. Readers wrapped by it block
+// before the next chunk while it is paused. A nil gate never pauses.
+type PauseGate struct {
+	mu      sync.Mutex
+	paused  bool
+	resumed chan struct{}
+}
+
+func NewPauseGate() *PauseGate {
+	return &PauseGate{}
+}
+
+// Toggle pauses a running gate or resumes a paused one and returns whether
+// it is now paused
+func (g *PauseGate) Toggle() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.paused {
+		close(g.resumed)
+	} else {
+		g.resumed = make(chan struct{})
+	}
+	g.paused = !g.paused
+	return g.paused
+}
+
+// Wait blocks while the gate is paused, returning early if ctx is cancelled
+func (g *PauseGate) Wait(ctx context.Context) error {
+	if g == nil {
+		return nil
+	}
+
+	g.mu.Lock()
+	paused, resumed := g.paused, g.resumed
+	g.mu.Unlock()
+	if !paused {
+		return nil
+	}
+
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return errReadCancelled
+	}
+}
+
+// Reader waits for the gate before every read from r
+func (g *PauseGate) Reader(ctx context.Context, r io.Reader) io.Reader {
+	return &pauseReader{ctx: ctx, gate: g, r: r}
+}
+
+type pauseReader struct {
+	ctx  context.Context
+	gate *PauseGate
+	r    io.Reader
+}
+
+func (r *pauseReader) Read(p []byte) (int, error) {
+	if err := r.gate.Wait(r.ctx); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// PauseMessageType is the message telling the receiver whether the sender
+// is paused
+func PauseMessageType(paused bool) string {
+	if paused {
+		return MessageTypePaused
+	}
+	return MessageTypeResumed
+}
+
+// PeerPause is a receiver's view of the sender's PauseGate, kept from the
+// pause messages it sends. Stall timeouts are held off while it is paused.
+// A nil PeerPause is never paused.
+type PeerPause struct {
+	mu      sync.Mutex
+	paused  bool
+	changed chan bool
+}
+
+func NewPeerPause() *PeerPause {
+	return &PeerPause{changed: make(chan bool, 1)}
+}
+
+// Set records whether the sender is paused. It is called from the one
+// goroutine reading the sender's messages.
+func (p *PeerPause) Set(paused bool) {
+	p.mu.Lock()
+	p.paused = paused
+	p.mu.Unlock()
+
+	// Only the latest state matters to a receive loop that missed one
+	select {
+	case <-p.changed:
+	default:
+	}
+	p.changed <- paused
+}
+
+// Paused reports whether the sender said it is paused
+func (p *PeerPause) Paused() bool {
+	if p == nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.paused
+}
+
+// Changed delivers whether the sender is paused each time it changes
+func (p *PeerPause) Changed() <-chan bool {
+	if p == nil {
+		return nil
+	}
+	return p.changed
+}
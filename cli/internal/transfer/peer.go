@@ -2,18 +2,34 @@ package transfer
 
 import (
 	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/BioHazard786/Warpdrop/cli/internal/config"
 	"github.com/BioHazard786/Warpdrop/cli/internal/signaling"
+	"github.com/BioHazard786/Warpdrop/cli/internal/trust"
 	"github.com/BioHazard786/Warpdrop/cli/internal/utils"
+	"github.com/pion/ice/v4"
 	pion "github.com/pion/webrtc/v4"
 )
 
 func NewPeerConnection(cfg *config.Config) (*pion.PeerConnection, error) {
-	iceServers := []pion.ICEServer{{URLs: cfg.GetSTUNServers()}}
+	var iceServers []pion.ICEServer
+	if stunServers := cfg.GetSTUNServers(); len(stunServers) > 0 {
+		iceServers = append(iceServers, pion.ICEServer{URLs: stunServers})
+	}
 
 	turnServers := cfg.GetTURNServers()
+	if cfg.ForceTCP {
+		turnServers = tcpTURNServers(turnServers)
+		if cfg.ForceRelay && turnServers == nil {
+			return nil, NewError("create peer connection", fmt.Errorf("--relay with --tcp needs a TURN server reachable over TCP or TLS"))
+		}
+	}
 	if turnServers != nil {
 		username, password := cfg.GetTURNCredentials()
 		iceServers = append(iceServers, pion.ICEServer{
@@ -23,23 +39,215 @@ func NewPeerConnection(cfg *config.Config) (*pion.PeerConnection, error) {
 		})
 	}
 
+	// With NoTURN set, GetTURNServers returns nil so the relay heuristic never applies
 	policy := pion.ICETransportPolicyAll
 	if turnServers != nil && (cfg.ForceRelay || utils.ShouldForceRelay()) {
 		policy = pion.ICETransportPolicyRelay
 	}
 
-	pc, err := pion.NewPeerConnection(pion.Configuration{
+	se, tcpMux, err := settingEngine(cfg)
+	if err != nil {
+		return nil, NewError("listen for ICE-TCP", err)
+	}
+	api := pion.NewAPI(pion.WithSettingEngine(se))
+
+	pcConfig := pion.Configuration{
 		ICEServers:         iceServers,
 		ICETransportPolicy: policy,
-	})
+	}
+	// The device certificate only lets receivers recognize trusted senders,
+	// so without one pion's throwaway certificate will do. Connecting never
+	// creates it; 'warpdrop trust' does.
+	if identity, err := trust.LoadIdentity(); err == nil {
+		pcConfig.Certificates = []pion.Certificate{identity.Certificate}
+	}
+
+	pc, err := api.NewPeerConnection(pcConfig)
 	if err != nil {
+		if tcpMux != nil {
+			tcpMux.Close()
+		}
 		return nil, NewError("create peer connection", err)
 	}
+
+	if tcpMux != nil {
+		pc.OnConnectionStateChange(func(state pion.PeerConnectionState) {
+			if state == pion.PeerConnectionStateClosed {
+				tcpMux.Close()
+			}
+		})
+	}
 	return pc, nil
 }
 
-func SetupICEHandlers(pc *pion.PeerConnection, client *signaling.Client, done chan struct{}) {
+// settingEngine restricts ICE to the transports and IP version cfg asks
+// for. With ForceTCP, besides dialing out (active TCP) it listens on a
+// random port so the peer can connect in (passive TCP), and returns the mux.
+func settingEngine(cfg *config.Config) (pion.SettingEngine, ice.TCPMux, error) {
+	var se pion.SettingEngine
+	if !cfg.ForceTCP {
+		if cfg.IPVersion != config.IPVersionAuto {
+			se.SetNetworkTypes(networkTypes(cfg.IPVersion, pion.NetworkTypeUDP4, pion.NetworkTypeUDP6))
+		}
+		return se, nil, nil
+	}
+
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		return se, nil, err
+	}
+
+	mux := pion.NewICETCPMux(nil, listener, 8)
+	se.SetICETCPMux(mux)
+	se.SetNetworkTypes(networkTypes(cfg.IPVersion, pion.NetworkTypeTCP4, pion.NetworkTypeTCP6))
+	return se, mux, nil
+}
+
+// networkTypes picks the IPv4 type, the IPv6 type or both for ipVersion
+func networkTypes(ipVersion int, v4, v6 pion.NetworkType) []pion.NetworkType {
+	switch ipVersion {
+	case config.IPVersion4:
+		return []pion.NetworkType{v4}
+	case config.IPVersion6:
+		return []pion.NetworkType{v6}
+	}
+	return []pion.NetworkType{v4, v6}
+}
+
+// tcpTURNServers keeps the TURN URLs reached over TCP or TLS
+func tcpTURNServers(urls []string) []string {
+	var tcp []string
+	for _, url := range urls {
+		if strings.HasPrefix(url, "turns:") || strings.Contains(url, "transport=tcp") {
+			tcp = append(tcp, url)
+		}
+	}
+	return tcp
+}
+
+// ConnectTimeoutError returns the error reported when the peer connection
+// is not established in time, pointing at --no-turn when relay was disabled.
+func ConnectTimeoutError(cfg *config.Config, details string) error {
+	if cfg != nil && cfg.NoTURN {
+		return WrapError("start", ErrDirectFailed, details)
+	}
+	return WrapError("start", ErrTimeout, details)
+}
+
+// ConnectionPath records the candidate types ICE settled on, so a summary
+// can tell a direct connection from one relayed through TURN
+type ConnectionPath struct {
+	mu     sync.Mutex
+	local  string
+	remote string
+
+	// pc is the connection the path was recorded from, and rtt the round
+	// trip time last measured on it, kept for once it has closed
+	pc  *pion.PeerConnection
+	rtt time.Duration
+}
+
+// pathServer is the candidate type recorded for transfers sent through the
+// signaling server rather than over WebRTC
+const pathServer = "server"
+
+// ServerPath is the path of a transfer sent through the signaling server
+func ServerPath() *ConnectionPath {
+	return &ConnectionPath{local: pathServer, remote: pathServer}
+}
+
+// record reads the selected candidate pair from pc
+func (p *ConnectionPath) record(pc *pion.PeerConnection) {
+	sctp := pc.SCTP()
+	if sctp == nil || sctp.Transport() == nil {
+		return
+	}
+	pair, err := sctp.Transport().ICETransport().GetSelectedCandidatePair()
+	if err != nil || pair == nil {
+		return
+	}
+
+	p.mu.Lock()
+	p.local = pair.Local.Typ.String()
+	p.remote = pair.Remote.Typ.String()
+	p.pc = pc
+	p.mu.Unlock()
+
+	// The peer may close the connection before a summary asks for the RTT
+	p.RTT()
+}
+
+// Types returns the local and remote candidate types, empty until connected
+func (p *ConnectionPath) Types() (local, remote string) {
+	if p == nil {
+		return "", ""
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.local, p.remote
+}
+
+// Relayed reports whether either side of the connection goes through TURN
+func (p *ConnectionPath) Relayed() bool {
+	local, remote := p.Types()
+	relay := pion.ICECandidateTypeRelay.String()
+	return local == relay || remote == relay
+}
+
+// String describes the path for display, or is empty when it is unknown
+func (p *ConnectionPath) String() string {
+	local, _ := p.Types()
+	switch {
+	case local == "":
+		return ""
+	case local == pathServer:
+		return "Via server"
+	case p.Relayed():
+		return "Relayed (TURN)"
+	}
+	return "Direct (P2P)"
+}
+
+// Details is String with the candidate types on each side, such as
+// "Direct (P2P), host to srflx"
+func (p *ConnectionPath) Details() string {
+	local, remote := p.Types()
+	if local == "" || local == pathServer {
+		return p.String()
+	}
+	return fmt.Sprintf("%s, %s to %s", p.String(), local, remote)
+}
+
+// RTT is the round trip time last measured on the selected candidate pair,
+// or zero when there is none yet
+func (p *ConnectionPath) RTT() time.Duration {
+	if p == nil {
+		return 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pc == nil || p.pc.ConnectionState() == pion.PeerConnectionStateClosed {
+		return p.rtt
+	}
+
+	for _, stat := range p.pc.GetStats() {
+		pair, ok := stat.(pion.ICECandidatePairStats)
+		if ok && pair.Nominated && pair.State == pion.StatsICECandidatePairStateSucceeded && pair.CurrentRoundTripTime > 0 {
+			p.rtt = time.Duration(pair.CurrentRoundTripTime * float64(time.Second))
+			break
+		}
+	}
+	return p.rtt
+}
+
+// SetupICEHandlers trickles local candidates to the peer and signals done
+// when ICE fails or closes. The returned path is filled in once connected.
+func SetupICEHandlers(pc *pion.PeerConnection, client signaling.Transport, done chan struct{}) *ConnectionPath {
+	path := &ConnectionPath{}
 	pc.OnICEConnectionStateChange(func(state pion.ICEConnectionState) {
+		if state == pion.ICEConnectionStateConnected {
+			path.record(pc)
+		}
 		if state == pion.ICEConnectionStateFailed || state == pion.ICEConnectionStateClosed {
 			select {
 			case done <- struct{}{}:
@@ -57,16 +265,34 @@ func SetupICEHandlers(pc *pion.PeerConnection, client *signaling.Client, done ch
 			Payload: signaling.SignalPayload{ICECandidate: c.ToJSON()},
 		})
 	})
+	return path
 }
 
-func CreateDataChannel(pc *pion.PeerConnection, label string) (*pion.DataChannel, error) {
-	ordered := true
-	maxRetransmits := uint16(5000)
+// ChannelOptions are a data channel's delivery guarantees
+type ChannelOptions struct {
+	// Ordered delivers messages in the order they were sent, so a lost one
+	// holds up everything behind it until it is retransmitted
+	Ordered bool
 
-	dc, err := pc.CreateDataChannel(label, &pion.DataChannelInit{
-		Ordered:           &ordered,
-		MaxPacketLifeTime: &maxRetransmits,
-	})
+	// MaxPacketLifeTime is how long in milliseconds a message is
+	// retransmitted before it is dropped. Zero retransmits until delivered.
+	MaxPacketLifeTime uint16
+}
+
+// Channel options used by the transfer protocols. Unordered channels are
+// only for receivers that write chunks by offset and ask for lost ranges.
+var (
+	OrderedChannel   = ChannelOptions{Ordered: true, MaxPacketLifeTime: 5000}
+	UnorderedChannel = ChannelOptions{MaxPacketLifeTime: 5000}
+)
+
+func CreateDataChannel(pc *pion.PeerConnection, label string, opts ChannelOptions) (*pion.DataChannel, error) {
+	init := &pion.DataChannelInit{Ordered: &opts.Ordered}
+	if opts.MaxPacketLifeTime > 0 {
+		init.MaxPacketLifeTime = &opts.MaxPacketLifeTime
+	}
+
+	dc, err := pc.CreateDataChannel(label, init)
 	if err != nil {
 		return nil, NewError("create data channel", err)
 	}
@@ -141,8 +367,13 @@ func HandleICECandidate(pc *pion.PeerConnection, payload *signaling.SignalPayloa
 	return nil
 }
 
+// ChannelsTimeout is how long WaitForChannels waits for file channels to
+// open. It stays under DefaultStallTimeout so a multichannel sender can
+// fall back to a single channel before the receiver gives up on it.
+const ChannelsTimeout = 15 * time.Second
+
 func WaitForChannels(channelsReady *int32, expected int, peerLeft <-chan struct{}) error {
-	timeout := time.After(30 * time.Second)
+	timeout := time.After(ChannelsTimeout)
 	ticker := time.NewTicker(50 * time.Millisecond)
 	defer ticker.Stop()
 
@@ -153,7 +384,7 @@ func WaitForChannels(channelsReady *int32, expected int, peerLeft <-chan struct{
 		case <-timeout:
 			return WrapError("wait channels", ErrTimeout, "channels not ready")
 		case <-ticker.C:
-			if int(*channelsReady) == expected {
+			if int(atomic.LoadInt32(channelsReady)) == expected {
 				return nil
 			}
 		}
@@ -0,0 +1,38 @@
+package transfer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/config"
+	pion "github.com/pion/webrtc/v4"
+)
+
+func TestNoTURNPeerConnectionHasNoTURNServer(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	cfg := &config.Config{
+		STUNServers: []string{"stun:stun.example.com:3478"},
+		TURNServers: []string{"turn:turn.example.com:3478"},
+		NoTURN:      true,
+		ForceRelay:  true,
+	}
+
+	pc, err := NewPeerConnection(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	conf := pc.GetConfiguration()
+	for _, server := range conf.ICEServers {
+		for _, url := range server.URLs {
+			if strings.HasPrefix(url, "turn") {
+				t.Errorf("TURN server %s used with NoTURN", url)
+			}
+		}
+	}
+	// Forcing relay without a relay would never connect
+	if conf.ICETransportPolicy != pion.ICETransportPolicyAll {
+		t.Errorf("got transport policy %s, want all", conf.ICETransportPolicy)
+	}
+}
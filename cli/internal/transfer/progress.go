@@ -1,13 +1,26 @@
 package transfer
 
 import (
+	"bufio"
+	"context"
 	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/BioHazard786/Warpdrop/cli/internal/history"
+	"github.com/BioHazard786/Warpdrop/cli/internal/trust"
 	"github.com/BioHazard786/Warpdrop/cli/internal/ui"
 	"github.com/BioHazard786/Warpdrop/cli/internal/utils"
 	"github.com/BioHazard786/Warpdrop/cli/internal/webrtc"
 	tea "github.com/charmbracelet/bubbletea"
+	pion "github.com/pion/webrtc/v4"
 )
 
 type ProgressTracker struct {
@@ -15,14 +28,78 @@ type ProgressTracker struct {
 	FileNames []string
 	FileSizes []int64
 	StartTime int64
+
+	// created is when the session began, before the peer accepted, and
+	// firstByte when the first bytes were reported, in Unix milliseconds
+	created   time.Time
+	firstByte atomic.Int64
+
+	// attached is set when progress renders inside an active dashboard
+	// rather than owning its own program
+	attached bool
+	finished chan struct{}
+	quitOnce sync.Once
+
+	// events is set in JSON mode or when embedded, where progress is
+	// emitted to out as events instead of drawn. lastEvent and lastBytes
+	// throttle them per file.
+	events    bool
+	out       *ui.Reporter
+	eventMu   sync.Mutex
+	lastEvent []time.Time
+	lastBytes []int64
+
+	// skipped files were filtered out by the receiver and are left out of
+	// the summary, and retries counts the retries of files sent again.
+	// failed files showed an error, and saved holds where received files
+	// were written.
+	skipMu  sync.Mutex
+	skipped map[int]bool
+	retries map[int]int
+	failed  map[int]bool
+	saved   map[int]string
 }
 
-func NewProgressTracker(fileNames []string, fileSizes []int64) *ProgressTracker {
+// progressEventInterval is the most often a file's progress is emitted in
+// JSON mode
+const progressEventInterval = 500 * time.Millisecond
+
+func NewProgressTracker(fileNames []string, fileSizes []int64, out *ui.Reporter) *ProgressTracker {
+	if out.Silent() {
+		lastBytes := make([]int64, len(fileNames))
+		for i := range lastBytes {
+			lastBytes[i] = -1
+		}
+		return &ProgressTracker{
+			FileNames: fileNames,
+			FileSizes: fileSizes,
+			created:   time.Now(),
+			finished:  make(chan struct{}),
+			events:    true,
+			out:       out,
+			lastEvent: make([]time.Time, len(fileNames)),
+			lastBytes: lastBytes,
+		}
+	}
+
+	if d := ui.ActiveDashboard(); d != nil {
+		d.Program().Send(ui.DashboardFilesMsg{Names: fileNames, Sizes: fileSizes})
+		return &ProgressTracker{
+			Program:   d.Program(),
+			FileNames: fileNames,
+			FileSizes: fileSizes,
+			created:   time.Now(),
+			attached:  true,
+			finished:  make(chan struct{}),
+		}
+	}
+
 	model := ui.NewProgressModel(fileNames, fileSizes)
 	return &ProgressTracker{
-		Program:   tea.NewProgram(model),
+		Program:   tea.NewProgram(model, tea.WithOutput(ui.Output())),
 		FileNames: fileNames,
 		FileSizes: fileSizes,
+		created:   time.Now(),
 	}
 }
 
@@ -31,68 +108,552 @@ func (p *ProgressTracker) Start() {
 }
 
 func (p *ProgressTracker) Run() error {
+	if p.attached || p.events {
+		<-p.finished
+		return nil
+	}
 	_, err := p.Program.Run()
 	return err
 }
 
+// Quit ends the progress display. When attached to a dashboard only Run is
+// released; the dashboard itself keeps running.
+func (p *ProgressTracker) Quit() {
+	if p.attached || p.events {
+		p.quitOnce.Do(func() { close(p.finished) })
+		return
+	}
+	p.Program.Quit()
+}
+
 func (p *ProgressTracker) Update(index int, current int64) {
+	if current > 0 {
+		p.firstByte.CompareAndSwap(0, time.Now().UnixMilli())
+	}
+	if p.events {
+		p.emitProgress(index, current, false)
+		return
+	}
 	if p.Program != nil {
 		p.Program.Send(ui.ProgressMsg{ID: index, Current: current})
 	}
 }
 
 func (p *ProgressTracker) Complete(index int) {
+	p.firstByte.CompareAndSwap(0, time.Now().UnixMilli())
+	if p.events {
+		p.emitProgress(index, p.FileSizes[index], true)
+		return
+	}
 	if p.Program != nil {
 		p.Program.Send(ui.ProgressCompleteMsg{ID: index})
 	}
 }
 
+// emitProgress writes a progress event for a file. It is skipped when
+// nothing changed, or when the last one was under progressEventInterval ago
+// unless final is set.
+func (p *ProgressTracker) emitProgress(index int, current int64, final bool) {
+	if index < 0 || index >= len(p.FileNames) {
+		return
+	}
+
+	p.eventMu.Lock()
+	now := time.Now()
+	if current == p.lastBytes[index] || (!final && now.Sub(p.lastEvent[index]) < progressEventInterval) {
+		p.eventMu.Unlock()
+		return
+	}
+	p.lastEvent[index] = now
+	p.lastBytes[index] = current
+	p.eventMu.Unlock()
+
+	var speed float64
+	if seconds := p.Duration().Seconds(); seconds > 0 {
+		speed = float64(current) / seconds
+	}
+	p.out.Emit(ui.Event{
+		Type:  ui.EventProgress,
+		File:  p.FileNames[index],
+		Bytes: current,
+		Total: p.FileSizes[index],
+		Speed: speed,
+	})
+}
+
+// Confirm records bytes the receiver has reported as written
+func (p *ProgressTracker) Confirm(index int, confirmed int64) {
+	if p.Program != nil {
+		p.Program.Send(ui.ProgressConfirmedMsg{ID: index, Confirmed: confirmed})
+	}
+}
+
 func (p *ProgressTracker) Error(index int, msg string) {
+	p.skipMu.Lock()
+	if p.failed == nil {
+		p.failed = make(map[int]bool)
+	}
+	p.failed[index] = true
+	p.skipMu.Unlock()
+
+	if p.events {
+		if index >= 0 && index < len(p.FileNames) {
+			p.out.Emit(ui.Event{Type: ui.EventError, File: p.FileNames[index], Error: msg})
+		}
+		return
+	}
 	if p.Program != nil {
 		p.Program.Send(ui.ProgressErrorMsg{ID: index, Err: fmt.Errorf("%s", msg)})
 	}
 }
 
+// Rename shows a file under name, such as when it was saved under a
+// different name than the sender's. The file keeps its name elsewhere.
+func (p *ProgressTracker) Rename(index int, name string) {
+	if index < 0 || index >= len(p.FileNames) || name == p.FileNames[index] {
+		return
+	}
+	if p.Program != nil {
+		p.Program.Send(ui.ProgressRenamedMsg{ID: index, Name: name})
+	}
+}
+
+// Saved records where a received file is written, for ReceivedFiles
+func (p *ProgressTracker) Saved(index int, location string) {
+	p.skipMu.Lock()
+	defer p.skipMu.Unlock()
+	if p.saved == nil {
+		p.saved = make(map[int]string)
+	}
+	p.saved[index] = location
+}
+
+// ReceivedFiles lists every offered file with where it was saved and how
+// it went. Files that failed or were skipped have no location.
+func (p *ProgressTracker) ReceivedFiles() []ui.ReceivedFileItem {
+	p.skipMu.Lock()
+	defer p.skipMu.Unlock()
+	items := make([]ui.ReceivedFileItem, len(p.FileNames))
+	for i := range p.FileNames {
+		item := ui.ReceivedFileItem{Location: p.saved[i], Size: p.FileSizes[i], Status: ui.ReceivedOK}
+		switch {
+		case p.skipped[i]:
+			item = ui.ReceivedFileItem{Size: p.FileSizes[i], Status: ui.ReceivedSkipped}
+		case p.failed[i]:
+			item = ui.ReceivedFileItem{Size: p.FileSizes[i], Status: ui.ReceivedFailed}
+		}
+		items[i] = item
+	}
+	return items
+}
+
+// Skip marks a file that won't be transferred. It shows as failed with msg
+// but doesn't count towards the summary.
+func (p *ProgressTracker) Skip(index int, msg string) {
+	p.skipMu.Lock()
+	if p.skipped == nil {
+		p.skipped = make(map[int]bool)
+	}
+	p.skipped[index] = true
+	p.skipMu.Unlock()
+	p.Error(index, msg)
+}
+
+// Retry starts a file over for its attempt'th retry
+func (p *ProgressTracker) Retry(index int, attempt int) {
+	p.skipMu.Lock()
+	if p.retries == nil {
+		p.retries = make(map[int]int)
+	}
+	p.retries[index] = attempt
+	delete(p.failed, index)
+	p.skipMu.Unlock()
+
+	if p.events {
+		p.emitProgress(index, 0, true)
+		return
+	}
+	if p.Program != nil {
+		p.Program.Send(ui.ProgressRetryMsg{ID: index, Attempt: attempt})
+	}
+}
+
+// Retried lists the files that were retried and how often, for the summary
+func (p *ProgressTracker) Retried() string {
+	p.skipMu.Lock()
+	defer p.skipMu.Unlock()
+	var retried []string
+	for i, name := range p.FileNames {
+		switch n := p.retries[i]; n {
+		case 0:
+		case 1:
+			retried = append(retried, name+" (once)")
+		default:
+			retried = append(retried, fmt.Sprintf("%s (%d times)", name, n))
+		}
+	}
+	return strings.Join(retried, ", ")
+}
+
+// Transferred returns the names of the files that weren't skipped
+func (p *ProgressTracker) Transferred() []string {
+	p.skipMu.Lock()
+	defer p.skipMu.Unlock()
+	names := make([]string, 0, len(p.FileNames))
+	for i, name := range p.FileNames {
+		if !p.skipped[i] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// TotalSize is the size of the files that weren't skipped
 func (p *ProgressTracker) TotalSize() int64 {
+	p.skipMu.Lock()
+	defer p.skipMu.Unlock()
 	var total int64
-	for _, s := range p.FileSizes {
-		total += s
+	for i, s := range p.FileSizes {
+		if !p.skipped[i] {
+			total += s
+		}
 	}
 	return total
 }
 
+// Duration is how long the transfer has been moving data, from the first
+// byte or, until one arrives, from Start
 func (p *ProgressTracker) Duration() time.Duration {
-	return time.Since(time.UnixMilli(p.StartTime))
+	start := p.firstByte.Load()
+	if start == 0 {
+		start = p.StartTime
+	}
+	return time.Since(time.UnixMilli(start))
 }
 
-func RenderSummary(filesCount int, totalSize int64, duration time.Duration) {
+// TotalDuration is how long the session has run, including the time spent
+// connecting and waiting for the peer to accept
+func (p *ProgressTracker) TotalDuration() time.Duration {
+	if p.created.IsZero() {
+		return time.Since(time.UnixMilli(p.StartTime))
+	}
+	return time.Since(p.created)
+}
+
+// RenderSummary prints the summary of a completed transfer and appends it
+// to the transfer history, unless it was a bench run. The history is best
+// effort: a write failure never fails the transfer.
+func RenderSummary(direction string, progress *ProgressTracker, peerType string, path *ConnectionPath, opts *TransferOptions) {
+	totalSize := progress.TotalSize()
+	duration := progress.Duration()
+	fileNames := progress.Transferred()
+
 	seconds := duration.Seconds()
-	fmt.Println()
-	ui.RenderTransferSummary(ui.TransferSummary{
-		Status:    "✅ Complete",
-		Files:     filesCount,
-		TotalSize: utils.FormatSize(totalSize),
-		Duration:  utils.FormatTimeDuration(duration),
-		Speed:     utils.FormatSpeed(float64(totalSize) / seconds),
+	out := opts.Out()
+	// Nothing a bench run receives is saved, so there are no files to list
+	bench := opts != nil && opts.Bench
+	if direction == history.DirectionReceived && !bench {
+		out.Println()
+		out.RenderReceivedFiles(progress.ReceivedFiles())
+		printReceivedText(progress.ReceivedFiles(), opts)
+	}
+	summary := ui.TransferSummary{
+		Status:       "✅ Complete",
+		Files:        len(fileNames),
+		TotalSize:    utils.FormatSize(totalSize),
+		Speed:        utils.FormatSpeed(float64(totalSize) / seconds),
+		TotalTime:    utils.FormatTimeDuration(progress.TotalDuration()),
+		TransferTime: utils.FormatTimeDuration(duration),
+		Connection:   path.String(),
+		Retried:      progress.Retried(),
+	}
+	if bench {
+		// A bench run is about the connection, so say more about it
+		summary.Connection = path.Details()
+		if rtt := path.RTT(); rtt > 0 {
+			summary.RTT = rtt.Round(time.Microsecond).String()
+		}
+	}
+	out.Println()
+	out.RenderTransferSummary(summary)
+	out.Emit(ui.Event{
+		Type:       ui.EventComplete,
+		Files:      len(fileNames),
+		Total:      totalSize,
+		Duration:   seconds,
+		Speed:      float64(totalSize) / seconds,
+		Connection: path.String(),
 	})
+
+	if bench {
+		return
+	}
+	entry := history.Entry{
+		Direction:  direction,
+		Files:      fileNames,
+		Bytes:      totalSize,
+		DurationMS: duration.Milliseconds(),
+		PeerType:   peerType,
+	}
+	if opts != nil {
+		entry.RoomID = opts.RoomID
+	}
+	history.Append(entry)
 }
 
-func BuildFileTable(files []webrtc.FileMetadata) []ui.FileTableItem {
+// maxPrintedText is the largest received text printed to the terminal
+const maxPrintedText = 4 * 1024
+
+// printReceivedText prints a single short plain text file saved to disk,
+// such as one sent with send --text, so notes and links can be read or
+// copied without opening it. Control characters are dropped, since the
+// text comes from the peer.
+func printReceivedText(items []ui.ReceivedFileItem, opts *TransferOptions) {
+	if len(items) != 1 || items[0].Status != ui.ReceivedOK || items[0].Size > maxPrintedText {
+		return
+	}
+	if opts != nil && (opts.Stdout || opts.Zip != nil || opts.Reporter.Embedded()) {
+		return
+	}
+
+	data, err := os.ReadFile(items[0].Location)
+	if err != nil || !utf8.Valid(data) || !strings.HasPrefix(http.DetectContentType(data), "text/plain") {
+		return
+	}
+	text := strings.Map(func(r rune) rune {
+		if r != '\n' && r != '\t' && (unicode.IsControl(r) || unicode.Is(unicode.Cf, r)) {
+			return -1
+		}
+		return r
+	}, string(data))
+
+	ui.Println()
+	ui.Println(strings.TrimRight(text, "\n"))
+}
+
+// BuildFileTable lists the offered files, marking those in skipped
+func BuildFileTable(files []webrtc.FileMetadata, skipped map[string]string) []ui.FileTableItem {
 	items := make([]ui.FileTableItem, len(files))
 	for i, f := range files {
 		items[i] = ui.FileTableItem{
-			Index: i + 1,
-			Name:  f.Name,
-			Size:  int64(f.Size),
-			Type:  f.Type,
+			Index:   i + 1,
+			Name:    f.Name,
+			Size:    int64(f.Size),
+			Type:    f.Type,
+			Skipped: skipped[f.Name] != "",
 		}
 	}
 	return items
 }
 
-func PromptConsent() bool {
-	fmt.Print("\n❓ Do you want to receive these files? [Y/n] ")
-	var consent string
-	fmt.Scanln(&consent)
-	return consent != "n" && consent != "N"
+// ConsentOptions controls how PromptConsent gets its answer
+type ConsentOptions struct {
+	// Sender is the sending device, shown when known
+	Sender *webrtc.DeviceInfoPayload
+
+	// Fingerprint is the sender's certificate fingerprint as verified by
+	// the DTLS handshake, empty when the transfer doesn't use WebRTC
+	Fingerprint string
+
+	// AutoAccept accepts without reading stdin
+	AutoAccept bool
+
+	// Timeout declines when no answer arrives in time; zero waits forever
+	Timeout time.Duration
+
+	// Trusted senders are accepted without reading stdin
+	Trusted *trust.List
+
+	// Size is the total size offered, checked against the free space in
+	// OutputDir
+	Size      uint64
+	OutputDir string
+
+	// Out is where the prompt is shown
+	Out *ui.Reporter
+}
+
+// NewConsentOptions builds the consent options for a receiver offered
+// metas by a sender with the given fingerprint; opts may be nil
+func NewConsentOptions(opts *TransferOptions, sender *webrtc.DeviceInfoPayload, fingerprint string, metas []webrtc.FileMetadata) ConsentOptions {
+	consent := ConsentOptions{Sender: sender, Fingerprint: fingerprint}
+	for _, meta := range metas {
+		consent.Size += meta.Size
+	}
+	if opts != nil {
+		consent.AutoAccept = opts.AutoAccept
+		consent.Timeout = opts.AcceptTimeout
+		consent.Trusted = opts.TrustedPeers
+		consent.OutputDir = opts.OutputDir
+		consent.Out = opts.Reporter
+		if opts.Bench {
+			// The data is thrown away, so it needs no disk space
+			consent.Size = 0
+		}
+	}
+	return consent
+}
+
+// warnDiskSpace warns on out when the offered files won't fit in dir.
+// Platforms that can't report free space are not checked.
+func warnDiskSpace(out *ui.Reporter, dir string, size uint64) {
+	if dir == "" {
+		dir = "."
+	}
+	// The output directory is created on demand, so check the nearest
+	// parent that already exists
+	for {
+		if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+
+	free, err := utils.FreeSpace(dir)
+	if err != nil || free >= size {
+		return
+	}
+	out.PrintWarningf("Not enough disk space: %s needed, %s free", utils.FormatSize(int64(size)), utils.FormatSize(int64(free)))
+}
+
+// CheckOffer rejects offers the receive options can't take. Receivers
+// decline such offers without asking.
+func CheckOffer(opts *TransferOptions, metas []webrtc.FileMetadata) error {
+	if opts == nil {
+		return nil
+	}
+	// Only the type filters can leave nothing to receive
+	if len(metas) == 0 {
+		return ErrOfferFiltered
+	}
+	if opts.Stdout && len(metas) > 1 {
+		return ErrStdoutMultipleFiles
+	}
+	if opts.MaxFiles > 0 && len(metas) > opts.MaxFiles {
+		return WrapError("check offer", ErrOfferTooManyFiles,
+			fmt.Sprintf("%d files offered, limit %d", len(metas), opts.MaxFiles))
+	}
+
+	var size uint64
+	for _, meta := range metas {
+		size += meta.Size
+	}
+	if opts.MaxSize > 0 && size > opts.MaxSize {
+		return WrapError("check offer", ErrOfferTooLarge,
+			fmt.Sprintf("%s offered, limit %s", utils.FormatSize(int64(size)), utils.FormatSize(int64(opts.MaxSize))))
+	}
+	return nil
+}
+
+// maxDeclineReason caps the reason typed when declining, in characters
+const maxDeclineReason = 200
+
+// PromptConsent asks whether to accept the offered files, naming the
+// sender's device when it is known. On a no it asks for an optional reason
+// to pass on to the sender. Cancelling ctx or running out of time while the
+// prompt is waiting counts as declining without one; callers then send
+// decline_receive.
+func PromptConsent(ctx context.Context, opts ConsentOptions) (bool, string) {
+	if opts.Sender != nil {
+		opts.Out.Printf("\n🖥️  Sender device: %s\n", DeviceLabel(*opts.Sender))
+	}
+	if opts.Fingerprint != "" {
+		opts.Out.Printf("🔑 Fingerprint: %s\n", opts.Fingerprint)
+	}
+	warnDiskSpace(opts.Out, opts.OutputDir, opts.Size)
+	if opts.AutoAccept {
+		opts.Out.Println("\n✅ Accepting files (--yes)")
+		return true, ""
+	}
+	if opts.Trusted.Contains(opts.Fingerprint) {
+		opts.Out.Println("\n✅ Accepting files from a trusted device")
+		return true, ""
+	}
+	// Nobody is at the terminal to answer for an embedded transfer
+	if opts.Out.Embedded() {
+		return false, ""
+	}
+
+	var timeout <-chan time.Time
+	if opts.Timeout > 0 {
+		timer := time.NewTimer(opts.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	stdin := bufio.NewReader(os.Stdin)
+	fmt.Fprint(ui.Output(), "\n❓ Do you want to receive these files? [Y/n] ")
+	consent, ok := readAnswer(ctx, stdin, timeout, opts.Timeout)
+	if !ok {
+		return false, ""
+	}
+	if consent != "n" && consent != "N" {
+		return true, ""
+	}
+
+	fmt.Fprint(ui.Output(), "📝 Reason for declining (optional, Enter to skip): ")
+	reason, _ := readAnswer(ctx, stdin, timeout, opts.Timeout)
+	if runes := []rune(reason); len(runes) > maxDeclineReason {
+		reason = string(runes[:maxDeclineReason])
+	}
+	return false, reason
+}
+
+// readAnswer reads a line from stdin with surrounding space trimmed. It
+// gives up when ctx is cancelled or timeout fires, saying no answer came
+// within waited.
+func readAnswer(ctx context.Context, stdin *bufio.Reader, timeout <-chan time.Time, waited time.Duration) (string, bool) {
+	answer := make(chan string, 1)
+	go func() {
+		line, _ := stdin.ReadString('\n')
+		answer <- strings.TrimSpace(line)
+	}()
+
+	select {
+	case line := <-answer:
+		return line, true
+	case <-timeout:
+		fmt.Fprintf(ui.Output(), "\n⏱️  No answer within %s, declining\n", waited)
+		return "", false
+	case <-ctx.Done():
+		fmt.Fprintln(ui.Output())
+		return "", false
+	}
+}
+
+// ProgressReporter sends throttled receive_progress messages back to the
+// sender once it has asked for them with a progress_request
+type ProgressReporter struct {
+	mu       sync.Mutex
+	enabled  bool
+	lastSent map[string]time.Time
+}
+
+func NewProgressReporter() *ProgressReporter {
+	return &ProgressReporter{lastSent: make(map[string]time.Time)}
+}
+
+func (r *ProgressReporter) Enable() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.enabled = true
+}
+
+// Report sends the received byte count for a file, at most once per
+// ProgressReportInterval unless final is set
+func (r *ProgressReporter) Report(dc *pion.DataChannel, fileName string, received uint64, final bool) {
+	r.mu.Lock()
+	if !r.enabled {
+		r.mu.Unlock()
+		return
+	}
+	interval := time.Duration(ProgressReportInterval) * time.Millisecond
+	if !final && time.Since(r.lastSent[fileName]) < interval {
+		r.mu.Unlock()
+		return
+	}
+	r.lastSent[fileName] = time.Now()
+	r.mu.Unlock()
+
+	SendReceiveProgress(dc, fileName, received)
 }
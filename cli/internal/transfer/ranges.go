@@ -0,0 +1,70 @@
+package transfer
+
+// ByteRange is a span of a file, such as one whose chunks never arrived
+type ByteRange struct {
+	Offset uint64
+	Length uint64
+}
+
+// End returns the offset just past the range
+func (r ByteRange) End() uint64 {
+	return r.Offset + r.Length
+}
+
+// rangeSet is the sorted, non-overlapping spans of a file written so far
+type rangeSet []ByteRange
+
+// add records that r was written, merging it with the spans it touches
+func (s rangeSet) add(r ByteRange) rangeSet {
+	if r.Length == 0 {
+		return s
+	}
+
+	merged := make(rangeSet, 0, len(s)+1)
+	i := 0
+	for ; i < len(s) && s[i].End() < r.Offset; i++ {
+		merged = append(merged, s[i])
+	}
+	for ; i < len(s) && s[i].Offset <= r.End(); i++ {
+		start := min(r.Offset, s[i].Offset)
+		r = ByteRange{Offset: start, Length: max(r.End(), s[i].End()) - start}
+	}
+	merged = append(merged, r)
+	return append(merged, s[i:]...)
+}
+
+// prefix returns how many bytes from the start of the file are written
+// without a gap
+func (s rangeSet) prefix() uint64 {
+	if len(s) == 0 || s[0].Offset > 0 {
+		return 0
+	}
+	return s[0].End()
+}
+
+// end returns the offset just past the furthest byte written
+func (s rangeSet) end() uint64 {
+	if len(s) == 0 {
+		return 0
+	}
+	return s[len(s)-1].End()
+}
+
+// missing returns the gaps between the start of the file and limit
+func (s rangeSet) missing(limit uint64) []ByteRange {
+	var gaps []ByteRange
+	next := uint64(0)
+	for _, r := range s {
+		if r.Offset >= limit {
+			break
+		}
+		if r.Offset > next {
+			gaps = append(gaps, ByteRange{Offset: next, Length: r.Offset - next})
+		}
+		next = r.End()
+	}
+	if next < limit {
+		gaps = append(gaps, ByteRange{Offset: next, Length: limit - next})
+	}
+	return gaps
+}
@@ -1,64 +1,456 @@
 package transfer
 
 import (
+	"errors"
+	"hash"
+	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 
 	"github.com/BioHazard786/Warpdrop/cli/internal/utils"
 	"github.com/BioHazard786/Warpdrop/cli/internal/webrtc"
 )
 
 type FileWriter struct {
-	File          *os.File
-	Metadata      webrtc.FileMetadata
+	File     *os.File
+	Path     string
+	Metadata webrtc.FileMetadata
+	Index    int
+
+	// ReceivedBytes is how much of the file is written without a gap, so it
+	// only moves past a dropped chunk once the chunk is resent
 	ReceivedBytes uint64
-	Index         int
+
+	// pos is the file offset the next Write lands at, and written the spans
+	// written so far
+	pos     uint64
+	written rangeSet
+
+	// hash covers everything written so far while writes are sequential;
+	// hashValid is cleared if a write lands out of order
+	hash      hash.Hash
+	hashValid bool
+
+	// cipher decrypts chunks of password-protected transfers
+	cipher *Cipher
+
+	// compression is the codec chunks are decompressed with after decrypting
+	compression string
+
+	// resumable keeps the partial file when a write fails so a later
+	// transfer can pick it up
+	resumable bool
+
+	// preserve restores the sender's modification time and mode on Close
+	preserve bool
+
+	// stdout is set when File is os.Stdout, which has no Path and is never
+	// closed or removed
+	stdout bool
+
+	// discard is set when File is the null device, for bench transfers
+	discard bool
+
+	// archive is set in zip mode. The file either streams into entry.w or,
+	// while another entry is open, into File spooled at spool; it has no
+	// Path either way.
+	archive *ZipArchive
+	entry   zipEntry
+	spool   string
+	closed  bool
+
+	// held keeps chunks of a streamed entry that arrived past a gap, by
+	// offset, since the entry can't seek
+	held      map[uint64][]byte
+	heldBytes int
 }
 
 func NewFileWriter(meta webrtc.FileMetadata, index int, opts *TransferOptions) (*FileWriter, error) {
-	filename := utils.GetUniqueFilename(meta.Name)
-	if opts != nil && opts.OutputDir != "" {
-		if err := os.MkdirAll(opts.OutputDir, 0755); err != nil {
-			return nil, NewFileError("create directory", opts.OutputDir, err)
+	if opts != nil && opts.Stdout {
+		return &FileWriter{
+			File:      os.Stdout,
+			Metadata:  meta,
+			Index:     index,
+			hash:      NewHasher(),
+			hashValid: true,
+			stdout:    true,
+		}, nil
+	}
+	if opts != nil && opts.Bench {
+		file, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+		if err != nil {
+			return nil, NewFileError("open", os.DevNull, err)
+		}
+		return &FileWriter{
+			File:      file,
+			Metadata:  meta,
+			Index:     index,
+			hash:      NewHasher(),
+			hashValid: true,
+			discard:   true,
+		}, nil
+	}
+	if opts != nil && opts.Zip != nil {
+		return opts.Zip.newWriter(meta, index, opts.Preserve)
+	}
+
+	outputDir := ""
+	if opts != nil {
+		outputDir = opts.OutputDir
+	}
+
+	target, err := outputPath(outputDir, meta)
+	if err != nil {
+		return nil, NewFileError("resolve path", meta.Name, err)
+	}
+
+	if err := PrepareOutputDir(opts, outputDir); err != nil {
+		return nil, err
+	}
+	if dir := filepath.Dir(target); dir != "." {
+		if err := os.MkdirAll(dir, dirMode(opts)); err != nil {
+			return nil, NewFileError("create directory", dir, err)
 		}
-		filename = filepath.Join(opts.OutputDir, filename)
 	}
 
-	file, err := os.Create(filename)
+	file, filename, err := createTarget(opts, target)
 	if err != nil {
 		return nil, NewFileError("create file", meta.Name, err)
 	}
 
 	return &FileWriter{
-		File:     file,
-		Metadata: meta,
-		Index:    index,
+		File:      file,
+		Path:      filename,
+		Metadata:  meta,
+		Index:     index,
+		hash:      NewHasher(),
+		hashValid: true,
 	}, nil
 }
 
+// ResumeFileWriter reopens a partially received file and positions it at
+// the recorded offset, discarding anything written past it
+func ResumeFileWriter(meta webrtc.FileMetadata, index int, entry ResumeEntry) (*FileWriter, error) {
+	file, err := os.OpenFile(entry.Path, os.O_RDWR, 0644)
+	if err != nil {
+		return nil, NewFileError("open partial file", meta.Name, err)
+	}
+
+	h := NewHasher()
+	hashValid := HashPrefix(h, file, entry.Offset) == nil
+
+	if err := file.Truncate(int64(entry.Offset)); err != nil {
+		file.Close()
+		return nil, NewFileError("truncate partial file", meta.Name, err)
+	}
+
+	if _, err := file.Seek(int64(entry.Offset), io.SeekStart); err != nil {
+		file.Close()
+		return nil, NewFileError("seek", meta.Name, err)
+	}
+
+	return &FileWriter{
+		File:          file,
+		Path:          entry.Path,
+		Metadata:      meta,
+		ReceivedBytes: entry.Offset,
+		Index:         index,
+		pos:           entry.Offset,
+		written:       rangeSet{}.add(ByteRange{Length: entry.Offset}),
+		hash:          h,
+		hashValid:     hashValid,
+	}, nil
+}
+
+// SetCipher makes Write decrypt each chunk before it reaches disk
+func (w *FileWriter) SetCipher(c *Cipher) {
+	w.cipher = c
+}
+
+// SetCompression makes Write decompress each chunk with codec
+func (w *FileWriter) SetCompression(codec string) {
+	w.compression = codec
+}
+
+// SetPreserve makes Close give a complete file the modification time and
+// permissions the sender reported
+func (w *FileWriter) SetPreserve(preserve bool) {
+	w.preserve = preserve
+}
+
+// SetResumable keeps the partial file on a failed write instead of
+// removing it
+func (w *FileWriter) SetResumable(resumable bool) {
+	w.resumable = resumable
+}
+
 func (w *FileWriter) Write(data []byte) (int, error) {
-	n, err := w.File.Write(data)
+	data, err := w.open(data)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := w.write(data)
 	if err != nil {
-		return n, NewFileError("write", w.Metadata.Name, err)
+		return n, err
+	}
+
+	// A streamed entry takes held chunks once the gap before them is filled
+	for next, ok := w.held[w.pos]; ok; next, ok = w.held[w.pos] {
+		delete(w.held, w.pos)
+		w.heldBytes -= len(next)
+		if _, err := w.write(next); err != nil {
+			return n, err
+		}
 	}
-	w.ReceivedBytes += uint64(n)
 	return n, nil
 }
 
+// open decrypts and decompresses a chunk
+func (w *FileWriter) open(data []byte) ([]byte, error) {
+	data, err := w.cipher.Open(data)
+	if err != nil {
+		return nil, NewFileError("decrypt", w.Metadata.Name, err)
+	}
+
+	data, err = Decompress(w.compression, data)
+	if err != nil {
+		return nil, NewFileError("decompress", w.Metadata.Name, err)
+	}
+	return data, nil
+}
+
+// write writes plain data at pos
+func (w *FileWriter) write(data []byte) (int, error) {
+	var dst io.Writer = w.File
+	if w.entry.w != nil {
+		dst = w.entry.w
+	}
+
+	n, err := dst.Write(data)
+	if err != nil {
+		return n, w.writeFailed(err)
+	}
+	w.hash.Write(data[:n])
+	w.written = w.written.add(ByteRange{Offset: w.pos, Length: uint64(n)})
+	w.pos += uint64(n)
+	w.ReceivedBytes = w.written.prefix()
+	return n, nil
+}
+
+// hold keeps a chunk for a streamed entry that arrived past a gap until the
+// gap is filled. Chunks before pos are resends of data already written.
+func (w *FileWriter) hold(data []byte, offset uint64) (int, error) {
+	if offset < w.pos {
+		return len(data), nil
+	}
+
+	data, err := w.open(data)
+	if err != nil {
+		return 0, err
+	}
+	if w.heldBytes+len(data) > maxHeldBytes {
+		return 0, WrapError("write", ErrZipOutOfOrder, w.Metadata.Name)
+	}
+
+	if w.held == nil {
+		w.held = make(map[uint64][]byte)
+	}
+	w.heldBytes += len(data) - len(w.held[offset])
+	w.held[offset] = data
+	w.written = w.written.add(ByteRange{Offset: offset, Length: uint64(len(data))})
+	return len(data), nil
+}
+
+// writeFailed removes the incomplete file unless it can be resumed, and
+// reports a full disk as ErrDiskFull
+func (w *FileWriter) writeFailed(err error) error {
+	if !w.resumable && !w.stdout && !w.discard && w.archive == nil {
+		w.File.Close()
+		os.Remove(w.Path)
+	}
+	if utils.IsDiskFull(err) {
+		err = ErrDiskFull
+	}
+	return NewFileError("write", w.Metadata.Name, err)
+}
+
+// WriteAt writes a chunk at offset, seeking when it doesn't follow the
+// previous one. Chunks may arrive past a gap and the gap be filled later.
 func (w *FileWriter) WriteAt(data []byte, offset uint64) (int, error) {
-	if offset != w.ReceivedBytes {
+	if offset != w.pos {
+		if w.entry.w != nil {
+			return w.hold(data, offset)
+		}
+		if w.stdout {
+			return 0, WrapError("write", ErrStdoutSeek, w.Metadata.Name)
+		}
+		w.hashValid = false
 		if _, err := w.File.Seek(int64(offset), 0); err != nil {
 			return 0, NewFileError("seek", w.Metadata.Name, err)
 		}
-		w.ReceivedBytes = offset
+		w.pos = offset
 	}
 	return w.Write(data)
 }
 
+// DisplayName is the file's name as the sender gave it, but ending in the
+// name actually written when it had to be renamed
+func (w *FileWriter) DisplayName() string {
+	if w.archive != nil {
+		return path.Join(path.Dir(w.Metadata.Name), path.Base(w.entry.name))
+	}
+	if w.Path == "" {
+		return w.Metadata.Name
+	}
+	return path.Join(path.Dir(w.Metadata.Name), filepath.Base(w.Path))
+}
+
+// Location is where the file is written: its path on disk, its name in the
+// zip archive, or "stdout"
+func (w *FileWriter) Location() string {
+	switch {
+	case w.stdout:
+		return "stdout"
+	case w.discard:
+		return os.DevNull
+	case w.archive != nil:
+		return w.entry.name
+	}
+	return w.Path
+}
+
+// End returns the offset just past the furthest byte written, which is where
+// the next chunk from the sender should start
+func (w *FileWriter) End() uint64 {
+	return w.written.end()
+}
+
+// Missing returns the gaps before End, the spans skipped over by chunks
+// written past them
+func (w *FileWriter) Missing() []ByteRange {
+	return w.written.missing(w.End())
+}
+
+// Tail returns the span between End and the end of the file, and whether
+// there is one
+func (w *FileWriter) Tail() (ByteRange, bool) {
+	end := w.End()
+	if end >= w.Metadata.Size {
+		return ByteRange{}, false
+	}
+	return ByteRange{Offset: end, Length: w.Metadata.Size - end}, true
+}
+
+// Checksum returns the hex SHA-256 of the written file. If writes were not
+// sequential the file is re-read from disk.
+func (w *FileWriter) Checksum() (string, error) {
+	if w.hashValid {
+		return FormatChecksum(w.hash), nil
+	}
+
+	name := w.Path
+	if w.spool != "" {
+		name = w.spool
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		return "", NewFileError("open", w.Metadata.Name, err)
+	}
+	defer file.Close()
+
+	h := NewHasher()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", NewFileError("hash", w.Metadata.Name, err)
+	}
+	return FormatChecksum(h), nil
+}
+
 func (w *FileWriter) IsComplete() bool {
 	return w.ReceivedBytes >= w.Metadata.Size
 }
 
 func (w *FileWriter) Close() error {
-	return w.File.Close()
+	if w.stdout {
+		return nil
+	}
+	if w.archive != nil {
+		return w.archive.finish(w)
+	}
+	if err := w.File.Close(); err != nil {
+		return err
+	}
+	if w.preserve && w.IsComplete() {
+		restoreAttributes(w.Path, w.Metadata)
+	}
+	return nil
+}
+
+// DefaultDirMode is the permission mode of directories created for received
+// files unless TransferOptions.DirMode says otherwise
+const DefaultDirMode os.FileMode = 0755
+
+func dirMode(opts *TransferOptions) os.FileMode {
+	if opts == nil || opts.DirMode == 0 {
+		return DefaultDirMode
+	}
+	return opts.DirMode
+}
+
+// PrepareOutputDir makes sure dir exists. A missing dir is created with the
+// options' DirMode when CreateDirs is set or opts is nil, and is an error
+// otherwise. An empty dir is the working directory.
+func PrepareOutputDir(opts *TransferOptions, dir string) error {
+	if dir == "" {
+		return nil
+	}
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return NewFileError("open output directory", dir, err)
+	}
+	if opts != nil && !opts.CreateDirs {
+		return NewFileError("open output directory", dir, ErrOutputDirMissing)
+	}
+	if err := os.MkdirAll(dir, dirMode(opts)); err != nil {
+		return NewFileError("create directory", dir, err)
+	}
+	return nil
+}
+
+// outputPath returns where a received file should be written. Files sent as
+// part of a directory keep their relative path under outputDir; every path
+// component is sanitized and the result must stay inside outputDir.
+func outputPath(outputDir string, meta webrtc.FileMetadata) (string, error) {
+	if outputDir == "" {
+		outputDir = "."
+	}
+
+	if meta.RelPath == "" {
+		return filepath.Join(outputDir, utils.SanitizeFilename(meta.Name)), nil
+	}
+
+	parts := []string{outputDir}
+	for part := range strings.SplitSeq(meta.RelPath, "/") {
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			return "", ErrUnsafePath
+		}
+		parts = append(parts, utils.SanitizeFilename(part))
+	}
+	if len(parts) == 1 {
+		return "", ErrUnsafePath
+	}
+
+	target := filepath.Join(parts...)
+	rel, err := filepath.Rel(outputDir, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", ErrUnsafePath
+	}
+	return target, nil
 }
@@ -0,0 +1,43 @@
+package transfer
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/webrtc"
+)
+
+func TestOutputPath(t *testing.T) {
+	dir := filepath.Join("out", "dir")
+	tests := []struct {
+		meta webrtc.FileMetadata
+		want string
+	}{
+		{webrtc.FileMetadata{Name: "a.txt"}, filepath.Join(dir, "a.txt")},
+		{webrtc.FileMetadata{Name: "../../etc/passwd"}, filepath.Join(dir, ".._.._etc_passwd")},
+		{webrtc.FileMetadata{Name: "b.txt", RelPath: "photos/2024/b.txt"}, filepath.Join(dir, "photos", "2024", "b.txt")},
+		{webrtc.FileMetadata{Name: "c.txt", RelPath: "./photos//c.txt"}, filepath.Join(dir, "photos", "c.txt")},
+		{webrtc.FileMetadata{Name: "d.txt", RelPath: `photos\..\..\d.txt`}, filepath.Join(dir, `photos_.._.._d.txt`)},
+		{webrtc.FileMetadata{Name: "e.txt", RelPath: "ph\u202eotos/e\x00.txt"}, filepath.Join(dir, "photos", "e.txt")},
+	}
+	for _, tt := range tests {
+		got, err := outputPath(dir, tt.meta)
+		if err != nil {
+			t.Errorf("outputPath(%q, %q): %v", tt.meta.Name, tt.meta.RelPath, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("outputPath(%q, %q) = %q, want %q", tt.meta.Name, tt.meta.RelPath, got, tt.want)
+		}
+	}
+}
+
+func TestOutputPathRejectsEscapes(t *testing.T) {
+	for _, relPath := range []string{"../x.txt", "photos/../../x.txt", "/", "./."} {
+		_, err := outputPath("out", webrtc.FileMetadata{Name: "x.txt", RelPath: relPath})
+		if !errors.Is(err, ErrUnsafePath) {
+			t.Errorf("outputPath with %q: got %v, want ErrUnsafePath", relPath, err)
+		}
+	}
+}
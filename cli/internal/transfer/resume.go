@@ -0,0 +1,162 @@
+package transfer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/webrtc"
+)
+
+// ResumeFileName is the sidecar that records partially received files
+const ResumeFileName = ".warpdrop-partial"
+
+// resumeSaveInterval bounds how often progress is flushed to the sidecar
+const resumeSaveInterval = time.Second
+
+type ResumeEntry struct {
+	Path   string `json:"path"`
+	Offset uint64 `json:"offset"`
+}
+
+// ResumeState persists per-file received byte counts so an interrupted
+// single-channel transfer can continue from where it stopped. Entries are
+// keyed by file name and size so a different file with the same name is
+// never appended to. A nil state records nothing.
+type ResumeState struct {
+	mu       sync.Mutex
+	path     string
+	entries  map[string]ResumeEntry
+	lastSave time.Time
+}
+
+func resumeKey(meta webrtc.FileMetadata) string {
+	return fmt.Sprintf("%s:%d", meta.Name, meta.Size)
+}
+
+// LoadResumeState reads the sidecar in dir. A missing or unreadable sidecar
+// yields an empty state.
+func LoadResumeState(dir string) *ResumeState {
+	if dir == "" {
+		dir = "."
+	}
+
+	state := &ResumeState{
+		path:    filepath.Join(dir, ResumeFileName),
+		entries: make(map[string]ResumeEntry),
+	}
+
+	data, err := os.ReadFile(state.path)
+	if err != nil {
+		return state
+	}
+	if err := json.Unmarshal(data, &state.entries); err != nil {
+		state.entries = make(map[string]ResumeEntry)
+	}
+	return state
+}
+
+// Lookup returns the partial file and offset to resume meta from, if the
+// partial file still exists and holds at least that many bytes
+func (s *ResumeState) Lookup(meta webrtc.FileMetadata) (ResumeEntry, bool) {
+	if s == nil {
+		return ResumeEntry{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[resumeKey(meta)]
+	if !ok || entry.Offset == 0 || entry.Offset >= meta.Size {
+		return ResumeEntry{}, false
+	}
+
+	stat, err := os.Stat(entry.Path)
+	if err != nil || uint64(stat.Size()) < entry.Offset {
+		return ResumeEntry{}, false
+	}
+	return entry, true
+}
+
+// Token identifies the partial files in the sidecar, so a receiver can tell
+// the sender it is resuming an earlier transfer. It is empty when there is
+// nothing to resume.
+func (s *ResumeState) Token() string {
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keys []string
+	for _, key := range slices.Sorted(maps.Keys(s.entries)) {
+		if s.entries[key].Offset > 0 {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(strings.Join(keys, "\n")))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Update records progress for meta, flushing to disk at most once per
+// resumeSaveInterval
+func (s *ResumeState) Update(meta webrtc.FileMetadata, path string, offset uint64) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.entries[resumeKey(meta)] = ResumeEntry{Path: path, Offset: offset}
+	due := time.Since(s.lastSave) >= resumeSaveInterval
+	s.mu.Unlock()
+
+	if due {
+		s.Save()
+	}
+}
+
+// Complete forgets meta once it has been fully received
+func (s *ResumeState) Complete(meta webrtc.FileMetadata) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	delete(s.entries, resumeKey(meta))
+	s.mu.Unlock()
+
+	s.Save()
+}
+
+// Save writes the sidecar, removing it when nothing is left to resume
+func (s *ResumeState) Save() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastSave = time.Now()
+
+	if len(s.entries) == 0 {
+		if err := os.Remove(s.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	data, err := json.Marshal(s.entries)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0644)
+}
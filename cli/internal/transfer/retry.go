@@ -0,0 +1,28 @@
+package transfer
+
+import (
+	"errors"
+	"io"
+)
+
+// DefaultRetries is how many times a file that failed on its own channel
+// is sent again on a fresh one unless TransferOptions.Retries says otherwise
+const DefaultRetries = 2
+
+// RetryLimit returns how many times a failed file may be sent again. Zero
+// turns retries off.
+func RetryLimit(opts *TransferOptions) int {
+	if opts == nil {
+		return DefaultRetries
+	}
+	return max(opts.Retries, 0)
+}
+
+// Retryable reports whether err is a channel failure that a fresh channel
+// might get past, rather than a problem with the file or the transfer
+func Retryable(err error) bool {
+	return errors.Is(err, ErrChannelClosed) ||
+		errors.Is(err, ErrChannelNotOpen) ||
+		errors.Is(err, ErrBufferTimeout) ||
+		errors.Is(err, io.ErrClosedPipe)
+}
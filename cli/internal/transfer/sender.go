@@ -1,9 +1,11 @@
 package transfer
 
 import (
+	"context"
 	"io"
 	"time"
 
+	"github.com/BioHazard786/Warpdrop/cli/internal/ui"
 	"github.com/BioHazard786/Warpdrop/cli/internal/utils"
 	"github.com/BioHazard786/Warpdrop/cli/internal/webrtc"
 	pion "github.com/pion/webrtc/v4"
@@ -14,20 +16,69 @@ type ChunkSender struct {
 	channel    *pion.DataChannel
 	controller *utils.ChunkSizeController
 	buffer     []byte
+	highWater  uint64
+	limiter    *RateLimiter
+	cipher     *Cipher
+	stats      *StatsRecorder
+
+	// ctx stops a wait for the send buffer to drain, such as when the
+	// heartbeat finds the peer dead
+	ctx context.Context
+
+	// compression is the codec chunks are compressed with before sealing
+	compression string
+}
+
+// BufferThresholds are how much a channel may have buffered before sending
+// pauses (High) and how far it must drain before sending resumes (Low)
+type BufferThresholds struct {
+	High uint64
+	Low  uint64
+}
+
+// SingleChannelThresholds are the configured water marks, since one channel
+// carries the whole transfer
+func SingleChannelThresholds(cfg utils.ChunkSizeConfig) BufferThresholds {
+	return BufferThresholds{
+		High: uint64(cfg.HighWaterMark),
+		Low:  uint64(cfg.LowWaterMark),
+	}
+}
+
+// minChannelHighWaterChunks keeps a multichannel share big enough for two of
+// the largest chunks, so a channel never waits on every chunk it sends
+const minChannelHighWaterChunks = 2
+
+// MultiChannelThresholds splits the configured water marks between the
+// channels sending at once, so the total buffered stays near the high water
+// mark however many files are sent. Each channel still gets room for two
+// of the largest chunks.
+func MultiChannelThresholds(cfg utils.ChunkSizeConfig, channels int) BufferThresholds {
+	high := uint64(cfg.HighWaterMark)
+	if channels > 1 {
+		high /= uint64(channels)
+	}
+	high = max(high, uint64(minChannelHighWaterChunks*cfg.MaxChunk))
+	return BufferThresholds{
+		High: high,
+		Low:  high / 4,
+	}
 }
 
-func NewChunkSender(dc *pion.DataChannel) *ChunkSender {
-	dc.SetBufferedAmountLowThreshold(uint64(LowWaterMark))
+func NewChunkSender(dc *pion.DataChannel, cfg utils.ChunkSizeConfig, thresholds BufferThresholds) *ChunkSender {
+	dc.SetBufferedAmountLowThreshold(thresholds.Low)
 	return &ChunkSender{
 		channel:    dc,
-		controller: utils.NewChunkSizeController(),
-		buffer:     make([]byte, utils.MaxChunkSize),
+		controller: utils.NewChunkSizeController(cfg),
+		buffer:     make([]byte, cfg.MaxChunk),
+		highWater:  thresholds.High,
+		ctx:        context.Background(),
 	}
 }
 
 func (s *ChunkSender) WaitForWindow() error {
 	bufferedAmount := s.channel.BufferedAmount()
-	if bufferedAmount < uint64(HighWaterMark) {
+	if bufferedAmount < s.highWater {
 		return nil
 	}
 
@@ -43,6 +94,8 @@ func (s *ChunkSender) WaitForWindow() error {
 	select {
 	case <-wait:
 		return nil
+	case <-s.ctx.Done():
+		return context.Cause(s.ctx)
 	case <-time.After(timeout):
 		newBufferedAmount := s.channel.BufferedAmount()
 		if newBufferedAmount < bufferedAmount {
@@ -53,13 +106,72 @@ func (s *ChunkSender) WaitForWindow() error {
 }
 
 func (s *ChunkSender) WaitForDrain() {
-	start := time.Now()
-	for s.channel.BufferedAmount() > 0 && time.Since(start) < time.Duration(DrainTimeout)*time.Second {
-		if s.channel.ReadyState() != pion.DataChannelStateOpen {
-			return
+	DrainChannel(s.channel, time.Duration(DrainTimeout)*time.Second)
+}
+
+// DrainChannel waits until dc has flushed its buffered data, the channel
+// stops being open, or timeout elapses. It reports whether the buffer drained.
+func DrainChannel(dc *pion.DataChannel, timeout time.Duration) bool {
+	if dc == nil {
+		return true
+	}
+
+	deadline := time.Now().Add(timeout)
+	for dc.BufferedAmount() > 0 {
+		if dc.ReadyState() != pion.DataChannelStateOpen || time.Now().After(deadline) {
+			return false
 		}
 		time.Sleep(50 * time.Millisecond)
 	}
+	return true
+}
+
+// WaitForAck waits for ack to be closed, giving up when the peer leaves or
+// timeout elapses. It reports whether the ack arrived.
+func WaitForAck(ack <-chan struct{}, peerLeft <-chan struct{}, timeout time.Duration) bool {
+	select {
+	case <-ack:
+		return true
+	default:
+	}
+
+	select {
+	case <-ack:
+		return true
+	case <-peerLeft:
+		return false
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// DefaultConfirmTimeout is how long a sender without a heartbeat waits for
+// the receiver to confirm it has written everything, before allowing extra
+// time for large transfers
+const DefaultConfirmTimeout = 10 * time.Second
+
+// confirmBytesPerSecond is the slowest final flush the default timeout
+// allows for
+const confirmBytesPerSecond = 50 << 20
+
+// ConfirmTimeout returns how long to wait for the receiver to confirm it has
+// written size bytes, zero meaning as long as it takes. Unless opts sets a
+// timeout, a sender with the heartbeat on waits until the heartbeat gives
+// up on the receiver, since a long final write doesn't mean it failed.
+func ConfirmTimeout(opts *TransferOptions, size uint64) time.Duration {
+	if opts != nil && opts.ConfirmTimeout > 0 {
+		return opts.ConfirmTimeout
+	}
+	if HeartbeatTimeout(opts) > 0 {
+		return 0
+	}
+	return DefaultConfirmTimeout + time.Duration(size/confirmBytesPerSecond)*time.Second
+}
+
+// WarnUnconfirmed explains that the files were sent but the receiver never
+// said it had written them within timeout
+func WarnUnconfirmed(out *ui.Reporter, timeout time.Duration) {
+	out.PrintWarningf("Every file was sent, but the receiver didn't confirm writing them within %s", timeout)
 }
 
 func (s *ChunkSender) IsOpen() bool {
@@ -71,6 +183,7 @@ func (s *ChunkSender) GetChunkSize() int {
 }
 
 func (s *ChunkSender) RecordBytes(n int64) {
+	s.stats.Record(n, s.controller.GetChunkSize())
 	s.controller.RecordBytesTransferred(n)
 }
 
@@ -78,7 +191,40 @@ func (s *ChunkSender) Buffer() []byte {
 	return s.buffer
 }
 
+// SetLimiter caps the send rate; the chunk size controller keeps adapting
+// underneath it
+func (s *ChunkSender) SetLimiter(l *RateLimiter) {
+	s.limiter = l
+}
+
+// SetStats records the throughput and chunk size of every chunk sent in r
+func (s *ChunkSender) SetStats(r *StatsRecorder) {
+	s.stats = r
+}
+
+// SetContext makes a wait for the send buffer give up once ctx is done
+func (s *ChunkSender) SetContext(ctx context.Context) {
+	s.ctx = ctx
+}
+
+// SetCipher encrypts every chunk payload with c before it is sent
+func (s *ChunkSender) SetCipher(c *Cipher) {
+	s.cipher = c
+}
+
+// SetCompression compresses every chunk payload with codec before it is
+// encrypted. An empty codec sends chunks as they are.
+func (s *ChunkSender) SetCompression(codec string) {
+	s.compression = codec
+}
+
+// Seal compresses and then encrypts a chunk payload, as configured
+func (s *ChunkSender) Seal(data []byte) []byte {
+	return s.cipher.Seal(Compress(s.compression, data))
+}
+
 func (s *ChunkSender) Send(data []byte) error {
+	s.limiter.Wait(len(data))
 	return s.channel.Send(data)
 }
 
@@ -86,16 +232,105 @@ type SingleChannelFileSender struct {
 	sender   *ChunkSender
 	fileName string
 	fileSize int64
+
+	// offset is where the next chunk sent by SendNext starts
+	offset uint64
 }
 
-func NewSingleChannelFileSender(dc *pion.DataChannel, fileName string, fileSize int64) *SingleChannelFileSender {
+func NewSingleChannelFileSender(dc *pion.DataChannel, cfg utils.ChunkSizeConfig, fileName string, fileSize int64) *SingleChannelFileSender {
 	return &SingleChannelFileSender{
-		sender:   NewChunkSender(dc),
+		sender:   NewChunkSender(dc, cfg, SingleChannelThresholds(cfg)),
 		fileName: fileName,
 		fileSize: fileSize,
 	}
 }
 
+func (s *SingleChannelFileSender) SetLimiter(l *RateLimiter) {
+	s.sender.SetLimiter(l)
+}
+
+func (s *SingleChannelFileSender) SetStats(r *StatsRecorder) {
+	s.sender.SetStats(r)
+}
+
+func (s *SingleChannelFileSender) SetContext(ctx context.Context) {
+	s.sender.SetContext(ctx)
+}
+
+func (s *SingleChannelFileSender) SetCipher(c *Cipher) {
+	s.sender.SetCipher(c)
+}
+
+func (s *SingleChannelFileSender) SetCompression(codec string) {
+	s.sender.SetCompression(codec)
+}
+
+// SetOffset makes SendNext start at offset, such as when the receiver
+// already has the start of the file
+func (s *SingleChannelFileSender) SetOffset(offset uint64) {
+	s.offset = offset
+}
+
+// Offset returns how far into the file SendNext has sent
+func (s *SingleChannelFileSender) Offset() uint64 {
+	return s.offset
+}
+
+// SendNext sends one chunk read from file and reports whether it was the
+// last. Calling it in turn for several files interleaves their chunks.
+func (s *SingleChannelFileSender) SendNext(file io.Reader) (bool, error) {
+	if !s.sender.IsOpen() {
+		return false, ErrChannelClosed
+	}
+	if err := s.sender.WaitForWindow(); err != nil {
+		return false, err
+	}
+
+	n, err := file.Read(s.sender.Buffer()[:s.sender.GetChunkSize()])
+	if err == io.EOF {
+		return true, s.sendEmpty()
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if err := s.sendChunk(s.offset, n); err != nil {
+		return false, err
+	}
+	s.offset += uint64(n)
+	s.sender.RecordBytes(int64(n))
+	return s.offset >= uint64(s.fileSize), nil
+}
+
+// sendEmpty sends an empty file as a single empty final chunk, which is
+// what tells the receiver it is complete
+func (s *SingleChannelFileSender) sendEmpty() error {
+	if s.fileSize != 0 || s.offset != 0 {
+		return nil
+	}
+	return s.sendChunk(0, 0)
+}
+
+// sendChunk sends the first n bytes of the buffer as the chunk at offset
+func (s *SingleChannelFileSender) sendChunk(offset uint64, n int) error {
+	message, err := webrtc.NewMessage(MessageTypeChunk, webrtc.ChunkPayload{
+		FileName:    s.fileName,
+		Offset:      offset,
+		Bytes:       s.sender.Seal(s.sender.Buffer()[:n]),
+		Final:       offset+uint64(n) >= uint64(s.fileSize),
+		Compression: s.sender.compression,
+	})
+	if err != nil {
+		return err
+	}
+
+	data, err := msgpack.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return s.sender.Send(data)
+}
+
 func (s *SingleChannelFileSender) SendChunks(file io.Reader, offset uint64, onProgress func(uint64), onComplete func(), onError func(string)) error {
 	if !s.sender.IsOpen() {
 		onError("channel not open")
@@ -119,6 +354,12 @@ func (s *SingleChannelFileSender) SendChunks(file io.Reader, offset uint64, onPr
 
 		if err != nil {
 			if err == io.EOF {
+				if currentOffset == 0 {
+					if err := s.sendEmpty(); err != nil {
+						onError(err.Error())
+						return err
+					}
+				}
 				s.sender.WaitForDrain()
 				onComplete()
 				return nil
@@ -127,25 +368,7 @@ func (s *SingleChannelFileSender) SendChunks(file io.Reader, offset uint64, onPr
 			return err
 		}
 
-		final := currentOffset+uint64(n) >= uint64(s.fileSize)
-		message, err := webrtc.NewMessage(MessageTypeChunk, webrtc.ChunkPayload{
-			FileName: s.fileName,
-			Offset:   currentOffset,
-			Bytes:    s.sender.Buffer()[:n],
-			Final:    final,
-		})
-		if err != nil {
-			onError(err.Error())
-			return err
-		}
-
-		data, err := msgpack.Marshal(message)
-		if err != nil {
-			onError(err.Error())
-			return err
-		}
-
-		if err := s.sender.Send(data); err != nil {
+		if err := s.sendChunk(currentOffset, n); err != nil {
 			onError(err.Error())
 			return err
 		}
@@ -160,12 +383,34 @@ type MultiChannelFileSender struct {
 	sender *ChunkSender
 }
 
-func NewMultiChannelFileSender(dc *pion.DataChannel) *MultiChannelFileSender {
+// NewMultiChannelFileSender creates a sender for one of channels files
+// being sent at once, which share the buffer thresholds between them
+func NewMultiChannelFileSender(dc *pion.DataChannel, cfg utils.ChunkSizeConfig, channels int) *MultiChannelFileSender {
 	return &MultiChannelFileSender{
-		sender: NewChunkSender(dc),
+		sender: NewChunkSender(dc, cfg, MultiChannelThresholds(cfg, channels)),
 	}
 }
 
+func (s *MultiChannelFileSender) SetLimiter(l *RateLimiter) {
+	s.sender.SetLimiter(l)
+}
+
+func (s *MultiChannelFileSender) SetStats(r *StatsRecorder) {
+	s.sender.SetStats(r)
+}
+
+func (s *MultiChannelFileSender) SetContext(ctx context.Context) {
+	s.sender.SetContext(ctx)
+}
+
+func (s *MultiChannelFileSender) SetCipher(c *Cipher) {
+	s.sender.SetCipher(c)
+}
+
+func (s *MultiChannelFileSender) SetCompression(codec string) {
+	s.sender.SetCompression(codec)
+}
+
 func (s *MultiChannelFileSender) SendChunks(file io.Reader, onProgress func(int64), onComplete func(), onError func(string)) error {
 	if !s.sender.IsOpen() {
 		onError("channel not open")
@@ -197,7 +442,7 @@ func (s *MultiChannelFileSender) SendChunks(file io.Reader, onProgress func(int6
 			return err
 		}
 
-		if err := s.sender.Send(s.sender.Buffer()[:n]); err != nil {
+		if err := s.sender.Send(s.sender.Seal(s.sender.Buffer()[:n])); err != nil {
 			onError(err.Error())
 			return err
 		}
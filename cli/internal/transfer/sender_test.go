@@ -0,0 +1,125 @@
+package transfer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/utils"
+	pion "github.com/pion/webrtc/v4"
+)
+
+// connectPeers returns two peer connections connected over loopback
+func connectPeers(t *testing.T) (*pion.PeerConnection, *pion.PeerConnection) {
+	t.Helper()
+	offerer, err := pion.NewPeerConnection(pion.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	answerer, err := pion.NewPeerConnection(pion.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		offerer.Close()
+		answerer.Close()
+	})
+	offerer.OnICECandidate(func(c *pion.ICECandidate) {
+		if c != nil {
+			answerer.AddICECandidate(c.ToJSON())
+		}
+	})
+	answerer.OnICECandidate(func(c *pion.ICECandidate) {
+		if c != nil {
+			offerer.AddICECandidate(c.ToJSON())
+		}
+	})
+	return offerer, answerer
+}
+
+// negotiate runs the offer and answer between the two peer connections
+func negotiate(t *testing.T, offerer, answerer *pion.PeerConnection) {
+	t.Helper()
+	offer, err := offerer.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := offerer.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+	if err := answerer.SetRemoteDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+	answer, err := answerer.CreateAnswer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := answerer.SetLocalDescription(answer); err != nil {
+		t.Fatal(err)
+	}
+	if err := offerer.SetRemoteDescription(answer); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestCloseAfterDrainDoesNotTruncate closes the sender the moment the last
+// chunk is sent, as a fast transfer does, and checks none of it is lost
+func TestCloseAfterDrainDoesNotTruncate(t *testing.T) {
+	for _, size := range []int{1, 64*1024 + 7, 3*1024*1024 + 123} {
+		sender, receiver := connectPeers(t)
+
+		data := make([]byte, size)
+		rand.Read(data)
+
+		var mu sync.Mutex
+		var received bytes.Buffer
+		closed := make(chan struct{})
+		receiver.OnDataChannel(func(dc *pion.DataChannel) {
+			dc.OnMessage(func(msg pion.DataChannelMessage) {
+				mu.Lock()
+				received.Write(msg.Data)
+				mu.Unlock()
+			})
+			dc.OnClose(func() { close(closed) })
+		})
+
+		dc, err := sender.CreateDataChannel("file-transfer-0", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opened := make(chan struct{})
+		dc.OnOpen(func() { close(opened) })
+		negotiate(t, sender, receiver)
+
+		select {
+		case <-opened:
+		case <-time.After(10 * time.Second):
+			t.Fatal("data channel did not open")
+		}
+
+		fs := NewMultiChannelFileSender(dc, utils.DefaultChunkSizeConfig(), 1)
+		if err := fs.SendChunks(bytes.NewReader(data), func(int64) {}, func() {}, func(string) {}); err != nil {
+			t.Fatal(err)
+		}
+		if !DrainChannel(dc, time.Duration(CloseTimeout)*time.Second) {
+			t.Fatal("data channel did not drain")
+		}
+		dc.Close()
+		sender.Close()
+
+		select {
+		case <-closed:
+		case <-time.After(10 * time.Second):
+			t.Fatal("receiver's channel did not close")
+		}
+
+		mu.Lock()
+		got := received.Bytes()
+		if !bytes.Equal(got, data) {
+			t.Errorf("size %d: received %d bytes, want %d intact", size, len(got), len(data))
+		}
+		mu.Unlock()
+	}
+}
@@ -0,0 +1,59 @@
+package transfer
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DefaultStallTimeout is how long a receiver waits for data before giving
+// the transfer up as stalled
+const DefaultStallTimeout = 30 * time.Second
+
+// StallTimeout returns the stall timeout set in opts. Zero never times out.
+func StallTimeout(opts *TransferOptions) time.Duration {
+	if opts == nil {
+		return DefaultStallTimeout
+	}
+	return opts.StallTimeout
+}
+
+// StallTimer fires once timeout passes, or never when timeout is zero
+func StallTimer(timeout time.Duration) <-chan time.Time {
+	if timeout <= 0 {
+		return nil
+	}
+	return time.After(timeout)
+}
+
+// StallError reports that no data arrived for timeout
+func StallError(timeout time.Duration) error {
+	return WrapError("receive", ErrTimeout, fmt.Sprintf("no data for %s", timeout))
+}
+
+// WatchStall calls stalled with a StallError once the count returned by
+// received stops growing for timeout, not counting time the sender is
+// paused. It returns when ctx is done, and right away when timeout is zero.
+func WatchStall(ctx context.Context, timeout time.Duration, received func() int64, pause *PeerPause, stalled func(error)) {
+	if timeout <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(max(timeout/10, 100*time.Millisecond))
+	defer ticker.Stop()
+
+	last, lastChange := received(), time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if n := received(); n != last || pause.Paused() {
+				last, lastChange = n, now
+			} else if now.Sub(lastChange) >= timeout {
+				stalled(StallError(timeout))
+				return
+			}
+		}
+	}
+}
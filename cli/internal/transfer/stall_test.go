@@ -0,0 +1,54 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWatchStallHoldsOffWhilePaused(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pause := NewPeerPause()
+	pause.Set(true)
+
+	stalled := make(chan error, 1)
+	timeout := 200 * time.Millisecond
+	go WatchStall(ctx, timeout, func() int64 { return 0 }, pause, func(err error) { stalled <- err })
+
+	select {
+	case err := <-stalled:
+		t.Fatalf("stalled while paused: %v", err)
+	case <-time.After(4 * timeout):
+	}
+
+	pause.Set(false)
+	select {
+	case err := <-stalled:
+		if !errors.Is(err, ErrTimeout) {
+			t.Errorf("got %v, want a timeout", err)
+		}
+	case <-time.After(4 * timeout):
+		t.Fatal("no stall after resuming")
+	}
+}
+
+func TestPeerPauseChangedKeepsLatest(t *testing.T) {
+	pause := NewPeerPause()
+	pause.Set(true)
+	pause.Set(false)
+
+	if pause.Paused() {
+		t.Error("still paused after resuming")
+	}
+	if paused := <-pause.Changed(); paused {
+		t.Error("Changed delivered a stale pause")
+	}
+
+	var none *PeerPause
+	if none.Paused() || none.Changed() != nil {
+		t.Error("nil PeerPause should never be paused")
+	}
+}
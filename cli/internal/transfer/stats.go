@@ -0,0 +1,158 @@
+package transfer
+
+import (
+	"encoding/csv"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/ui"
+)
+
+// statsInterval is how often StatsRecorder takes a sample
+const statsInterval = 500 * time.Millisecond
+
+// StatsSample is the throughput over one interval of a transfer
+type StatsSample struct {
+	Time time.Time
+
+	// Bytes is the total sent so far and Speed the rate over the interval,
+	// in bytes per second
+	Bytes int64
+	Speed float64
+
+	// ChunkSize is the average chunk size the adaptive controller picked
+	// over the interval
+	ChunkSize int
+}
+
+// StatsRecorder keeps a time series of throughput and chunk size across
+// every channel of a transfer, for writing to a CSV file. A nil recorder
+// records nothing, and the zero value records without a file to write.
+type StatsRecorder struct {
+	path string
+
+	mu      sync.Mutex
+	samples []StatsSample
+	total   int64
+
+	// the interval being measured: when it started, the bytes sent and the
+	// chunk sizes in effect for each chunk
+	windowStart  time.Time
+	windowBytes  int64
+	windowChunks int64
+	windowSizes  int64
+}
+
+// NewStatsRecorder returns a recorder that writes to path, or nil if path
+// is empty
+func NewStatsRecorder(path string) *StatsRecorder {
+	if path == "" {
+		return nil
+	}
+	return &StatsRecorder{path: path}
+}
+
+// Record adds a chunk of n bytes sent while the controller's chunk size was
+// chunkSize, taking a sample once the interval is up
+func (r *StatsRecorder) Record(n int64, chunkSize int) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if r.windowStart.IsZero() {
+		r.windowStart = now
+	}
+	r.total += n
+	r.windowBytes += n
+	r.windowChunks++
+	r.windowSizes += int64(chunkSize)
+
+	if now.Sub(r.windowStart) >= statsInterval {
+		r.sample(now)
+	}
+}
+
+// sample closes the current interval. The caller holds mu.
+func (r *StatsRecorder) sample(now time.Time) {
+	if r.windowChunks == 0 {
+		return
+	}
+
+	var speed float64
+	if elapsed := now.Sub(r.windowStart).Seconds(); elapsed > 0 {
+		speed = float64(r.windowBytes) / elapsed
+	}
+	r.samples = append(r.samples, StatsSample{
+		Time:      now,
+		Bytes:     r.total,
+		Speed:     speed,
+		ChunkSize: int(r.windowSizes / r.windowChunks),
+	})
+
+	r.windowStart = now
+	r.windowBytes = 0
+	r.windowChunks = 0
+	r.windowSizes = 0
+}
+
+// Samples samples what is left of the last interval and returns every
+// sample taken
+func (r *StatsRecorder) Samples() []StatsSample {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sample(time.Now())
+	return append([]StatsSample(nil), r.samples...)
+}
+
+// Write writes every sample to the recorder's file as CSV
+func (r *StatsRecorder) Write() error {
+	if r == nil || r.path == "" {
+		return nil
+	}
+
+	samples := r.Samples()
+
+	f, err := os.Create(r.path)
+	if err != nil {
+		return NewFileError("create stats file", r.path, err)
+	}
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"timestamp", "bytes", "speed_bps", "chunk_size"})
+	for _, s := range samples {
+		w.Write([]string{
+			s.Time.Format(time.RFC3339Nano),
+			strconv.FormatInt(s.Bytes, 10),
+			strconv.FormatFloat(s.Speed, 'f', 0, 64),
+			strconv.Itoa(s.ChunkSize),
+		})
+	}
+	w.Flush()
+
+	if err := w.Error(); err != nil {
+		f.Close()
+		return NewFileError("write stats file", r.path, err)
+	}
+	if err := f.Close(); err != nil {
+		return NewFileError("write stats file", r.path, err)
+	}
+	return nil
+}
+
+// WriteStats writes the stats of a completed transfer, warning on out
+// rather than failing when the file can't be written
+func WriteStats(r *StatsRecorder, out *ui.Reporter) {
+	if err := r.Write(); err != nil {
+		out.PrintWarningf("Could not write transfer stats: %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package transfer
+
+import (
+	"strings"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/signaling"
+)
+
+// SuggestRoomID replaces words of roomID that aren't room ID words with
+// the closest one. It returns "" when every word is known or nothing is
+// close enough to be a likely typo.
+func SuggestRoomID(roomID string) string {
+	words := strings.Split(roomID, "-")
+	changed := false
+	for i, word := range words {
+		if closest := closestWord(word); closest != "" && closest != word {
+			words[i] = closest
+			changed = true
+		}
+	}
+	if !changed {
+		return ""
+	}
+	return strings.Join(words, "-")
+}
+
+// closestWord returns the known word nearest to word, or "" when none is
+// within a typo's distance. Short words allow a single edit.
+func closestWord(word string) string {
+	best, bestDist := "", 2
+	if len(word) <= 4 {
+		bestDist = 1
+	}
+	for _, candidate := range signaling.Words {
+		if candidate == word {
+			return word
+		}
+		if d := levenshtein(word, candidate); d <= bestDist && (best == "" || d < bestDist) {
+			best, bestDist = candidate, d
+		}
+	}
+	return best
+}
+
+// levenshtein returns the edit distance between a and b
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
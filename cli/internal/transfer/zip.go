@@ -0,0 +1,176 @@
+package transfer
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/utils"
+	"github.com/BioHazard786/Warpdrop/cli/internal/webrtc"
+)
+
+// maxHeldBytes caps how much of a streamed zip entry may wait in memory for
+// a gap before it to be filled
+const maxHeldBytes = 64 << 20
+
+// ZipArchive is the zip a --zip receive writes files into as they arrive.
+// A zip takes one entry at a time, so the first file opened streams straight
+// in while files received alongside it are spooled to temp files and added
+// once the archive is free.
+type ZipArchive struct {
+	mu   sync.Mutex
+	zip  *utils.ZipWriter
+	busy bool
+
+	// queued are complete spool files waiting for the streamed entry
+	queued []*FileWriter
+	count  int
+	err    error
+}
+
+// zipEntry is where a FileWriter's file goes in the archive
+type zipEntry struct {
+	name    string
+	modTime time.Time
+	mode    os.FileMode
+
+	// w is the open entry while the file streams into the archive
+	w io.Writer
+}
+
+// NewZipArchive starts an archive on w, which need not be seekable
+func NewZipArchive(w io.Writer, opts utils.ZipOptions) (*ZipArchive, error) {
+	zw, err := utils.NewZipWriter(w, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &ZipArchive{zip: zw}, nil
+}
+
+// Count returns how many complete files the archive holds
+func (a *ZipArchive) Count() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.count
+}
+
+// Close adds the files still waiting and finishes the archive
+func (a *ZipArchive) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.addQueued()
+	if err := a.zip.Close(); err != nil && a.err == nil {
+		a.err = err
+	}
+	return a.err
+}
+
+// newWriter names meta's entry and opens it when no other entry is, or
+// spools the file otherwise
+func (a *ZipArchive) newWriter(meta webrtc.FileMetadata, index int, preserve bool) (*FileWriter, error) {
+	target, err := outputPath("", meta)
+	if err != nil {
+		return nil, NewFileError("resolve path", meta.Name, err)
+	}
+
+	entry := zipEntry{modTime: time.Now(), mode: 0644}
+	if preserve && meta.ModTime > 0 {
+		entry.modTime = time.UnixMilli(meta.ModTime)
+	}
+	if preserve && meta.Mode != 0 {
+		entry.mode = preservedMode(meta.Mode)
+	}
+
+	w := &FileWriter{
+		Metadata:  meta,
+		Index:     index,
+		hash:      NewHasher(),
+		hashValid: true,
+		archive:   a,
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	entry.name = a.zip.Name(filepath.ToSlash(target))
+
+	if !a.busy {
+		if entry.w, err = a.zip.Create(entry.name, entry.modTime, entry.mode); err != nil {
+			return nil, NewFileError("add to zip", meta.Name, err)
+		}
+		a.busy = true
+		w.entry = entry
+		return w, nil
+	}
+
+	spool, err := os.CreateTemp("", "warpdrop-spool-*")
+	if err != nil {
+		return nil, NewFileError("create spool file", meta.Name, err)
+	}
+	w.File = spool
+	w.spool = spool.Name()
+	w.entry = entry
+	return w, nil
+}
+
+// finish ends w's entry, or queues its spool file while another entry is
+// open. A streamed entry can't be taken back out, so one that stopped part
+// way stays truncated in the archive.
+func (a *ZipArchive) finish(w *FileWriter) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	switch {
+	case w.entry.w != nil:
+		a.busy = false
+		if w.IsComplete() {
+			a.count++
+		}
+	case !w.IsComplete():
+		w.File.Close()
+		os.Remove(w.spool)
+		return nil
+	default:
+		a.queued = append(a.queued, w)
+		if a.busy {
+			return nil
+		}
+	}
+
+	a.addQueued()
+	return a.err
+}
+
+// addQueued copies the waiting spool files into the archive and removes
+// them. The first error is kept for Close to report.
+func (a *ZipArchive) addQueued() {
+	for _, w := range a.queued {
+		if err := a.addSpool(w); err != nil && a.err == nil {
+			a.err = NewFileError("add to zip", w.Metadata.Name, err)
+		}
+	}
+	a.queued = nil
+}
+
+func (a *ZipArchive) addSpool(w *FileWriter) error {
+	defer os.Remove(w.spool)
+	defer w.File.Close()
+
+	dst, err := a.zip.Create(w.entry.name, w.entry.modTime, w.entry.mode)
+	if err != nil {
+		return err
+	}
+	if _, err := w.File.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, w.File); err != nil {
+		return err
+	}
+	a.count++
+	return nil
+}
@@ -0,0 +1,179 @@
+package trust
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/config"
+	pion "github.com/pion/webrtc/v4"
+)
+
+// Identity is the DTLS certificate this device connects with. The DTLS
+// handshake proves a peer holds the certificate's key, so its fingerprint
+// identifies the device in a way the peer can't fake.
+type Identity struct {
+	Certificate pion.Certificate
+	Fingerprint string
+}
+
+// identityLifetime is how long a generated certificate stays valid
+const identityLifetime = 20 * 365 * 24 * time.Hour
+
+// IdentityPath returns where the device certificate lives: identity.pem
+// next to the config file
+func IdentityPath() (string, error) {
+	path, err := config.FilePath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), "identity.pem"), nil
+}
+
+// Fingerprint returns the fingerprint of a DER encoded certificate: the
+// first 16 bytes of its SHA-256 in hex
+func Fingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:16])
+}
+
+// LoadIdentity reads the device certificate. It fails with an error
+// matching os.ErrNotExist if the device has none yet.
+func LoadIdentity() (*Identity, error) {
+	return loadIdentity(false)
+}
+
+// EnsureIdentity reads the device certificate, generating one and saving it
+// if the device has none yet
+func EnsureIdentity() (*Identity, error) {
+	return loadIdentity(true)
+}
+
+// loadIdentity reads the device certificate, generating it when missing if
+// create is set
+func loadIdentity(create bool) (*Identity, error) {
+	path, err := IdentityPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if create && errors.Is(err, os.ErrNotExist) {
+		if data, err = generateIdentity(path); err != nil {
+			return nil, fmt.Errorf("create device certificate: %w", err)
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	identity, err := parseIdentity(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return identity, nil
+}
+
+// generateIdentity creates a self-signed certificate and writes it to path
+// with its key, returning the PEM written
+func generateIdentity(path string) ([]byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 62))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "WarpDrop"},
+		NotBefore:    now.Add(-24 * time.Hour),
+		NotAfter:     now.Add(identityLifetime),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})...)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	// The key is what the fingerprint vouches for, so only the owner may read it
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// parseIdentity reads a certificate and its private key from PEM
+func parseIdentity(data []byte) (*Identity, error) {
+	var cert *x509.Certificate
+	var key *ecdsa.PrivateKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		var err error
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err = x509.ParseCertificate(block.Bytes)
+		case "PRIVATE KEY":
+			var parsed any
+			parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err == nil {
+				var ok bool
+				if key, ok = parsed.(*ecdsa.PrivateKey); !ok {
+					err = errors.New("private key is not ECDSA")
+				}
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cert == nil || key == nil {
+		return nil, errors.New("missing certificate or private key")
+	}
+
+	return &Identity{
+		Certificate: pion.CertificateFromX509(key, cert),
+		Fingerprint: Fingerprint(cert.Raw),
+	}, nil
+}
+
+// RemoteFingerprint returns the fingerprint of the certificate pc's peer
+// proved it holds in the DTLS handshake, or "" before it completes
+func RemoteFingerprint(pc *pion.PeerConnection) string {
+	sctp := pc.SCTP()
+	if sctp == nil || sctp.Transport() == nil {
+		return ""
+	}
+	der := sctp.Transport().GetRemoteCertificate()
+	if len(der) == 0 {
+		return ""
+	}
+	return Fingerprint(der)
+}
@@ -0,0 +1,114 @@
+package trust
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	pion "github.com/pion/webrtc/v4"
+)
+
+func TestLoadIdentityPersists(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	first, err := EnsureIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := LoadIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Fingerprint != second.Fingerprint {
+		t.Errorf("fingerprint changed from %s to %s", first.Fingerprint, second.Fingerprint)
+	}
+	if _, err := NormalizeFingerprint(first.Fingerprint); err != nil {
+		t.Error(err)
+	}
+	if first.Certificate.Expires().Before(time.Now().Add(365 * 24 * time.Hour)) {
+		t.Errorf("certificate expires %s", first.Certificate.Expires())
+	}
+}
+
+func TestLoadIdentityDoesNotCreate(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	if _, err := LoadIdentity(); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("LoadIdentity() error = %v, want not exist", err)
+	}
+	path, err := IdentityPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("LoadIdentity created %s", path)
+	}
+}
+
+// TestRemoteFingerprintMatchesIdentity connects a peer using the device
+// certificate and checks the other side sees its fingerprint
+func TestRemoteFingerprintMatchesIdentity(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	identity, err := EnsureIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sender, err := pion.NewPeerConnection(pion.Configuration{Certificates: []pion.Certificate{identity.Certificate}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+	receiver, err := pion.NewPeerConnection(pion.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer receiver.Close()
+
+	if RemoteFingerprint(receiver) != "" {
+		t.Error("fingerprint known before connecting")
+	}
+
+	opened := make(chan struct{})
+	receiver.OnDataChannel(func(dc *pion.DataChannel) {
+		dc.OnOpen(func() { close(opened) })
+	})
+	if _, err := sender.CreateDataChannel("test", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	offer, err := sender.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gathered := pion.GatheringCompletePromise(sender)
+	if err := sender.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+	<-gathered
+	if err := receiver.SetRemoteDescription(*sender.LocalDescription()); err != nil {
+		t.Fatal(err)
+	}
+	answer, err := receiver.CreateAnswer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gathered = pion.GatheringCompletePromise(receiver)
+	if err := receiver.SetLocalDescription(answer); err != nil {
+		t.Fatal(err)
+	}
+	<-gathered
+	if err := sender.SetRemoteDescription(*receiver.LocalDescription()); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-opened:
+	case <-time.After(10 * time.Second):
+		t.Fatal("data channel did not open")
+	}
+	if got := RemoteFingerprint(receiver); got != identity.Fingerprint {
+		t.Errorf("remote fingerprint %q, want %q", got, identity.Fingerprint)
+	}
+}
@@ -0,0 +1,96 @@
+package trust
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/config"
+)
+
+// Peer is a device whose transfers are accepted without asking
+type Peer struct {
+	Fingerprint string    `json:"fingerprint"`
+	AddedAt     time.Time `json:"added_at"`
+}
+
+// List is the set of trusted peers, stored as JSON
+type List struct {
+	Peers []Peer `json:"peers"`
+}
+
+var fingerprintPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// FilePath returns where the trusted peers live: trusted.json next to the
+// config file
+func FilePath() (string, error) {
+	path, err := config.FilePath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), "trusted.json"), nil
+}
+
+// NormalizeFingerprint lowercases fp and checks it looks like a device
+// fingerprint
+func NormalizeFingerprint(fp string) (string, error) {
+	fp = strings.ToLower(strings.TrimSpace(fp))
+	if !fingerprintPattern.MatchString(fp) {
+		return "", fmt.Errorf("invalid fingerprint %q (expected 32 hex characters)", fp)
+	}
+	return fp, nil
+}
+
+// Load reads the list at path. A missing file yields an empty list.
+func Load(path string) (*List, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &List{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var list List
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &list, nil
+}
+
+// Save writes the list to path, creating its directory
+func (l *List) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0600)
+}
+
+// Contains reports whether fp is trusted. A nil list trusts nobody.
+func (l *List) Contains(fp string) bool {
+	if l == nil || fp == "" {
+		return false
+	}
+	return slices.ContainsFunc(l.Peers, func(p Peer) bool {
+		return p.Fingerprint == fp
+	})
+}
+
+// Add trusts fp, reporting false if it already was
+func (l *List) Add(fp string) bool {
+	if l.Contains(fp) {
+		return false
+	}
+	l.Peers = append(l.Peers, Peer{Fingerprint: fp, AddedAt: time.Now()})
+	return true
+}
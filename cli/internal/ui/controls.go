@@ -0,0 +1,64 @@
+package ui
+
+import "sync"
+
+// TransferControls are the actions a running transfer offers from the
+// progress display
+type TransferControls struct {
+	// TogglePause pauses or resumes sending and returns whether it is now
+	// paused
+	TogglePause func() bool
+
+	// CancelFile stops a single file. Nil when the protocol can't skip files.
+	CancelFile func(index int)
+}
+
+var (
+	controlsMu sync.Mutex
+	controls   *TransferControls
+)
+
+// SetTransferControls makes the progress keybindings drive c. The returned
+// func removes it.
+func SetTransferControls(c *TransferControls) func() {
+	controlsMu.Lock()
+	controls = c
+	controlsMu.Unlock()
+
+	return func() {
+		controlsMu.Lock()
+		controls = nil
+		controlsMu.Unlock()
+	}
+}
+
+// currentControls returns the registered controls, or an empty set
+func currentControls() TransferControls {
+	controlsMu.Lock()
+	defer controlsMu.Unlock()
+	if controls == nil {
+		return TransferControls{}
+	}
+	return *controls
+}
+
+// TogglePause pauses or resumes the transfer, returning whether it is now
+// paused and whether one was running that supports it
+func TogglePause() (paused, ok bool) {
+	c := currentControls()
+	if c.TogglePause == nil {
+		return false, false
+	}
+	return c.TogglePause(), true
+}
+
+// CancelFile stops the file at index and reports whether the transfer
+// supports skipping files
+func CancelFile(index int) bool {
+	c := currentControls()
+	if c.CancelFile == nil {
+		return false
+	}
+	c.CancelFile(index)
+	return true
+}
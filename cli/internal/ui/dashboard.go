@@ -0,0 +1,276 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/bubbles/progress"
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// maxDashboardLogLines is how many recent log lines the dashboard keeps visible
+const maxDashboardLogLines = 6
+
+// activeDashboard is the running dashboard, if any. While set, spinners and
+// Printf output are routed into the dashboard instead of stdout.
+var (
+	activeDashboard   *Dashboard
+	activeDashboardMu sync.RWMutex
+)
+
+// ActiveDashboard returns the running dashboard or nil
+func ActiveDashboard() *Dashboard {
+	activeDashboardMu.RLock()
+	defer activeDashboardMu.RUnlock()
+	return activeDashboard
+}
+
+func setActiveDashboard(d *Dashboard) {
+	activeDashboardMu.Lock()
+	defer activeDashboardMu.Unlock()
+	activeDashboard = d
+}
+
+// DashboardStatusMsg replaces the current activity line
+type DashboardStatusMsg string
+
+// DashboardLogMsg appends a line to the dashboard log
+type DashboardLogMsg string
+
+// DashboardPeerMsg updates the peer status line
+type DashboardPeerMsg string
+
+// DashboardQRMsg shows a QR code of the room link below the room info
+type DashboardQRMsg struct{}
+
+// DashboardFilesMsg attaches a progress view for the given files
+type DashboardFilesMsg struct {
+	Names []string
+	Sizes []int64
+}
+
+// DashboardModel composes room info, peer status and live progress in one view
+type DashboardModel struct {
+	room        *RoomInfo
+	showQR      bool
+	peer        string
+	status      string
+	logs        []string
+	progress    *ProgressModel
+	spinner     spinner.Model
+	interrupted bool
+}
+
+// NewDashboardModel creates a dashboard for the given room
+func NewDashboardModel(roomID, shortCode, roomLink string) DashboardModel {
+	s := spinner.New()
+	s.Spinner = spinner.Points
+	s.Style = SpinnerStyle
+
+	return DashboardModel{
+		room:    NewRoomInfo(roomID, shortCode, roomLink),
+		peer:    "waiting",
+		spinner: s,
+	}
+}
+
+func (m DashboardModel) Init() tea.Cmd {
+	return m.spinner.Tick
+}
+
+func (m DashboardModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if msg.Type == tea.KeyCtrlC {
+			// A running transfer cancels itself and tells the peer
+			if Interrupt() {
+				return m, nil
+			}
+			m.interrupted = true
+			return m, tea.Quit
+		}
+		// Other keys drive the transfer from the progress display
+		if m.progress != nil {
+			newModel, _ := m.progress.Update(msg)
+			pm := newModel.(ProgressModel)
+			m.progress = &pm
+		}
+		return m, nil
+
+	case tea.WindowSizeMsg:
+		if m.progress != nil {
+			newModel, _ := m.progress.Update(msg)
+			pm := newModel.(ProgressModel)
+			m.progress = &pm
+		}
+		return m, nil
+
+	case spinner.TickMsg:
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+
+	case DashboardStatusMsg:
+		m.status = string(msg)
+		return m, nil
+
+	case DashboardLogMsg:
+		m.logs = append(m.logs, string(msg))
+		return m, nil
+
+	case DashboardPeerMsg:
+		m.peer = string(msg)
+		return m, nil
+
+	case DashboardQRMsg:
+		m.showQR = true
+		return m, nil
+
+	case DashboardFilesMsg:
+		pm := NewProgressModel(msg.Names, msg.Sizes)
+		m.progress = &pm
+		m.status = ""
+		return m, nil
+
+	case ProgressMsg, ProgressCompleteMsg, ProgressConfirmedMsg, ProgressErrorMsg, ProgressRenamedMsg, ProgressRetryMsg, progress.FrameMsg:
+		if m.progress == nil {
+			return m, nil
+		}
+		newModel, cmd := m.progress.Update(msg)
+		pm := newModel.(ProgressModel)
+		m.progress = &pm
+		// The embedded progress model quits on completion; the dashboard
+		// lifetime is controlled by its owner instead.
+		if _, isFrame := msg.(progress.FrameMsg); isFrame {
+			return m, cmd
+		}
+		return m, nil
+	}
+
+	return m, nil
+}
+
+func (m DashboardModel) View() string {
+	var b strings.Builder
+
+	b.WriteString(m.room.View())
+	b.WriteString("\n\n")
+
+	// The code is only useful until a receiver has joined
+	if m.showQR && m.progress == nil {
+		b.WriteString(qrView(m.room.RoomLink))
+		b.WriteString("\n")
+	}
+
+	b.WriteString(fmt.Sprintf("%s Peer: %s\n", IconPeer, BoldStyle.Render(m.peer)))
+
+	if m.status != "" {
+		b.WriteString(fmt.Sprintf("%s %s\n", m.spinner.View(), m.status))
+	}
+
+	if m.progress != nil {
+		b.WriteString("\n")
+		b.WriteString(m.progress.View())
+	}
+
+	if len(m.logs) > 0 {
+		b.WriteString("\n")
+		start := max(0, len(m.logs)-maxDashboardLogLines)
+		for _, line := range m.logs[start:] {
+			b.WriteString(MutedStyle.Render(line))
+			b.WriteString("\n")
+		}
+	}
+
+	b.WriteString(FooterStyle.Render("ctrl+c to quit"))
+	return b.String()
+}
+
+// Dashboard runs a full-screen DashboardModel for the lifetime of a send
+type Dashboard struct {
+	program *tea.Program
+	done    chan struct{}
+	logs    []string
+	mu      sync.Mutex
+}
+
+// StartDashboard launches the dashboard on the alternate screen and routes
+// spinner and Printf output into it until Stop is called.
+func StartDashboard(roomID, shortCode, roomLink string) *Dashboard {
+	d := &Dashboard{done: make(chan struct{})}
+	d.program = tea.NewProgram(NewDashboardModel(roomID, shortCode, roomLink), tea.WithAltScreen())
+	setActiveDashboard(d)
+
+	go func() {
+		defer close(d.done)
+		model, err := d.program.Run()
+		setActiveDashboard(nil)
+
+		dm, _ := model.(DashboardModel)
+		if dm.interrupted || errors.Is(err, tea.ErrInterrupted) {
+			d.flushLogs()
+			os.Exit(0)
+		}
+	}()
+
+	return d
+}
+
+// Program returns the underlying Bubble Tea program
+func (d *Dashboard) Program() *tea.Program {
+	return d.program
+}
+
+// SetPeer updates the peer status line
+func (d *Dashboard) SetPeer(status string) {
+	d.program.Send(DashboardPeerMsg(status))
+}
+
+// ShowQR displays a QR code of the room link until the transfer starts
+func (d *Dashboard) ShowQR() {
+	d.program.Send(DashboardQRMsg{})
+}
+
+// SetStatus updates the activity line shown next to the spinner
+func (d *Dashboard) SetStatus(status string) {
+	d.program.Send(DashboardStatusMsg(status))
+}
+
+// Log appends output to the dashboard, one entry per non-empty line
+func (d *Dashboard) Log(text string) {
+	for line := range strings.SplitSeq(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		d.mu.Lock()
+		d.logs = append(d.logs, line)
+		d.mu.Unlock()
+		d.program.Send(DashboardLogMsg(line))
+	}
+}
+
+// Stop leaves the alternate screen and replays the log to stdout
+func (d *Dashboard) Stop() {
+	d.program.Quit()
+	select {
+	case <-d.done:
+	case <-time.After(2 * time.Second):
+		d.program.Kill()
+		<-d.done
+	}
+	d.flushLogs()
+}
+
+func (d *Dashboard) flushLogs() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, line := range d.logs {
+		fmt.Println(line)
+	}
+	d.logs = nil
+}
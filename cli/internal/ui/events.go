@@ -0,0 +1,65 @@
+package ui
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// Event types written in --json mode
+const (
+	EventRoomCreated = "room_created"
+	EventPeerJoined  = "peer_joined"
+	EventProgress    = "progress"
+	EventComplete    = "complete"
+	EventError       = "error"
+	EventDeclined    = "declined"
+)
+
+// Event is one line of --json output. Fields that don't apply to an event
+// type are left out.
+type Event struct {
+	Type       string  `json:"type"`
+	RoomID     string  `json:"room_id,omitempty"`
+	RoomLink   string  `json:"room_link,omitempty"`
+	Code       string  `json:"code,omitempty"`
+	PeerType   string  `json:"peer_type,omitempty"`
+	File       string  `json:"file,omitempty"`
+	Files      int     `json:"files,omitempty"`
+	Bytes      int64   `json:"bytes,omitempty"`
+	Total      int64   `json:"total,omitempty"`
+	Speed      float64 `json:"speed,omitempty"`
+	Duration   float64 `json:"duration,omitempty"`
+	Connection string  `json:"connection,omitempty"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// jsonMode is set by --json. While set, Printf, Println and spinners are
+// silent and Emit writes events to stdout instead.
+var (
+	jsonMode    atomic.Bool
+	jsonEncoder = json.NewEncoder(os.Stdout)
+	jsonMu      sync.Mutex
+)
+
+// SetJSONMode switches output between the terminal UI and JSON events
+func SetJSONMode(on bool) {
+	jsonMode.Store(on)
+}
+
+// JSONMode reports whether output is JSON events
+func JSONMode() bool {
+	return jsonMode.Load()
+}
+
+// Emit writes e as one line of JSON. It does nothing outside JSON mode, so
+// callers don't need to check.
+func Emit(e Event) {
+	if !JSONMode() {
+		return
+	}
+	jsonMu.Lock()
+	defer jsonMu.Unlock()
+	jsonEncoder.Encode(e)
+}
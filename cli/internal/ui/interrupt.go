@@ -0,0 +1,37 @@
+package ui
+
+import "sync"
+
+var (
+	interruptMu      sync.Mutex
+	interruptHandler func()
+)
+
+// OnInterrupt makes the next Ctrl+C call handler instead of exiting, so a
+// running transfer can shut down cleanly. The returned func removes it.
+func OnInterrupt(handler func()) func() {
+	interruptMu.Lock()
+	interruptHandler = handler
+	interruptMu.Unlock()
+
+	return func() {
+		interruptMu.Lock()
+		interruptHandler = nil
+		interruptMu.Unlock()
+	}
+}
+
+// Interrupt runs the registered handler and reports whether there was one.
+// The handler only fires once; a second Ctrl+C falls back to exiting.
+func Interrupt() bool {
+	interruptMu.Lock()
+	handler := interruptHandler
+	interruptHandler = nil
+	interruptMu.Unlock()
+
+	if handler == nil {
+		return false
+	}
+	handler()
+	return true
+}
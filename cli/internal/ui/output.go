@@ -0,0 +1,47 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// output is where Printf, Println, spinners and progress are drawn. It is
+// moved to stderr when stdout carries received data.
+var output io.Writer = os.Stdout
+
+// SetOutput redirects terminal output to w
+func SetOutput(w io.Writer) {
+	output = w
+}
+
+// Output returns the writer terminal output goes to
+func Output() io.Writer {
+	return output
+}
+
+// Printf writes formatted output to Output, or into the dashboard when one
+// is active. It is silent in JSON mode.
+func Printf(format string, args ...any) {
+	if JSONMode() {
+		return
+	}
+	if d := ActiveDashboard(); d != nil {
+		d.Log(fmt.Sprintf(format, args...))
+		return
+	}
+	fmt.Fprintf(output, format, args...)
+}
+
+// Println writes a line to Output, or into the dashboard when one is
+// active. It is silent in JSON mode.
+func Println(args ...any) {
+	if JSONMode() {
+		return
+	}
+	if d := ActiveDashboard(); d != nil {
+		d.Log(fmt.Sprint(args...))
+		return
+	}
+	fmt.Fprintln(output, args...)
+}
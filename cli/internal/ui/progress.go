@@ -2,6 +2,7 @@ package ui
 
 import (
 	"fmt"
+	"math"
 	"strings"
 	"time"
 
@@ -9,6 +10,19 @@ import (
 	"github.com/charmbracelet/bubbles/progress"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+const (
+	// speedWindow is how far back byte samples are kept to measure speed
+	speedWindow = 5 * time.Second
+
+	// minSpeedSpan is how much history is needed before showing a speed
+	minSpeedSpan = time.Second
+
+	// speedSmoothing is the time constant of the moving average applied to
+	// the windowed speed, which keeps the ETA from jumping around
+	speedSmoothing = 2 * time.Second
 )
 
 // ProgressItem represents a single file transfer progress
@@ -17,19 +31,67 @@ type ProgressItem struct {
 	Name       string
 	Total      int64
 	Current    int64
-	StartTime  time.Time
-	Started    bool
 	Speed      float64
+	Confirmed  int64
+	Confirming bool
 	IsComplete bool
 	HasError   bool
 	ErrorMsg   string
+
+	// Attempt counts the retries of a file sent again after its channel
+	// failed, zero for the first try
+	Attempt int
+
+	// samples are recent byte counts, oldest first, with one older than
+	// speedWindow kept as the baseline
+	samples []progressSample
+}
+
+type progressSample struct {
+	at    time.Time
+	bytes int64
+}
+
+// addSample records the byte count at now and updates the smoothed speed
+// from the bytes moved over the sample window
+func (item *ProgressItem) addSample(now time.Time, bytes int64) {
+	var last time.Time
+	if n := len(item.samples); n > 0 {
+		last = item.samples[n-1].at
+	}
+	item.samples = append(item.samples, progressSample{at: now, bytes: bytes})
+
+	drop := 0
+	for drop < len(item.samples)-1 && now.Sub(item.samples[drop+1].at) >= speedWindow {
+		drop++
+	}
+	item.samples = item.samples[drop:]
+
+	first := item.samples[0]
+	span := now.Sub(first.at)
+	if span < minSpeedSpan {
+		return
+	}
+	rate := float64(bytes-first.bytes) / span.Seconds()
+
+	if item.Speed == 0 {
+		item.Speed = rate
+		return
+	}
+	// Weigh the new rate by the time since the last sample so the average
+	// behaves the same however often progress is reported
+	alpha := 1 - math.Exp(-now.Sub(last).Seconds()/speedSmoothing.Seconds())
+	item.Speed += alpha * (rate - item.Speed)
 }
 
 // ProgressModel handles multiple file progress bars
 type ProgressModel struct {
 	items      []*ProgressItem
 	progresses []progress.Model
+	overall    progress.Model
 	width      int
+	paused     bool
+	selected   int
 }
 
 // NewProgressModel creates a new multi-file progress model
@@ -43,22 +105,30 @@ func NewProgressModel(fileNames []string, fileSizes []int64) ProgressModel {
 			Name:  fileNames[i],
 			Total: fileSizes[i],
 		}
-
-		p := progress.New(
-			progress.WithGradient(ProgressStart, ProgressEnd),
-			progress.WithWidth(30),
-			progress.WithoutPercentage(),
-		)
-		progresses[i] = p
+		progresses[i] = newProgressBar()
 	}
 
 	return ProgressModel{
 		items:      items,
 		progresses: progresses,
+		overall:    newProgressBar(),
 		width:      80,
 	}
 }
 
+func newProgressBar() progress.Model {
+	opts := []progress.Option{
+		progress.WithGradient(ProgressStart, ProgressEnd),
+		progress.WithWidth(30),
+		progress.WithoutPercentage(),
+	}
+	// The bar detects colors on its own, without checking NO_COLOR
+	if NoColor() {
+		opts = append(opts, progress.WithColorProfile(termenv.Ascii))
+	}
+	return progress.New(opts...)
+}
+
 func (m ProgressModel) Init() tea.Cmd {
 	return tickCmd()
 }
@@ -76,12 +146,43 @@ type ProgressCompleteMsg struct {
 	ID int
 }
 
+// ProgressConfirmedMsg updates the bytes the receiver has confirmed for a file
+type ProgressConfirmedMsg struct {
+	ID        int
+	Confirmed int64
+}
+
 // ProgressErrorMsg marks a file as errored
 type ProgressErrorMsg struct {
 	ID  int
 	Err error
 }
 
+// ProgressRetryMsg starts a file over from nothing on a retry
+type ProgressRetryMsg struct {
+	ID      int
+	Attempt int
+}
+
+// ProgressRenamedMsg changes the name shown for a file
+type ProgressRenamedMsg struct {
+	ID   int
+	Name string
+}
+
+// setPaused shows whether the transfer is paused
+func (m *ProgressModel) setPaused(paused bool) {
+	m.paused = paused
+	if paused {
+		return
+	}
+	// The pause would drag the speed down, so measure afresh
+	for _, item := range m.items {
+		item.samples = nil
+		item.Speed = 0
+	}
+}
+
 func tickCmd() tea.Cmd {
 	return tea.Tick(100*time.Millisecond, func(t time.Time) tea.Msg {
 		return TickMsg(t)
@@ -107,8 +208,24 @@ func (m ProgressModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, tickCmd()
 
 	case tea.KeyMsg:
-		if msg.Type == tea.KeyCtrlC {
-			return m, tea.Quit
+		switch msg.String() {
+		case "ctrl+c":
+			// The transfer quits the display itself once it has cancelled
+			if !Interrupt() {
+				return m, tea.Quit
+			}
+		case " ":
+			// The transfer can't send the display a message from here,
+			// since Update is what reads them
+			if paused, ok := TogglePause(); ok {
+				m.setPaused(paused)
+			}
+		case "up", "k":
+			m.selected = max(m.selected-1, 0)
+		case "down", "j":
+			m.selected = min(m.selected+1, len(m.items)-1)
+		case "x":
+			CancelFile(m.selected)
 		}
 		return m, nil
 
@@ -117,6 +234,7 @@ func (m ProgressModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		for i := range m.progresses {
 			m.progresses[i].Width = min(30, msg.Width-50)
 		}
+		m.overall.Width = min(30, msg.Width-50)
 		return m, nil
 
 	case progress.FrameMsg:
@@ -132,16 +250,7 @@ func (m ProgressModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case ProgressMsg:
 		if msg.ID >= 0 && msg.ID < len(m.items) {
 			item := m.items[msg.ID]
-			if !item.Started && msg.Current > 0 {
-				item.Started = true
-				item.StartTime = time.Now()
-			}
-			if item.Started {
-				elapsed := time.Since(item.StartTime).Seconds()
-				if elapsed > 0 {
-					item.Speed = float64(msg.Current) / elapsed
-				}
-			}
+			item.addSample(time.Now(), msg.Current)
 			item.Current = msg.Current
 			if item.Current >= item.Total {
 				item.IsComplete = true
@@ -159,6 +268,32 @@ func (m ProgressModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		return m, nil
 
+	case ProgressConfirmedMsg:
+		if msg.ID >= 0 && msg.ID < len(m.items) {
+			m.items[msg.ID].Confirming = true
+			m.items[msg.ID].Confirmed = msg.Confirmed
+		}
+		return m, nil
+
+	case ProgressRenamedMsg:
+		if msg.ID >= 0 && msg.ID < len(m.items) {
+			m.items[msg.ID].Name = msg.Name
+		}
+		return m, nil
+
+	case ProgressRetryMsg:
+		if msg.ID >= 0 && msg.ID < len(m.items) {
+			item := m.items[msg.ID]
+			item.Attempt = msg.Attempt
+			item.Current = 0
+			item.IsComplete = false
+			item.HasError = false
+			item.ErrorMsg = ""
+			item.samples = nil
+			item.Speed = 0
+		}
+		return m, nil
+
 	case ProgressErrorMsg:
 		if msg.ID >= 0 && msg.ID < len(m.items) {
 			m.items[msg.ID].HasError = true
@@ -175,8 +310,24 @@ func (m ProgressModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 func (m ProgressModel) View() string {
 	var b strings.Builder
+	controls := currentControls()
+
+	// A total only adds something when there is more than one file
+	if len(m.items) > 1 {
+		b.WriteString(m.totalView())
+		b.WriteString("\n\n")
+	}
 
 	for i, item := range m.items {
+		// Mark the file x would cancel
+		if controls.CancelFile != nil {
+			if i == m.selected {
+				b.WriteString("› ")
+			} else {
+				b.WriteString("  ")
+			}
+		}
+
 		var icon string
 		var nameStyle lipgloss.Style
 
@@ -191,8 +342,11 @@ func (m ProgressModel) View() string {
 			nameStyle = lipgloss.NewStyle()
 		}
 
-		name := utils.TruncateString(item.Name, 30)
+		name := utils.TruncateString(utils.SanitizeDisplayName(item.Name), 30)
 		b.WriteString(fmt.Sprintf("%s %s ", icon, nameStyle.Render(name)))
+		if item.Attempt > 0 {
+			b.WriteString(WarningStyle.Render(fmt.Sprintf("retry %d ", item.Attempt)))
+		}
 
 		if item.Total > 0 {
 			percent := float64(item.Current) / float64(item.Total)
@@ -204,13 +358,8 @@ func (m ProgressModel) View() string {
 			b.WriteString(fmt.Sprintf(" %5.1f%%", percent))
 		}
 
-		if !item.IsComplete && !item.HasError && item.Speed > 0 {
-			b.WriteString(MutedStyle.Render(fmt.Sprintf(" %s", utils.FormatSpeed(item.Speed))))
-			remaining := item.Total - item.Current
-			if remaining > 0 && item.Speed > 0 {
-				etaSeconds := float64(remaining) / item.Speed
-				b.WriteString(MutedStyle.Render(fmt.Sprintf(" ETA: %s", utils.FormatTimeDuration(time.Duration(etaSeconds*float64(time.Second))))))
-			}
+		if !item.IsComplete && !item.HasError && len(item.samples) > 0 {
+			b.WriteString(MutedStyle.Render(item.speedView()))
 		}
 
 		b.WriteString(MutedStyle.Render(fmt.Sprintf(" (%s/%s)",
@@ -218,8 +367,64 @@ func (m ProgressModel) View() string {
 			utils.FormatSize(item.Total))))
 
 		b.WriteString("\n")
+
+		if item.Confirming && item.Total > 0 {
+			percent := float64(item.Confirmed) / float64(item.Total) * 100
+			b.WriteString(MutedStyle.Render(fmt.Sprintf("   ↳ confirmed %5.1f%% (%s/%s)",
+				percent,
+				utils.FormatSize(item.Confirmed),
+				utils.FormatSize(item.Total))))
+			b.WriteString("\n")
+		}
+	}
+
+	if m.paused {
+		b.WriteString(WarningStyle.Render("⏸  Paused"))
+		b.WriteString("\n")
+	}
+
+	if controls.TogglePause != nil {
+		help := "space pause/resume"
+		if controls.CancelFile != nil {
+			help += " • ↑/↓ select • x cancel file"
+		}
+		b.WriteString(MutedStyle.Render(help))
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// speedView renders the speed and ETA of a file in progress, or a
+// placeholder until enough samples have come in to estimate them
+func (item *ProgressItem) speedView() string {
+	if item.Speed <= 0 {
+		return " ETA: calculating..."
 	}
+	view := " " + utils.FormatSpeed(item.Speed)
+	if remaining := item.Total - item.Current; remaining > 0 {
+		eta := time.Duration(float64(remaining) / item.Speed * float64(time.Second))
+		view += " ETA: " + utils.FormatTimeDuration(eta)
+	}
+	return view
+}
 
+// totalView renders the combined progress of every file
+func (m ProgressModel) totalView() string {
+	percent, current, total, speed := m.GetTotalProgress()
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("%s %s ", IconTransfer, BoldStyle.Render("Total")))
+	if total > 0 {
+		b.WriteString(m.overall.ViewAs(percent / 100))
+		b.WriteString(fmt.Sprintf(" %5.1f%%", percent))
+	}
+	if speed > 0 {
+		b.WriteString(MutedStyle.Render(fmt.Sprintf(" %s", utils.FormatSpeed(speed))))
+	}
+	b.WriteString(MutedStyle.Render(fmt.Sprintf(" (%s/%s)",
+		utils.FormatSize(current),
+		utils.FormatSize(total))))
 	return b.String()
 }
 
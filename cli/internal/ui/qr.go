@@ -0,0 +1,83 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// qrQuietZone is the blank margin scanners need around the code, in modules
+const qrQuietZone = 2
+
+// qrStyle pins dark modules to black on white so the code scans on both
+// light and dark terminal themes
+var qrStyle = lipgloss.NewStyle().
+	Foreground(lipgloss.Color("#000000")).
+	Background(lipgloss.Color("#FFFFFF"))
+
+// RoomQR renders link as a QR code using half-block characters, two module
+// rows per line. It returns false if the code is wider than the terminal.
+func RoomQR(link string) (string, bool) {
+	code, err := qrcode.New(link, qrcode.Medium)
+	if err != nil {
+		return "", false
+	}
+	code.DisableBorder = true
+	modules := code.Bitmap()
+
+	size := len(modules) + 2*qrQuietZone
+	if size > terminalWidth() {
+		return "", false
+	}
+
+	dark := func(x, y int) bool {
+		x, y = x-qrQuietZone, y-qrQuietZone
+		if y < 0 || y >= len(modules) || x < 0 || x >= len(modules) {
+			return false
+		}
+		return modules[y][x]
+	}
+
+	var b strings.Builder
+	for y := 0; y < size; y += 2 {
+		var line strings.Builder
+		for x := range size {
+			top, bottom := dark(x, y), dark(x, y+1)
+			switch {
+			case top && bottom:
+				line.WriteRune('█')
+			case top:
+				line.WriteRune('▀')
+			case bottom:
+				line.WriteRune('▄')
+			default:
+				line.WriteRune(' ')
+			}
+		}
+		b.WriteString(qrStyle.Render(line.String()))
+		b.WriteString("\n")
+	}
+	return b.String(), true
+}
+
+// RenderRoomQR prints a scannable QR code of the room link, or only the
+// link when the terminal is too narrow to fit the code
+func RenderRoomQR(link string) {
+	qr, ok := RoomQR(link)
+	if !ok {
+		Printf("%s Terminal too narrow for a QR code, open %s instead\n", IconQR, link)
+		return
+	}
+	Printf("\n%s Scan to open on your phone:\n\n%s", IconQR, qr)
+}
+
+// qrView renders the QR section shown inside the dashboard
+func qrView(link string) string {
+	qr, ok := RoomQR(link)
+	if !ok {
+		return fmt.Sprintf("%s %s\n", IconQR, MutedStyle.Render("terminal too narrow for QR code"))
+	}
+	return fmt.Sprintf("%s Scan to open on your phone:\n%s", IconQR, qr)
+}
@@ -0,0 +1,114 @@
+package ui
+
+import "sync"
+
+// Reporter is what one transfer reports to. A nil Reporter is the terminal:
+// it draws, or writes JSON events in --json mode. One from NewReporter
+// draws nothing and passes events to a callback instead, so transfers
+// embedded in another program share no output state with each other.
+type Reporter struct {
+	mu      sync.Mutex
+	onEvent func(Event)
+}
+
+// NewReporter returns a Reporter that passes events to onEvent, which may
+// be nil to drop them
+func NewReporter(onEvent func(Event)) *Reporter {
+	if onEvent == nil {
+		onEvent = func(Event) {}
+	}
+	return &Reporter{onEvent: onEvent}
+}
+
+// Embedded reports whether events go to a callback, in which case nobody
+// is at the terminal to answer prompts
+func (r *Reporter) Embedded() bool {
+	return r != nil
+}
+
+// Silent reports whether nothing is drawn, because the transfer is
+// embedded or in JSON mode
+func (r *Reporter) Silent() bool {
+	return r.Embedded() || JSONMode()
+}
+
+// Emit passes e to the callback, one event at a time, or writes it as
+// Emit does
+func (r *Reporter) Emit(e Event) {
+	if !r.Embedded() {
+		Emit(e)
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onEvent(e)
+}
+
+// Printf is Printf on the terminal and does nothing when embedded
+func (r *Reporter) Printf(format string, args ...any) {
+	if !r.Embedded() {
+		Printf(format, args...)
+	}
+}
+
+// Println is Println on the terminal and does nothing when embedded
+func (r *Reporter) Println(args ...any) {
+	if !r.Embedded() {
+		Println(args...)
+	}
+}
+
+func (r *Reporter) PrintWarning(msg string) {
+	if !r.Embedded() {
+		PrintWarning(msg)
+	}
+}
+
+func (r *Reporter) PrintWarningf(format string, args ...any) {
+	if !r.Embedded() {
+		PrintWarningf(format, args...)
+	}
+}
+
+func (r *Reporter) RenderFileTable(items []FileTableItem) {
+	if !r.Embedded() {
+		RenderFileTable(items)
+	}
+}
+
+func (r *Reporter) RenderReceivedFiles(items []ReceivedFileItem) {
+	if !r.Embedded() {
+		RenderReceivedFiles(items)
+	}
+}
+
+func (r *Reporter) RenderTransferSummary(summary TransferSummary) {
+	if !r.Embedded() {
+		RenderTransferSummary(summary)
+	}
+}
+
+// NewConnectionSpinner is NewConnectionSpinner on the terminal. When
+// embedded the spinner draws nothing.
+func (r *Reporter) NewConnectionSpinner(message string) *SimpleSpinner {
+	sp := NewConnectionSpinner(message)
+	sp.silent = r.Embedded()
+	return sp
+}
+
+// RunSpinner is RunSpinner on the terminal. When embedded nothing is drawn.
+func (r *Reporter) RunSpinner(message string) func() {
+	sp := NewSimpleSpinner(message)
+	sp.silent = r.Embedded()
+	sp.Start()
+	return sp.Stop
+}
+
+// SetTransferControls is SetTransferControls on the terminal. Embedded
+// transfers have no progress display to drive them.
+func (r *Reporter) SetTransferControls(c *TransferControls) func() {
+	if r.Embedded() {
+		return func() {}
+	}
+	return SetTransferControls(c)
+}
@@ -0,0 +1,59 @@
+package ui
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestReportersKeepTheirOwnEvents(t *testing.T) {
+	var mu sync.Mutex
+	got := map[string][]string{}
+	newReporter := func(name string) *Reporter {
+		return NewReporter(func(e Event) {
+			// Calling back into the package must not deadlock
+			Emit(e)
+			Printf("")
+			mu.Lock()
+			got[name] = append(got[name], e.RoomID)
+			mu.Unlock()
+		})
+	}
+	a, b := newReporter("a"), newReporter("b")
+
+	var wg sync.WaitGroup
+	for _, r := range []struct {
+		reporter *Reporter
+		room     string
+	}{{a, "a"}, {b, "b"}} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				r.reporter.Emit(Event{Type: EventProgress, RoomID: r.room})
+			}
+		}()
+	}
+	wg.Wait()
+
+	for name, rooms := range got {
+		if len(rooms) != 100 {
+			t.Errorf("reporter %s got %d events, want 100", name, len(rooms))
+		}
+		for _, room := range rooms {
+			if room != name {
+				t.Errorf("reporter %s got an event for %s", name, room)
+				break
+			}
+		}
+	}
+	if JSONMode() {
+		t.Error("an embedded reporter switched on JSON mode")
+	}
+	if !a.Silent() || !a.Embedded() {
+		t.Error("embedded reporter would draw")
+	}
+	var terminal *Reporter
+	if terminal.Embedded() {
+		t.Error("nil reporter is embedded")
+	}
+}
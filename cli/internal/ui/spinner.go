@@ -2,6 +2,7 @@ package ui
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/charmbracelet/bubbles/spinner"
@@ -9,11 +10,18 @@ import (
 
 // SimpleSpinner provides a simple blocking spinner for CLI operations
 type SimpleSpinner struct {
-	message  string
 	spinner  spinner.Spinner
 	interval time.Duration
 	done     chan struct{}
-	stopped  bool
+
+	// mu guards message and stopped, which UpdateMessage and Stop change
+	// while the spinner goroutine draws
+	mu      sync.Mutex
+	message string
+	stopped bool
+
+	// silent spinners draw nothing, for transfers embedded elsewhere
+	silent bool
 }
 
 // NewSimpleSpinner creates a spinner for general loading operations (Dot style)
@@ -47,43 +55,81 @@ func NewWaitingSpinner(message string) *SimpleSpinner {
 }
 
 func (s *SimpleSpinner) Start() {
+	if s.silent || JSONMode() {
+		return
+	}
+	if d := ActiveDashboard(); d != nil {
+		s.mu.Lock()
+		message := s.message
+		s.mu.Unlock()
+		d.SetStatus(message)
+		return
+	}
+
 	go func() {
 		frames := s.spinner.Frames
-		i := 0
-		for {
+		for i := 0; ; i++ {
+			s.mu.Lock()
+			if s.stopped {
+				s.mu.Unlock()
+				return
+			}
+			frame := SpinnerStyle.Render(frames[i%len(frames)])
+			// Clear the rest of the line in case the message got shorter
+			fmt.Fprintf(output, "\r%s %s\033[K", frame, s.message)
+			s.mu.Unlock()
+
 			select {
 			case <-s.done:
 				return
-			default:
-				frame := SpinnerStyle.Render(frames[i%len(frames)])
-				fmt.Printf("\r%s %s", frame, s.message)
-				i++
-				time.Sleep(s.interval)
+			case <-time.After(s.interval):
 			}
 		}
 	}()
 }
 
 func (s *SimpleSpinner) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if !s.stopped {
 		s.stopped = true
 		close(s.done)
-		fmt.Print("\r\033[K") // Clear the line
+		if s.silent || JSONMode() {
+			return
+		}
+		if d := ActiveDashboard(); d != nil {
+			d.SetStatus("")
+			return
+		}
+		fmt.Fprint(output, "\r\033[K") // Clear the line
 	}
 }
 
 func (s *SimpleSpinner) Success(message string) {
 	s.Stop()
-	fmt.Printf("%s %s\n", SuccessStyle.Render(IconSuccess), message)
+	if s.silent {
+		return
+	}
+	Printf("%s %s\n", SuccessStyle.Render(IconSuccess), message)
 }
 
 func (s *SimpleSpinner) Error(message string) {
 	s.Stop()
-	fmt.Printf("%s %s\n", ErrorStyle.Render(IconError), message)
+	if s.silent {
+		return
+	}
+	Printf("%s %s\n", ErrorStyle.Render(IconError), message)
 }
 
 func (s *SimpleSpinner) UpdateMessage(message string) {
+	s.mu.Lock()
 	s.message = message
+	stopped := s.stopped
+	s.mu.Unlock()
+
+	if d := ActiveDashboard(); d != nil && !stopped && !s.silent {
+		d.SetStatus(message)
+	}
 }
 
 // RunSpinner starts a loading spinner and returns a stop function
@@ -0,0 +1,25 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSpinnerUpdateMessageWhileDrawing(t *testing.T) {
+	SetOutput(io.Discard)
+	defer SetOutput(os.Stdout)
+
+	sp := NewConnectionSpinner("Connecting")
+	sp.interval = time.Millisecond
+	sp.Start()
+	for i := range 100 {
+		sp.UpdateMessage(fmt.Sprintf("Retrying (attempt %d)", i))
+		time.Sleep(100 * time.Microsecond)
+	}
+	sp.Stop()
+	sp.UpdateMessage("after stop")
+	sp.Stop()
+}
@@ -2,144 +2,286 @@ package ui
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
 )
 
-// Color palette
-var (
-	// Primary colors - using WarpDrop accent color
-	Primary    = lipgloss.Color("#22d3ee") // WarpDrop Cyan accent
-	Secondary  = lipgloss.Color("#7C3AED") // Violet
-	Success    = lipgloss.Color("#10B981") // Emerald
-	Warning    = lipgloss.Color("#F59E0B") // Amber
-	Error      = lipgloss.Color("#EF4444") // Red
-	Muted      = lipgloss.Color("#6B7280") // Gray
-	Foreground = lipgloss.Color("#F9FAFB") // Light gray
-	Background = lipgloss.Color("#111827") // Dark gray
+// Theme is a color palette. Every style below is built from the active one.
+type Theme struct {
+	Primary    lipgloss.Color
+	Secondary  lipgloss.Color
+	Success    lipgloss.Color
+	Warning    lipgloss.Color
+	Error      lipgloss.Color
+	Muted      lipgloss.Color
+	Foreground lipgloss.Color
+	Background lipgloss.Color
+
+	// Header is the background of header bars and RowAlt the text of every
+	// other table row
+	Header lipgloss.Color
+	RowAlt lipgloss.Color
 
 	// Gradient-like colors for progress
-	ProgressStart = "#22d3ee" // WarpDrop Cyan
-	ProgressEnd   = "#0ea5e9" // Sky Blue
+	ProgressStart string
+	ProgressEnd   string
+}
+
+// Built-in themes
+var (
+	// DarkTheme suits terminals with a dark background and is the default
+	DarkTheme = Theme{
+		Primary:       lipgloss.Color("#22d3ee"), // WarpDrop Cyan accent
+		Secondary:     lipgloss.Color("#7C3AED"), // Violet
+		Success:       lipgloss.Color("#10B981"), // Emerald
+		Warning:       lipgloss.Color("#F59E0B"), // Amber
+		Error:         lipgloss.Color("#EF4444"), // Red
+		Muted:         lipgloss.Color("#6B7280"), // Gray
+		Foreground:    lipgloss.Color("#F9FAFB"), // Light gray
+		Background:    lipgloss.Color("#111827"), // Dark gray
+		Header:        lipgloss.Color("#1F2937"),
+		RowAlt:        lipgloss.Color("245"),
+		ProgressStart: "#22d3ee", // WarpDrop Cyan
+		ProgressEnd:   "#0ea5e9", // Sky Blue
+	}
+
+	// LightTheme uses darker shades that stay readable on a light background
+	LightTheme = Theme{
+		Primary:       lipgloss.Color("#0E7490"), // Dark cyan
+		Secondary:     lipgloss.Color("#6D28D9"), // Deep violet
+		Success:       lipgloss.Color("#047857"), // Dark emerald
+		Warning:       lipgloss.Color("#B45309"), // Dark amber
+		Error:         lipgloss.Color("#B91C1C"), // Dark red
+		Muted:         lipgloss.Color("#4B5563"), // Slate
+		Foreground:    lipgloss.Color("#111827"), // Near black
+		Background:    lipgloss.Color("#F9FAFB"), // Off white
+		Header:        lipgloss.Color("#E5E7EB"),
+		RowAlt:        lipgloss.Color("238"),
+		ProgressStart: "#0E7490",
+		ProgressEnd:   "#1D4ED8",
+	}
+)
+
+// Themes maps the names accepted by --theme to their palettes
+var Themes = map[string]Theme{
+	"dark":  DarkTheme,
+	"light": LightTheme,
+}
+
+// ThemeNames lists the accepted values of --theme
+var ThemeNames = []string{"dark", "light"}
+
+// SetTheme rebuilds every style from the named theme
+func SetTheme(name string) error {
+	theme, ok := Themes[name]
+	if !ok {
+		return fmt.Errorf("unknown theme %q: use %s", name, strings.Join(ThemeNames, " or "))
+	}
+	applyTheme(theme)
+	return nil
+}
+
+// noColor is set by --no-color or the NO_COLOR environment variable
+var noColor = termenv.EnvNoColor()
+
+// SetNoColor turns off colors, leaving bold and borders, when on. Colors
+// already off through NO_COLOR stay off.
+func SetNoColor(on bool) {
+	if !on {
+		return
+	}
+	noColor = true
+	lipgloss.SetColorProfile(termenv.Ascii)
+}
+
+// NoColor reports whether colors are off
+func NoColor() bool {
+	return noColor
+}
+
+func init() {
+	applyTheme(DarkTheme)
+}
+
+// Color palette of the active theme
+var (
+	Primary    lipgloss.Color
+	Secondary  lipgloss.Color
+	Success    lipgloss.Color
+	Warning    lipgloss.Color
+	Error      lipgloss.Color
+	Muted      lipgloss.Color
+	Foreground lipgloss.Color
+	Background lipgloss.Color
+
+	ProgressStart string
+	ProgressEnd   string
 )
 
 // Text styles
 var (
+	TitleStyle    lipgloss.Style
+	SubtitleStyle lipgloss.Style
+	SuccessStyle  lipgloss.Style
+	ErrorStyle    lipgloss.Style
+	WarningStyle  lipgloss.Style
+	MutedStyle    lipgloss.Style
+	BoldStyle     lipgloss.Style
+	StatusStyle   lipgloss.Style
+)
+
+// Box styles
+var (
+	BoxStyle        lipgloss.Style
+	InfoBoxStyle    lipgloss.Style
+	SuccessBoxStyle lipgloss.Style
+	ErrorBoxStyle   lipgloss.Style
+)
+
+// Table styles
+var (
+	TableHeaderStyle lipgloss.Style
+	TableRowStyle    lipgloss.Style
+	TableRowAltStyle lipgloss.Style
+)
+
+// Progress bar styles
+var (
+	ProgressBarStyle       lipgloss.Style
+	ProgressBarFilledStyle lipgloss.Style
+	ProgressBarEmptyStyle  lipgloss.Style
+	ProgressLabelStyle     lipgloss.Style
+	ProgressPercentStyle   lipgloss.Style
+	ProgressSpeedStyle     lipgloss.Style
+)
+
+// Layout styles
+var (
+	ContainerStyle lipgloss.Style
+	HeaderStyle    lipgloss.Style
+	FooterStyle    lipgloss.Style
+)
+
+// Spinner style
+var SpinnerStyle lipgloss.Style
+
+// applyTheme makes t the active palette and rebuilds the styles from it
+func applyTheme(t Theme) {
+	Primary = t.Primary
+	Secondary = t.Secondary
+	Success = t.Success
+	Warning = t.Warning
+	Error = t.Error
+	Muted = t.Muted
+	Foreground = t.Foreground
+	Background = t.Background
+	ProgressStart = t.ProgressStart
+	ProgressEnd = t.ProgressEnd
+
 	TitleStyle = lipgloss.NewStyle().
-			Bold(true).
-			Foreground(Primary).
-			MarginBottom(1)
+		Bold(true).
+		Foreground(Primary).
+		MarginBottom(1)
 
 	SubtitleStyle = lipgloss.NewStyle().
-			Foreground(Secondary).
-			Italic(true)
+		Foreground(Secondary).
+		Italic(true)
 
 	SuccessStyle = lipgloss.NewStyle().
-			Foreground(Success).
-			Bold(true)
+		Foreground(Success).
+		Bold(true)
 
 	ErrorStyle = lipgloss.NewStyle().
-			Foreground(Error).
-			Bold(true)
+		Foreground(Error).
+		Bold(true)
 
 	WarningStyle = lipgloss.NewStyle().
-			Foreground(Warning)
+		Foreground(Warning)
 
 	MutedStyle = lipgloss.NewStyle().
-			Foreground(Muted)
+		Foreground(Muted)
 
 	BoldStyle = lipgloss.NewStyle().
-			Bold(true)
+		Bold(true)
 
 	StatusStyle = lipgloss.NewStyle().
-			Foreground(Foreground).
-			Background(Primary).
-			Padding(0, 1).
-			Bold(true)
-)
+		Foreground(Foreground).
+		Background(Primary).
+		Padding(0, 1).
+		Bold(true)
 
-// Box styles
-var (
 	BoxStyle = lipgloss.NewStyle().
-			Border(lipgloss.RoundedBorder()).
-			BorderForeground(Primary).
-			Padding(1, 2)
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(Primary).
+		Padding(1, 2)
 
 	InfoBoxStyle = lipgloss.NewStyle().
-			Border(lipgloss.RoundedBorder()).
-			BorderForeground(Secondary).
-			Padding(1, 2)
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(Secondary).
+		Padding(1, 2)
 
 	SuccessBoxStyle = lipgloss.NewStyle().
-			Border(lipgloss.DoubleBorder()).
-			BorderForeground(Success).
-			Padding(1, 2)
+		Border(lipgloss.DoubleBorder()).
+		BorderForeground(Success).
+		Padding(1, 2)
 
 	ErrorBoxStyle = lipgloss.NewStyle().
-			Border(lipgloss.ThickBorder()).
-			BorderForeground(Error).
-			Padding(1, 2)
-)
+		Border(lipgloss.ThickBorder()).
+		BorderForeground(Error).
+		Padding(1, 2)
 
-// Table styles
-var (
 	TableHeaderStyle = lipgloss.NewStyle().
-				Bold(true).
-				Foreground(Primary).
-				Align(lipgloss.Center)
+		Bold(true).
+		Foreground(Primary).
+		Align(lipgloss.Center)
 
-	tableCellStyle = lipgloss.NewStyle().Padding(0, 1)
+	tableCellStyle := lipgloss.NewStyle().Padding(0, 1)
 
 	TableRowStyle = tableCellStyle.Foreground(Foreground)
 
-	TableRowAltStyle = tableCellStyle.Foreground(lipgloss.Color("245"))
-)
+	TableRowAltStyle = tableCellStyle.Foreground(t.RowAlt)
 
-// Progress bar styles
-var (
 	ProgressBarStyle = lipgloss.NewStyle().
-				Foreground(Primary)
+		Foreground(Primary)
 
 	ProgressBarFilledStyle = lipgloss.NewStyle().
-				Foreground(Success)
+		Foreground(Success)
 
 	ProgressBarEmptyStyle = lipgloss.NewStyle().
-				Foreground(Muted)
+		Foreground(Muted)
 
 	ProgressLabelStyle = lipgloss.NewStyle().
-				Foreground(Foreground).
-				Width(40)
+		Foreground(Foreground).
+		Width(40)
 
 	ProgressPercentStyle = lipgloss.NewStyle().
-				Foreground(Secondary).
-				Width(8).
-				Align(lipgloss.Right)
+		Foreground(Secondary).
+		Width(8).
+		Align(lipgloss.Right)
 
 	ProgressSpeedStyle = lipgloss.NewStyle().
-				Foreground(Muted).
-				Width(15).
-				Align(lipgloss.Right)
-)
+		Foreground(Muted).
+		Width(15).
+		Align(lipgloss.Right)
 
-// Layout styles
-var (
 	ContainerStyle = lipgloss.NewStyle().
-			Margin(1, 2)
+		Margin(1, 2)
 
 	HeaderStyle = lipgloss.NewStyle().
-			Bold(true).
-			Foreground(Primary).
-			Background(lipgloss.Color("#1F2937")).
-			Padding(0, 2).
-			MarginBottom(1)
+		Bold(true).
+		Foreground(Primary).
+		Background(t.Header).
+		Padding(0, 2).
+		MarginBottom(1)
 
 	FooterStyle = lipgloss.NewStyle().
-			Foreground(Muted).
-			MarginTop(1)
-)
+		Foreground(Muted).
+		MarginTop(1)
 
-// Spinner style
-var SpinnerStyle = lipgloss.NewStyle().Foreground(Primary)
+	SpinnerStyle = lipgloss.NewStyle().Foreground(Primary)
+}
 
 // Helper function to create styled text
 func Styled(text string, style lipgloss.Style) string {
@@ -172,7 +314,7 @@ const (
 )
 
 func PrintError(msg string) {
-	fmt.Printf("%s %s\n", ErrorStyle.Render(IconError), ErrorStyle.Render(msg))
+	Printf("%s %s\n", ErrorStyle.Render(IconError), ErrorStyle.Render(msg))
 }
 
 func PrintErrorf(format string, args ...any) {
@@ -180,7 +322,7 @@ func PrintErrorf(format string, args ...any) {
 }
 
 func PrintWarning(msg string) {
-	fmt.Printf("%s %s\n", WarningStyle.Render(IconWarning), WarningStyle.Render(msg))
+	Printf("%s %s\n", WarningStyle.Render(IconWarning), WarningStyle.Render(msg))
 }
 
 func PrintWarningf(format string, args ...any) {
@@ -188,7 +330,7 @@ func PrintWarningf(format string, args ...any) {
 }
 
 func PrintSuccess(msg string) {
-	fmt.Printf("%s %s\n", SuccessStyle.Render(IconSuccess), msg)
+	Printf("%s %s\n", SuccessStyle.Render(IconSuccess), msg)
 }
 
 func PrintSuccessf(format string, args ...any) {
@@ -196,7 +338,7 @@ func PrintSuccessf(format string, args ...any) {
 }
 
 func PrintInfo(msg string) {
-	fmt.Printf("%s %s\n", IconInfo, msg)
+	Printf("%s %s\n", IconInfo, msg)
 }
 
 func PrintInfof(format string, args ...any) {
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/BioHazard786/Warpdrop/cli/internal/utils"
 	"github.com/charmbracelet/lipgloss"
@@ -87,6 +88,9 @@ type FileTableItem struct {
 	Name  string
 	Size  int64
 	Type  string
+
+	// Skipped marks a file filtered out by type, which won't be received
+	Skipped bool
 }
 
 type FileTable struct {
@@ -118,9 +122,13 @@ func (t *FileTable) View() string {
 
 	rows := make([][]string, 0, len(t.items))
 	for _, item := range t.items {
+		name := utils.SanitizeDisplayName(item.Name)
+		if item.Skipped {
+			name += MutedStyle.Render(" (filtered)")
+		}
 		row := []string{
 			fmt.Sprintf("%d", item.Index),
-			item.Name,
+			name,
 			utils.FormatSize(item.Size),
 		}
 
@@ -143,11 +151,79 @@ func (t *FileTable) View() string {
 }
 
 func (t *FileTable) Render() {
-	fmt.Println(t.View())
+	Println(t.View())
 }
 
 func RenderFileTable(items []FileTableItem) {
-	fmt.Println(NewFileTable(items).View())
+	Println(NewFileTable(items).View())
+}
+
+/* -------------------------------------------------------------------------- */
+/*                             Received Files Table                           */
+/* -------------------------------------------------------------------------- */
+
+// Outcomes of a received file
+const (
+	ReceivedOK      = "ok"
+	ReceivedFailed  = "failed"
+	ReceivedSkipped = "skipped"
+)
+
+type ReceivedFileItem struct {
+	// Location is where the file was written, after any renaming. Files
+	// that weren't written have none.
+	Location string
+	Size     int64
+	Status   string
+}
+
+// ReceivedFilesTable lists where each received file ended up
+type ReceivedFilesTable struct {
+	items []ReceivedFileItem
+}
+
+func NewReceivedFilesTable(items []ReceivedFileItem) *ReceivedFilesTable {
+	return &ReceivedFilesTable{items: items}
+}
+
+func (t *ReceivedFilesTable) View() string {
+	if len(t.items) == 0 {
+		return MutedStyle.Render("No files")
+	}
+
+	headers := []string{"Saved As", "Size", "Status"}
+
+	rows := make([][]string, 0, len(t.items))
+	for _, item := range t.items {
+		location := MutedStyle.Render("-")
+		if item.Location != "" {
+			location = utils.SanitizeDisplayName(item.Location)
+		}
+
+		status := SuccessStyle.Render(item.Status)
+		switch item.Status {
+		case ReceivedFailed:
+			status = ErrorStyle.Render(item.Status)
+		case ReceivedSkipped:
+			status = MutedStyle.Render(item.Status)
+		}
+
+		rows = append(rows, []string{location, utils.FormatSize(item.Size), status})
+	}
+
+	tbl := tableStyle().
+		Headers(headers...).
+		Rows(rows...)
+
+	if w := tableWidth(headers, rows); w > terminalWidth() {
+		tbl = tbl.Width(terminalWidth())
+	}
+
+	return tbl.Render()
+}
+
+func RenderReceivedFiles(items []ReceivedFileItem) {
+	Println(NewReceivedFilesTable(items).View())
 }
 
 /* -------------------------------------------------------------------------- */
@@ -158,17 +234,37 @@ type TransferSummary struct {
 	Status    string
 	Files     int
 	TotalSize string
-	Duration  string
 	Speed     string
+
+	// TotalTime runs from the start of the session, including waiting for
+	// the peer to accept, and TransferTime from the first byte sent
+	TotalTime    string
+	TransferTime string
+
+	// Connection says whether the peers connected directly or via TURN.
+	// The row is left out when it is empty.
+	Connection string
+
+	// RTT is the connection's round trip time. The row is left out when it
+	// is empty.
+	RTT string
+
+	// Retried lists files that were sent again after their channel failed.
+	// The row is left out when it is empty.
+	Retried string
 }
 
 func NewTransferSummary(summary TransferSummary) *TransferSummary {
 	return &TransferSummary{
-		Status:    summary.Status,
-		Files:     summary.Files,
-		TotalSize: summary.TotalSize,
-		Duration:  summary.Duration,
-		Speed:     summary.Speed,
+		Status:       summary.Status,
+		Files:        summary.Files,
+		TotalSize:    summary.TotalSize,
+		Speed:        summary.Speed,
+		TotalTime:    summary.TotalTime,
+		TransferTime: summary.TransferTime,
+		Connection:   summary.Connection,
+		RTT:          summary.RTT,
+		Retried:      summary.Retried,
 	}
 }
 
@@ -179,9 +275,19 @@ func (t *TransferSummary) View() string {
 		{"Status", t.Status},
 		{"Files", fmt.Sprintf("%d", t.Files)},
 		{"Total Size", t.TotalSize},
-		{"Duration", t.Duration},
+		{"Total Time", t.TotalTime},
+		{"Transfer Time", t.TransferTime},
 		{"Avg Speed", t.Speed},
 	}
+	if t.Connection != "" {
+		rows = append(rows, []string{"Connection", t.Connection})
+	}
+	if t.RTT != "" {
+		rows = append(rows, []string{"RTT", t.RTT})
+	}
+	if t.Retried != "" {
+		rows = append(rows, []string{"Retried", t.Retried})
+	}
 
 	tbl := tableStyle().
 		Headers(headers...).
@@ -195,7 +301,7 @@ func (t *TransferSummary) View() string {
 }
 
 func RenderTransferSummary(summary TransferSummary) {
-	fmt.Println(NewTransferSummary(summary).View())
+	Println(NewTransferSummary(summary).View())
 }
 
 /* -------------------------------------------------------------------------- */
@@ -203,19 +309,25 @@ func RenderTransferSummary(summary TransferSummary) {
 /* -------------------------------------------------------------------------- */
 
 type RoomInfo struct {
-	RoomID   string
-	RoomLink string
+	RoomID    string
+	ShortCode string
+	RoomLink  string
 }
 
-func NewRoomInfo(roomID, roomLink string) *RoomInfo {
+func NewRoomInfo(roomID, shortCode, roomLink string) *RoomInfo {
 	return &RoomInfo{
-		RoomID:   roomID,
-		RoomLink: roomLink,
+		RoomID:    roomID,
+		ShortCode: shortCode,
+		RoomLink:  roomLink,
 	}
 }
 
 func (r *RoomInfo) View() string {
-	content := fmt.Sprintf("%s Room Created!\n\n%s Room ID: %s\n%s Room Link: %s", IconSuccess, IconCopy, BoldStyle.Foreground(Primary).Render(r.RoomID), IconWeb, MutedStyle.Render(r.RoomLink))
+	content := fmt.Sprintf("%s Room Created!\n\n%s Room ID: %s", IconSuccess, IconCopy, BoldStyle.Foreground(Primary).Render(r.RoomID))
+	if r.ShortCode != "" {
+		content += fmt.Sprintf("\n%s Code: %s", IconQR, BoldStyle.Foreground(Primary).Render(r.ShortCode))
+	}
+	content += fmt.Sprintf("\n%s Room Link: %s", IconWeb, MutedStyle.Render(r.RoomLink))
 
 	box := SuccessBoxStyle
 
@@ -226,6 +338,71 @@ func (r *RoomInfo) View() string {
 	return box.Render(content)
 }
 
-func RenderRoomInfo(roomID, roomLink string) {
-	fmt.Println(NewRoomInfo(roomID, roomLink).View())
+func RenderRoomInfo(roomID, shortCode, roomLink string) {
+	Println(NewRoomInfo(roomID, shortCode, roomLink).View())
+}
+
+/* -------------------------------------------------------------------------- */
+/*                                History Table                               */
+/* -------------------------------------------------------------------------- */
+
+type HistoryTableItem struct {
+	Time      time.Time
+	Direction string
+	Files     []string
+	Size      int64
+	Duration  time.Duration
+	PeerType  string
+	RoomID    string
+}
+
+type HistoryTable struct {
+	items []HistoryTableItem
+}
+
+func NewHistoryTable(items []HistoryTableItem) *HistoryTable {
+	return &HistoryTable{items: items}
+}
+
+func (t *HistoryTable) View() string {
+	if len(t.items) == 0 {
+		return MutedStyle.Render("No transfers yet")
+	}
+
+	headers := []string{"When", "Direction", "Files", "Size", "Duration", "Peer", "Room"}
+
+	rows := make([][]string, 0, len(t.items))
+	for _, item := range t.items {
+		files := MutedStyle.Render("none")
+		if len(item.Files) > 0 {
+			files = utils.SanitizeDisplayName(item.Files[0])
+			if len(item.Files) > 1 {
+				files += fmt.Sprintf(" +%d more", len(item.Files)-1)
+			}
+		}
+
+		rows = append(rows, []string{
+			item.Time.Local().Format("2006-01-02 15:04"),
+			item.Direction,
+			files,
+			utils.FormatSize(item.Size),
+			utils.FormatTimeDuration(item.Duration),
+			item.PeerType,
+			item.RoomID,
+		})
+	}
+
+	tbl := tableStyle().
+		Headers(headers...).
+		Rows(rows...)
+
+	if w := tableWidth(headers, rows); w > terminalWidth() {
+		tbl = tbl.Width(terminalWidth())
+	}
+
+	return tbl.Render()
+}
+
+func RenderHistoryTable(items []HistoryTableItem) {
+	Println(NewHistoryTable(items).View())
 }
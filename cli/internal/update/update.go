@@ -0,0 +1,139 @@
+package update
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/config"
+)
+
+// InstallerURL serves install.sh and the latest version at /version
+const InstallerURL = "https://install." + config.DefaultDomain
+
+// CheckInterval is how long a version check is reused before the installer
+// is asked again
+const CheckInterval = 24 * time.Hour
+
+// VersionPayload is the installer's /version response
+type VersionPayload struct {
+	Version string `json:"version"`
+}
+
+// cacheEntry is the last version check. Latest is empty when it failed, so
+// an unreachable installer is also only retried after CheckInterval.
+type cacheEntry struct {
+	CheckedAt time.Time `json:"checked_at"`
+	Latest    string    `json:"latest,omitempty"`
+}
+
+// CachePath returns where the last check is kept:
+// $XDG_CACHE_HOME/warpdrop/update.json, falling back to ~/.cache
+func CachePath() (string, error) {
+	dir := os.Getenv("XDG_CACHE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".cache")
+	}
+	return filepath.Join(dir, "warpdrop", "update.json"), nil
+}
+
+// Latest asks the installer for the latest released version
+func Latest(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, InstallerURL+"/version", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("version check failed: %s", resp.Status)
+	}
+
+	var payload VersionPayload
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return "", fmt.Errorf("version check failed: %w", err)
+	}
+	if payload.Version == "" {
+		return "", fmt.Errorf("version check failed: no version returned")
+	}
+	return payload.Version, nil
+}
+
+// CachedLatest returns the latest version, asking the installer only when
+// the cached answer is older than CheckInterval. It returns "" when the
+// version is unknown; the check is best effort and never fails.
+func CachedLatest(ctx context.Context) string {
+	path, err := CachePath()
+	if err != nil {
+		return ""
+	}
+
+	var entry cacheEntry
+	if data, err := os.ReadFile(path); err == nil && json.Unmarshal(data, &entry) == nil &&
+		time.Since(entry.CheckedAt) < CheckInterval {
+		return entry.Latest
+	}
+
+	latest, _ := Latest(ctx)
+	entry = cacheEntry{CheckedAt: time.Now(), Latest: latest}
+	if data, err := json.Marshal(entry); err == nil {
+		if os.MkdirAll(filepath.Dir(path), 0755) == nil {
+			os.WriteFile(path, data, 0644)
+		}
+	}
+	return latest
+}
+
+// Newer reports whether latest is a later release than current. Versions
+// that don't parse, such as dev builds, are never outdated.
+func Newer(latest, current string) bool {
+	l, ok := parseVersion(latest)
+	if !ok {
+		return false
+	}
+	c, ok := parseVersion(current)
+	if !ok {
+		return false
+	}
+	for i := range l {
+		if l[i] != c[i] {
+			return l[i] > c[i]
+		}
+	}
+	return false
+}
+
+// parseVersion reads major.minor.patch with an optional leading v. Any
+// pre-release or build suffix is ignored.
+func parseVersion(v string) ([3]int, bool) {
+	var parts [3]int
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	v, _, _ = strings.Cut(v, "-")
+	v, _, _ = strings.Cut(v, "+")
+
+	fields := strings.Split(v, ".")
+	if len(fields) == 0 || len(fields) > 3 {
+		return parts, false
+	}
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return parts, false
+		}
+		parts[i] = n
+	}
+	return parts, true
+}
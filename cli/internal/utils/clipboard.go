@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+var ErrNoClipboard = errors.New("no clipboard available")
+
+// clipboardTimeout bounds a clipboard tool that hangs, e.g. waiting on a
+// display server that isn't answering
+const clipboardTimeout = 2 * time.Second
+
+// clipboardCommands lists the tools tried, in order, to set the clipboard.
+// On Linux and the BSDs they need a graphical session, so none are tried on
+// a headless machine.
+func clipboardCommands() [][]string {
+	switch runtime.GOOS {
+	case "darwin":
+		return [][]string{{"pbcopy"}}
+	case "windows":
+		return [][]string{{"clip"}}
+	}
+
+	var cmds [][]string
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		cmds = append(cmds, []string{"wl-copy"})
+	}
+	if os.Getenv("DISPLAY") != "" {
+		cmds = append(cmds,
+			[]string{"xclip", "-selection", "clipboard"},
+			[]string{"xsel", "--clipboard", "--input"},
+		)
+	}
+	return cmds
+}
+
+// pasteCommands lists the tools tried, in order, to read the clipboard,
+// under the same conditions as clipboardCommands
+func pasteCommands() [][]string {
+	switch runtime.GOOS {
+	case "darwin":
+		return [][]string{{"pbpaste"}}
+	case "windows":
+		return [][]string{{"powershell", "-NoProfile", "-Command", "Get-Clipboard"}}
+	}
+
+	var cmds [][]string
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		cmds = append(cmds, []string{"wl-paste", "--no-newline"})
+	}
+	if os.Getenv("DISPLAY") != "" {
+		cmds = append(cmds,
+			[]string{"xclip", "-selection", "clipboard", "-out"},
+			[]string{"xsel", "--clipboard", "--output"},
+		)
+	}
+	return cmds
+}
+
+// CopyToClipboard puts text on the system clipboard using the first
+// clipboard tool that works, returning ErrNoClipboard if none does
+func CopyToClipboard(text string) error {
+	for _, args := range clipboardCommands() {
+		path, err := exec.LookPath(args[0])
+		if err != nil {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), clipboardTimeout)
+		cmd := exec.CommandContext(ctx, path, args[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		err = cmd.Run()
+		cancel()
+		if err == nil {
+			return nil
+		}
+	}
+	return ErrNoClipboard
+}
+
+// ReadClipboard returns the text on the system clipboard using the first
+// clipboard tool that works, returning ErrNoClipboard if none does
+func ReadClipboard() (string, error) {
+	for _, args := range pasteCommands() {
+		path, err := exec.LookPath(args[0])
+		if err != nil {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), clipboardTimeout)
+		out, err := exec.CommandContext(ctx, path, args[1:]...).Output()
+		cancel()
+		if err == nil {
+			return string(out), nil
+		}
+	}
+	return "", ErrNoClipboard
+}
@@ -0,0 +1,18 @@
+//go:build !(linux || darwin || freebsd || dragonfly || windows)
+
+package utils
+
+import (
+	"errors"
+	"syscall"
+)
+
+// FreeSpace is not implemented on this platform, so callers skip the check
+func FreeSpace(dir string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
+
+// IsDiskFull reports whether err came from writing to a full filesystem
+func IsDiskFull(err error) bool {
+	return errors.Is(err, syscall.ENOSPC)
+}
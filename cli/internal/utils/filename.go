@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"runtime"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// SanitizeDisplayName makes a peer-supplied filename safe to render.
+// Invalid UTF-8 is replaced, the name is NFC-normalized, and control and
+// format characters (including RTL overrides and zero-width characters,
+// which can be used to spoof extensions) are dropped.
+func SanitizeDisplayName(name string) string {
+	name = strings.ToValidUTF8(name, "\uFFFD")
+	name = norm.NFC.String(name)
+
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || unicode.Is(unicode.Cf, r) {
+			return -1
+		}
+		return r
+	}, name)
+}
+
+// windowsNames makes SanitizeFilename follow Windows naming rules
+var windowsNames = runtime.GOOS == "windows"
+
+// windowsReserved are device names Windows won't create a file as, even
+// with an extension
+var windowsReserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"CONIN$": true, "CONOUT$": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"COM¹": true, "COM²": true, "COM³": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+	"LPT¹": true, "LPT²": true, "LPT³": true,
+}
+
+// SanitizeFilename makes a peer-supplied filename safe to create on disk.
+// On top of SanitizeDisplayName it strips path separators so the name can
+// never escape the output directory. On Windows it also replaces characters
+// the filesystem rejects, drops trailing dots and spaces, and renames
+// reserved device names such as CON.
+func SanitizeFilename(name string) string {
+	name = SanitizeDisplayName(name)
+	name = strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' {
+			return '_'
+		}
+		if windowsNames && strings.ContainsRune(`<>:"|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if windowsNames {
+		name = strings.TrimRight(name, ". ")
+	}
+
+	if name == "" || name == "." || name == ".." {
+		return "file"
+	}
+	if windowsNames && isWindowsReserved(name) {
+		return "_" + name
+	}
+	return name
+}
+
+// isWindowsReserved reports whether name, ignoring case and any extension,
+// is a Windows device name
+func isWindowsReserved(name string) bool {
+	base, _, _ := strings.Cut(name, ".")
+	return windowsReserved[strings.ToUpper(strings.TrimRight(base, " "))]
+}
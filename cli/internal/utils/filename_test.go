@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeDisplayName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"report.pdf", "report.pdf"},
+		// A right-to-left override makes this one display as "invoiceexe.pdf"
+		{"invoice\u202efdp.exe", "invoicefdp.exe"},
+		{"pass\u200bwords.txt", "passwords.txt"},
+		{"bell\a\x1b[31mred.txt", "bell[31mred.txt"},
+		{"new\nline.txt", "newline.txt"},
+		{"bad\xffbyte.txt", "bad\ufffdbyte.txt"},
+		// e followed by a combining acute accent is composed into é
+		{"cafe\u0301.txt", "caf\u00e9.txt"},
+		{"日本語.txt", "日本語.txt"},
+	}
+	for _, tt := range tests {
+		if got := SanitizeDisplayName(tt.name); got != tt.want {
+			t.Errorf("SanitizeDisplayName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"report.pdf", "report.pdf"},
+		{"dir/file.txt", "dir_file.txt"},
+		{`dir\file.txt`, "dir_file.txt"},
+		{"/etc/passwd", "_etc_passwd"},
+		{"", "file"},
+		{".", "file"},
+		{"..", "file"},
+		{"  \u200b ", "file"},
+		{"  padded.txt  ", "padded.txt"},
+		{".hidden", ".hidden"},
+		{"invoice\u202efdp.exe", "invoicefdp.exe"},
+	}
+	for _, tt := range tests {
+		if got := SanitizeFilename(tt.name); got != tt.want {
+			t.Errorf("SanitizeFilename(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSanitizeFilenameHostile(t *testing.T) {
+	defer func() { windowsNames = runtime.GOOS == "windows" }()
+
+	for _, windows := range []bool{false, true} {
+		windowsNames = windows
+		for _, name := range []string{"../../etc/passwd", `..\..\Windows\win.ini`, "evil\x00.txt", "a\x00/../b"} {
+			got := SanitizeFilename(name)
+			if strings.ContainsAny(got, "/\\\x00") || got == ".." || got == "." {
+				t.Errorf("SanitizeFilename(%q) with Windows rules %v = %q", name, windows, got)
+			}
+		}
+		if got := SanitizeFilename("../../etc/passwd"); got != ".._.._etc_passwd" {
+			t.Errorf("SanitizeFilename(../../etc/passwd) with Windows rules %v = %q", windows, got)
+		}
+		if got := SanitizeFilename("evil\x00.txt"); got != "evil.txt" {
+			t.Errorf("SanitizeFilename with a NUL and Windows rules %v = %q, want evil.txt", windows, got)
+		}
+	}
+}
+
+func TestSanitizeFilenameWindows(t *testing.T) {
+	windowsNames = true
+	defer func() { windowsNames = runtime.GOOS == "windows" }()
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"CON", "_CON"},
+		{"con", "_con"},
+		{"CON.txt", "_CON.txt"},
+		{"nul.tar.gz", "_nul.tar.gz"},
+		{"COM1", "_COM1"},
+		{"LPT9.log", "_LPT9.log"},
+		{"CON ", "_CON"},
+		{"CONSOLE.txt", "CONSOLE.txt"},
+		{"COM10", "COM10"},
+		{"report.pdf.", "report.pdf"},
+		{"notes . . ", "notes"},
+		{"...", "file"},
+		{`what?<>:"|*.txt`, "what_______.txt"},
+		{"C:\\evil", "C__evil"},
+	}
+	for _, tt := range tests {
+		if got := SanitizeFilename(tt.name); got != tt.want {
+			t.Errorf("SanitizeFilename(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MinRoomIDWords and MaxRoomIDWords are the room ID lengths a server may
+// be configured to generate. The default is four words.
+const (
+	MinRoomIDWords = 2
+	MaxRoomIDWords = 10
+)
+
+// ShortCodeDigits is the length of the numeric codes a sender can ask for
+// in place of a room ID
+const ShortCodeDigits = 6
+
+// IsShortCode reports whether id is a numeric short code
+func IsShortCode(id string) bool {
+	return len(id) == ShortCodeDigits && strings.Trim(id, "0123456789") == ""
+}
+
+// ValidateRoomID checks that id has the word-word-word-word form servers
+// generate, or is a numeric short code, and returns it trimmed and
+// lowercased. It catches typos before a round trip to the server.
+func ValidateRoomID(id string) (string, error) {
+	id = strings.ToLower(strings.TrimSpace(id))
+	if id == "" {
+		return "", fmt.Errorf("room ID cannot be empty")
+	}
+	if IsShortCode(id) {
+		return id, nil
+	}
+
+	words := strings.Split(id, "-")
+	for i, word := range words {
+		if word == "" {
+			return "", fmt.Errorf("invalid room ID %q: word %d is empty", id, i+1)
+		}
+		if strings.Trim(word, "abcdefghijklmnopqrstuvwxyz") != "" {
+			return "", fmt.Errorf("invalid room ID %q: %q should only contain letters", id, word)
+		}
+	}
+	if len(words) < MinRoomIDWords || len(words) > MaxRoomIDWords {
+		return "", fmt.Errorf("invalid room ID %q: expected %d to %d words separated by dashes, got %d", id, MinRoomIDWords, MaxRoomIDWords, len(words))
+	}
+	return id, nil
+}
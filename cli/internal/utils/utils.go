@@ -2,10 +2,15 @@ package utils
 
 import (
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/mattn/go-runewidth"
 )
 
 // --- Buffer Management Constants ---
@@ -16,10 +21,31 @@ const (
 	HighWaterMark    = 2 * 1024 * 1024 // 2 MB - backpressure threshold
 	LowWaterMark     = 512 * 1024      // 512 KB - resume threshold
 
+	// MaxMessageSize is the largest data channel message every peer takes,
+	// Chrome's SCTP max-message-size. Larger messages fail to send.
+	MaxMessageSize = 256 * 1024
+
+	// ChunkSizeLimit is the largest configurable chunk, which leaves room
+	// in a message for the chunk's framing, encryption and compression
+	ChunkSizeLimit = 240 * 1024
+
 	// Timeout constants
 	SendTimeout   = 60 // seconds - increased for slow connections
 	SignalTimeout = 30 // seconds
 	DrainTimeout  = 30 // seconds - increased for slow connections
+	CloseTimeout  = 5  // seconds - bound on waiting for final acks during Close
+	CancelTimeout = 2  // seconds - bound on waiting for the peer to acknowledge a cancel
+
+	// RangeRetryInterval is how long a single-channel receiver waits for
+	// data before asking again for chunk ranges that never arrived
+	RangeRetryInterval = 2 // seconds
+
+	// ProgressReportInterval throttles receive_progress messages
+	ProgressReportInterval = 500 // milliseconds
+
+	// MaxPipelineDepth bounds how many files a single-channel receiver may
+	// request ahead of the one being sent
+	MaxPipelineDepth = 16
 )
 
 // Speed thresholds for chunk size adjustment (in bytes per second)
@@ -31,9 +57,55 @@ const (
 	// > 1 MB/s = VERY_FAST
 )
 
+// ChunkSizeConfig bounds dynamic chunk sizing and data channel backpressure
+type ChunkSizeConfig struct {
+	MinChunk      int
+	MaxChunk      int
+	DefaultChunk  int
+	HighWaterMark int
+	LowWaterMark  int
+}
+
+// DefaultChunkSizeConfig returns the built-in chunk size bounds
+func DefaultChunkSizeConfig() ChunkSizeConfig {
+	return ChunkSizeConfig{
+		MinChunk:      MinChunkSize,
+		MaxChunk:      MaxChunkSize,
+		DefaultChunk:  DefaultChunkSize,
+		HighWaterMark: HighWaterMark,
+		LowWaterMark:  LowWaterMark,
+	}
+}
+
+// Validate checks that min <= default <= max <= ChunkSizeLimit and that the
+// water marks leave room for at least one full chunk between them
+func (c ChunkSizeConfig) Validate() error {
+	if c.MinChunk <= 0 {
+		return fmt.Errorf("minimum chunk size must be positive")
+	}
+	if c.MaxChunk > ChunkSizeLimit {
+		return fmt.Errorf("max chunk size (%s) must be at most %s, so every chunk fits in a data channel message",
+			FormatSize(int64(c.MaxChunk)), FormatSize(ChunkSizeLimit))
+	}
+	if c.MinChunk > c.DefaultChunk || c.DefaultChunk > c.MaxChunk {
+		return fmt.Errorf("chunk sizes must satisfy min (%s) <= default (%s) <= max (%s)",
+			FormatSize(int64(c.MinChunk)), FormatSize(int64(c.DefaultChunk)), FormatSize(int64(c.MaxChunk)))
+	}
+	if c.LowWaterMark < 0 || c.LowWaterMark >= c.HighWaterMark {
+		return fmt.Errorf("low water mark (%s) must be below high water mark (%s)",
+			FormatSize(int64(c.LowWaterMark)), FormatSize(int64(c.HighWaterMark)))
+	}
+	if c.HighWaterMark < c.MaxChunk {
+		return fmt.Errorf("high water mark (%s) must be at least the max chunk size (%s)",
+			FormatSize(int64(c.HighWaterMark)), FormatSize(int64(c.MaxChunk)))
+	}
+	return nil
+}
+
 // ChunkSizeController manages dynamic chunk sizing based on transfer speed
 type ChunkSizeController struct {
 	mu               sync.Mutex
+	cfg              ChunkSizeConfig
 	currentChunkSize int
 	bytesTransferred int64
 	lastUpdateTime   time.Time
@@ -41,9 +113,10 @@ type ChunkSizeController struct {
 }
 
 // NewChunkSizeController creates a new chunk size controller
-func NewChunkSizeController() *ChunkSizeController {
+func NewChunkSizeController(cfg ChunkSizeConfig) *ChunkSizeController {
 	return &ChunkSizeController{
-		currentChunkSize: DefaultChunkSize,
+		cfg:              cfg,
+		currentChunkSize: cfg.DefaultChunk,
 		lastUpdateTime:   time.Now(),
 	}
 }
@@ -92,7 +165,7 @@ func (c *ChunkSizeController) updateChunkSize(elapsed time.Duration) {
 	smoothedChunkSize := c.currentChunkSize + int(float64(targetChunkSize-c.currentChunkSize)*0.25)
 
 	// Clamp to valid range
-	c.currentChunkSize = max(MinChunkSize, min(MaxChunkSize, smoothedChunkSize))
+	c.currentChunkSize = max(c.cfg.MinChunk, min(c.cfg.MaxChunk, smoothedChunkSize))
 
 	// Reset counters
 	c.bytesTransferred = 0
@@ -108,7 +181,7 @@ func (c *ChunkSizeController) calculateTargetChunkSize(speed float64) int {
 	switch {
 	case speed < SpeedVerySlowThreshold:
 		// Very slow connection (< 50 KB/s): use minimum chunk size
-		return MinChunkSize
+		return c.cfg.MinChunk
 	case speed < SpeedSlowThreshold:
 		// Slow connection (50-200 KB/s): use small chunks
 		return 8 * 1024 // 8 KB
@@ -119,8 +192,8 @@ func (c *ChunkSizeController) calculateTargetChunkSize(speed float64) int {
 		// Medium-fast connection (500 KB/s - 1 MB/s): use medium chunks
 		return 32 * 1024 // 32 KB
 	default:
-		// Fast connection (> 1 MB/s): use large chunks
-		return MaxChunkSize // 64 KB
+		// Fast connection (> 1 MB/s): use the largest allowed chunks
+		return c.cfg.MaxChunk
 	}
 }
 
@@ -150,6 +223,51 @@ func FormatSize(bytes int64) string {
 	}
 }
 
+// ParseSize parses a byte count such as "65536", "64KB" or "2MB".
+// Units are binary multiples and case-insensitive.
+func ParseSize(s string) (int, error) {
+	n, err := ParseBytes(s)
+	if err != nil || n > math.MaxInt {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int(n), nil
+}
+
+// ParseBytes is ParseSize for sizes that may not fit in an int on 32-bit
+// platforms, and also accepts TB
+func ParseBytes(s string) (int64, error) {
+	str := strings.ToUpper(strings.TrimSpace(s))
+
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(str, unit.suffix) {
+			str = strings.TrimSpace(strings.TrimSuffix(str, unit.suffix))
+			multiplier = unit.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(str, 10, 64)
+	if err != nil || n <= 0 || n > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * multiplier, nil
+}
+
+// ParseRate parses a transfer rate such as "2MB/s" or "500KB" into bytes per second
+func ParseRate(s string) (int, error) {
+	trimmed := strings.TrimSpace(s)
+	trimmed = strings.TrimSuffix(strings.TrimSuffix(trimmed, "/s"), "/S")
+	n, err := ParseSize(trimmed)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate %q", s)
+	}
+	return n, nil
+}
+
 func FormatSpeed(bytesPerSecond float64) string {
 	const (
 		KB = 1024.0
@@ -171,21 +289,30 @@ func FormatSpeed(bytesPerSecond float64) string {
 
 // GetUniqueFilename returns a unique filename by appending (1), (2), etc. if file exists
 func GetUniqueFilename(filename string) string {
-	// If file doesn't exist, return original name
-	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		return filename
+	return uniqueName(filename, func(name string) bool {
+		_, err := os.Stat(name)
+		return !os.IsNotExist(err)
+	})
+}
+
+// uniqueName returns name, or the first "name (N).ext" that exists reports
+// as free
+func uniqueName(name string, exists func(string) bool) string {
+	// If the name is free, return it unchanged
+	if !exists(name) {
+		return name
 	}
 
 	// Extract extension and base name
-	ext := filepath.Ext(filename)
-	nameWithoutExt := filename[:len(filename)-len(ext)]
+	ext := filepath.Ext(name)
+	nameWithoutExt := name[:len(name)-len(ext)]
 
 	// Try appending (1), (2), (3), etc.
 	counter := 1
 	for {
-		newFilename := fmt.Sprintf("%s (%d)%s", nameWithoutExt, counter, ext)
-		if _, err := os.Stat(newFilename); os.IsNotExist(err) {
-			return newFilename
+		newName := fmt.Sprintf("%s (%d)%s", nameWithoutExt, counter, ext)
+		if !exists(newName) {
+			return newName
 		}
 		counter++
 	}
@@ -205,12 +332,14 @@ func FormatTimeDuration(d time.Duration) string {
 	}
 }
 
+// TruncateString shortens s to at most maxLen terminal cells, measuring
+// wide and combining characters correctly
 func TruncateString(s string, maxLen int) string {
-	if len(s) <= maxLen {
+	if runewidth.StringWidth(s) <= maxLen {
 		return s
 	}
 	if maxLen <= 3 {
-		return s[:maxLen]
+		return runewidth.Truncate(s, maxLen, "")
 	}
-	return s[:maxLen-3] + "..."
+	return runewidth.Truncate(s, maxLen, "...")
 }
@@ -2,76 +2,130 @@ package utils
 
 import (
 	"archive/zip"
+	"compress/flate"
+	"fmt"
 	"io"
 	"os"
-	"path/filepath"
+	"path"
+	"time"
 )
 
-// ZipDirectory zips the contents of source directory into target zip file
-func ZipDirectory(source, target string) error {
-	zipFile, err := os.Create(target)
-	if err != nil {
-		return err
-	}
-	defer zipFile.Close()
+// Zip compression levels. The default deflates at the standard level.
+const (
+	ZipLevelDefault = ""
+	ZipLevelStore   = "store"
+	ZipLevelFast    = "fast"
+	ZipLevelBest    = "best"
+)
 
-	archive := zip.NewWriter(zipFile)
-	defer archive.Close()
+var zipLevels = map[string]int{
+	ZipLevelDefault: flate.DefaultCompression,
+	ZipLevelStore:   flate.NoCompression,
+	ZipLevelFast:    flate.BestSpeed,
+	ZipLevelBest:    flate.BestCompression,
+}
 
-	info, err := os.Stat(source)
-	if err != nil {
-		return err
-	}
+// ZipOptions controls how ZipWriter builds the archive
+type ZipOptions struct {
+	// Flatten puts every file in the archive root. Names that clash get a
+	// " (N)" suffix like GetUniqueFilename gives them on disk.
+	Flatten bool
 
-	var baseDir string
-	if info.IsDir() {
-		baseDir = source
-	} else {
-		baseDir = filepath.Dir(source)
-	}
+	// Level is one of the ZipLevel constants; store skips compression,
+	// which is fastest for media that is already compressed
+	Level string
+}
 
-	return filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+// ValidateZipLevel reports whether level is one ZipWriter understands
+func ValidateZipLevel(level string) error {
+	if _, ok := zipLevels[level]; ok {
+		return nil
+	}
+	return fmt.Errorf("unknown zip level %q (use store, fast or best)", level)
+}
 
-		// Create a header based on the file info
-		header, err := zip.FileInfoHeader(info)
-		if err != nil {
-			return err
-		}
+// ZipWriter builds an archive one entry at a time, laying entries out the
+// way the files would be on disk
+type ZipWriter struct {
+	archive *zip.Writer
+	method  uint16
+	flatten bool
 
-		// Relativize the path
-		relPath, err := filepath.Rel(baseDir, path)
-		if err != nil {
-			return err
-		}
+	// taken holds the entry names in use and dirs the folders already
+	// written
+	taken map[string]bool
+	dirs  map[string]bool
+}
 
-		// Use forward slashes for cross-platform compatibility
-		header.Name = filepath.ToSlash(relPath)
+// NewZipWriter starts an archive on w, which need not be seekable
+func NewZipWriter(w io.Writer, opts ZipOptions) (*ZipWriter, error) {
+	if err := ValidateZipLevel(opts.Level); err != nil {
+		return nil, err
+	}
 
-		if info.IsDir() {
-			header.Name += "/"
-		} else {
-			header.Method = zip.Deflate
-		}
+	archive := zip.NewWriter(w)
+	method := zip.Deflate
+	switch level := zipLevels[opts.Level]; level {
+	case flate.NoCompression:
+		method = zip.Store
+	case flate.DefaultCompression:
+	default:
+		archive.RegisterCompressor(zip.Deflate, func(w io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(w, level)
+		})
+	}
 
-		writer, err := archive.CreateHeader(header)
-		if err != nil {
-			return err
-		}
+	return &ZipWriter{
+		archive: archive,
+		method:  method,
+		flatten: opts.Flatten,
+		taken:   make(map[string]bool),
+		dirs:    make(map[string]bool),
+	}, nil
+}
 
-		if info.IsDir() {
-			return nil
-		}
+// Name reserves an entry name for the file at the slash-separated relPath.
+// Flattening drops its folders, and a name already taken gets a " (N)"
+// suffix like GetUniqueFilename gives it on disk.
+func (z *ZipWriter) Name(relPath string) string {
+	if z.flatten {
+		relPath = path.Base(relPath)
+	}
+	name := uniqueName(relPath, func(name string) bool { return z.taken[name] })
+	z.taken[name] = true
+	return name
+}
 
-		file, err := os.Open(path)
-		if err != nil {
-			return err
-		}
-		defer file.Close()
+// Create starts the entry name, adding its folders first, and returns the
+// writer for its contents. The writer is valid until the next Create or
+// Close.
+func (z *ZipWriter) Create(name string, modTime time.Time, mode os.FileMode) (io.Writer, error) {
+	if err := z.createDir(path.Dir(name)); err != nil {
+		return nil, err
+	}
+	header := &zip.FileHeader{Name: name, Method: z.method, Modified: modTime}
+	header.SetMode(mode)
+	return z.archive.CreateHeader(header)
+}
 
-		_, err = io.Copy(writer, file)
+func (z *ZipWriter) createDir(dir string) error {
+	if dir == "." || z.dirs[dir] {
+		return nil
+	}
+	if err := z.createDir(path.Dir(dir)); err != nil {
+		return err
+	}
+	header := &zip.FileHeader{Name: dir + "/", Modified: time.Now()}
+	header.SetMode(os.ModeDir | 0755)
+	if _, err := z.archive.CreateHeader(header); err != nil {
 		return err
-	})
+	}
+	z.dirs[dir] = true
+	return nil
+}
+
+// Close writes the archive's central directory. It does not close the
+// underlying writer.
+func (z *ZipWriter) Close() error {
+	return z.archive.Close()
 }
@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExpandZipName fills in the {date}, {time}, {count} and {room} placeholders
+// of a zip name template and adds the .zip extension when it is missing
+func ExpandZipName(template string, now time.Time, count int, room string) string {
+	name := strings.NewReplacer(
+		"{date}", now.Format("2006-01-02"),
+		"{time}", now.Format("150405"),
+		"{count}", strconv.Itoa(count),
+		"{room}", room,
+	).Replace(template)
+
+	if !strings.EqualFold(filepath.Ext(name), ".zip") {
+		name += ".zip"
+	}
+	return name
+}
@@ -7,6 +7,25 @@ type FileMetadata struct {
 	Name string `msgpack:"name"`
 	Size uint64 `msgpack:"size"`
 	Type string `msgpack:"type"`
+
+	// RelPath is set for files sent as part of a directory so the receiver
+	// can recreate the tree
+	RelPath string `msgpack:"relPath,omitempty"`
+
+	// ModTime is the file's modification time in Unix milliseconds, as
+	// browsers report it, and Mode its permission bits. Either is zero when
+	// the sender doesn't know it.
+	ModTime int64  `msgpack:"modTime,omitempty"`
+	Mode    uint32 `msgpack:"mode,omitempty"`
+
+	// Compression is the codec the sender offers to compress this file's
+	// chunks with. The receiver accepts it in ready_to_receive.
+	Compression string `msgpack:"compression,omitempty"`
+
+	// Checksum is the hex SHA-256 of the file contents. The sender computes it
+	// while reading the file, so it is only set in the file_checksum message
+	// sent after the file's last chunk.
+	Checksum string `msgpack:"checksum,omitempty"`
 }
 
 // Message represents all WebRTC data channel messages
@@ -15,16 +34,75 @@ type Message struct {
 	Payload msgpack.RawMessage `msgpack:"payload"`
 }
 
-// DeviceInfoPayload is sent by receiver with device info
+// DeviceInfoPayload describes a peer's device. The receiver sends it when
+// the channel opens and CLI senders send theirs ahead of the file list.
 type DeviceInfoPayload struct {
 	DeviceName    string `msgpack:"deviceName"`
 	DeviceVersion string `msgpack:"deviceVersion"`
+
+	// Interleave is set by peers that can receive chunks of several
+	// requested files mixed together on one channel. Senders send files
+	// one at a time to receivers that don't set it.
+	Interleave bool `msgpack:"interleave,omitempty"`
+
+	// QueuedChannels is set by peers that take multichannel file channels
+	// opened as earlier files finish, rather than all before the file
+	// list. Senders open every channel up front for receivers that don't.
+	QueuedChannels bool `msgpack:"queuedChannels,omitempty"`
+
+	// Fallback is set by multichannel receivers that can start over on a
+	// single channel when the file channels never open. Senders give up
+	// on receivers that don't set it.
+	Fallback bool `msgpack:"fallback,omitempty"`
+
+	// Controls is set by receivers that understand transfer_paused,
+	// transfer_resumed and file_cancelled. Senders don't send them, or
+	// offer to cancel single files, to receivers that don't set it.
+	Controls bool `msgpack:"controls,omitempty"`
+
+	// Checksums is set by senders that send file_checksum after each
+	// file. Receivers verifying files don't wait for checksums from
+	// senders that don't set it.
+	Checksums bool `msgpack:"checksums,omitempty"`
 }
 
-// ReadyToReceivePayload is sent by receiver to request a file
+// ReadyToReceivePayload is sent by receiver to request a file. Compression
+// is the offered codec the receiver accepted, empty for none.
 type ReadyToReceivePayload struct {
+	FileName    string `msgpack:"fileName"`
+	Offset      uint64 `msgpack:"offset"`
+	Compression string `msgpack:"compression,omitempty"`
+}
+
+// PipelineDepthPayload is sent by sender before the metadata to let the
+// receiver request several files ahead
+type PipelineDepthPayload struct {
+	Depth int `msgpack:"depth"`
+}
+
+// FileCancelledPayload is sent by sender when the user stops one file
+type FileCancelledPayload struct {
+	FileName string `msgpack:"fileName"`
+}
+
+// FilesSkippedPayload is sent by receiver ahead of ready_to_receive to name
+// offered files it filtered out and won't request
+type FilesSkippedPayload struct {
+	FileNames []string `msgpack:"fileNames"`
+}
+
+// RetryFilesPayload is sent by receiver after its first pass over the files
+// to name those whose channel failed, so the sender can send them again
+type RetryFilesPayload struct {
+	FileNames []string `msgpack:"fileNames"`
+}
+
+// RequestRangePayload is sent by receiver to ask for a span of a file
+// again after chunks in it were dropped
+type RequestRangePayload struct {
 	FileName string `msgpack:"fileName"`
 	Offset   uint64 `msgpack:"offset"`
+	Length   uint64 `msgpack:"length"`
 }
 
 // ChunkPayload represents a file chunk
@@ -33,6 +111,50 @@ type ChunkPayload struct {
 	Offset   uint64 `msgpack:"offset"`
 	Bytes    []byte `msgpack:"bytes"`
 	Final    bool   `msgpack:"final"`
+
+	// Compression is the codec Bytes were compressed with, empty for none
+	Compression string `msgpack:"compression,omitempty"`
+}
+
+// ReceiveProgressPayload is sent by receiver to report bytes written to disk
+type ReceiveProgressPayload struct {
+	FileName string `msgpack:"fileName"`
+	Received uint64 `msgpack:"received"`
+}
+
+// AuthChallengePayload is sent by sender when the transfer is password
+// protected. It carries only the salt and a verifier, never the key.
+type AuthChallengePayload struct {
+	Salt     []byte `msgpack:"salt"`
+	Verifier []byte `msgpack:"verifier"`
+}
+
+// AuthResponsePayload is sent by receiver to prove it knows the password.
+// An empty proof means the password entered was wrong.
+type AuthResponsePayload struct {
+	Proof []byte `msgpack:"proof,omitempty"`
+}
+
+// ChecksumMismatchPayload is sent by receiver when a file fails verification
+type ChecksumMismatchPayload struct {
+	FileName string `msgpack:"fileName"`
+	Expected string `msgpack:"expected"`
+	Actual   string `msgpack:"actual"`
+}
+
+// ErrorPayload is sent by either side when the transfer fails on its end.
+// Code is stable so the peer can explain it; Message is for display.
+type ErrorPayload struct {
+	Code     string `msgpack:"code"`
+	Message  string `msgpack:"message"`
+	FileName string `msgpack:"fileName,omitempty"`
+}
+
+// DeclinePayload is sent by receiver when it turns the offer down. Reason
+// is set when it was declined automatically, such as over a size limit, or
+// typed by the receiver.
+type DeclinePayload struct {
+	Reason string `msgpack:"reason,omitempty"`
 }
 
 // DecodePayload decodes the message payload into the provided struct
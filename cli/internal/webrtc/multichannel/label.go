@@ -0,0 +1,60 @@
+package multichannel
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	controlChannelLabel = "control"
+	fileChannelPrefix   = "file-transfer-"
+	retryChannelPrefix  = "file-retry-"
+)
+
+// fileChannelLabel returns the data channel label for the file at index
+func fileChannelLabel(index int) string {
+	return fmt.Sprintf("%s%d", fileChannelPrefix, index)
+}
+
+// parseFileChannelIndex extracts the file index from a data channel label.
+// SCTP does not guarantee channels are announced in creation order, so the
+// receiver relies on the label rather than arrival order.
+func parseFileChannelIndex(label string) (int, bool) {
+	if !strings.HasPrefix(label, fileChannelPrefix) {
+		return 0, false
+	}
+	index, err := strconv.Atoi(strings.TrimPrefix(label, fileChannelPrefix))
+	if err != nil || index < 0 {
+		return 0, false
+	}
+	return index, true
+}
+
+// retryChannelLabel returns the label of the fresh channel the file at
+// index is sent again on, for its attempt'th retry
+func retryChannelLabel(index, attempt int) string {
+	return fmt.Sprintf("%s%d-%d", retryChannelPrefix, index, attempt)
+}
+
+// parseRetryChannelLabel extracts the file index and attempt from a retry
+// channel label
+func parseRetryChannelLabel(label string) (int, int, bool) {
+	rest, ok := strings.CutPrefix(label, retryChannelPrefix)
+	if !ok {
+		return 0, 0, false
+	}
+	indexStr, attemptStr, ok := strings.Cut(rest, "-")
+	if !ok {
+		return 0, 0, false
+	}
+	index, err := strconv.Atoi(indexStr)
+	if err != nil || index < 0 {
+		return 0, 0, false
+	}
+	attempt, err := strconv.Atoi(attemptStr)
+	if err != nil || attempt < 1 {
+		return 0, 0, false
+	}
+	return index, attempt, true
+}
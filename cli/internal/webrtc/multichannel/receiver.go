@@ -1,20 +1,25 @@
 package multichannel
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"os"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/BioHazard786/Warpdrop/cli/internal/config"
+	"github.com/BioHazard786/Warpdrop/cli/internal/history"
 	"github.com/BioHazard786/Warpdrop/cli/internal/signaling"
 	"github.com/BioHazard786/Warpdrop/cli/internal/transfer"
+	"github.com/BioHazard786/Warpdrop/cli/internal/trust"
 	"github.com/BioHazard786/Warpdrop/cli/internal/ui"
 	"github.com/BioHazard786/Warpdrop/cli/internal/webrtc"
 	pion "github.com/pion/webrtc/v4"
 )
 
-func NewReceiverSession(client *signaling.Client, handler *signaling.Handler, cfg *config.Config, peerInfo *signaling.PeerInfo) (*ReceiverSession, error) {
+func NewReceiverSession(client signaling.Transport, handler *signaling.Handler, cfg *config.Config, peerInfo *signaling.PeerInfo) (*ReceiverSession, error) {
 	peer, err := newReceiverPeer(client, cfg)
 	if err != nil {
 		return nil, err
@@ -26,6 +31,7 @@ func NewReceiverSession(client *signaling.Client, handler *signaling.Handler, cf
 		handler:         handler,
 		config:          cfg,
 		peerInfo:        peerInfo,
+		handover:        make(chan struct{}),
 	}, nil
 }
 
@@ -36,26 +42,41 @@ func (r *ReceiverSession) SetProgressUI() {
 		fileNames[i] = fc.Metadata.Name
 		fileSizes[i] = int64(fc.Metadata.Size)
 	}
-	r.progress = transfer.NewProgressTracker(fileNames, fileSizes)
+	r.progress = transfer.NewProgressTracker(fileNames, fileSizes, r.options.Out())
 }
 
 func (r *ReceiverSession) SetOptions(opts *transfer.TransferOptions) {
 	r.options = opts
+	if opts != nil && opts.Verify {
+		r.verification = &transfer.VerificationResult{}
+	}
+	// Nothing is written before the file channels open, but a zip entry or
+	// stdout can't be started over
+	r.peer.fallback = r.canRetry()
 }
 
-func newReceiverPeer(client *signaling.Client, cfg *config.Config) (*ReceiverPeer, error) {
+func newReceiverPeer(client signaling.Transport, cfg *config.Config) (*ReceiverPeer, error) {
 	pc, err := transfer.NewPeerConnection(cfg)
 	if err != nil {
 		return nil, err
 	}
 
 	peer := &ReceiverPeer{
-		connection:       pc,
-		metadataReceived: make(chan []webrtc.FileMetadata, 1),
-		done:             make(chan struct{}),
+		connection:        pc,
+		channelsByIndex:   make(map[int]*ReceiverFileChannel),
+		retryChannels:     make(chan *ReceiverFileChannel, 16),
+		metadataReceived:  make(chan []webrtc.FileMetadata, 1),
+		progressReporter:  transfer.NewProgressReporter(),
+		checksums:         transfer.NewChecksumStore(),
+		authChallenge:     make(chan webrtc.AuthChallengePayload, 1),
+		cancellation:      transfer.NewCancellation(),
+		heartbeat:         transfer.NewHeartbeat(),
+		pause:             transfer.NewPeerPause(),
+		done:              make(chan struct{}),
+		fallbackRequested: make(chan struct{}, 1),
 	}
 
-	transfer.SetupICEHandlers(pc, client, peer.done)
+	peer.path = transfer.SetupICEHandlers(pc, client, peer.done)
 	peer.setupDataHandlers()
 
 	return peer, nil
@@ -63,36 +84,109 @@ func newReceiverPeer(client *signaling.Client, cfg *config.Config) (*ReceiverPee
 
 func (p *ReceiverPeer) setupDataHandlers() {
 	p.connection.OnDataChannel(func(dc *pion.DataChannel) {
-		if dc.Label() == "control" {
+		if dc.Label() == controlChannelLabel {
 			p.controlChannel = dc
 			p.setupControlHandlers()
 			return
 		}
 
-		channel := &ReceiverFileChannel{
-			Channel:       dc,
-			chunkReceived: make(chan []byte, 128),
-			Index:         len(p.fileChannels),
+		if index, attempt, ok := parseRetryChannelLabel(dc.Label()); ok {
+			p.addRetryChannel(dc, index, attempt)
+			return
 		}
-		p.fileChannels = append(p.fileChannels, channel)
 
-		dc.OnOpen(func() {
-			atomic.AddInt32(&p.channelsReady, 1)
-		})
+		if p.addFileChannel(dc) {
+			dc.OnOpen(func() {
+				atomic.AddInt32(&p.channelsReady, 1)
+			})
+		}
+	})
+}
 
-		dc.OnMessage(func(msg pion.DataChannelMessage) {
-			channel.chunkReceived <- msg.Data
-		})
+// addFileChannel files dc under the index in its label, whatever order the
+// channels arrive in. It reports false for labels that aren't file
+// channels and for duplicates, which are closed.
+func (p *ReceiverPeer) addFileChannel(dc *pion.DataChannel) bool {
+	index, ok := parseFileChannelIndex(dc.Label())
+	if !ok {
+		return false
+	}
 
-		dc.OnClose(func() {
-			close(channel.chunkReceived)
-		})
+	// A file queued behind others already has its place from the file
+	// list, waiting for the channel
+	p.channelsMu.Lock()
+	defer p.channelsMu.Unlock()
+	channel, exists := p.channelsByIndex[index]
+	if exists && channel.Channel != nil {
+		dc.Close()
+		return false
+	}
+	if !exists {
+		channel = newFileChannel(index)
+		p.channelsByIndex[index] = channel
+	}
+	p.attach(channel, dc)
+	return true
+}
+
+// newFileChannel creates the file channel for the file at index, which
+// has no data channel until attach gives it one
+func newFileChannel(index int) *ReceiverFileChannel {
+	return &ReceiverFileChannel{
+		chunkReceived: make(chan []byte, 128),
+		cancelled:     make(chan struct{}),
+		attached:      make(chan struct{}),
+		Index:         index,
+	}
+}
+
+// attach makes dc the file channel's data channel, queueing the chunks it
+// receives. The caller holds channelsMu.
+func (p *ReceiverPeer) attach(channel *ReceiverFileChannel, dc *pion.DataChannel) {
+	channel.Channel = dc
+
+	dc.OnMessage(func(msg pion.DataChannelMessage) {
+		p.heartbeat.Alive()
+		channel.chunkReceived <- msg.Data
 	})
+
+	dc.OnClose(func() {
+		close(channel.chunkReceived)
+	})
+	close(channel.attached)
+}
+
+// queued reports whether the sender opens file channels as earlier files
+// finish, rather than all of them before the file list
+func (p *ReceiverPeer) queued() bool {
+	return p.senderDevice != nil && p.senderDevice.QueuedChannels
+}
+
+// addRetryChannel takes the fresh channel the sender opened to send the
+// file at index again, replacing the one that failed
+func (p *ReceiverPeer) addRetryChannel(dc *pion.DataChannel, index, attempt int) {
+	p.channelsMu.Lock()
+	previous, ok := p.channelsByIndex[index]
+	if !ok || index >= len(p.fileChannels) {
+		p.channelsMu.Unlock()
+		dc.Close()
+		return
+	}
+	channel := newFileChannel(index)
+	p.attach(channel, dc)
+	channel.Metadata = previous.Metadata
+	channel.attempt = attempt
+	p.channelsByIndex[index] = channel
+	p.channelsMu.Unlock()
+
+	p.retryChannels <- channel
 }
 
 func (p *ReceiverPeer) setupControlHandlers() {
 	p.controlChannel.OnOpen(func() {
-		transfer.SendDeviceInfo(p.controlChannel)
+		deviceInfo := transfer.DeviceInfo()
+		deviceInfo.Fallback = p.fallback
+		transfer.SendTypedMessage(p.controlChannel, transfer.MessageTypeDeviceInfo, deviceInfo)
 	})
 
 	p.controlChannel.OnMessage(func(msg pion.DataChannelMessage) {
@@ -100,6 +194,7 @@ func (p *ReceiverPeer) setupControlHandlers() {
 		if err != nil {
 			return
 		}
+		p.heartbeat.Alive()
 
 		switch message.Type {
 		case transfer.MessageTypeFilesMetadata:
@@ -108,27 +203,110 @@ func (p *ReceiverPeer) setupControlHandlers() {
 				return
 			}
 			p.metadataReceived <- metas
+
+		case transfer.MessageTypeDeviceInfo:
+			// Sent ahead of the file list, so it is set before Transfer
+			var deviceInfo webrtc.DeviceInfoPayload
+			if err := message.DecodePayload(&deviceInfo); err != nil {
+				return
+			}
+			p.senderDevice = &deviceInfo
+			if deviceInfo.Checksums {
+				p.checksums.Expect()
+			}
+
+		case transfer.MessageTypeAuthChallenge:
+			var challenge webrtc.AuthChallengePayload
+			if err := message.DecodePayload(&challenge); err != nil {
+				return
+			}
+			p.authChallenge <- challenge
+
+		case transfer.MessageTypeProgressRequest:
+			p.progressReporter.Enable()
+
+		case transfer.MessageTypeFileCancelled:
+			var cancelled webrtc.FileCancelledPayload
+			if err := message.DecodePayload(&cancelled); err != nil {
+				return
+			}
+			p.cancelFile(cancelled.FileName)
+
+		case transfer.MessageTypePaused, transfer.MessageTypeResumed:
+			p.pause.Set(message.Type == transfer.MessageTypePaused)
+
+		case transfer.MessageTypeCancelled, transfer.MessageTypeCancelAck:
+			p.cancellation.HandleMessage(p.controlChannel, message.Type)
+
+		case transfer.MessageTypePing, transfer.MessageTypePong:
+			p.heartbeat.HandleMessage(p.controlChannel, message.Type)
+
+		case transfer.MessageTypeTransferError:
+			p.cancellation.HandleError(message)
+
+		case transfer.MessageTypeFallback:
+			select {
+			case p.fallbackRequested <- struct{}{}:
+			default:
+			}
+
+		case transfer.MessageTypeFileChecksum:
+			var meta webrtc.FileMetadata
+			if err := message.DecodePayload(&meta); err != nil {
+				return
+			}
+			p.checksums.Set(meta)
 		}
 	})
 }
 
-func (r *ReceiverSession) Start() error {
-	stopSpinner := ui.RunConnectionSpinner("Establishing WebRTC connection...")
-	defer stopSpinner()
+// cancelFile stops receiving a file the sender skipped
+func (p *ReceiverPeer) cancelFile(name string) {
+	for _, fc := range p.fileChannels {
+		if fc.Metadata.Name == name {
+			fc.cancelOnce.Do(func() { close(fc.cancelled) })
+			return
+		}
+	}
+}
+
+func (r *ReceiverSession) Start(ctx context.Context) error {
+	spinner := r.options.Out().NewConnectionSpinner("Establishing WebRTC connection...")
+	spinner.Start()
+	defer spinner.Stop()
+
+	// A NAT probe, if asked for, runs while the connection is set up
+	r.natCheck = transfer.StartNATCheck(r.options, r.config, r.signalingClient, r.peerInfo, spinner.UpdateMessage)
+	defer r.natCheck.Stop()
 
 	go r.listenForSignals()
 
-	select {
-	case fileMetadataList := <-r.peer.metadataReceived:
-		if err := r.addMetadata(fileMetadataList); err != nil {
-			return err
-		}
+waitForMetadata:
+	for {
+		select {
+		case fileMetadataList := <-r.peer.metadataReceived:
+			if err := r.addMetadata(fileMetadataList); err != nil {
+				return err
+			}
+			break waitForMetadata
+
+		case challenge := <-r.peer.authChallenge:
+			spinner.Stop()
+			cipher, err := transfer.AnswerAuthChallenge(r.peer.controlChannel, challenge, r.password(), r.options.Out())
+			if err != nil {
+				return err
+			}
+			r.peer.cipher = cipher
 
-	case errMsg := <-r.handler.Error:
-		return transfer.WrapError("start", transfer.ErrSignalingError, errMsg)
+		case errMsg := <-r.handler.Error:
+			return transfer.WrapError("start", transfer.ErrSignalingError, errMsg)
 
-	case <-time.After(time.Duration(transfer.SignalTimeout) * time.Second):
-		return transfer.WrapError("start", transfer.ErrTimeout, "waiting for metadata")
+		case <-ctx.Done():
+			return transfer.ErrTransferCancelled
+
+		case <-time.After(time.Duration(transfer.SignalTimeout) * time.Second):
+			return transfer.ConnectTimeoutError(r.config, "waiting for metadata")
+		}
 	}
 
 	return nil
@@ -148,11 +326,15 @@ func (r *ReceiverSession) listenForSignals() {
 
 		case <-r.peer.done:
 			return
+		case <-r.handover:
+			return
 		}
 	}
 }
 
 func (r *ReceiverSession) handleSignal(payload *signaling.SignalPayload) error {
+	r.natCheck.HandleSignal(payload)
+
 	if payload.SDP != "" {
 		var sdpType pion.SDPType
 		switch payload.Type {
@@ -182,58 +364,128 @@ func (r *ReceiverSession) handleSignal(payload *signaling.SignalPayload) error {
 	return transfer.HandleICECandidate(r.peer.connection, payload)
 }
 
+func (r *ReceiverSession) password() string {
+	if r.options == nil {
+		return ""
+	}
+	return r.options.Password
+}
+
+// addMetadata assigns the file list to the file channels. Senders that
+// open channels as files finish have only opened some by now, and the
+// other files wait for theirs.
 func (r *ReceiverSession) addMetadata(fileMetadataList []webrtc.FileMetadata) error {
-	if err := transfer.WaitForChannels(&r.peer.channelsReady, len(fileMetadataList), r.handler.PeerLeft); err != nil {
-		return err
+	queued := r.peer.queued()
+	if !queued {
+		if err := transfer.WaitForChannels(&r.peer.channelsReady, len(fileMetadataList), r.handler.PeerLeft); err != nil {
+			return err
+		}
 	}
 
+	r.peer.channelsMu.Lock()
+	defer r.peer.channelsMu.Unlock()
+
+	fileChannels := make([]*ReceiverFileChannel, len(fileMetadataList))
 	for i, metaData := range fileMetadataList {
-		r.peer.fileChannels[i].Metadata = metaData
+		fc, ok := r.peer.channelsByIndex[i]
+		if !ok && queued {
+			fc = newFileChannel(i)
+			r.peer.channelsByIndex[i] = fc
+		} else if !ok {
+			return transfer.WrapError("assign metadata", transfer.ErrChannelsNotReady, metaData.Name)
+		}
+		fc.Metadata = metaData
+		fileChannels[i] = fc
 	}
+	r.peer.fileChannels = fileChannels
 
 	return nil
 }
 
-func (r *ReceiverSession) Transfer() error {
-	items := transfer.BuildFileTable(r.buildMetadataList())
-	ui.RenderFileTable(items)
+func (r *ReceiverSession) Transfer(ctx context.Context) error {
+	ctx, cancel := r.peer.cancellation.Watch(ctx)
+	defer cancel()
+
+	offered := r.buildMetadataList()
+	metas, skipped := transfer.FilterOffer(r.options, offered)
+	r.skipped = skipped
+	items := transfer.BuildFileTable(offered, skipped)
+	r.options.Out().RenderFileTable(items)
 
-	if !transfer.PromptConsent() {
-		transfer.SendSimpleMessage(r.peer.controlChannel, transfer.MessageTypeDeclineReceive)
+	if err := transfer.CheckOffer(r.options, metas); err != nil {
+		transfer.SendDecline(r.peer.controlChannel, transfer.DeclineReason(err))
+		return err
+	}
+
+	if ok, reason := transfer.PromptConsent(ctx, transfer.NewConsentOptions(r.options, r.peer.senderDevice, trust.RemoteFingerprint(r.peer.connection), metas)); !ok {
+		if r.peer.cancellation.PeerCancelled() {
+			return transfer.ErrSenderCancelled
+		}
+		transfer.SendDecline(r.peer.controlChannel, reason)
 		return transfer.ErrTransferCancelled
 	}
 
+	// Skipped files must be named before ready_to_receive starts the
+	// sender on every channel
+	if len(skipped) > 0 {
+		if err := transfer.SendFilesSkipped(r.peer.controlChannel, transfer.SkippedNames(offered, skipped)); err != nil {
+			return err
+		}
+	}
+
+	// Accept compression for every file the sender offered it on
+	for _, fc := range r.peer.fileChannels {
+		if skipped[fc.Metadata.Name] != "" {
+			continue
+		}
+		if codec := transfer.PickCompression(fc.Metadata.Compression); codec != "" {
+			r.compression = codec
+			break
+		}
+	}
+
 	r.progress.Start()
-	fmt.Printf("\n%s Receiving files...\n\n", ui.IconReceive)
+	r.options.Out().Printf("\n%s Receiving files...\n\n", ui.IconReceive)
 
-	filesCount := len(r.peer.fileChannels)
+	filesCount := len(metas)
 	errChan := make(chan error, 1)
 
+	// A stall or a sender that goes quiet cancels the file goroutines with
+	// its error as the cause, leaving ctx to tell a cancelled transfer apart
+	recvCtx, stop := r.peer.heartbeat.Watch(ctx, r.peer.controlChannel, transfer.HeartbeatTimeout(r.options))
+	defer stop(nil)
+	go transfer.WatchStall(recvCtx, transfer.StallTimeout(r.options), r.receivedBytes, r.peer.pause, stop)
+	go r.watchFallback(recvCtx, stop)
+
 	go func() {
-		defer r.progress.Program.Quit()
+		defer r.progress.Quit()
 
-		transfer.SendSimpleMessage(r.peer.controlChannel, transfer.MessageTypeReadyToReceive)
+		transfer.SendTypedMessage(r.peer.controlChannel, transfer.MessageTypeReadyToReceive, webrtc.ReadyToReceivePayload{
+			Compression: r.compression,
+		})
 
 		wg := &sync.WaitGroup{}
 		wg.Add(filesCount)
 
-		var firstErr error
-		var errOnce sync.Once
-
+		batch := newReceiveBatch()
 		for _, fc := range r.peer.fileChannels {
+			if reason := r.skipped[fc.Metadata.Name]; reason != "" {
+				r.progress.Skip(fc.Index, reason)
+				continue
+			}
 			go func(fc *ReceiverFileChannel) {
-				if err := r.receiveFile(fc, wg); err != nil {
-					errOnce.Do(func() {
-						firstErr = err
-					})
-				}
+				batch.record(fc, r.receiveFile(recvCtx, fc, wg))
 			}(fc)
 		}
 
 		wg.Wait()
 
-		if firstErr != nil {
-			errChan <- firstErr
+		if batch.err != nil {
+			errChan <- batch.err
+			return
+		}
+		if err := r.retryLost(recvCtx, batch.lost); err != nil {
+			errChan <- err
 			return
 		}
 
@@ -246,13 +498,48 @@ func (r *ReceiverSession) Transfer() error {
 	}
 
 	if err := <-errChan; err != nil {
+		if errors.Is(err, transfer.ErrFallback) {
+			r.options.Out().PrintWarning("File channels did not open, retrying over a single channel")
+			close(r.handover)
+			return err
+		}
+		if cancelErr := r.peer.cancellation.Resolve(ctx, r.peer.controlChannel, transfer.ErrSenderCancelled); cancelErr != nil {
+			return cancelErr
+		}
+		transfer.SendTransferError(r.peer.controlChannel, err)
 		return err
 	}
 
-	transfer.RenderSummary(filesCount, r.progress.TotalSize(), r.progress.Duration())
+	if r.verification != nil {
+		r.verification.Warn(r.options.Out())
+		if err := r.verification.Err(); err != nil {
+			return err
+		}
+	}
+
+	transfer.RenderSummary(history.DirectionReceived, r.progress, r.peerInfo.ClientType, r.peer.path, r.options)
 	return nil
 }
 
+// watchFallback cancels the receive with ErrFallback when the sender asks
+// to start over on a single channel
+func (r *ReceiverSession) watchFallback(ctx context.Context, stop context.CancelCauseFunc) {
+	select {
+	case <-r.peer.fallbackRequested:
+		stop(transfer.ErrFallback)
+	case <-ctx.Done():
+	}
+}
+
+// receivedBytes totals the bytes written across every file channel
+func (r *ReceiverSession) receivedBytes() int64 {
+	var total int64
+	for _, fc := range r.peer.fileChannels {
+		total += atomic.LoadInt64(&fc.ReceivedBytes)
+	}
+	return total
+}
+
 func (r *ReceiverSession) buildMetadataList() []webrtc.FileMetadata {
 	metas := make([]webrtc.FileMetadata, len(r.peer.fileChannels))
 	for i, fc := range r.peer.fileChannels {
@@ -261,17 +548,79 @@ func (r *ReceiverSession) buildMetadataList() []webrtc.FileMetadata {
 	return metas
 }
 
-func (r *ReceiverSession) receiveFile(fc *ReceiverFileChannel, wg *sync.WaitGroup) error {
+func (r *ReceiverSession) receiveFile(ctx context.Context, fc *ReceiverFileChannel, wg *sync.WaitGroup) error {
 	defer wg.Done()
 
+	// Files queued behind others wait for the sender to open their channel
+	select {
+	case <-fc.attached:
+	case <-fc.cancelled:
+		r.progress.Error(fc.Index, "cancelled by sender")
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+
 	writer, err := transfer.NewFileWriter(fc.Metadata, fc.Index, r.options)
 	if err != nil {
 		r.progress.Error(fc.Index, err.Error())
 		return err
 	}
 	defer writer.Close()
+	writer.SetCipher(r.peer.cipher)
+	writer.SetPreserve(r.options.Preserve)
+	r.progress.Rename(fc.Index, writer.DisplayName())
+	r.progress.Saved(fc.Index, writer.Location())
+	if r.compression != "" && fc.Metadata.Compression == r.compression {
+		writer.SetCompression(r.compression)
+	}
+
+	// An empty file has no chunks to wait for
+	if writer.IsComplete() {
+		r.peer.progressReporter.Report(r.peer.controlChannel, fc.Metadata.Name, 0, true)
+		r.finishFile(writer)
+		return nil
+	}
+
+	for {
+		var data []byte
+		select {
+		case chunk, ok := <-fc.chunkReceived:
+			if !ok {
+				if !writer.IsComplete() {
+					err := transfer.WrapError("receive", transfer.ErrChannelClosed, fc.Metadata.Name)
+					// The sender can send a lost file again from the start
+					if r.canRetry() {
+						writer.Close()
+						os.Remove(writer.Path)
+						return err
+					}
+					r.progress.Error(fc.Index, "channel closed early")
+					return err
+				}
+				r.finishFile(writer)
+				return nil
+			}
+			data = chunk
+		case <-fc.cancelled:
+			// Chunks already in flight are dropped so the channel never blocks
+			go func() {
+				for range fc.chunkReceived {
+				}
+			}()
+			writer.Close()
+			os.Remove(writer.Path)
+			r.progress.Error(fc.Index, "cancelled by sender")
+			return nil
+		case <-ctx.Done():
+			// Files are received again from the start after a fallback
+			if errors.Is(context.Cause(ctx), transfer.ErrFallback) {
+				writer.Close()
+				os.Remove(writer.Path)
+			}
+			return context.Cause(ctx)
+		}
 
-	for data := range fc.chunkReceived {
 		if _, err := writer.Write(data); err != nil {
 			r.progress.Error(fc.Index, err.Error())
 			return err
@@ -279,27 +628,125 @@ func (r *ReceiverSession) receiveFile(fc *ReceiverFileChannel, wg *sync.WaitGrou
 
 		atomic.StoreInt64(&fc.ReceivedBytes, int64(writer.ReceivedBytes))
 		r.progress.Update(fc.Index, int64(writer.ReceivedBytes))
+		r.peer.progressReporter.Report(r.peer.controlChannel, fc.Metadata.Name, writer.ReceivedBytes, writer.IsComplete())
 
 		if writer.IsComplete() {
-			r.progress.Complete(fc.Index)
+			r.finishFile(writer)
 			return nil
 		}
 	}
+}
+
+// receiveBatch collects the outcome of receiving a set of files at once.
+// Files whose channel failed are lost and may be asked for again; any
+// other failure ends the transfer.
+type receiveBatch struct {
+	mu   sync.Mutex
+	lost map[int]*ReceiverFileChannel
+	err  error
+}
+
+func newReceiveBatch() *receiveBatch {
+	return &receiveBatch{lost: make(map[int]*ReceiverFileChannel)}
+}
 
-	if !writer.IsComplete() {
-		r.progress.Error(fc.Index, "channel closed early")
-		return transfer.WrapError("receive", transfer.ErrChannelClosed, fc.Metadata.Name)
+func (b *receiveBatch) record(fc *ReceiverFileChannel, err error) {
+	if err == nil {
+		return
 	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if transfer.Retryable(err) {
+		b.lost[fc.Index] = fc
+	} else if b.err == nil {
+		b.err = err
+	}
+}
+
+// canRetry reports whether a lost file can be received again from the
+// start. Data already written to stdout or into the zip can't be undone.
+func (r *ReceiverSession) canRetry() bool {
+	return r.options == nil || (!r.options.Stdout && r.options.Zip == nil)
+}
+
+// retryLost asks the sender to send the lost files again and receives
+// them on the fresh channels it opens, until none are lost. A sender out of
+// retries fails the transfer itself; one that never opens the channels,
+// such as an older CLI, fails it after SignalTimeout.
+func (r *ReceiverSession) retryLost(ctx context.Context, lost map[int]*ReceiverFileChannel) error {
+	for len(lost) > 0 {
+		names := make([]string, 0, len(lost))
+		for _, fc := range lost {
+			names = append(names, fc.Metadata.Name)
+		}
+		if err := transfer.SendRetryFiles(r.peer.controlChannel, names); err != nil {
+			return err
+		}
 
-	r.progress.Complete(fc.Index)
+		wg := &sync.WaitGroup{}
+		batch := newReceiveBatch()
+		for pending := len(lost); pending > 0; {
+			select {
+			case fc := <-r.peer.retryChannels:
+				if _, ok := lost[fc.Index]; !ok {
+					fc.Channel.Close()
+					continue
+				}
+				pending--
+				r.peer.fileChannels[fc.Index] = fc
+				r.progress.Retry(fc.Index, fc.attempt)
+
+				wg.Add(1)
+				go func(fc *ReceiverFileChannel) {
+					batch.record(fc, r.receiveFile(ctx, fc, wg))
+				}(fc)
+
+			case <-ctx.Done():
+				wg.Wait()
+				return context.Cause(ctx)
+
+			case <-time.After(time.Duration(transfer.SignalTimeout) * time.Second):
+				wg.Wait()
+				for _, fc := range lost {
+					r.progress.Error(fc.Index, "channel closed early")
+				}
+				return transfer.WrapError("receive", transfer.ErrChannelClosed, strings.Join(names, ", "))
+			}
+		}
+
+		wg.Wait()
+		if batch.err != nil {
+			return batch.err
+		}
+		lost = batch.lost
+	}
 	return nil
 }
 
+// finishFile marks a fully written file complete, verifying it against the
+// sender's checksum first when --verify is set
+func (r *ReceiverSession) finishFile(writer *transfer.FileWriter) {
+	if r.verification != nil {
+		if err := r.verification.Check(r.peer.controlChannel, writer, r.peer.checksums); err == transfer.ErrChecksumMismatch {
+			r.progress.Error(writer.Index, "checksum mismatch")
+			return
+		}
+	}
+	r.progress.Complete(writer.Index)
+}
+
+// Close flushes any pending control messages (such as the final
+// downloading_done) before tearing the connection down. After a fallback
+// the signaling connection is left open for the next session.
 func (r *ReceiverSession) Close() error {
 	if r.peer != nil {
+		transfer.DrainChannel(r.peer.controlChannel, time.Duration(transfer.CloseTimeout)*time.Second)
 		r.peer.close()
 	}
-	time.Sleep(100 * time.Millisecond)
+
+	if r.handedOver() {
+		return nil
+	}
 
 	if r.signalingClient != nil {
 		r.signalingClient.Close()
@@ -310,14 +757,26 @@ func (r *ReceiverSession) Close() error {
 	return nil
 }
 
+// handedOver reports whether the transfer fell back to a single channel
+func (r *ReceiverSession) handedOver() bool {
+	select {
+	case <-r.handover:
+		return true
+	default:
+		return false
+	}
+}
+
 func (p *ReceiverPeer) close() error {
 	if p.controlChannel != nil {
 		p.controlChannel.Close()
 	}
-	for _, fc := range p.fileChannels {
+	p.channelsMu.Lock()
+	for _, fc := range p.channelsByIndex {
 		if fc != nil && fc.Channel != nil {
 			fc.Channel.Close()
 		}
 	}
+	p.channelsMu.Unlock()
 	return p.connection.Close()
 }
@@ -0,0 +1,156 @@
+package multichannel
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/signaling"
+	"github.com/BioHazard786/Warpdrop/cli/internal/webrtc"
+	pion "github.com/pion/webrtc/v4"
+)
+
+func TestParseFileChannelIndex(t *testing.T) {
+	tests := []struct {
+		label string
+		index int
+		ok    bool
+	}{
+		{fileChannelLabel(0), 0, true},
+		{fileChannelLabel(12), 12, true},
+		{controlChannelLabel, 0, false},
+		{retryChannelLabel(3, 1), 0, false},
+		{fileChannelPrefix, 0, false},
+		{fileChannelPrefix + "-1", 0, false},
+		{fileChannelPrefix + "x", 0, false},
+	}
+	for _, tt := range tests {
+		index, ok := parseFileChannelIndex(tt.label)
+		if index != tt.index || ok != tt.ok {
+			t.Errorf("parseFileChannelIndex(%q) = %d, %v, want %d, %v", tt.label, index, ok, tt.index, tt.ok)
+		}
+	}
+}
+
+// newTestReceiver returns a receiver whose peer connection is never
+// connected, and a function making data channels on it
+func newTestReceiver(t *testing.T) (*ReceiverSession, func(label string) *pion.DataChannel) {
+	t.Helper()
+	pc, err := pion.NewPeerConnection(pion.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+
+	r := &ReceiverSession{
+		peer: &ReceiverPeer{
+			connection:      pc,
+			channelsByIndex: make(map[int]*ReceiverFileChannel),
+		},
+		handler: &signaling.Handler{PeerLeft: make(chan struct{})},
+	}
+	newChannel := func(label string) *pion.DataChannel {
+		dc, err := pc.CreateDataChannel(label, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dc
+	}
+	return r, newChannel
+}
+
+func testMetadata(n int) []webrtc.FileMetadata {
+	metas := make([]webrtc.FileMetadata, n)
+	for i := range metas {
+		metas[i] = webrtc.FileMetadata{Name: fmt.Sprintf("file-%d.txt", i), Size: uint64(i)}
+	}
+	return metas
+}
+
+func assertMapping(t *testing.T, r *ReceiverSession, metas []webrtc.FileMetadata) {
+	t.Helper()
+	if len(r.peer.fileChannels) != len(metas) {
+		t.Fatalf("got %d file channels, want %d", len(r.peer.fileChannels), len(metas))
+	}
+	for i, fc := range r.peer.fileChannels {
+		if fc.Index != i {
+			t.Errorf("file channel %d has index %d", i, fc.Index)
+		}
+		if fc.Metadata.Name != metas[i].Name {
+			t.Errorf("file channel %d has %q, want %q", i, fc.Metadata.Name, metas[i].Name)
+		}
+		if fc.Channel != nil && fc.Channel.Label() != fileChannelLabel(i) {
+			t.Errorf("file %q is on channel %q, want %q", metas[i].Name, fc.Channel.Label(), fileChannelLabel(i))
+		}
+	}
+}
+
+func TestAddMetadataOutOfOrderChannels(t *testing.T) {
+	r, newChannel := newTestReceiver(t)
+	metas := testMetadata(5)
+
+	for _, index := range []int{3, 0, 4, 1, 2} {
+		if !r.peer.addFileChannel(newChannel(fileChannelLabel(index))) {
+			t.Fatalf("file channel %d was not added", index)
+		}
+	}
+	r.peer.channelsReady = int32(len(metas))
+
+	if err := r.addMetadata(metas); err != nil {
+		t.Fatal(err)
+	}
+	assertMapping(t, r, metas)
+	for i, fc := range r.peer.fileChannels {
+		if fc.Channel == nil {
+			t.Errorf("file channel %d has no data channel", i)
+		}
+	}
+}
+
+func TestAddFileChannelIgnoresOthersAndDuplicates(t *testing.T) {
+	r, newChannel := newTestReceiver(t)
+
+	if r.peer.addFileChannel(newChannel(controlChannelLabel)) {
+		t.Error("control channel was added as a file channel")
+	}
+	if !r.peer.addFileChannel(newChannel(fileChannelLabel(1))) {
+		t.Fatal("file channel 1 was not added")
+	}
+	first := r.peer.channelsByIndex[1].Channel
+	if r.peer.addFileChannel(newChannel(fileChannelLabel(1))) {
+		t.Error("duplicate file channel was added")
+	}
+	if r.peer.channelsByIndex[1].Channel != first {
+		t.Error("duplicate file channel replaced the first")
+	}
+	if len(r.peer.channelsByIndex) != 1 {
+		t.Errorf("got %d file channels, want 1", len(r.peer.channelsByIndex))
+	}
+}
+
+func TestAddMetadataQueuedChannels(t *testing.T) {
+	r, newChannel := newTestReceiver(t)
+	r.peer.senderDevice = &webrtc.DeviceInfoPayload{QueuedChannels: true}
+	metas := testMetadata(4)
+
+	// Only the later files' channels are open when the list arrives
+	r.peer.addFileChannel(newChannel(fileChannelLabel(2)))
+	r.peer.addFileChannel(newChannel(fileChannelLabel(1)))
+
+	if err := r.addMetadata(metas); err != nil {
+		t.Fatal(err)
+	}
+	assertMapping(t, r, metas)
+	if r.peer.fileChannels[0].Channel != nil || r.peer.fileChannels[3].Channel != nil {
+		t.Error("files without a channel yet were given one")
+	}
+
+	// The rest arrive after the file list and take their files' places
+	r.peer.addFileChannel(newChannel(fileChannelLabel(3)))
+	r.peer.addFileChannel(newChannel(fileChannelLabel(0)))
+	assertMapping(t, r, metas)
+	for i, fc := range r.peer.fileChannels {
+		if fc.Channel == nil {
+			t.Errorf("file channel %d has no data channel", i)
+		}
+	}
+}
@@ -1,14 +1,17 @@
 package multichannel
 
 import (
-	"fmt"
-	"os"
+	"context"
+	"errors"
+	"io"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/BioHazard786/Warpdrop/cli/internal/config"
 	"github.com/BioHazard786/Warpdrop/cli/internal/files"
+	"github.com/BioHazard786/Warpdrop/cli/internal/history"
 	"github.com/BioHazard786/Warpdrop/cli/internal/signaling"
 	"github.com/BioHazard786/Warpdrop/cli/internal/transfer"
 	"github.com/BioHazard786/Warpdrop/cli/internal/ui"
@@ -16,19 +19,26 @@ import (
 	pion "github.com/pion/webrtc/v4"
 )
 
-func NewSenderSession(client *signaling.Client, handler *signaling.Handler, cfg *config.Config, fileInfos []*files.FileInfo, peerInfo *signaling.PeerInfo) (*SenderSession, error) {
+func NewSenderSession(client signaling.Transport, handler *signaling.Handler, cfg *config.Config, fileInfos []*files.FileInfo, peerInfo *signaling.PeerInfo) (*SenderSession, error) {
 	peer, err := newSenderPeer(client, cfg, fileInfos)
 	if err != nil {
 		return nil, err
 	}
 
-	return &SenderSession{
+	session := &SenderSession{
 		peer:            peer,
 		signalingClient: client,
 		handler:         handler,
 		config:          cfg,
 		peerInfo:        peerInfo,
-	}, nil
+		attempts:        make(map[int]int),
+		failed:          make(map[int]bool),
+		handover:        make(chan struct{}),
+	}
+	peer.onReceiveProgress = session.handleReceiveProgress
+	peer.onChecksumMismatch = session.handleChecksumMismatch
+
+	return session, nil
 }
 
 func (s *SenderSession) SetProgressUI() {
@@ -38,20 +48,31 @@ func (s *SenderSession) SetProgressUI() {
 		fileNames[i] = f.FileInfo.Name
 		fileSizes[i] = int64(f.FileInfo.Size)
 	}
-	s.progress = transfer.NewProgressTracker(fileNames, fileSizes)
+	s.progress = transfer.NewProgressTracker(fileNames, fileSizes, s.options.Out())
 }
 
 func (s *SenderSession) SetOptions(opts *transfer.TransferOptions) {
 	s.options = opts
+	// One limiter is shared by every file so the cap applies to the whole transfer
+	if opts != nil {
+		s.limiter = transfer.NewRateLimiter(opts.RateLimit)
+		s.stats = opts.StatsRecorder()
+	}
+	if opts != nil && opts.Password != "" {
+		s.peer.auth = transfer.NewPasswordKey(opts.Password)
+	}
+	if opts != nil {
+		s.peer.compress = opts.Compress
+	}
 }
 
-func newSenderPeer(client *signaling.Client, cfg *config.Config, fileInfos []*files.FileInfo) (*SenderPeer, error) {
+func newSenderPeer(client signaling.Transport, cfg *config.Config, fileInfos []*files.FileInfo) (*SenderPeer, error) {
 	pc, err := transfer.NewPeerConnection(cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	cc, err := transfer.CreateDataChannel(pc, "control")
+	cc, err := transfer.CreateDataChannel(pc, controlChannelLabel, transfer.OrderedChannel)
 	if err != nil {
 		pc.Close()
 		return nil, err
@@ -59,52 +80,68 @@ func newSenderPeer(client *signaling.Client, cfg *config.Config, fileInfos []*fi
 
 	fileChannels := make([]*SenderFileChannel, len(fileInfos))
 	for i, fileInfo := range fileInfos {
-		fc, err := createFileChannel(pc, fileInfo, i)
-		if err != nil {
+		fileChannels[i] = &SenderFileChannel{FileInfo: fileInfo, Index: i}
+	}
+
+	// Only the first files get a channel with the offer; the others are
+	// opened as those finish
+	upFront := min(len(fileChannels), cfg.MaxChannels)
+	for _, fc := range fileChannels[:upFront] {
+		if err := createFileChannel(pc, fc); err != nil {
 			pc.Close()
 			return nil, err
 		}
-		fileChannels[i] = fc
 	}
 
 	peer := &SenderPeer{
 		connection:         pc,
 		controlChannel:     cc,
 		fileChannels:       fileChannels,
+		upFront:            upFront,
 		deviceInfoReceived: make(chan webrtc.DeviceInfoPayload, 1),
-		receiverReady:      make(chan struct{}, 1),
-		declineReceived:    make(chan struct{}, 1),
-		downloadingDone:    make(chan struct{}, 1),
+		receiverReady:      make(chan webrtc.ReadyToReceivePayload, 1),
+		declineReceived:    make(chan string, 1),
+		filesSkipped:       make(chan []string, 1),
+		retryRequested:     make(chan []string, 1),
+		downloadingDone:    make(chan struct{}),
+		authFailed:         make(chan struct{}, 1),
+		cancellation:       transfer.NewCancellation(),
+		heartbeat:          transfer.NewHeartbeat(),
 		done:               make(chan struct{}),
 	}
 
-	transfer.SetupICEHandlers(pc, client, peer.done)
+	peer.path = transfer.SetupICEHandlers(pc, client, peer.done)
 	peer.setupControlHandlers()
 	peer.setupFileHandlers()
 	return peer, nil
 }
 
-func createFileChannel(pc *pion.PeerConnection, fileInfo *files.FileInfo, index int) (*SenderFileChannel, error) {
-	dc, err := transfer.CreateDataChannel(pc, fmt.Sprintf("file-transfer-%d", index))
+// createFileChannel gives fc its channel and opens its file
+func createFileChannel(pc *pion.PeerConnection, fc *SenderFileChannel) error {
+	dc, err := transfer.CreateDataChannel(pc, fileChannelLabel(fc.Index), transfer.OrderedChannel)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	file, err := os.Open(fileInfo.Path)
+	file, err := fc.FileInfo.Open()
 	if err != nil {
-		return nil, transfer.NewFileError("open", fileInfo.Name, err)
+		dc.Close()
+		return transfer.NewFileError("open", fc.FileInfo.Name, err)
 	}
 
-	return &SenderFileChannel{
-		Channel:  dc,
-		FileInfo: fileInfo,
-		File:     file,
-		Index:    index,
-	}, nil
+	fc.Channel = dc
+	fc.File = file
+	return nil
 }
 
 func (p *SenderPeer) setupControlHandlers() {
 	p.controlChannel.OnOpen(func() {
+		// Password-protected transfers only reveal the file list once the
+		// receiver has proven it knows the password
+		if p.auth != nil {
+			transfer.SendAuthChallenge(p.controlChannel, p.auth)
+			return
+		}
 		p.sendMetadata()
 	})
 
@@ -113,16 +150,67 @@ func (p *SenderPeer) setupControlHandlers() {
 		if err != nil {
 			return
 		}
+		p.heartbeat.Alive()
+
+		// A receiver that hasn't proven it knows the password hasn't seen
+		// the file list either, so it may not start the transfer
+		if p.auth != nil && !p.authenticated {
+			switch message.Type {
+			case transfer.MessageTypeReadyToReceive, transfer.MessageTypeRetryFiles, transfer.MessageTypeFilesSkipped:
+				return
+			}
+		}
 
 		switch message.Type {
 		case transfer.MessageTypeReadyToReceive:
-			p.receiverReady <- struct{}{}
+			// Older receivers send no payload, which means no compression
+			var ready webrtc.ReadyToReceivePayload
+			message.DecodePayload(&ready)
+			p.receiverReady <- ready
 
 		case transfer.MessageTypeDeclineReceive:
-			p.declineReceived <- struct{}{}
+			// Declines from older peers carry no payload
+			var decline webrtc.DeclinePayload
+			message.DecodePayload(&decline)
+			p.declineReceived <- decline.Reason
+
+		case transfer.MessageTypeFilesSkipped:
+			var skipped webrtc.FilesSkippedPayload
+			if err := message.DecodePayload(&skipped); err != nil {
+				return
+			}
+			p.filesSkipped <- skipped.FileNames
+
+		case transfer.MessageTypeRetryFiles:
+			var retry webrtc.RetryFilesPayload
+			if err := message.DecodePayload(&retry); err != nil {
+				return
+			}
+			p.retryRequested <- retry.FileNames
+
+		case transfer.MessageTypeAuthResponse:
+			var response webrtc.AuthResponsePayload
+			if err := message.DecodePayload(&response); err != nil || p.auth == nil {
+				return
+			}
+			if !p.auth.CheckProof(response.Proof) {
+				p.authFailed <- struct{}{}
+				return
+			}
+			p.authenticated = true
+			p.sendMetadata()
 
 		case transfer.MessageTypeDownloadingDone:
-			p.downloadingDone <- struct{}{}
+			p.downloadingOnce.Do(func() { close(p.downloadingDone) })
+
+		case transfer.MessageTypeCancelled, transfer.MessageTypeCancelAck:
+			p.cancellation.HandleMessage(p.controlChannel, message.Type)
+
+		case transfer.MessageTypePing, transfer.MessageTypePong:
+			p.heartbeat.HandleMessage(p.controlChannel, message.Type)
+
+		case transfer.MessageTypeTransferError:
+			p.cancellation.HandleError(message)
 
 		case transfer.MessageTypeDeviceInfo:
 			var deviceInfo webrtc.DeviceInfoPayload
@@ -130,33 +218,93 @@ func (p *SenderPeer) setupControlHandlers() {
 				return
 			}
 			p.deviceInfoReceived <- deviceInfo
+
+		case transfer.MessageTypeReceiveProgress:
+			var progress webrtc.ReceiveProgressPayload
+			if err := message.DecodePayload(&progress); err != nil {
+				return
+			}
+			if p.onReceiveProgress != nil {
+				p.onReceiveProgress(progress)
+			}
+
+		case transfer.MessageTypeChecksumMismatch:
+			var mismatch webrtc.ChecksumMismatchPayload
+			if err := message.DecodePayload(&mismatch); err != nil {
+				return
+			}
+			if p.onChecksumMismatch != nil {
+				p.onChecksumMismatch(mismatch)
+			}
 		}
 	})
 }
 
 func (p *SenderPeer) sendMetadata() {
+	transfer.SendDeviceInfo(p.controlChannel)
+
 	metadata := make([]webrtc.FileMetadata, len(p.fileChannels))
 	for i, fc := range p.fileChannels {
-		metadata[i] = webrtc.FileMetadata{
-			Name: fc.FileInfo.Name,
-			Size: uint64(fc.FileInfo.Size),
-			Type: fc.FileInfo.Type,
-		}
+		metadata[i] = fileMetadata(fc.FileInfo)
+		metadata[i].Compression = p.offeredCompression(fc.FileInfo)
 	}
 	transfer.SendFilesMetadata(p.controlChannel, metadata)
 }
 
+// offeredCompression returns the codec offered for a file, if any
+func (p *SenderPeer) offeredCompression(info *files.FileInfo) string {
+	if p.compress && transfer.ShouldCompress(info.Type) {
+		return transfer.CompressionZstd
+	}
+	return ""
+}
+
+func fileMetadata(info *files.FileInfo) webrtc.FileMetadata {
+	return webrtc.FileMetadata{
+		Name:    info.Name,
+		Size:    uint64(info.Size),
+		Type:    info.Type,
+		RelPath: info.RelPath,
+		ModTime: info.ModTime.UnixMilli(),
+		Mode:    uint32(info.Mode),
+	}
+}
+
 func (p *SenderPeer) setupFileHandlers() {
-	for _, fc := range p.fileChannels {
+	for _, fc := range p.fileChannels[:p.upFront] {
 		fc.Channel.OnOpen(func() {
 			atomic.AddInt32(&p.channelsReady, 1)
 		})
 	}
 }
 
-func (s *SenderSession) Start() error {
-	stopSpinner := ui.RunConnectionSpinner("Establishing WebRTC connection...")
-	defer stopSpinner()
+// openAll gives every file its channel up front, for receivers that expect
+// them all before the file list
+func (p *SenderPeer) openAll() error {
+	for _, fc := range p.fileChannels[p.upFront:] {
+		if err := createFileChannel(p.connection, fc); err != nil {
+			return err
+		}
+		fc.Channel.OnOpen(func() {
+			atomic.AddInt32(&p.channelsReady, 1)
+		})
+	}
+	p.upFront = len(p.fileChannels)
+	return nil
+}
+
+func (s *SenderSession) Start(ctx context.Context) error {
+	if s.config.Unordered {
+		s.options.Out().PrintWarning("--unordered is ignored: each file has its own channel, which is kept in order")
+	}
+
+	spinner := s.options.Out().NewConnectionSpinner("Establishing WebRTC connection...")
+	spinner.Start()
+	defer spinner.Stop()
+
+	// A NAT probe, if asked for, runs while the connection is set up
+	s.natCheck = transfer.StartNATCheck(s.options, s.config, s.signalingClient, s.peerInfo, spinner.UpdateMessage)
+	defer s.natCheck.Stop()
 
 	go s.listenForSignals()
 
@@ -175,14 +323,24 @@ func (s *SenderSession) Start() error {
 
 	select {
 	case deviceInfo := <-s.peer.deviceInfoReceived:
-		stopSpinner()
-		fmt.Printf("🖥️  Receiver device: %s v%s\n", deviceInfo.DeviceName, deviceInfo.DeviceVersion)
+		spinner.Stop()
+		s.options.Out().Printf("🖥️  Receiver device: %s\n", transfer.DeviceLabel(deviceInfo))
+		s.peer.fallback = deviceInfo.Fallback
+		s.peer.controls = deviceInfo.Controls
+		if !deviceInfo.QueuedChannels {
+			if err := s.peer.openAll(); err != nil {
+				return err
+			}
+		}
 
 	case errMsg := <-s.handler.Error:
 		return transfer.WrapError("start", transfer.ErrSignalingError, errMsg)
 
+	case <-ctx.Done():
+		return transfer.ErrTransferCancelled
+
 	case <-time.After(time.Duration(transfer.SignalTimeout) * time.Second):
-		return transfer.WrapError("start", transfer.ErrTimeout, "waiting for answer")
+		return transfer.ConnectTimeoutError(s.config, "waiting for answer")
 	}
 
 	return nil
@@ -200,77 +358,155 @@ func (s *SenderSession) listenForSignals() {
 			}
 			transfer.HandleSDPSignal(s.peer.connection, sig)
 			transfer.HandleICECandidate(s.peer.connection, sig)
+			s.natCheck.HandleSignal(sig)
 
 		case <-s.peer.done:
 			return
+		case <-s.handover:
+			return
 		}
 	}
 }
 
-func (s *SenderSession) Transfer() error {
-	stopSpinner := ui.RunSpinner("Waiting for receiver to accept...")
+func (s *SenderSession) Transfer(ctx context.Context) error {
+	ctx, cancel := s.peer.cancellation.Watch(ctx)
+	defer cancel()
+
+	// A receiver that goes quiet cancels the send with the heartbeat error
+	// as the cause, leaving ctx to tell a cancelled transfer apart
+	sendCtx, stop := s.peer.heartbeat.Watch(ctx, s.peer.controlChannel, transfer.HeartbeatTimeout(s.options))
+	defer stop(nil)
+
+	stopSpinner := s.options.Out().RunSpinner("Waiting for receiver to accept...")
 	defer stopSpinner()
 
+	if s.options != nil && s.options.ConfirmProgress {
+		transfer.SendSimpleMessage(s.peer.controlChannel, transfer.MessageTypeProgressRequest)
+	}
+
 	select {
-	case <-s.peer.receiverReady:
+	case ready := <-s.peer.receiverReady:
 		stopSpinner()
-	case <-s.peer.declineReceived:
-		return transfer.ErrTransferDeclined
+		s.sending = true
+		s.compression = ready.Compression
+	case reason := <-s.peer.declineReceived:
+		return transfer.DeclinedError(reason)
+	case <-s.peer.authFailed:
+		return transfer.WrapError("authenticate", transfer.ErrWrongPassword, "receiver entered the wrong password")
 	case <-s.handler.PeerLeft:
 		return transfer.ErrPeerDisconnected
 	case <-s.handler.Error:
 		return transfer.ErrSignalingError
+	case <-sendCtx.Done():
+		return s.stopped(ctx, transfer.HeartbeatError(sendCtx, sendCtx.Err()))
 	}
 
-	if err := transfer.WaitForChannels(&s.peer.channelsReady, len(s.peer.fileChannels), s.handler.PeerLeft); err != nil {
+	if err := transfer.WaitForChannels(&s.peer.channelsReady, s.peer.upFront, s.handler.PeerLeft); err != nil {
+		if errors.Is(err, transfer.ErrTimeout) && s.peer.fallback {
+			return s.fallBack(err)
+		}
 		return err
 	}
 
-	fmt.Printf("\n%s Sending files...\n\n", ui.IconSend)
+	// The receiver names files it filtered out before ready_to_receive
+	skipped := make(map[string]bool)
+	select {
+	case names := <-s.peer.filesSkipped:
+		for _, name := range names {
+			skipped[name] = true
+		}
+	default:
+	}
+
+	s.options.Out().Printf("\n%s Sending files...\n\n", ui.IconSend)
 
 	s.progress.Start()
 	filesCount := len(s.peer.fileChannels)
 	errChan := make(chan error, 1)
 
-	go func() {
-		defer s.progress.Program.Quit()
-
-		wg := &sync.WaitGroup{}
-		wg.Add(filesCount)
+	// Each file can be cancelled on its own without ending the transfer
+	fileCtxs := make([]context.Context, filesCount)
+	fileCancels := make([]context.CancelFunc, filesCount)
+	for i := range filesCount {
+		fileCtxs[i], fileCancels[i] = context.WithCancel(sendCtx)
+		defer fileCancels[i]()
+	}
 
-		// We need to capture the first error that occurs in file senders
-		// using atomic value or a channel?
-		// Since sendFile returns error, we can use an error channel and a once to close it?
-		// Or strictly cancel context?
-		// For simplicity, we just log/track if any failed.
+	s.pause = transfer.NewPauseGate()
+	controls := &ui.TransferControls{
+		TogglePause: func() bool {
+			paused := s.pause.Toggle()
+			if s.peer.controls {
+				transfer.SendPause(s.peer.controlChannel, paused)
+			}
+			return paused
+		},
+	}
+	// Receivers that don't know file_cancelled would wait for the file
+	if s.peer.controls {
+		controls.CancelFile = func(index int) {
+			if index >= 0 && index < filesCount {
+				fileCancels[index]()
+			}
+		}
+	}
+	stopControls := s.options.Out().SetTransferControls(controls)
+	defer stopControls()
 
-		var firstErr error
-		var errOnce sync.Once
+	go func() {
+		defer s.progress.Quit()
 
+		queue := make([]*SenderFileChannel, 0, filesCount)
 		for _, fc := range s.peer.fileChannels {
-			go func(fc *SenderFileChannel) {
-				if err := s.sendFile(fc, wg); err != nil {
-					errOnce.Do(func() {
-						firstErr = err
-					})
-				}
-			}(fc)
+			if skipped[fc.FileInfo.Name] {
+				fc.close()
+				s.progress.Skip(fc.Index, "skipped by receiver")
+				continue
+			}
+			queue = append(queue, fc)
 		}
 
-		wg.Wait()
-
-		if firstErr != nil {
-			errChan <- firstErr
+		// Files without a channel yet get one once an earlier file is done
+		err := s.sendQueued(sendCtx, fileCtxs, queue, func(fc *SenderFileChannel) error {
+			if fc.Channel != nil {
+				return nil
+			}
+			return s.peer.openFileChannel(fc, fileChannelLabel(fc.Index))
+		})
+		if err != nil {
+			errChan <- err
 			return
 		}
 
-		select {
-		case <-s.peer.downloadingDone:
-		case <-s.handler.PeerLeft:
-			errChan <- transfer.ErrPeerDisconnected
-			return
-		case <-time.After(10 * time.Second):
-			// Log warning, but don't fail session
+		// Running out of time isn't an error, since every chunk was sent
+		var size uint64
+		for _, fc := range s.peer.fileChannels {
+			size += uint64(fc.FileInfo.Size)
+		}
+		confirmTimeout := transfer.ConfirmTimeout(s.options, size)
+
+		// The receiver either confirms every file or names the ones it
+		// lost, which are sent again before waiting once more
+		for {
+			select {
+			case <-s.peer.downloadingDone:
+				s.completeFailed()
+			case names := <-s.peer.retryRequested:
+				if err := s.retryFiles(sendCtx, fileCtxs, names); err != nil {
+					errChan <- err
+					return
+				}
+				continue
+			case <-s.handler.PeerLeft:
+				errChan <- transfer.ErrPeerDisconnected
+				return
+			case <-sendCtx.Done():
+				errChan <- sendCtx.Err()
+				return
+			case <-transfer.StallTimer(confirmTimeout):
+				s.unconfirmed = confirmTimeout
+			}
+			break
 		}
 
 		errChan <- nil
@@ -281,63 +517,357 @@ func (s *SenderSession) Transfer() error {
 	}
 
 	if err := <-errChan; err != nil {
+		return s.stopped(ctx, transfer.HeartbeatError(sendCtx, err))
+	}
+
+	if err := s.checksumError(); err != nil {
 		return err
 	}
 
-	var totalSize int64
+	transfer.RenderSummary(history.DirectionSent, s.progress, s.peerInfo.ClientType, s.peer.path, s.options)
+	transfer.WriteStats(s.stats, s.options.Out())
+	if s.unconfirmed > 0 {
+		transfer.WarnUnconfirmed(s.options.Out(), s.unconfirmed)
+	}
+	return nil
+}
+
+func (s *SenderSession) handleReceiveProgress(payload webrtc.ReceiveProgressPayload) {
+	if s.progress == nil {
+		return
+	}
 	for _, fc := range s.peer.fileChannels {
-		totalSize += fc.FileInfo.Size
+		if fc.FileInfo.Name == payload.FileName {
+			s.progress.Confirm(fc.Index, int64(payload.Received))
+			return
+		}
 	}
+}
 
-	transfer.RenderSummary(filesCount, totalSize, s.progress.Duration())
-	return nil
+// stopped reports why the transfer ended with err, telling the receiver
+// whether it was cancelled or failed here. No final ack will follow either,
+// so Close skips it.
+func (s *SenderSession) stopped(ctx context.Context, err error) error {
+	s.sending = false
+	if cancelErr := s.peer.cancellation.Resolve(ctx, s.peer.controlChannel, transfer.ErrReceiverCancelled); cancelErr != nil {
+		return cancelErr
+	}
+	// The receiver may be waiting to be sent lost files again, so make sure
+	// it hears about the failure before the connection closes
+	transfer.SendTransferError(s.peer.controlChannel, err)
+	transfer.DrainChannel(s.peer.controlChannel, time.Duration(transfer.DrainTimeout)*time.Second)
+	return err
 }
 
-func (s *SenderSession) sendFile(fc *SenderFileChannel, wg *sync.WaitGroup) error {
+// sendFile sends one file on its channel. fileCtx is cancelled when the user
+// stops just this file, which skips it instead of failing the transfer.
+func (s *SenderSession) sendFile(ctx, fileCtx context.Context, fc *SenderFileChannel, wg *sync.WaitGroup) error {
 	defer wg.Done()
 	defer fc.File.Close()
 
-	sender := transfer.NewMultiChannelFileSender(fc.Channel)
+	channels := min(len(s.peer.fileChannels), s.config.MaxChannels)
+	sender := transfer.NewMultiChannelFileSender(fc.Channel, s.config.Chunk, channels)
+	sender.SetContext(fileCtx)
+	sender.SetLimiter(s.limiter)
+	sender.SetStats(s.stats)
+	sender.SetCipher(s.peer.auth.Cipher())
+	if codec := s.peer.offeredCompression(fc.FileInfo); codec != "" && codec == s.compression {
+		sender.SetCompression(codec)
+	}
+	hasher := transfer.NewHasher()
 
-	return sender.SendChunks(
-		fc.File,
+	var failure string
+	err := sender.SendChunks(
+		transfer.ContextReader(fileCtx, s.pause.Reader(fileCtx, io.TeeReader(fc.File, hasher))),
 		func(sentBytes int64) {
 			atomic.StoreInt64(&fc.SentBytes, sentBytes)
 			s.progress.Update(fc.Index, sentBytes)
 		},
 		func() { s.progress.Complete(fc.Index) },
-		func(msg string) { s.progress.Error(fc.Index, msg) },
+		func(msg string) { failure = msg },
 	)
+	if err != nil {
+		if ctx.Err() == nil && fileCtx.Err() != nil {
+			s.progress.Error(fc.Index, failure)
+			fc.Channel.Close()
+			return transfer.SendFileCancelled(s.peer.controlChannel, fc.FileInfo.Name)
+		}
+		// Closing the channel tells the receiver the file was lost, and
+		// it asks for it again once the other files are done
+		if ctx.Err() == nil && transfer.Retryable(err) && s.attempts[fc.Index] < transfer.RetryLimit(s.options) {
+			fc.Channel.Close()
+			s.setFailed(fc.Index, true)
+			return nil
+		}
+		s.progress.Error(fc.Index, failure)
+		return err
+	}
+
+	// Every chunk has been handed over, and closing the channel only takes
+	// effect once they have arrived, so its stream is free for the next file
+	fc.Channel.Close()
+
+	// The receiver can finish on the last byte and close the channel before
+	// the checksum goes out, and no longer needs it by then
+	err = transfer.SendFileChecksum(s.peer.controlChannel, fileMetadata(fc.FileInfo), transfer.FormatChecksum(hasher))
+	if err != nil && s.peer.receiverDone() {
+		return nil
+	}
+	return err
+}
+
+// sendQueued sends the queued files, no more than MaxChannels at a time,
+// calling open to give each its channel before it starts. It stops starting
+// files once one fails and returns the first error.
+func (s *SenderSession) sendQueued(ctx context.Context, fileCtxs []context.Context, queue []*SenderFileChannel, open func(*SenderFileChannel) error) error {
+	wg := &sync.WaitGroup{}
+	slots := make(chan struct{}, s.config.MaxChannels)
+	failed := make(chan struct{})
+
+	var firstErr error
+	var errOnce sync.Once
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			close(failed)
+		})
+	}
+
+start:
+	for _, fc := range queue {
+		select {
+		case slots <- struct{}{}:
+		case <-failed:
+			break start
+		case <-ctx.Done():
+			fail(ctx.Err())
+			break start
+		}
+
+		if err := open(fc); err != nil {
+			fail(err)
+			break
+		}
+
+		wg.Add(1)
+		go func(fc *SenderFileChannel) {
+			defer func() { <-slots }()
+			if err := s.sendFile(ctx, fileCtxs[fc.Index], fc, wg); err != nil {
+				fail(err)
+			}
+		}(fc)
+	}
+
+	wg.Wait()
+	return firstErr
+}
+
+// retryFiles sends the files the receiver lost again, each on a fresh
+// channel, and returns once they have all been sent
+func (s *SenderSession) retryFiles(ctx context.Context, fileCtxs []context.Context, names []string) error {
+	var retries []*SenderFileChannel
+	for _, name := range names {
+		fc := s.peer.fileChannel(name)
+		if fc == nil {
+			continue
+		}
+		if s.attempts[fc.Index] >= transfer.RetryLimit(s.options) {
+			s.progress.Error(fc.Index, "failed")
+			return transfer.WrapError("send", transfer.ErrRetriesExhausted, name)
+		}
+		s.attempts[fc.Index]++
+		retries = append(retries, fc)
+	}
+
+	return s.sendQueued(ctx, fileCtxs, retries, func(fc *SenderFileChannel) error {
+		if err := s.peer.openFileChannel(fc, retryChannelLabel(fc.Index, s.attempts[fc.Index])); err != nil {
+			return err
+		}
+		s.setFailed(fc.Index, false)
+		s.progress.Retry(fc.Index, s.attempts[fc.Index])
+		return nil
+	})
+}
+
+// setFailed records whether the file at index is waiting to be retried
+func (s *SenderSession) setFailed(index int, failed bool) {
+	s.failedMu.Lock()
+	defer s.failedMu.Unlock()
+	if failed {
+		s.failed[index] = true
+	} else {
+		delete(s.failed, index)
+	}
 }
 
+// completeFailed marks files whose channel failed here complete once the
+// receiver has confirmed it got everything anyway
+func (s *SenderSession) completeFailed() {
+	s.failedMu.Lock()
+	defer s.failedMu.Unlock()
+	for index := range s.failed {
+		s.progress.Complete(index)
+	}
+}
+
+// fileChannel returns the file sent under name, or nil
+func (p *SenderPeer) fileChannel(name string) *SenderFileChannel {
+	for _, fc := range p.fileChannels {
+		if fc.FileInfo.Name == name {
+			return fc
+		}
+	}
+	return nil
+}
+
+// openFileChannel gives fc a fresh channel labelled label, once it is open,
+// and opens the file from the start. Files waiting for a free channel and
+// files being retried get theirs this way.
+func (p *SenderPeer) openFileChannel(fc *SenderFileChannel, label string) error {
+	file, err := fc.FileInfo.Open()
+	if err != nil {
+		return transfer.NewFileError("open", fc.FileInfo.Name, err)
+	}
+
+	dc, err := transfer.CreateDataChannel(p.connection, label, transfer.OrderedChannel)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	opened := make(chan struct{})
+	dc.OnOpen(func() { close(opened) })
+	select {
+	case <-opened:
+	case <-time.After(time.Duration(transfer.SignalTimeout) * time.Second):
+		dc.Close()
+		file.Close()
+		return transfer.WrapError("open channel", transfer.ErrChannelNotOpen, fc.FileInfo.Name)
+	}
+
+	fc.Channel = dc
+	fc.File = file
+	atomic.StoreInt64(&fc.SentBytes, 0)
+	return nil
+}
+
+func (s *SenderSession) handleChecksumMismatch(payload webrtc.ChecksumMismatchPayload) {
+	s.mismatchMu.Lock()
+	s.mismatched = append(s.mismatched, payload.FileName)
+	s.mismatchMu.Unlock()
+
+	if s.progress == nil {
+		return
+	}
+	for _, fc := range s.peer.fileChannels {
+		if fc.FileInfo.Name == payload.FileName {
+			s.progress.Error(fc.Index, "checksum mismatch")
+			return
+		}
+	}
+}
+
+// checksumError reports files the receiver said failed verification
+func (s *SenderSession) checksumError() error {
+	s.mismatchMu.Lock()
+	defer s.mismatchMu.Unlock()
+	if len(s.mismatched) == 0 {
+		return nil
+	}
+	return transfer.WrapError("transfer", transfer.ErrChecksumMismatch, strings.Join(s.mismatched, ", "))
+}
+
+// fallBack asks the receiver to start over on a single channel and stops
+// listening for signals, leaving them to the next session. It returns err
+// when the receiver can't be asked.
+func (s *SenderSession) fallBack(err error) error {
+	if transfer.SendSimpleMessage(s.peer.controlChannel, transfer.MessageTypeFallback) != nil {
+		return err
+	}
+	s.options.Out().PrintWarning("File channels did not open, retrying over a single channel")
+	s.sending = false
+	close(s.handover)
+	return transfer.ErrFallback
+}
+
+// handedOver reports whether the transfer fell back to a single channel
+func (s *SenderSession) handedOver() bool {
+	select {
+	case <-s.handover:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close flushes pending data for up to CloseTimeout, then tears the
+// connection down.
+// After a fallback the signaling connection is left open for the next
+// session.
+// It returns ErrNoFinalAck when files were sent and Transfer never heard the
+// receiver confirm it has them.
 func (s *SenderSession) Close() error {
+	confirmed := true
 	if s.peer != nil {
+		if s.sending {
+			confirmed = s.peer.flush()
+		}
 		s.peer.close()
 	}
-	time.Sleep(100 * time.Millisecond)
 
+	if s.handedOver() {
+		return nil
+	}
 	if s.signalingClient != nil {
 		s.signalingClient.Close()
 	}
 	if s.handler != nil {
 		s.handler.Close()
 	}
+
+	if !confirmed {
+		return transfer.ErrNoFinalAck
+	}
 	return nil
 }
 
+// flush waits for queued data to reach the receiver and reports whether it
+// confirmed having every file
+func (p *SenderPeer) flush() bool {
+	timeout := time.Duration(transfer.CloseTimeout) * time.Second
+	for _, fc := range p.fileChannels {
+		transfer.DrainChannel(fc.Channel, timeout)
+	}
+	transfer.DrainChannel(p.controlChannel, timeout)
+	return p.receiverDone()
+}
+
+// receiverDone reports whether the receiver has confirmed it has every file
+func (p *SenderPeer) receiverDone() bool {
+	select {
+	case <-p.downloadingDone:
+		return true
+	default:
+		return false
+	}
+}
+
 func (p *SenderPeer) close() error {
 	if p.controlChannel != nil {
 		p.controlChannel.Close()
 	}
 	for _, fc := range p.fileChannels {
-		if fc != nil {
-			if fc.Channel != nil {
-				fc.Channel.Close()
-			}
-			if fc.File != nil {
-				fc.File.Close()
-			}
-		}
+		fc.close()
 	}
 	return p.connection.Close()
 }
+
+// close closes the file's channel and the file, if it has them
+func (fc *SenderFileChannel) close() {
+	if fc.Channel != nil {
+		fc.Channel.Close()
+	}
+	if fc.File != nil {
+		fc.File.Close()
+	}
+}
@@ -1,7 +1,8 @@
 package multichannel
 
 import (
-	"os"
+	"sync"
+	"time"
 
 	"github.com/BioHazard786/Warpdrop/cli/internal/config"
 	"github.com/BioHazard786/Warpdrop/cli/internal/files"
@@ -13,12 +14,35 @@ import (
 
 type SenderSession struct {
 	peer            *SenderPeer
-	signalingClient *signaling.Client
+	signalingClient signaling.Transport
 	handler         *signaling.Handler
 	config          *config.Config
 	peerInfo        *signaling.PeerInfo
 	progress        *transfer.ProgressTracker
 	options         *transfer.TransferOptions
+	natCheck        *transfer.NATCheck
+	limiter         *transfer.RateLimiter
+	stats           *transfer.StatsRecorder
+	pause           *transfer.PauseGate
+	sending         bool
+	compression     string
+	mismatchMu      sync.Mutex
+	mismatched      []string
+
+	// unconfirmed is how long the sender waited for downloading_done
+	// before giving up, zero when it arrived
+	unconfirmed time.Duration
+
+	// attempts counts the retries of each file, and failed holds files
+	// whose channel failed here, which wait for the receiver to ask for
+	// them again
+	attempts map[int]int
+	failedMu sync.Mutex
+	failed   map[int]bool
+
+	// handover is closed when the transfer falls back to a single
+	// channel, leaving the signaling connection to the next session
+	handover chan struct{}
 }
 
 type SenderPeer struct {
@@ -27,43 +51,98 @@ type SenderPeer struct {
 	fileChannels       []*SenderFileChannel
 	channelsReady      int32
 	deviceInfoReceived chan webrtc.DeviceInfoPayload
-	receiverReady      chan struct{}
-	declineReceived    chan struct{}
+	receiverReady      chan webrtc.ReadyToReceivePayload
+	declineReceived    chan string
+	filesSkipped       chan []string
+	retryRequested     chan []string
 	downloadingDone    chan struct{}
+	downloadingOnce    sync.Once
 	done               chan struct{}
+	path               *transfer.ConnectionPath
+	onReceiveProgress  func(webrtc.ReceiveProgressPayload)
+	onChecksumMismatch func(webrtc.ChecksumMismatchPayload)
+	auth               *transfer.PasswordKey
+	authFailed         chan struct{}
+	cancellation       *transfer.Cancellation
+	heartbeat          *transfer.Heartbeat
+	compress           bool
+
+	// authenticated is set once the receiver proves it knows the password
+	authenticated bool
+
+	// fallback is set when the receiver can start over on a single
+	// channel if the file channels never open
+	fallback bool
+
+	// upFront is how many file channels are opened before the transfer
+	// starts; the others are opened as earlier files finish
+	upFront int
+
+	// controls is set when the receiver understands pause messages and
+	// file_cancelled
+	controls bool
 }
 
 type SenderFileChannel struct {
 	Channel   *pion.DataChannel
 	FileInfo  *files.FileInfo
-	File      *os.File
+	File      files.File
 	Index     int
 	SentBytes int64
 }
 
 type ReceiverSession struct {
 	peer            *ReceiverPeer
-	signalingClient *signaling.Client
+	signalingClient signaling.Transport
 	handler         *signaling.Handler
 	config          *config.Config
 	peerInfo        *signaling.PeerInfo
 	progress        *transfer.ProgressTracker
 	options         *transfer.TransferOptions
+	natCheck        *transfer.NATCheck
+	verification    *transfer.VerificationResult
+	skipped         map[string]string
+	compression     string
+	handover        chan struct{}
 }
 
 type ReceiverPeer struct {
 	connection       *pion.PeerConnection
 	controlChannel   *pion.DataChannel
 	fileChannels     []*ReceiverFileChannel
+	channelsByIndex  map[int]*ReceiverFileChannel
+	channelsMu       sync.Mutex
 	channelsReady    int32
+	retryChannels    chan *ReceiverFileChannel
 	metadataReceived chan []webrtc.FileMetadata
+	progressReporter *transfer.ProgressReporter
+	checksums        *transfer.ChecksumStore
+	authChallenge    chan webrtc.AuthChallengePayload
+	senderDevice     *webrtc.DeviceInfoPayload
+	cipher           *transfer.Cipher
+	cancellation     *transfer.Cancellation
+	heartbeat        *transfer.Heartbeat
+	pause            *transfer.PeerPause
 	done             chan struct{}
+	path             *transfer.ConnectionPath
+
+	// fallback offers the sender to start over on a single channel, which
+	// it asks for on fallbackRequested
+	fallback          bool
+	fallbackRequested chan struct{}
 }
 
 type ReceiverFileChannel struct {
 	Channel       *pion.DataChannel
 	Metadata      webrtc.FileMetadata
 	chunkReceived chan []byte
+	cancelled     chan struct{}
+	cancelOnce    sync.Once
+	attached      chan struct{}
 	Index         int
 	ReceivedBytes int64
+
+	// attempt is the retry the channel was opened for, zero for the
+	// file's first channel
+	attempt int
 }
@@ -1,5 +1,7 @@
 package webrtc
 
+import "slices"
+
 type ProtocolType string
 
 const (
@@ -8,8 +10,57 @@ const (
 
 	// SingleChannelProtocol uses one data channel for sequential transfers (web-compatible)
 	SingleChannelProtocol ProtocolType = "single-channel"
+
+	// ServerRelayProtocol sends files through the signaling server instead
+	// of a WebRTC connection. It is only picked when a peer asks for it
+	// with --via-server, by advertising nothing else.
+	ServerRelayProtocol ProtocolType = "server-relay"
 )
 
+// SupportedProtocols lists the protocols this build can run. It is
+// advertised to the peer when creating or joining a room.
+var SupportedProtocols = []ProtocolType{MultiChannelProtocol, SingleChannelProtocol, ServerRelayProtocol}
+
+// protocolRank orders protocols from most to least preferred. Both peers
+// rank the same way, so they pick the same protocol whatever order each
+// advertised in.
+var protocolRank = []ProtocolType{MultiChannelProtocol, SingleChannelProtocol, ServerRelayProtocol}
+
+// Negotiate picks the most preferred protocol both local and remote
+// support, and reports whether they have one in common. Protocols this
+// build doesn't know are ignored.
+func Negotiate(local, remote []ProtocolType) (ProtocolType, bool) {
+	for _, p := range protocolRank {
+		if slices.Contains(local, p) && slices.Contains(remote, p) {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// PeerProtocols returns the protocols a peer advertised. Web peers and
+// older CLIs advertise none, so theirs are guessed from peerType as
+// SelectProtocol does.
+func PeerProtocols(peerType string, advertised []string) []ProtocolType {
+	if len(advertised) == 0 {
+		return []ProtocolType{SelectProtocol(peerType)}
+	}
+	protocols := make([]ProtocolType, len(advertised))
+	for i, p := range advertised {
+		protocols[i] = ProtocolType(p)
+	}
+	return protocols
+}
+
+// ProtocolNames returns protocols as the strings sent to the server
+func ProtocolNames(protocols []ProtocolType) []string {
+	names := make([]string, len(protocols))
+	for i, p := range protocols {
+		names[i] = string(p)
+	}
+	return names
+}
+
 // SelectProtocol determines which protocol to use based on peer capabilities
 func SelectProtocol(peerType string) ProtocolType {
 	// Check if peer is CLI and supports multi-channel
@@ -0,0 +1,61 @@
+package webrtc
+
+import "testing"
+
+func TestNegotiate(t *testing.T) {
+	all := SupportedProtocols
+	tests := []struct {
+		name   string
+		local  []ProtocolType
+		remote []ProtocolType
+		want   ProtocolType
+		ok     bool
+	}{
+		{"both support everything", all, all, MultiChannelProtocol, true},
+		{"order doesn't matter", all, []ProtocolType{ServerRelayProtocol, SingleChannelProtocol, MultiChannelProtocol}, MultiChannelProtocol, true},
+		{"web peer", all, []ProtocolType{SingleChannelProtocol}, SingleChannelProtocol, true},
+		{"via server locally", []ProtocolType{ServerRelayProtocol}, all, ServerRelayProtocol, true},
+		{"via server remotely", all, []ProtocolType{ServerRelayProtocol}, ServerRelayProtocol, true},
+		{"unknown protocols ignored", all, []ProtocolType{"quantum-tunnel", SingleChannelProtocol}, SingleChannelProtocol, true},
+		{"only unknown protocols", all, []ProtocolType{"quantum-tunnel"}, "", false},
+		{"via server against a web peer", []ProtocolType{ServerRelayProtocol}, []ProtocolType{SingleChannelProtocol}, "", false},
+		{"remote offers nothing", all, nil, "", false},
+		{"local offers nothing", nil, all, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := Negotiate(tt.local, tt.remote)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: Negotiate = %q, %v, want %q, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+		// Both sides must come to the same answer
+		if back, _ := Negotiate(tt.remote, tt.local); back != got {
+			t.Errorf("%s: peers disagree: %q and %q", tt.name, got, back)
+		}
+	}
+}
+
+func TestPeerProtocols(t *testing.T) {
+	tests := []struct {
+		peerType   string
+		advertised []string
+		want       []ProtocolType
+	}{
+		{"cli", nil, []ProtocolType{MultiChannelProtocol}},
+		{"web", nil, []ProtocolType{SingleChannelProtocol}},
+		{"cli", []string{"server-relay"}, []ProtocolType{ServerRelayProtocol}},
+		{"web", []string{"single-channel", "new-thing"}, []ProtocolType{SingleChannelProtocol, "new-thing"}},
+	}
+	for _, tt := range tests {
+		got := PeerProtocols(tt.peerType, tt.advertised)
+		if len(got) != len(tt.want) {
+			t.Errorf("PeerProtocols(%q, %v) = %v, want %v", tt.peerType, tt.advertised, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("PeerProtocols(%q, %v) = %v, want %v", tt.peerType, tt.advertised, got, tt.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,172 @@
+// Package serverrelay sends files through the signaling server instead of a
+// WebRTC connection, as a last resort for networks where neither STUN nor
+// TURN gets through. It carries the same messages as the data channel
+// protocols, one file at a time, in the server's data messages.
+package serverrelay
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/signaling"
+	"github.com/BioHazard786/Warpdrop/cli/internal/transfer"
+	"github.com/BioHazard786/Warpdrop/cli/internal/ui"
+	"github.com/BioHazard786/Warpdrop/cli/internal/webrtc"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	// chunkSize keeps a sealed chunk, once framed and base64 encoded,
+	// under signaling.MaxDataPayload
+	chunkSize = 32 * 1024
+
+	// window is how much the sender may have in flight before the receiver
+	// acknowledges it, which keeps the server's queues short
+	window = 8 * chunkSize
+
+	// closeDelay is how long close waits for the last message to be written
+	closeDelay = 200 * time.Millisecond
+)
+
+// errTimeout is returned by next when nothing arrives in time
+var errTimeout = errors.New("timed out")
+
+// peer exchanges messages with the other side through the server
+type peer struct {
+	client  signaling.Transport
+	handler *signaling.Handler
+
+	// cancelled is the error for the other side cancelling, and ended is
+	// set once it cancelled, failed or left, so there is no one to tell
+	// about failures here
+	cancelled error
+	ended     bool
+
+	// paused is set while the sender says it is paused, which holds off
+	// the timeout in next
+	paused bool
+}
+
+func newPeer(client signaling.Transport, handler *signaling.Handler, cancelled error) *peer {
+	return &peer{
+		client:    client,
+		handler:   handler,
+		cancelled: cancelled,
+	}
+}
+
+// send sends a message of msgType to the other side
+func (p *peer) send(msgType string, payload any) error {
+	msg, err := webrtc.NewMessage(msgType, payload)
+	if err != nil {
+		return transfer.NewError("create message", err)
+	}
+	data, err := msgpack.Marshal(msg)
+	if err != nil {
+		return transfer.NewError("marshal message", err)
+	}
+	return signaling.SendData(p.client, data)
+}
+
+// next waits for the next message from the other side. A cancel or failure
+// it reports, the other side leaving or a server error end the wait with an
+// error, as does ctx, or timeout passing unless it is zero or the sender is
+// paused.
+func (p *peer) next(ctx context.Context, timeout time.Duration) (*webrtc.Message, error) {
+	expired := p.stallTimer(timeout)
+	for {
+		select {
+		case data, ok := <-p.handler.Data:
+			if !ok {
+				p.ended = true
+				return nil, transfer.ErrPeerDisconnected
+			}
+			msg, err := transfer.ParseMessage(data)
+			if err != nil {
+				continue
+			}
+
+			switch msg.Type {
+			case transfer.MessageTypeCancelled:
+				p.ended = true
+				return nil, p.cancelled
+			case transfer.MessageTypeTransferError:
+				var payload webrtc.ErrorPayload
+				if err := msg.DecodePayload(&payload); err != nil {
+					continue
+				}
+				p.ended = true
+				return nil, transfer.RemoteError(payload)
+			case transfer.MessageTypePaused, transfer.MessageTypeResumed:
+				p.paused = msg.Type == transfer.MessageTypePaused
+				expired = p.stallTimer(timeout)
+				continue
+			}
+			return msg, nil
+
+		case <-p.handler.PeerLeft:
+			p.ended = true
+			return nil, transfer.ErrPeerDisconnected
+
+		case errMsg := <-p.handler.Error:
+			return nil, transfer.WrapError("relay", transfer.ErrSignalingError, errMsg)
+
+		case <-ctx.Done():
+			return nil, ctx.Err()
+
+		case <-expired:
+			return nil, errTimeout
+		}
+	}
+}
+
+// stallTimer fires once timeout passes, unless the sender is paused
+func (p *peer) stallTimer(timeout time.Duration) <-chan time.Time {
+	if p.paused {
+		return nil
+	}
+	return transfer.StallTimer(timeout)
+}
+
+// stopped tells the other side why the transfer ended with err, unless it
+// is the one that ended it. A local cancel is reported as
+// ErrTransferCancelled.
+func (p *peer) stopped(ctx context.Context, err error) error {
+	if p.ended {
+		return err
+	}
+	if ctx.Err() != nil {
+		p.send(transfer.MessageTypeCancelled, nil)
+		return transfer.ErrTransferCancelled
+	}
+	p.send(transfer.MessageTypeTransferError, transfer.NewErrorPayload(err))
+	return err
+}
+
+// close disconnects from the server, giving the last message sent a moment
+// to go out first
+func (p *peer) close() {
+	if p.client != nil {
+		time.Sleep(closeDelay)
+		p.client.Close()
+	}
+	if p.handler != nil {
+		p.handler.Close()
+	}
+}
+
+// startTimeoutError explains that nothing came through the server while
+// setting up, which is what an older server that drops data messages does
+func startTimeoutError() error {
+	return transfer.WrapError("start", transfer.ErrTimeout, "nothing arrived through the server, which may not relay file data")
+}
+
+// warnViaServer says on out what sending through the server costs
+func warnViaServer(out *ui.Reporter, encrypted bool) {
+	msg := "Sending through the signaling server: this is slow and uses the server's bandwidth"
+	if !encrypted {
+		msg += ", and the server can read the files unless --password is set"
+	}
+	out.PrintWarning(msg)
+}
@@ -0,0 +1,285 @@
+package serverrelay
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/config"
+	"github.com/BioHazard786/Warpdrop/cli/internal/history"
+	"github.com/BioHazard786/Warpdrop/cli/internal/signaling"
+	"github.com/BioHazard786/Warpdrop/cli/internal/transfer"
+	"github.com/BioHazard786/Warpdrop/cli/internal/ui"
+	"github.com/BioHazard786/Warpdrop/cli/internal/webrtc"
+)
+
+type ReceiverSession struct {
+	peer          *peer
+	config        *config.Config
+	peerInfo      *signaling.PeerInfo
+	filesMetadata []webrtc.FileMetadata
+	senderDevice  *webrtc.DeviceInfoPayload
+	cipher        *transfer.Cipher
+	progress      *transfer.ProgressTracker
+	options       *transfer.TransferOptions
+	verification  *transfer.VerificationResult
+	skipped       map[string]string
+}
+
+func NewReceiverSession(client signaling.Transport, handler *signaling.Handler, cfg *config.Config, peerInfo *signaling.PeerInfo) *ReceiverSession {
+	return &ReceiverSession{
+		peer:     newPeer(client, handler, transfer.ErrSenderCancelled),
+		config:   cfg,
+		peerInfo: peerInfo,
+	}
+}
+
+func (r *ReceiverSession) SetProgressUI() {
+	fileNames := make([]string, len(r.filesMetadata))
+	fileSizes := make([]int64, len(r.filesMetadata))
+	for i, f := range r.filesMetadata {
+		fileNames[i] = f.Name
+		fileSizes[i] = int64(f.Size)
+	}
+	r.progress = transfer.NewProgressTracker(fileNames, fileSizes, r.options.Out())
+}
+
+func (r *ReceiverSession) SetOptions(opts *transfer.TransferOptions) {
+	r.options = opts
+	if opts != nil && opts.Verify {
+		r.verification = &transfer.VerificationResult{}
+	}
+}
+
+// Start says hello to the sender through the server and waits for the file
+// list, answering a password challenge on the way
+func (r *ReceiverSession) Start(ctx context.Context) error {
+	warnViaServer(r.options.Out(), r.password() != "")
+
+	spinner := r.options.Out().NewConnectionSpinner("Waiting for sender through the server...")
+	spinner.Start()
+	defer spinner.Stop()
+
+	if err := r.peer.send(transfer.MessageTypeDeviceInfo, transfer.DeviceInfo()); err != nil {
+		return err
+	}
+
+	for {
+		msg, err := r.peer.next(ctx, time.Duration(transfer.SignalTimeout)*time.Second)
+		if err == errTimeout {
+			return startTimeoutError()
+		}
+		if err != nil {
+			return r.peer.stopped(ctx, err)
+		}
+
+		switch msg.Type {
+		case transfer.MessageTypeDeviceInfo:
+			var deviceInfo webrtc.DeviceInfoPayload
+			if err := msg.DecodePayload(&deviceInfo); err != nil {
+				continue
+			}
+			r.senderDevice = &deviceInfo
+
+		case transfer.MessageTypeAuthChallenge:
+			var challenge webrtc.AuthChallengePayload
+			if err := msg.DecodePayload(&challenge); err != nil {
+				continue
+			}
+			spinner.Stop()
+			if err := r.answerChallenge(challenge); err != nil {
+				return err
+			}
+
+		case transfer.MessageTypeFilesMetadata:
+			var metas []webrtc.FileMetadata
+			if err := msg.DecodePayload(&metas); err != nil {
+				return transfer.NewError("decode metadata", transfer.ErrMetadataFailed)
+			}
+			r.filesMetadata = metas
+			return nil
+		}
+	}
+}
+
+// answerChallenge proves the password to the sender, or tells it none or
+// the wrong one was given
+func (r *ReceiverSession) answerChallenge(challenge webrtc.AuthChallengePayload) error {
+	key, err := transfer.CheckAuthChallenge(challenge, r.password(), r.options.Out())
+	if errors.Is(err, transfer.ErrPasswordRequired) || errors.Is(err, transfer.ErrWrongPassword) {
+		r.peer.send(transfer.MessageTypeAuthResponse, webrtc.AuthResponsePayload{})
+		r.peer.ended = true
+	}
+	if err != nil {
+		return err
+	}
+
+	r.cipher = key.Cipher()
+	return r.peer.send(transfer.MessageTypeAuthResponse, webrtc.AuthResponsePayload{Proof: key.Proof()})
+}
+
+func (r *ReceiverSession) password() string {
+	if r.options == nil {
+		return ""
+	}
+	return r.options.Password
+}
+
+func (r *ReceiverSession) Transfer(ctx context.Context) error {
+	metas, skipped := transfer.FilterOffer(r.options, r.filesMetadata)
+	r.skipped = skipped
+	items := transfer.BuildFileTable(r.filesMetadata, skipped)
+	r.options.Out().RenderFileTable(items)
+
+	if err := transfer.CheckOffer(r.options, metas); err != nil {
+		r.peer.send(transfer.MessageTypeDeclineReceive, webrtc.DeclinePayload{Reason: transfer.DeclineReason(err)})
+		return err
+	}
+
+	if ok, reason := transfer.PromptConsent(ctx, transfer.NewConsentOptions(r.options, r.senderDevice, "", metas)); !ok {
+		r.peer.send(transfer.MessageTypeDeclineReceive, webrtc.DeclinePayload{Reason: reason})
+		return transfer.ErrTransferCancelled
+	}
+
+	// The sender has to hear about skipped files before the first request
+	if len(skipped) > 0 {
+		names := transfer.SkippedNames(r.filesMetadata, skipped)
+		if err := r.peer.send(transfer.MessageTypeFilesSkipped, webrtc.FilesSkippedPayload{FileNames: names}); err != nil {
+			return err
+		}
+	}
+
+	r.progress.Start()
+	r.options.Out().Printf("\n%s Receiving files...\n\n", ui.IconReceive)
+
+	errChan := make(chan error, 1)
+
+	go func() {
+		defer r.progress.Quit()
+		errChan <- r.receiveFiles(ctx)
+	}()
+
+	if err := r.progress.Run(); err != nil {
+		return err
+	}
+
+	if err := <-errChan; err != nil {
+		return r.peer.stopped(ctx, err)
+	}
+
+	if r.verification != nil {
+		r.verification.Warn(r.options.Out())
+		if err := r.verification.Err(); err != nil {
+			return err
+		}
+	}
+
+	transfer.RenderSummary(history.DirectionReceived, r.progress, r.peerInfo.ClientType, transfer.ServerPath(), r.options)
+	return nil
+}
+
+// receiveFiles asks for each file it didn't skip in turn, in the order
+// they were offered
+func (r *ReceiverSession) receiveFiles(ctx context.Context) error {
+	for i, meta := range r.filesMetadata {
+		if reason := r.skipped[meta.Name]; reason != "" {
+			r.progress.Skip(i, reason)
+			continue
+		}
+
+		writer, err := transfer.NewFileWriter(meta, i, r.options)
+		if err != nil {
+			return err
+		}
+		writer.SetCipher(r.cipher)
+		writer.SetPreserve(r.options.Preserve)
+		r.progress.Rename(i, writer.DisplayName())
+		r.progress.Saved(i, writer.Location())
+
+		err = r.receiveFile(ctx, writer)
+		writer.Close()
+		if err != nil {
+			return transfer.NewFileError("receive", meta.Name, err)
+		}
+	}
+
+	r.peer.ended = true
+	return r.peer.send(transfer.MessageTypeDownloadingDone, nil)
+}
+
+// receiveFile asks for a file and writes its chunks, acknowledging each one
+// so the sender can send more, until the checksum that follows the last
+func (r *ReceiverSession) receiveFile(ctx context.Context, writer *transfer.FileWriter) error {
+	meta := writer.Metadata
+	if err := r.peer.send(transfer.MessageTypeReadyToReceive, webrtc.ReadyToReceivePayload{FileName: meta.Name}); err != nil {
+		return err
+	}
+
+	stallTimeout := transfer.StallTimeout(r.options)
+	for {
+		msg, err := r.peer.next(ctx, stallTimeout)
+		if err == errTimeout {
+			return transfer.StallError(stallTimeout)
+		}
+		if err != nil {
+			return err
+		}
+
+		switch msg.Type {
+		case transfer.MessageTypeChunk:
+			var chunk webrtc.ChunkPayload
+			if err := msg.DecodePayload(&chunk); err != nil {
+				return transfer.NewError("decode chunk", err)
+			}
+			if chunk.FileName != meta.Name {
+				return transfer.WrapError("receive", transfer.ErrFilenameMismatch, chunk.FileName)
+			}
+			if _, err := writer.WriteAt(chunk.Bytes, chunk.Offset); err != nil {
+				return err
+			}
+
+			r.progress.Update(writer.Index, int64(writer.ReceivedBytes))
+			progress := webrtc.ReceiveProgressPayload{FileName: meta.Name, Received: writer.ReceivedBytes}
+			if err := r.peer.send(transfer.MessageTypeReceiveProgress, progress); err != nil {
+				return err
+			}
+
+		case transfer.MessageTypeFileChecksum:
+			var sent webrtc.FileMetadata
+			if err := msg.DecodePayload(&sent); err != nil || sent.Name != meta.Name {
+				continue
+			}
+			if !writer.IsComplete() {
+				return transfer.WrapError("receive", transfer.ErrInvalidFile, "sender finished before the whole file arrived")
+			}
+			return r.finishFile(writer, sent.Checksum)
+		}
+	}
+}
+
+// finishFile marks a fully written file complete, verifying it against the
+// sender's checksum first when --verify is set
+func (r *ReceiverSession) finishFile(writer *transfer.FileWriter, expected string) error {
+	if r.verification != nil {
+		store := transfer.NewChecksumStore()
+		store.Set(webrtc.FileMetadata{Name: writer.Metadata.Name, Checksum: expected})
+
+		expected, actual, err := transfer.VerifyFile(writer, store)
+		r.verification.Record(writer.Metadata.Name, err)
+		if err == transfer.ErrChecksumMismatch {
+			r.progress.Error(writer.Index, "checksum mismatch")
+			return r.peer.send(transfer.MessageTypeChecksumMismatch, webrtc.ChecksumMismatchPayload{
+				FileName: writer.Metadata.Name,
+				Expected: expected,
+				Actual:   actual,
+			})
+		}
+	}
+	r.progress.Complete(writer.Index)
+	return nil
+}
+
+func (r *ReceiverSession) Close() error {
+	r.peer.close()
+	return nil
+}
@@ -0,0 +1,435 @@
+package serverrelay
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/config"
+	"github.com/BioHazard786/Warpdrop/cli/internal/files"
+	"github.com/BioHazard786/Warpdrop/cli/internal/history"
+	"github.com/BioHazard786/Warpdrop/cli/internal/signaling"
+	"github.com/BioHazard786/Warpdrop/cli/internal/transfer"
+	"github.com/BioHazard786/Warpdrop/cli/internal/ui"
+	"github.com/BioHazard786/Warpdrop/cli/internal/webrtc"
+)
+
+type SenderSession struct {
+	peer     *peer
+	config   *config.Config
+	peerInfo *signaling.PeerInfo
+	files    []*files.FileInfo
+	progress *transfer.ProgressTracker
+	options  *transfer.TransferOptions
+	limiter  *transfer.RateLimiter
+	stats    *transfer.StatsRecorder
+	pause    *transfer.PauseGate
+	auth     *transfer.PasswordKey
+
+	// sending is the file being sent and acked how much of it the receiver
+	// has written; mismatched are the files it said failed verification
+	sending    string
+	acked      uint64
+	mismatched []string
+
+	// unconfirmed is how long the sender waited for downloading_done
+	// before giving up, zero when it arrived
+	unconfirmed time.Duration
+
+	// controls is set when the receiver understands pause messages
+	controls bool
+}
+
+func NewSenderSession(client signaling.Transport, handler *signaling.Handler, cfg *config.Config, fileInfos []*files.FileInfo, peerInfo *signaling.PeerInfo) *SenderSession {
+	return &SenderSession{
+		peer:     newPeer(client, handler, transfer.ErrReceiverCancelled),
+		config:   cfg,
+		peerInfo: peerInfo,
+		files:    fileInfos,
+	}
+}
+
+func (s *SenderSession) SetProgressUI() {
+	fileNames := make([]string, len(s.files))
+	fileSizes := make([]int64, len(s.files))
+	for i, f := range s.files {
+		fileNames[i] = f.Name
+		fileSizes[i] = int64(f.Size)
+	}
+	s.progress = transfer.NewProgressTracker(fileNames, fileSizes, s.options.Out())
+}
+
+func (s *SenderSession) SetOptions(opts *transfer.TransferOptions) {
+	s.options = opts
+	if opts == nil {
+		return
+	}
+	s.limiter = transfer.NewRateLimiter(opts.RateLimit)
+	s.stats = opts.StatsRecorder()
+	if opts.Password != "" {
+		s.auth = transfer.NewPasswordKey(opts.Password)
+	}
+}
+
+// Start waits for the receiver to say hello through the server, then
+// offers the files, behind a password challenge when one is set
+func (s *SenderSession) Start(ctx context.Context) error {
+	warnViaServer(s.options.Out(), s.auth != nil)
+
+	spinner := s.options.Out().NewConnectionSpinner("Waiting for receiver through the server...")
+	spinner.Start()
+	defer spinner.Stop()
+
+	for {
+		msg, err := s.peer.next(ctx, time.Duration(transfer.SignalTimeout)*time.Second)
+		if err == errTimeout {
+			return startTimeoutError()
+		}
+		if err != nil {
+			return s.peer.stopped(ctx, err)
+		}
+		if msg.Type != transfer.MessageTypeDeviceInfo {
+			continue
+		}
+
+		var deviceInfo webrtc.DeviceInfoPayload
+		if err := msg.DecodePayload(&deviceInfo); err != nil {
+			continue
+		}
+		spinner.Stop()
+		s.options.Out().Printf("🖥️  Receiver device: %s\n", transfer.DeviceLabel(deviceInfo))
+		s.controls = deviceInfo.Controls
+		break
+	}
+
+	if err := s.peer.send(transfer.MessageTypeDeviceInfo, transfer.DeviceInfo()); err != nil {
+		return err
+	}
+	// Password-protected transfers only reveal the file list once the
+	// receiver has proven it knows the password
+	if s.auth != nil {
+		return s.peer.send(transfer.MessageTypeAuthChallenge, s.auth.Challenge())
+	}
+	return s.sendMetadata()
+}
+
+func (s *SenderSession) sendMetadata() error {
+	metadata := make([]webrtc.FileMetadata, len(s.files))
+	for i, info := range s.files {
+		metadata[i] = fileMetadata(info)
+	}
+	return s.peer.send(transfer.MessageTypeFilesMetadata, metadata)
+}
+
+func fileMetadata(info *files.FileInfo) webrtc.FileMetadata {
+	return webrtc.FileMetadata{
+		Name:    info.Name,
+		Size:    uint64(info.Size),
+		Type:    info.Type,
+		RelPath: info.RelPath,
+		ModTime: info.ModTime.UnixMilli(),
+		Mode:    uint32(info.Mode),
+	}
+}
+
+func (s *SenderSession) Transfer(ctx context.Context) error {
+	stopSpinner := s.options.Out().RunSpinner("Waiting for receiver to accept...")
+	defer stopSpinner()
+
+	skipped, first, err := s.awaitAccept(ctx)
+	if err != nil {
+		return s.peer.stopped(ctx, err)
+	}
+	stopSpinner()
+
+	s.options.Out().Printf("\n%s Sending files...\n\n", ui.IconSend)
+
+	s.progress.Start()
+
+	s.pause = transfer.NewPauseGate()
+	stopControls := s.options.Out().SetTransferControls(&ui.TransferControls{
+		TogglePause: func() bool {
+			paused := s.pause.Toggle()
+			if s.controls {
+				s.peer.send(transfer.PauseMessageType(paused), nil)
+			}
+			return paused
+		},
+	})
+	defer stopControls()
+
+	errChan := make(chan error, 1)
+
+	go func() {
+		defer s.progress.Quit()
+
+		if err := s.sendFiles(ctx, skipped, first); err != nil {
+			errChan <- err
+			return
+		}
+		errChan <- s.awaitDone(ctx)
+	}()
+
+	// Block until UI is done
+	if err := s.progress.Run(); err != nil {
+		return err
+	}
+
+	if err := <-errChan; err != nil {
+		return s.peer.stopped(ctx, err)
+	}
+
+	if len(s.mismatched) > 0 {
+		return transfer.WrapError("transfer", transfer.ErrChecksumMismatch, strings.Join(s.mismatched, ", "))
+	}
+
+	transfer.RenderSummary(history.DirectionSent, s.progress, s.peerInfo.ClientType, transfer.ServerPath(), s.options)
+	transfer.WriteStats(s.stats, s.options.Out())
+	if s.unconfirmed > 0 {
+		transfer.WarnUnconfirmed(s.options.Out(), s.unconfirmed)
+	}
+	return nil
+}
+
+// awaitAccept answers the receiver's password proof, if any, and waits for
+// it to accept the offer. It returns the names of files the receiver
+// filtered out and the first file it asks for.
+func (s *SenderSession) awaitAccept(ctx context.Context) (map[string]bool, string, error) {
+	skipped := make(map[string]bool)
+	for {
+		msg, err := s.peer.next(ctx, 0)
+		if err != nil {
+			return nil, "", err
+		}
+
+		switch msg.Type {
+		case transfer.MessageTypeAuthResponse:
+			var response webrtc.AuthResponsePayload
+			if err := msg.DecodePayload(&response); err != nil || s.auth == nil {
+				continue
+			}
+			if !s.auth.CheckProof(response.Proof) {
+				s.peer.ended = true
+				return nil, "", transfer.WrapError("authenticate", transfer.ErrWrongPassword, "receiver entered the wrong password")
+			}
+			if err := s.sendMetadata(); err != nil {
+				return nil, "", err
+			}
+
+		case transfer.MessageTypeDeclineReceive:
+			// Declines from a manual answer carry no reason
+			var decline webrtc.DeclinePayload
+			msg.DecodePayload(&decline)
+			s.peer.ended = true
+			return nil, "", transfer.DeclinedError(decline.Reason)
+
+		case transfer.MessageTypeFilesSkipped:
+			var payload webrtc.FilesSkippedPayload
+			if err := msg.DecodePayload(&payload); err != nil {
+				continue
+			}
+			for _, name := range payload.FileNames {
+				skipped[name] = true
+			}
+
+		case transfer.MessageTypeReadyToReceive:
+			var ready webrtc.ReadyToReceivePayload
+			if err := msg.DecodePayload(&ready); err != nil {
+				continue
+			}
+			return skipped, ready.FileName, nil
+		}
+	}
+}
+
+// sendFiles sends each file the receiver didn't skip, in order, starting
+// with first and waiting for it to ask for each of the others
+func (s *SenderSession) sendFiles(ctx context.Context, skipped map[string]bool, first string) error {
+	for i, info := range s.files {
+		if skipped[info.Name] {
+			s.progress.Skip(i, "skipped by receiver")
+			continue
+		}
+
+		name := first
+		first = ""
+		if name == "" {
+			var err error
+			if name, err = s.awaitReady(ctx); err != nil {
+				return err
+			}
+		}
+		if name != info.Name {
+			return transfer.WrapError("transfer", transfer.ErrFilenameMismatch, name)
+		}
+
+		if err := s.sendFile(ctx, i, info); err != nil {
+			s.progress.Error(i, err.Error())
+			return err
+		}
+	}
+	return nil
+}
+
+// awaitReady waits for the receiver to ask for its next file and returns
+// the file's name
+func (s *SenderSession) awaitReady(ctx context.Context) (string, error) {
+	for {
+		msg, err := s.await(ctx, 0)
+		if err != nil {
+			return "", err
+		}
+		if msg.Type != transfer.MessageTypeReadyToReceive {
+			continue
+		}
+
+		var ready webrtc.ReadyToReceivePayload
+		if err := msg.DecodePayload(&ready); err != nil {
+			continue
+		}
+		return ready.FileName, nil
+	}
+}
+
+// sendFile sends a file in chunks, keeping no more than window bytes ahead
+// of what the receiver has acknowledged, then its checksum
+func (s *SenderSession) sendFile(ctx context.Context, index int, info *files.FileInfo) error {
+	file, err := info.Open()
+	if err != nil {
+		return transfer.NewFileError("open", info.Name, err)
+	}
+	defer file.Close()
+
+	hasher := transfer.NewHasher()
+	reader := transfer.ContextReader(ctx, s.pause.Reader(ctx, io.TeeReader(file, hasher)))
+	cipher := s.auth.Cipher()
+	size := uint64(info.Size)
+	buf := make([]byte, chunkSize)
+	s.sending = info.Name
+	s.acked = 0
+
+	var offset uint64
+	for offset < size {
+		for offset-s.acked >= window {
+			if err := s.awaitAck(ctx); err != nil {
+				return err
+			}
+		}
+
+		n, err := io.ReadFull(reader, buf)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = nil
+		}
+		if err != nil {
+			return transfer.NewFileError("read", info.Name, err)
+		}
+		if n == 0 {
+			return transfer.WrapError("read", transfer.ErrInvalidFile, info.Name+" is shorter than offered")
+		}
+
+		s.limiter.Wait(n)
+		err = s.peer.send(transfer.MessageTypeChunk, webrtc.ChunkPayload{
+			FileName: info.Name,
+			Offset:   offset,
+			Bytes:    cipher.Seal(buf[:n]),
+			Final:    offset+uint64(n) >= size,
+		})
+		if err != nil {
+			return err
+		}
+
+		offset += uint64(n)
+		s.stats.Record(int64(n), chunkSize)
+		s.progress.Update(index, int64(offset))
+	}
+
+	s.progress.Complete(index)
+	meta := fileMetadata(info)
+	meta.Checksum = transfer.FormatChecksum(hasher)
+	return s.peer.send(transfer.MessageTypeFileChecksum, meta)
+}
+
+// awaitAck waits for the receiver to acknowledge more of the current file
+func (s *SenderSession) awaitAck(ctx context.Context) error {
+	acked := s.acked
+	for s.acked == acked {
+		if _, err := s.await(ctx, time.Duration(transfer.SendTimeout)*time.Second); err != nil {
+			if err == errTimeout {
+				return transfer.WrapError("send", transfer.ErrBufferTimeout, "receiver stopped acknowledging data")
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// awaitDone waits for the receiver to confirm every file is written.
+// Running out of time isn't an error, since every chunk was sent; it is
+// only warned about.
+func (s *SenderSession) awaitDone(ctx context.Context) error {
+	var size uint64
+	for _, f := range s.files {
+		size += uint64(f.Size)
+	}
+	confirmTimeout := transfer.ConfirmTimeout(s.options, size)
+	for {
+		msg, err := s.await(ctx, confirmTimeout)
+		if err == errTimeout {
+			s.unconfirmed = confirmTimeout
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Type == transfer.MessageTypeDownloadingDone {
+			s.peer.ended = true
+			return nil
+		}
+	}
+}
+
+// await returns the next message from the receiver, recording the progress
+// and checksum reports that can arrive at any point on the way
+func (s *SenderSession) await(ctx context.Context, timeout time.Duration) (*webrtc.Message, error) {
+	msg, err := s.peer.next(ctx, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	switch msg.Type {
+	case transfer.MessageTypeReceiveProgress:
+		var progress webrtc.ReceiveProgressPayload
+		if err := msg.DecodePayload(&progress); err != nil {
+			break
+		}
+		if progress.FileName == s.sending {
+			s.acked = progress.Received
+		}
+		for i, f := range s.files {
+			if f.Name == progress.FileName {
+				s.progress.Confirm(i, int64(progress.Received))
+				break
+			}
+		}
+
+	case transfer.MessageTypeChecksumMismatch:
+		var mismatch webrtc.ChecksumMismatchPayload
+		if err := msg.DecodePayload(&mismatch); err != nil {
+			break
+		}
+		s.mismatched = append(s.mismatched, mismatch.FileName)
+		for i, f := range s.files {
+			if f.Name == mismatch.FileName {
+				s.progress.Error(i, "checksum mismatch")
+				break
+			}
+		}
+	}
+	return msg, nil
+}
+
+func (s *SenderSession) Close() error {
+	s.peer.close()
+	return nil
+}
@@ -1,19 +1,21 @@
 package singlechannel
 
 import (
-	"fmt"
+	"context"
 	"time"
 
 	"github.com/BioHazard786/Warpdrop/cli/internal/config"
+	"github.com/BioHazard786/Warpdrop/cli/internal/history"
 	"github.com/BioHazard786/Warpdrop/cli/internal/signaling"
 	"github.com/BioHazard786/Warpdrop/cli/internal/transfer"
+	"github.com/BioHazard786/Warpdrop/cli/internal/trust"
 	"github.com/BioHazard786/Warpdrop/cli/internal/ui"
 	"github.com/BioHazard786/Warpdrop/cli/internal/webrtc"
 	pion "github.com/pion/webrtc/v4"
 	"github.com/vmihailenco/msgpack/v5"
 )
 
-func NewReceiverSession(client *signaling.Client, handler *signaling.Handler, cfg *config.Config, peerInfo *signaling.PeerInfo) (*ReceiverSession, error) {
+func NewReceiverSession(client signaling.Transport, handler *signaling.Handler, cfg *config.Config, peerInfo *signaling.PeerInfo) (*ReceiverSession, error) {
 	peer, err := newReceiverPeer(client, cfg)
 	if err != nil {
 		return nil, err
@@ -35,14 +37,17 @@ func (r *ReceiverSession) SetProgressUI() {
 		fileNames[i] = f.Name
 		fileSizes[i] = int64(f.Size)
 	}
-	r.progress = transfer.NewProgressTracker(fileNames, fileSizes)
+	r.progress = transfer.NewProgressTracker(fileNames, fileSizes, r.options.Out())
 }
 
 func (r *ReceiverSession) SetOptions(opts *transfer.TransferOptions) {
 	r.options = opts
+	if opts != nil && opts.Verify {
+		r.verification = &transfer.VerificationResult{}
+	}
 }
 
-func newReceiverPeer(client *signaling.Client, cfg *config.Config) (*ReceiverPeer, error) {
+func newReceiverPeer(client signaling.Transport, cfg *config.Config) (*ReceiverPeer, error) {
 	pc, err := transfer.NewPeerConnection(cfg)
 	if err != nil {
 		return nil, err
@@ -52,10 +57,17 @@ func newReceiverPeer(client *signaling.Client, cfg *config.Config) (*ReceiverPee
 		connection:       pc,
 		metadataReceived: make(chan struct{}, 1),
 		chunkReceived:    make(chan msgpack.RawMessage, 128),
+		progressReporter: transfer.NewProgressReporter(),
+		checksums:        transfer.NewChecksumStore(),
+		authChallenge:    make(chan webrtc.AuthChallengePayload, 1),
+		cancellation:     transfer.NewCancellation(),
+		heartbeat:        transfer.NewHeartbeat(),
+		pause:            transfer.NewPeerPause(),
+		pipelineDepth:    1,
 		done:             make(chan struct{}),
 	}
 
-	transfer.SetupICEHandlers(pc, client, peer.done)
+	peer.path = transfer.SetupICEHandlers(pc, client, peer.done)
 	peer.setupDataHandlers()
 
 	return peer, nil
@@ -77,6 +89,7 @@ func (p *ReceiverPeer) setupDataHandlers() {
 			if err != nil {
 				return
 			}
+			p.heartbeat.Alive()
 
 			switch message.Type {
 			case transfer.MessageTypeFilesMetadata:
@@ -87,29 +100,101 @@ func (p *ReceiverPeer) setupDataHandlers() {
 				p.filesMetadata = metas
 				p.metadataReceived <- struct{}{}
 
+			case transfer.MessageTypeDeviceInfo:
+				// Sent ahead of the file list, so it is set before Transfer
+				var deviceInfo webrtc.DeviceInfoPayload
+				if err := message.DecodePayload(&deviceInfo); err != nil {
+					return
+				}
+				p.senderDevice = &deviceInfo
+				if deviceInfo.Checksums {
+					p.checksums.Expect()
+				}
+
 			case transfer.MessageTypeChunk:
 				p.chunkReceived <- message.Payload
+
+			case transfer.MessageTypePipelineDepth:
+				var pipeline webrtc.PipelineDepthPayload
+				if err := message.DecodePayload(&pipeline); err != nil {
+					return
+				}
+				p.pipelineDepth = transfer.ClampPipelineDepth(pipeline.Depth)
+
+			case transfer.MessageTypeAuthChallenge:
+				var challenge webrtc.AuthChallengePayload
+				if err := message.DecodePayload(&challenge); err != nil {
+					return
+				}
+				p.authChallenge <- challenge
+
+			case transfer.MessageTypeProgressRequest:
+				p.progressReporter.Enable()
+
+			case transfer.MessageTypeCancelled, transfer.MessageTypeCancelAck:
+				p.cancellation.HandleMessage(dc, message.Type)
+
+			case transfer.MessageTypePing, transfer.MessageTypePong:
+				p.heartbeat.HandleMessage(dc, message.Type)
+
+			case transfer.MessageTypePaused, transfer.MessageTypeResumed:
+				p.pause.Set(message.Type == transfer.MessageTypePaused)
+
+			case transfer.MessageTypeTransferError:
+				p.cancellation.HandleError(message)
+
+			case transfer.MessageTypeFileChecksum:
+				var meta webrtc.FileMetadata
+				if err := message.DecodePayload(&meta); err != nil {
+					return
+				}
+				p.checksums.Set(meta)
 			}
 		})
 	})
 }
 
-func (r *ReceiverSession) Start() error {
-	stopSpinner := ui.RunConnectionSpinner("Establishing WebRTC connection...")
-	defer stopSpinner()
+func (r *ReceiverSession) Start(ctx context.Context) error {
+	spinner := r.options.Out().NewConnectionSpinner("Establishing WebRTC connection...")
+	spinner.Start()
+	defer spinner.Stop()
+
+	// A NAT probe, if asked for, runs while the connection is set up
+	r.natCheck = transfer.StartNATCheck(r.options, r.config, r.signalingClient, r.peerInfo, spinner.UpdateMessage)
+	defer r.natCheck.Stop()
 
 	go r.listenForSignals()
 
-	select {
-	case <-r.peer.metadataReceived:
-		return nil
+	for {
+		select {
+		case <-r.peer.metadataReceived:
+			return nil
+
+		case challenge := <-r.peer.authChallenge:
+			spinner.Stop()
+			cipher, err := transfer.AnswerAuthChallenge(r.peer.dataChannel, challenge, r.password(), r.options.Out())
+			if err != nil {
+				return err
+			}
+			r.peer.cipher = cipher
+
+		case errMsg := <-r.handler.Error:
+			return transfer.WrapError("start", transfer.ErrSignalingError, errMsg)
+
+		case <-ctx.Done():
+			return transfer.ErrTransferCancelled
 
-	case errMsg := <-r.handler.Error:
-		return transfer.WrapError("start", transfer.ErrSignalingError, errMsg)
+		case <-time.After(time.Duration(transfer.SignalTimeout) * time.Second):
+			return transfer.ConnectTimeoutError(r.config, "waiting for metadata")
+		}
+	}
+}
 
-	case <-time.After(time.Duration(transfer.SignalTimeout) * time.Second):
-		return transfer.WrapError("start", transfer.ErrTimeout, "waiting for metadata")
+func (r *ReceiverSession) password() string {
+	if r.options == nil {
+		return ""
 	}
+	return r.options.Password
 }
 
 func (r *ReceiverSession) listenForSignals() {
@@ -133,6 +218,8 @@ func (r *ReceiverSession) listenForSignals() {
 }
 
 func (r *ReceiverSession) handleSignal(payload *signaling.SignalPayload) error {
+	r.natCheck.HandleSignal(payload)
+
 	if payload.SDP != "" {
 		var sdpType pion.SDPType
 		switch payload.Type {
@@ -162,38 +249,59 @@ func (r *ReceiverSession) handleSignal(payload *signaling.SignalPayload) error {
 	return transfer.HandleICECandidate(r.peer.connection, payload)
 }
 
-func (r *ReceiverSession) Transfer() error {
-	items := transfer.BuildFileTable(r.peer.filesMetadata)
-	ui.RenderFileTable(items)
+func (r *ReceiverSession) Transfer(ctx context.Context) error {
+	ctx, cancel := r.peer.cancellation.Watch(ctx)
+	defer cancel()
+
+	metas, skipped := transfer.FilterOffer(r.options, r.peer.filesMetadata)
+	r.skipped = skipped
+	items := transfer.BuildFileTable(r.peer.filesMetadata, skipped)
+	r.options.Out().RenderFileTable(items)
+
+	if err := transfer.CheckOffer(r.options, metas); err != nil {
+		transfer.SendDecline(r.peer.dataChannel, transfer.DeclineReason(err))
+		return err
+	}
 
-	if !transfer.PromptConsent() {
-		transfer.SendSimpleMessage(r.peer.dataChannel, transfer.MessageTypeDeclineReceive)
+	if ok, reason := transfer.PromptConsent(ctx, transfer.NewConsentOptions(r.options, r.peer.senderDevice, trust.RemoteFingerprint(r.peer.connection), metas)); !ok {
+		if r.peer.cancellation.PeerCancelled() {
+			return transfer.ErrSenderCancelled
+		}
+		transfer.SendDecline(r.peer.dataChannel, reason)
 		return transfer.ErrTransferCancelled
 	}
 
+	// The sender counts the files it will be asked for, so it has to hear
+	// about skipped ones before the first request
+	if len(skipped) > 0 {
+		if err := transfer.SendFilesSkipped(r.peer.dataChannel, transfer.SkippedNames(r.peer.filesMetadata, skipped)); err != nil {
+			return err
+		}
+	}
+
 	r.progress.Start()
-	fmt.Printf("\n%s Receiving files...\n\n", ui.IconReceive)
+	r.options.Out().Printf("\n%s Receiving files...\n\n", ui.IconReceive)
 
-	filesCount := len(r.peer.filesMetadata)
 	errChan := make(chan error, 1)
 
-	go func() {
-		defer r.progress.Program.Quit()
-
-		for i, meta := range r.peer.filesMetadata {
-			if err := transfer.SendReadyToReceive(r.peer.dataChannel, meta.Name, 0); err != nil {
-				errChan <- err
-				return
-			}
+	// A peer that goes quiet cancels the receive with the heartbeat error
+	// as the cause, leaving ctx to tell a cancelled transfer apart
+	recvCtx, stop := r.peer.heartbeat.Watch(ctx, r.peer.dataChannel, transfer.HeartbeatTimeout(r.options))
+	defer stop(nil)
 
-			if err := r.receiveFile(meta, i); err != nil {
-				errChan <- transfer.NewFileError("receive", meta.Name, err)
-				return
-			}
+	go func() {
+		defer r.progress.Quit()
+
+		// Stdout and zip archives can't be appended to later, and bench
+		// data isn't kept, so nothing is kept to resume
+		var resume *transfer.ResumeState
+		if r.options == nil {
+			resume = transfer.LoadResumeState("")
+		} else if !r.options.Stdout && !r.options.Bench && r.options.Zip == nil {
+			resume = transfer.LoadResumeState(r.options.OutputDir)
 		}
 
-		transfer.SendSimpleMessage(r.peer.dataChannel, transfer.MessageTypeDownloadingDone)
-		errChan <- nil
+		errChan <- r.receiveFiles(recvCtx, resume)
 	}()
 
 	if err := r.progress.Run(); err != nil {
@@ -201,57 +309,244 @@ func (r *ReceiverSession) Transfer() error {
 	}
 
 	if err := <-errChan; err != nil {
+		err = transfer.HeartbeatError(recvCtx, err)
+		if cancelErr := r.peer.cancellation.Resolve(ctx, r.peer.dataChannel, transfer.ErrSenderCancelled); cancelErr != nil {
+			return cancelErr
+		}
+		transfer.SendTransferError(r.peer.dataChannel, err)
 		return err
 	}
 
-	transfer.RenderSummary(filesCount, r.progress.TotalSize(), r.progress.Duration())
+	if r.verification != nil {
+		r.verification.Warn(r.options.Out())
+		if err := r.verification.Err(); err != nil {
+			return err
+		}
+	}
+
+	transfer.RenderSummary(history.DirectionReceived, r.progress, r.peerInfo.ClientType, r.peer.path, r.options)
 	return nil
 }
 
-func (r *ReceiverSession) receiveFile(meta webrtc.FileMetadata, index int) error {
+// openWriter resumes a partially received file when the sidecar has a
+// matching entry, otherwise it creates a new file
+func (r *ReceiverSession) openWriter(meta webrtc.FileMetadata, index int, resume *transfer.ResumeState) (*transfer.FileWriter, error) {
+	if entry, ok := resume.Lookup(meta); ok {
+		writer, err := transfer.ResumeFileWriter(meta, index, entry)
+		if err == nil {
+			writer.SetCipher(r.peer.cipher)
+			writer.SetResumable(true)
+			writer.SetPreserve(r.options.Preserve)
+			r.progress.Update(index, int64(writer.ReceivedBytes))
+			return writer, nil
+		}
+	}
+
 	writer, err := transfer.NewFileWriter(meta, index, r.options)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	writer.SetCipher(r.peer.cipher)
+	writer.SetPreserve(r.options.Preserve)
+	// The sidecar records progress, so a failed write leaves the file for
+	// the next attempt to resume
+	writer.SetResumable(true)
+	return writer, nil
+}
+
+// receiveFiles requests up to pipelineDepth files ahead of the one being
+// received. The sender answers them in order, so files still finish one at
+// a time, but the next request is already waiting when a file completes.
+func (r *ReceiverSession) receiveFiles(ctx context.Context, resume *transfer.ResumeState) error {
+	metas := r.peer.filesMetadata
+	pending := make(map[string]*transfer.FileWriter, r.peer.pipelineDepth)
+	r.started = make(map[string]bool, len(metas))
+	r.finished = make(map[string]bool, len(metas))
+	defer func() {
+		for _, writer := range pending {
+			writer.Close()
+		}
+		resume.Save()
+	}()
+
+	// Skipped files keep their place in the progress view
+	indices := make([]int, 0, len(metas))
+	for i, meta := range metas {
+		if reason := r.skipped[meta.Name]; reason != "" {
+			r.progress.Skip(i, reason)
+			continue
+		}
+		indices = append(indices, i)
+	}
+
+	next := 0
+	for _, done := range indices {
+		for next < len(indices) && len(pending) < r.peer.pipelineDepth {
+			meta := metas[indices[next]]
+			writer, err := r.openWriter(meta, indices[next], resume)
+			if err != nil {
+				return err
+			}
+			pending[meta.Name] = writer
+			r.progress.Rename(indices[next], writer.DisplayName())
+			r.progress.Saved(indices[next], writer.Location())
+			next++
+
+			compression := transfer.PickCompression(meta.Compression)
+			if err := transfer.SendReadyToReceive(r.peer.dataChannel, meta.Name, writer.ReceivedBytes, compression); err != nil {
+				return err
+			}
+		}
+
+		writer, err := r.receiveFile(ctx, pending, resume)
+		if err != nil {
+			return transfer.NewFileError("receive", metas[done].Name, err)
+		}
+		delete(pending, writer.Metadata.Name)
+		r.finished[writer.Metadata.Name] = true
+		writer.Close()
+		resume.Save()
 	}
-	defer writer.Close()
+
+	return transfer.SendSimpleMessage(r.peer.dataChannel, transfer.MessageTypeDownloadingDone)
+}
+
+// receiveFile writes chunks to the pending file they name until one of the
+// files is complete, and returns its writer. Dropped chunks are asked for
+// again with request_range as soon as a later chunk shows the gap on an
+// ordered channel, and again whenever no data arrives for RangeRetryInterval.
+func (r *ReceiverSession) receiveFile(ctx context.Context, pending map[string]*transfer.FileWriter, resume *transfer.ResumeState) (*transfer.FileWriter, error) {
+	// An empty file is complete before its single empty chunk arrives, and
+	// senders that never send that chunk aren't waited for
+	for _, writer := range pending {
+		if writer.Metadata.Size == 0 {
+			resume.Complete(writer.Metadata)
+			r.finishFile(writer)
+			return writer, nil
+		}
+	}
+
+	retryInterval := time.Duration(transfer.RangeRetryInterval) * time.Second
+	// A paused sender sends nothing, which isn't a stall
+	stallTimeout := transfer.StallTimeout(r.options)
+	stallTimer := func() <-chan time.Time {
+		if r.peer.pause.Paused() {
+			return nil
+		}
+		return transfer.StallTimer(stallTimeout)
+	}
+	stall := stallTimer()
+	retry := time.After(retryInterval)
 
 	for {
 		select {
 		case rawChunk := <-r.peer.chunkReceived:
+			stall = stallTimer()
+			retry = time.After(retryInterval)
+
 			var chunk webrtc.ChunkPayload
 			if err := msgpack.Unmarshal(rawChunk, &chunk); err != nil {
-				return transfer.NewError("decode chunk", err)
+				return nil, transfer.NewError("decode chunk", err)
 			}
 
-			if chunk.FileName != meta.Name {
-				return transfer.WrapError("receive", transfer.ErrFilenameMismatch, chunk.FileName)
+			writer, ok := pending[chunk.FileName]
+			if !ok {
+				// A range is resent twice when its request was repeated
+				if r.finished[chunk.FileName] {
+					continue
+				}
+				return nil, transfer.WrapError("receive", transfer.ErrFilenameMismatch, chunk.FileName)
 			}
+			meta := writer.Metadata
+			r.started[meta.Name] = true
 
+			end := writer.End()
+			writer.SetCompression(chunk.Compression)
 			if _, err := writer.WriteAt(chunk.Bytes, chunk.Offset); err != nil {
-				return err
+				return nil, err
+			}
+			// On an unordered channel a gap is usually a chunk still on its
+			// way, so it is left to the retry timer
+			if chunk.Offset > end && r.peer.dataChannel.Ordered() {
+				gap := transfer.ByteRange{Offset: end, Length: chunk.Offset - end}
+				if err := transfer.SendRequestRange(r.peer.dataChannel, meta.Name, gap); err != nil {
+					return nil, err
+				}
 			}
 
-			r.progress.Update(index, int64(writer.ReceivedBytes))
+			complete := writer.IsComplete()
+			r.progress.Update(writer.Index, int64(writer.ReceivedBytes))
+			r.peer.progressReporter.Report(r.peer.dataChannel, meta.Name, writer.ReceivedBytes, complete)
+
+			if complete {
+				resume.Complete(meta)
+				r.finishFile(writer)
+				return writer, nil
+			}
+			resume.Update(meta, writer.Path, writer.ReceivedBytes)
 
-			if chunk.Final {
-				r.progress.Complete(index)
-				return nil
+		case <-retry:
+			retry = time.After(retryInterval)
+			if err := r.requestMissing(pending); err != nil {
+				return nil, err
 			}
 
+		case <-r.peer.pause.Changed():
+			stall = stallTimer()
+
 		case <-r.handler.PeerLeft:
-			return transfer.ErrPeerDisconnected
+			return nil, transfer.ErrPeerDisconnected
+
+		case <-ctx.Done():
+			return nil, ctx.Err()
 
-		case <-time.After(30 * time.Second):
-			return transfer.WrapError("receive", transfer.ErrTimeout, "waiting for data")
+		case <-stall:
+			return nil, transfer.StallError(stallTimeout)
+		}
+	}
+}
+
+// requestMissing asks again for the gaps in files the sender has started,
+// in case the request or the resent chunks were lost too. The end of a file
+// is only asked for once its checksum shows every chunk was sent, since the
+// sender may just be slow or paused.
+func (r *ReceiverSession) requestMissing(pending map[string]*transfer.FileWriter) error {
+	for name, writer := range pending {
+		if !r.started[name] {
+			continue
+		}
+		gaps := writer.Missing()
+		if tail, ok := writer.Tail(); ok && r.peer.checksums.Has(name) {
+			gaps = append(gaps, tail)
+		}
+		for _, gap := range gaps {
+			if err := transfer.SendRequestRange(r.peer.dataChannel, name, gap); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// finishFile marks a fully written file complete, verifying it against the
+// sender's checksum first when --verify is set
+func (r *ReceiverSession) finishFile(writer *transfer.FileWriter) {
+	if r.verification != nil {
+		if err := r.verification.Check(r.peer.dataChannel, writer, r.peer.checksums); err == transfer.ErrChecksumMismatch {
+			r.progress.Error(writer.Index, "checksum mismatch")
+			return
 		}
 	}
+	r.progress.Complete(writer.Index)
 }
 
+// Close flushes any pending control messages (such as the final
+// downloading_done) before tearing the connection down.
 func (r *ReceiverSession) Close() error {
 	if r.peer != nil {
+		transfer.DrainChannel(r.peer.dataChannel, time.Duration(transfer.CloseTimeout)*time.Second)
 		r.peer.close()
 	}
-	time.Sleep(100 * time.Millisecond)
 
 	if r.signalingClient != nil {
 		r.signalingClient.Close()
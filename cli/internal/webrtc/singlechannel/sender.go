@@ -1,13 +1,14 @@
 package singlechannel
 
 import (
-	"fmt"
+	"context"
 	"io"
-	"os"
+	"strings"
 	"time"
 
 	"github.com/BioHazard786/Warpdrop/cli/internal/config"
 	"github.com/BioHazard786/Warpdrop/cli/internal/files"
+	"github.com/BioHazard786/Warpdrop/cli/internal/history"
 	"github.com/BioHazard786/Warpdrop/cli/internal/signaling"
 	"github.com/BioHazard786/Warpdrop/cli/internal/transfer"
 	"github.com/BioHazard786/Warpdrop/cli/internal/ui"
@@ -15,19 +16,30 @@ import (
 	pion "github.com/pion/webrtc/v4"
 )
 
-func NewSenderSession(client *signaling.Client, handler *signaling.Handler, cfg *config.Config, fileInfos []*files.FileInfo, peerInfo *signaling.PeerInfo) (*SenderSession, error) {
-	peer, err := newSenderPeer(client, cfg, fileInfos)
+func NewSenderSession(client signaling.Transport, handler *signaling.Handler, cfg *config.Config, fileInfos []*files.FileInfo, peerInfo *signaling.PeerInfo) (*SenderSession, error) {
+	// The web app streams chunks to disk as they arrive, so only a CLI
+	// receiver, which writes them by offset, gets an unordered channel
+	channelOpts := transfer.OrderedChannel
+	if cfg.Unordered && peerInfo.ClientType == "cli" {
+		channelOpts = transfer.UnorderedChannel
+	}
+
+	peer, err := newSenderPeer(client, cfg, fileInfos, channelOpts)
 	if err != nil {
 		return nil, err
 	}
 
-	return &SenderSession{
+	session := &SenderSession{
 		peer:            peer,
 		signalingClient: client,
 		handler:         handler,
 		config:          cfg,
 		peerInfo:        peerInfo,
-	}, nil
+	}
+	peer.onReceiveProgress = session.handleReceiveProgress
+	peer.onChecksumMismatch = session.handleChecksumMismatch
+
+	return session, nil
 }
 
 func (s *SenderSession) SetProgressUI() {
@@ -37,20 +49,41 @@ func (s *SenderSession) SetProgressUI() {
 		fileNames[i] = f.Name
 		fileSizes[i] = int64(f.Size)
 	}
-	s.progress = transfer.NewProgressTracker(fileNames, fileSizes)
+	s.progress = transfer.NewProgressTracker(fileNames, fileSizes, s.options.Out())
 }
 
 func (s *SenderSession) SetOptions(opts *transfer.TransferOptions) {
 	s.options = opts
+	// One limiter is shared by every file so the cap applies to the whole transfer
+	if opts != nil {
+		s.limiter = transfer.NewRateLimiter(opts.RateLimit)
+		s.stats = opts.StatsRecorder()
+	}
+	if opts != nil && opts.Password != "" {
+		s.peer.auth = transfer.NewPasswordKey(opts.Password)
+	}
+	if opts != nil {
+		s.peer.compress = opts.Compress
+	}
+	// Every outstanding request must fit in the buffer so the message
+	// handler never blocks on it
+	if opts != nil && opts.PipelineDepth > 1 {
+		s.peer.pipelineDepth = transfer.ClampPipelineDepth(opts.PipelineDepth)
+		s.peer.receiverReady = make(chan webrtc.ReadyToReceivePayload, s.peer.pipelineDepth)
+	}
 }
 
-func newSenderPeer(client *signaling.Client, cfg *config.Config, fileInfos []*files.FileInfo) (*SenderPeer, error) {
+// rangeQueueSize bounds the range requests waiting to be resent; more are
+// dropped until the receiver asks again
+const rangeQueueSize = 64
+
+func newSenderPeer(client signaling.Transport, cfg *config.Config, fileInfos []*files.FileInfo, channelOpts transfer.ChannelOptions) (*SenderPeer, error) {
 	pc, err := transfer.NewPeerConnection(cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	dc, err := transfer.CreateDataChannel(pc, "file-transfer")
+	dc, err := transfer.CreateDataChannel(pc, "file-transfer", channelOpts)
 	if err != nil {
 		pc.Close()
 		return nil, err
@@ -60,20 +93,32 @@ func newSenderPeer(client *signaling.Client, cfg *config.Config, fileInfos []*fi
 		connection:         pc,
 		dataChannel:        dc,
 		files:              fileInfos,
+		pipelineDepth:      1,
 		deviceInfoReceived: make(chan webrtc.DeviceInfoPayload, 1),
 		receiverReady:      make(chan webrtc.ReadyToReceivePayload, 1),
-		declineReceived:    make(chan struct{}, 1),
-		downloadingDone:    make(chan struct{}, 1),
+		declineReceived:    make(chan string, 1),
+		filesSkipped:       make(chan []string, 1),
+		rangeRequested:     make(chan webrtc.RequestRangePayload, rangeQueueSize),
+		downloadingDone:    make(chan struct{}),
+		authFailed:         make(chan struct{}, 1),
+		cancellation:       transfer.NewCancellation(),
+		heartbeat:          transfer.NewHeartbeat(),
 		done:               make(chan struct{}),
 	}
 
-	transfer.SetupICEHandlers(pc, client, peer.done)
+	peer.path = transfer.SetupICEHandlers(pc, client, peer.done)
 	peer.setupDataHandlers()
 	return peer, nil
 }
 
 func (p *SenderPeer) setupDataHandlers() {
 	p.dataChannel.OnOpen(func() {
+		// Password-protected transfers only reveal the file list once the
+		// receiver has proven it knows the password
+		if p.auth != nil {
+			transfer.SendAuthChallenge(p.dataChannel, p.auth)
+			return
+		}
 		p.sendMetadata()
 	})
 
@@ -82,6 +127,16 @@ func (p *SenderPeer) setupDataHandlers() {
 		if err != nil {
 			return
 		}
+		p.heartbeat.Alive()
+
+		// A receiver that hasn't proven it knows the password hasn't seen
+		// the file list either, so it may not start the transfer
+		if p.auth != nil && !p.authenticated {
+			switch message.Type {
+			case transfer.MessageTypeReadyToReceive, transfer.MessageTypeRequestRange, transfer.MessageTypeFilesSkipped:
+				return
+			}
+		}
 
 		switch message.Type {
 		case transfer.MessageTypeReadyToReceive:
@@ -92,10 +147,52 @@ func (p *SenderPeer) setupDataHandlers() {
 			p.receiverReady <- ready
 
 		case transfer.MessageTypeDownloadingDone:
-			p.downloadingDone <- struct{}{}
+			p.downloadingOnce.Do(func() { close(p.downloadingDone) })
 
 		case transfer.MessageTypeDeclineReceive:
-			p.declineReceived <- struct{}{}
+			// Declines from older peers carry no payload
+			var decline webrtc.DeclinePayload
+			message.DecodePayload(&decline)
+			p.declineReceived <- decline.Reason
+
+		case transfer.MessageTypeFilesSkipped:
+			var skipped webrtc.FilesSkippedPayload
+			if err := message.DecodePayload(&skipped); err != nil {
+				return
+			}
+			p.filesSkipped <- skipped.FileNames
+
+		case transfer.MessageTypeRequestRange:
+			var request webrtc.RequestRangePayload
+			if err := message.DecodePayload(&request); err != nil {
+				return
+			}
+			// The receiver asks again if this one is dropped
+			select {
+			case p.rangeRequested <- request:
+			default:
+			}
+
+		case transfer.MessageTypeCancelled, transfer.MessageTypeCancelAck:
+			p.cancellation.HandleMessage(p.dataChannel, message.Type)
+
+		case transfer.MessageTypePing, transfer.MessageTypePong:
+			p.heartbeat.HandleMessage(p.dataChannel, message.Type)
+
+		case transfer.MessageTypeTransferError:
+			p.cancellation.HandleError(message)
+
+		case transfer.MessageTypeAuthResponse:
+			var response webrtc.AuthResponsePayload
+			if err := message.DecodePayload(&response); err != nil || p.auth == nil {
+				return
+			}
+			if !p.auth.CheckProof(response.Proof) {
+				p.authFailed <- struct{}{}
+				return
+			}
+			p.authenticated = true
+			p.sendMetadata()
 
 		case transfer.MessageTypeDeviceInfo:
 			var deviceInfo webrtc.DeviceInfoPayload
@@ -103,25 +200,76 @@ func (p *SenderPeer) setupDataHandlers() {
 				return
 			}
 			p.deviceInfoReceived <- deviceInfo
+
+		case transfer.MessageTypeReceiveProgress:
+			var progress webrtc.ReceiveProgressPayload
+			if err := message.DecodePayload(&progress); err != nil {
+				return
+			}
+			if p.onReceiveProgress != nil {
+				p.onReceiveProgress(progress)
+			}
+
+		case transfer.MessageTypeChecksumMismatch:
+			var mismatch webrtc.ChecksumMismatchPayload
+			if err := message.DecodePayload(&mismatch); err != nil {
+				return
+			}
+			if p.onChecksumMismatch != nil {
+				p.onChecksumMismatch(mismatch)
+			}
 		}
 	})
 }
 
 func (p *SenderPeer) sendMetadata() {
+	// Only announce pipelining when it is on so the default exchange is
+	// unchanged for receivers that don't know the message
+	if p.pipelineDepth > 1 {
+		transfer.SendPipelineDepth(p.dataChannel, p.pipelineDepth)
+	}
+
+	transfer.SendDeviceInfo(p.dataChannel)
+
 	metadata := make([]webrtc.FileMetadata, len(p.files))
 	for i, info := range p.files {
-		metadata[i] = webrtc.FileMetadata{
-			Name: info.Name,
-			Size: uint64(info.Size),
-			Type: info.Type,
-		}
+		metadata[i] = fileMetadata(info)
+		metadata[i].Compression = p.offeredCompression(info)
 	}
 	transfer.SendFilesMetadata(p.dataChannel, metadata)
 }
 
-func (s *SenderSession) Start() error {
-	stopSpinner := ui.RunConnectionSpinner("Establishing WebRTC connection...")
-	defer stopSpinner()
+// offeredCompression returns the codec offered for a file, if any
+func (p *SenderPeer) offeredCompression(info *files.FileInfo) string {
+	if p.compress && transfer.ShouldCompress(info.Type) {
+		return transfer.CompressionZstd
+	}
+	return ""
+}
+
+func fileMetadata(info *files.FileInfo) webrtc.FileMetadata {
+	return webrtc.FileMetadata{
+		Name:    info.Name,
+		Size:    uint64(info.Size),
+		Type:    info.Type,
+		RelPath: info.RelPath,
+		ModTime: info.ModTime.UnixMilli(),
+		Mode:    uint32(info.Mode),
+	}
+}
+
+func (s *SenderSession) Start(ctx context.Context) error {
+	if s.config.Unordered && s.peerInfo.ClientType != "cli" {
+		s.options.Out().PrintWarning("--unordered is ignored: web receivers need chunks in order")
+	}
+
+	spinner := s.options.Out().NewConnectionSpinner("Establishing WebRTC connection...")
+	spinner.Start()
+	defer spinner.Stop()
+
+	// A NAT probe, if asked for, runs while the connection is set up
+	s.natCheck = transfer.StartNATCheck(s.options, s.config, s.signalingClient, s.peerInfo, spinner.UpdateMessage)
+	defer s.natCheck.Stop()
 
 	go s.listenForSignals()
 
@@ -140,14 +288,19 @@ func (s *SenderSession) Start() error {
 
 	select {
 	case deviceInfo := <-s.peer.deviceInfoReceived:
-		stopSpinner()
-		fmt.Printf("🖥️  Receiver device: %s v%s\n", deviceInfo.DeviceName, deviceInfo.DeviceVersion)
+		spinner.Stop()
+		s.peer.interleave = deviceInfo.Interleave
+		s.peer.controls = deviceInfo.Controls
+		s.options.Out().Printf("🖥️  Receiver device: %s\n", transfer.DeviceLabel(deviceInfo))
 
 	case errMsg := <-s.handler.Error:
 		return transfer.WrapError("start", transfer.ErrSignalingError, errMsg)
 
+	case <-ctx.Done():
+		return transfer.ErrTransferCancelled
+
 	case <-time.After(time.Duration(transfer.SignalTimeout) * time.Second):
-		return transfer.WrapError("start", transfer.ErrTimeout, "waiting for answer")
+		return transfer.ConnectTimeoutError(s.config, "waiting for answer")
 	}
 
 	return nil
@@ -165,6 +318,7 @@ func (s *SenderSession) listenForSignals() {
 			}
 			transfer.HandleSDPSignal(s.peer.connection, sig)
 			transfer.HandleICECandidate(s.peer.connection, sig)
+			s.natCheck.HandleSignal(sig)
 
 		case <-s.peer.done:
 			return
@@ -172,19 +326,29 @@ func (s *SenderSession) listenForSignals() {
 	}
 }
 
-func (s *SenderSession) Transfer() error {
-	stopSpinner := ui.RunSpinner("Waiting for receiver to accept...")
+func (s *SenderSession) Transfer(ctx context.Context) error {
+	ctx, cancel := s.peer.cancellation.Watch(ctx)
+	defer cancel()
+
+	// A receiver that goes quiet cancels the send with the heartbeat error
+	// as the cause, leaving ctx to tell a cancelled transfer apart
+	sendCtx, stop := s.peer.heartbeat.Watch(ctx, s.peer.dataChannel, transfer.HeartbeatTimeout(s.options))
+	defer stop(nil)
+
+	stopSpinner := s.options.Out().RunSpinner("Waiting for receiver to accept...")
 	defer stopSpinner()
 
+	if s.options != nil && s.options.ConfirmProgress {
+		transfer.SendSimpleMessage(s.peer.dataChannel, transfer.MessageTypeProgressRequest)
+	}
+
 	filesCount := len(s.peer.files)
 	fileByName := make(map[string]*files.FileInfo, filesCount)
 	fileIndexByName := make(map[string]int, filesCount)
 
-	var totalSize int64
 	for i, f := range s.peer.files {
 		fileByName[f.Name] = f
 		fileIndexByName[f.Name] = i
-		totalSize += f.Size
 	}
 
 	var readyPayload webrtc.ReadyToReceivePayload
@@ -192,62 +356,54 @@ func (s *SenderSession) Transfer() error {
 	select {
 	case readyPayload = <-s.peer.receiverReady:
 		stopSpinner()
-	case <-s.peer.declineReceived:
-		return transfer.ErrTransferDeclined
+		s.sending = true
+	case reason := <-s.peer.declineReceived:
+		return transfer.DeclinedError(reason)
+	case <-s.peer.authFailed:
+		return transfer.WrapError("authenticate", transfer.ErrWrongPassword, "receiver entered the wrong password")
 	case <-s.handler.PeerLeft:
 		return transfer.ErrPeerDisconnected
 	case <-s.handler.Error:
 		return transfer.ErrSignalingError
+	case <-sendCtx.Done():
+		return s.stopped(ctx, transfer.HeartbeatError(sendCtx, sendCtx.Err()))
+	}
+
+	// The receiver names files it filtered out ahead of its first request
+	var skipped []string
+	select {
+	case skipped = <-s.peer.filesSkipped:
+	default:
 	}
 
-	fmt.Printf("\n%s Sending files...\n\n", ui.IconSend)
+	s.options.Out().Printf("\n%s Sending files...\n\n", ui.IconSend)
 
 	s.progress.Start()
 
-	errChan := make(chan error, 1)
-
-	go func() {
-		defer s.progress.Program.Quit()
-
-		for i := range filesCount {
-			if i > 0 {
-				select {
-				case readyPayload = <-s.peer.receiverReady:
-				case <-s.peer.declineReceived:
-					errChan <- transfer.ErrTransferDeclined
-					return
-				case <-s.handler.PeerLeft:
-					errChan <- transfer.ErrPeerDisconnected
-					return
-				case <-s.handler.Error:
-					errChan <- transfer.ErrSignalingError
-					return
-				}
+	s.pause = transfer.NewPauseGate()
+	stopControls := s.options.Out().SetTransferControls(&ui.TransferControls{
+		TogglePause: func() bool {
+			paused := s.pause.Toggle()
+			if s.peer.controls {
+				transfer.SendPause(s.peer.dataChannel, paused)
 			}
+			return paused
+		},
+	})
+	defer stopControls()
 
-			fileInfo, ok := fileByName[readyPayload.FileName]
-			if !ok {
-				errChan <- transfer.WrapError("transfer", transfer.ErrInvalidFile, readyPayload.FileName)
-				return
-			}
+	errChan := make(chan error, 1)
 
-			fileIndex := fileIndexByName[readyPayload.FileName]
-			if err := s.sendFile(fileInfo, readyPayload.Offset, fileIndex); err != nil {
-				errChan <- err
-				return
-			}
-		}
+	go func() {
+		defer s.progress.Quit()
 
-		select {
-		case <-s.peer.downloadingDone:
-		case <-s.handler.PeerLeft:
-			errChan <- transfer.ErrPeerDisconnected
+		count := filesCount - s.skipFiles(skipped)
+		if err := s.sendFiles(sendCtx, readyPayload, count, fileByName, fileIndexByName); err != nil {
+			errChan <- err
 			return
-		case <-time.After(10 * time.Second):
-			// We don't fail the transfer here, just log warning after UI cleans up
 		}
 
-		errChan <- nil
+		errChan <- s.awaitDone(sendCtx, fileByName)
 	}()
 
 	// Block until UI is done
@@ -258,40 +414,304 @@ func (s *SenderSession) Transfer() error {
 	// Check if there was an error during transfer
 	transferErr := <-errChan
 	if transferErr != nil {
-		return transferErr
+		return s.stopped(ctx, transfer.HeartbeatError(sendCtx, transferErr))
+	}
+
+	if err := s.checksumError(); err != nil {
+		return err
 	}
 
-	transfer.RenderSummary(filesCount, totalSize, s.progress.Duration())
+	transfer.RenderSummary(history.DirectionSent, s.progress, s.peerInfo.ClientType, s.peer.path, s.options)
+	transfer.WriteStats(s.stats, s.options.Out())
+	if s.unconfirmed > 0 {
+		transfer.WarnUnconfirmed(s.options.Out(), s.unconfirmed)
+	}
 	return nil
 }
 
-func (s *SenderSession) sendFile(fileInfo *files.FileInfo, startOffset uint64, fileIndex int) error {
-	file, err := os.Open(fileInfo.Path)
+// awaitReady waits for the receiver to request the next file, resending
+// ranges it asks for in the meantime
+func (s *SenderSession) awaitReady(ctx context.Context, fileByName map[string]*files.FileInfo) (webrtc.ReadyToReceivePayload, error) {
+	for {
+		select {
+		case ready := <-s.peer.receiverReady:
+			return ready, nil
+		case request := <-s.peer.rangeRequested:
+			if err := s.resendRange(ctx, fileByName, request); err != nil {
+				return webrtc.ReadyToReceivePayload{}, err
+			}
+		case reason := <-s.peer.declineReceived:
+			return webrtc.ReadyToReceivePayload{}, transfer.DeclinedError(reason)
+		case <-s.handler.PeerLeft:
+			return webrtc.ReadyToReceivePayload{}, transfer.ErrPeerDisconnected
+		case <-s.handler.Error:
+			return webrtc.ReadyToReceivePayload{}, transfer.ErrSignalingError
+		case <-ctx.Done():
+			return webrtc.ReadyToReceivePayload{}, ctx.Err()
+		}
+	}
+}
+
+// awaitDone waits for the receiver to confirm every file is written,
+// resending ranges it asks for in the meantime. Running out of time isn't
+// an error, since every chunk was sent; it is only warned about.
+func (s *SenderSession) awaitDone(ctx context.Context, fileByName map[string]*files.FileInfo) error {
+	var size uint64
+	for _, f := range s.peer.files {
+		size += uint64(f.Size)
+	}
+	confirmTimeout := transfer.ConfirmTimeout(s.options, size)
+	timeout := transfer.StallTimer(confirmTimeout)
+	for {
+		select {
+		case <-s.peer.downloadingDone:
+			return nil
+		case request := <-s.peer.rangeRequested:
+			if err := s.resendRange(ctx, fileByName, request); err != nil {
+				return err
+			}
+		case <-s.handler.PeerLeft:
+			return transfer.ErrPeerDisconnected
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout:
+			s.unconfirmed = confirmTimeout
+			return nil
+		}
+	}
+}
+
+// resendRange sends the chunks of a range the receiver never got. It runs
+// between files so its chunks don't interleave with another file's window.
+func (s *SenderSession) resendRange(ctx context.Context, fileByName map[string]*files.FileInfo, request webrtc.RequestRangePayload) error {
+	fileInfo, ok := fileByName[request.FileName]
+	if !ok {
+		return transfer.WrapError("resend", transfer.ErrInvalidFile, request.FileName)
+	}
+	size := uint64(fileInfo.Size)
+	if request.Offset >= size || request.Length == 0 {
+		return nil
+	}
+	length := min(request.Length, size-request.Offset)
+
+	file, err := fileInfo.Open()
 	if err != nil {
 		return transfer.NewFileError("open", fileInfo.Name, err)
 	}
 	defer file.Close()
 
-	if _, err := file.Seek(int64(startOffset), io.SeekStart); err != nil {
-		return transfer.NewFileError("seek", fileInfo.Name, err)
-	}
-
-	sender := transfer.NewSingleChannelFileSender(s.peer.dataChannel, fileInfo.Name, fileInfo.Size)
+	// Resent chunks go uncompressed; each chunk names its own codec
+	sender := transfer.NewSingleChannelFileSender(s.peer.dataChannel, s.config.Chunk, fileInfo.Name, fileInfo.Size)
+	sender.SetContext(ctx)
+	sender.SetLimiter(s.limiter)
+	sender.SetStats(s.stats)
+	sender.SetCipher(s.peer.auth.Cipher())
 
 	return sender.SendChunks(
-		file,
-		startOffset,
-		func(offset uint64) { s.progress.Update(fileIndex, int64(offset)) },
-		func() { s.progress.Complete(fileIndex) },
-		func(msg string) { s.progress.Error(fileIndex, msg) },
+		transfer.ContextReader(ctx, io.NewSectionReader(file, int64(request.Offset), int64(length))),
+		request.Offset,
+		func(uint64) {},
+		func() {},
+		func(string) {},
 	)
 }
 
+// stopped reports why the transfer ended with err, telling the receiver
+// whether it was cancelled or failed here. No final ack will follow either,
+// so Close skips it.
+func (s *SenderSession) stopped(ctx context.Context, err error) error {
+	s.sending = false
+	if cancelErr := s.peer.cancellation.Resolve(ctx, s.peer.dataChannel, transfer.ErrReceiverCancelled); cancelErr != nil {
+		return cancelErr
+	}
+	transfer.SendTransferError(s.peer.dataChannel, err)
+	return err
+}
+
+// checksumError reports files the receiver said failed verification
+func (s *SenderSession) checksumError() error {
+	s.mismatchMu.Lock()
+	defer s.mismatchMu.Unlock()
+	if len(s.mismatched) == 0 {
+		return nil
+	}
+	return transfer.WrapError("transfer", transfer.ErrChecksumMismatch, strings.Join(s.mismatched, ", "))
+}
+
+// skipFiles marks the files the receiver won't request and returns how
+// many of them were offered
+func (s *SenderSession) skipFiles(names []string) int {
+	count := 0
+	for _, name := range names {
+		for i, f := range s.peer.files {
+			if f.Name == name {
+				s.progress.Skip(i, "skipped by receiver")
+				count++
+				break
+			}
+		}
+	}
+	return count
+}
+
+func (s *SenderSession) handleReceiveProgress(payload webrtc.ReceiveProgressPayload) {
+	if s.progress == nil {
+		return
+	}
+	for i, f := range s.peer.files {
+		if f.Name == payload.FileName {
+			s.progress.Confirm(i, int64(payload.Received))
+			return
+		}
+	}
+}
+
+// sendFiles sends the count files the receiver requests, starting with
+// first. Receivers that take interleaved chunks get every outstanding
+// request sent at once, a chunk of each in turn; others get one file at a
+// time in the order they asked.
+func (s *SenderSession) sendFiles(ctx context.Context, first webrtc.ReadyToReceivePayload, count int, fileByName map[string]*files.FileInfo, fileIndexByName map[string]int) error {
+	var active []*outgoingFile
+	defer func() {
+		for _, f := range active {
+			f.file.Close()
+		}
+	}()
+
+	start := func(ready webrtc.ReadyToReceivePayload) error {
+		f, err := s.openFile(ctx, ready, fileByName, fileIndexByName)
+		if err != nil {
+			return err
+		}
+		active = append(active, f)
+		count--
+		return nil
+	}
+	if err := start(first); err != nil {
+		return err
+	}
+
+	for len(active) > 0 {
+		// Requests that came in since the last turn join it
+		for s.peer.interleave && count > 0 && len(s.peer.receiverReady) > 0 {
+			if err := start(<-s.peer.receiverReady); err != nil {
+				return err
+			}
+		}
+
+		next := make([]*outgoingFile, 0, len(active))
+		for _, f := range active {
+			done, err := f.sender.SendNext(f.reader)
+			if err != nil {
+				s.progress.Error(f.index, err.Error())
+				return err
+			}
+			s.progress.Update(f.index, int64(f.sender.Offset()))
+			if !done {
+				next = append(next, f)
+				continue
+			}
+
+			f.file.Close()
+			s.progress.Complete(f.index)
+			if err := s.sendChecksum(f); err != nil {
+				return err
+			}
+		}
+		active = next
+
+		if len(active) == 0 && count > 0 {
+			ready, err := s.awaitReady(ctx, fileByName)
+			if err != nil {
+				return err
+			}
+			if err := start(ready); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// openFile opens a requested file at the offset the receiver asked for
+func (s *SenderSession) openFile(ctx context.Context, ready webrtc.ReadyToReceivePayload, fileByName map[string]*files.FileInfo, fileIndexByName map[string]int) (*outgoingFile, error) {
+	fileInfo, ok := fileByName[ready.FileName]
+	if !ok {
+		return nil, transfer.WrapError("transfer", transfer.ErrInvalidFile, ready.FileName)
+	}
+
+	file, err := fileInfo.Open()
+	if err != nil {
+		return nil, transfer.NewFileError("open", fileInfo.Name, err)
+	}
+
+	// Hashing the already-received prefix also positions the file at the offset
+	hasher := transfer.NewHasher()
+	if err := transfer.HashPrefix(hasher, file, ready.Offset); err != nil {
+		file.Close()
+		return nil, transfer.NewFileError("seek", fileInfo.Name, err)
+	}
+
+	sender := transfer.NewSingleChannelFileSender(s.peer.dataChannel, s.config.Chunk, fileInfo.Name, fileInfo.Size)
+	sender.SetContext(ctx)
+	sender.SetLimiter(s.limiter)
+	sender.SetStats(s.stats)
+	sender.SetCipher(s.peer.auth.Cipher())
+	sender.SetOffset(ready.Offset)
+	// Only compress with the codec this file was offered with
+	if codec := s.peer.offeredCompression(fileInfo); codec != "" && codec == ready.Compression {
+		sender.SetCompression(codec)
+	}
+
+	return &outgoingFile{
+		info:   fileInfo,
+		index:  fileIndexByName[ready.FileName],
+		file:   file,
+		hasher: hasher,
+		reader: transfer.ContextReader(ctx, s.pause.Reader(ctx, io.TeeReader(file, hasher))),
+		sender: sender,
+	}, nil
+}
+
+// sendChecksum sends the checksum of a file whose last chunk went out
+func (s *SenderSession) sendChecksum(f *outgoingFile) error {
+	// The receiver can finish on the last byte and close the channel before
+	// the checksum goes out, and no longer needs it by then
+	err := transfer.SendFileChecksum(s.peer.dataChannel, fileMetadata(f.info), transfer.FormatChecksum(f.hasher))
+	if err != nil && s.peer.receiverDone() {
+		return nil
+	}
+	return err
+}
+
+func (s *SenderSession) handleChecksumMismatch(payload webrtc.ChecksumMismatchPayload) {
+	s.mismatchMu.Lock()
+	s.mismatched = append(s.mismatched, payload.FileName)
+	s.mismatchMu.Unlock()
+
+	if s.progress == nil {
+		return
+	}
+	for i, f := range s.peer.files {
+		if f.Name == payload.FileName {
+			s.progress.Error(i, "checksum mismatch")
+			return
+		}
+	}
+}
+
+// Close flushes pending data for up to CloseTimeout, then tears the
+// connection down.
+// It returns ErrNoFinalAck when files were sent and Transfer never heard the
+// receiver confirm it has them.
 func (s *SenderSession) Close() error {
+	confirmed := true
 	if s.peer != nil {
+		if s.sending {
+			confirmed = s.peer.flush()
+		}
 		s.peer.close()
 	}
-	time.Sleep(100 * time.Millisecond)
 
 	if s.signalingClient != nil {
 		s.signalingClient.Close()
@@ -299,9 +719,31 @@ func (s *SenderSession) Close() error {
 	if s.handler != nil {
 		s.handler.Close()
 	}
+
+	if !confirmed {
+		return transfer.ErrNoFinalAck
+	}
 	return nil
 }
 
+// flush waits for queued data to reach the receiver and reports whether it
+// confirmed having every file
+func (p *SenderPeer) flush() bool {
+	timeout := time.Duration(transfer.CloseTimeout) * time.Second
+	transfer.DrainChannel(p.dataChannel, timeout)
+	return p.receiverDone()
+}
+
+// receiverDone reports whether the receiver has confirmed it has every file
+func (p *SenderPeer) receiverDone() bool {
+	select {
+	case <-p.downloadingDone:
+		return true
+	default:
+		return false
+	}
+}
+
 func (p *SenderPeer) close() error {
 	if p.dataChannel != nil {
 		p.dataChannel.Close()
@@ -1,7 +1,10 @@
 package singlechannel
 
 import (
-	"os"
+	"hash"
+	"io"
+	"sync"
+	"time"
 
 	"github.com/BioHazard786/Warpdrop/cli/internal/config"
 	"github.com/BioHazard786/Warpdrop/cli/internal/files"
@@ -14,12 +17,23 @@ import (
 
 type SenderSession struct {
 	peer            *SenderPeer
-	signalingClient *signaling.Client
+	signalingClient signaling.Transport
 	handler         *signaling.Handler
 	config          *config.Config
 	peerInfo        *signaling.PeerInfo
 	progress        *transfer.ProgressTracker
 	options         *transfer.TransferOptions
+	natCheck        *transfer.NATCheck
+	limiter         *transfer.RateLimiter
+	stats           *transfer.StatsRecorder
+	pause           *transfer.PauseGate
+	sending         bool
+	mismatchMu      sync.Mutex
+	mismatched      []string
+
+	// unconfirmed is how long the sender waited for downloading_done
+	// before giving up, zero when it arrived
+	unconfirmed time.Duration
 }
 
 type SenderPeer struct {
@@ -28,19 +42,49 @@ type SenderPeer struct {
 	files              []*files.FileInfo
 	deviceInfoReceived chan webrtc.DeviceInfoPayload
 	receiverReady      chan webrtc.ReadyToReceivePayload
-	declineReceived    chan struct{}
+	declineReceived    chan string
+	filesSkipped       chan []string
+	rangeRequested     chan webrtc.RequestRangePayload
 	downloadingDone    chan struct{}
+	downloadingOnce    sync.Once
 	done               chan struct{}
+	path               *transfer.ConnectionPath
+	onReceiveProgress  func(webrtc.ReceiveProgressPayload)
+	onChecksumMismatch func(webrtc.ChecksumMismatchPayload)
+	auth               *transfer.PasswordKey
+	authFailed         chan struct{}
+	cancellation       *transfer.Cancellation
+	heartbeat          *transfer.Heartbeat
+	pipelineDepth      int
+	compress           bool
+
+	// authenticated is set once the receiver proves it knows the password
+	authenticated bool
+
+	// interleave is set when the receiver takes chunks of several files at
+	// once, so outstanding requests are sent together
+	interleave bool
+
+	// controls is set when the receiver understands pause messages
+	controls bool
 }
 
 type ReceiverSession struct {
 	peer            *ReceiverPeer
-	signalingClient *signaling.Client
+	signalingClient signaling.Transport
 	handler         *signaling.Handler
 	config          *config.Config
 	peerInfo        *signaling.PeerInfo
 	progress        *transfer.ProgressTracker
 	options         *transfer.TransferOptions
+	natCheck        *transfer.NATCheck
+	verification    *transfer.VerificationResult
+	skipped         map[string]string
+
+	// started names files the sender has begun sending, and finished those
+	// already written, whose resent chunks are ignored
+	started  map[string]bool
+	finished map[string]bool
 }
 
 type ReceiverPeer struct {
@@ -49,11 +93,31 @@ type ReceiverPeer struct {
 	filesMetadata    []webrtc.FileMetadata
 	metadataReceived chan struct{}
 	chunkReceived    chan msgpack.RawMessage
+	progressReporter *transfer.ProgressReporter
+	checksums        *transfer.ChecksumStore
+	authChallenge    chan webrtc.AuthChallengePayload
+	senderDevice     *webrtc.DeviceInfoPayload
+	cipher           *transfer.Cipher
+	cancellation     *transfer.Cancellation
+	heartbeat        *transfer.Heartbeat
+	pause            *transfer.PeerPause
+	pipelineDepth    int
 	done             chan struct{}
+	path             *transfer.ConnectionPath
+}
+
+// outgoingFile is a requested file being sent
+type outgoingFile struct {
+	info   *files.FileInfo
+	index  int
+	file   files.File
+	hasher hash.Hash
+	reader io.Reader
+	sender *transfer.SingleChannelFileSender
 }
 
 type FileContext struct {
 	Info  *files.FileInfo
-	File  *os.File
+	File  files.File
 	Index int
 }
@@ -0,0 +1,335 @@
+// Package warpdrop sends and receives files with WarpDrop from another Go
+// program. It runs the same transfers as the CLI but draws nothing: room
+// details and progress are reported to an OnEvent callback instead. Each
+// Send or Receive reports only to its own callback, so several may run at
+// once.
+package warpdrop
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/BioHazard786/Warpdrop/cli/internal/config"
+	"github.com/BioHazard786/Warpdrop/cli/internal/engine"
+	"github.com/BioHazard786/Warpdrop/cli/internal/files"
+	"github.com/BioHazard786/Warpdrop/cli/internal/signaling"
+	"github.com/BioHazard786/Warpdrop/cli/internal/transfer"
+	"github.com/BioHazard786/Warpdrop/cli/internal/ui"
+	"github.com/BioHazard786/Warpdrop/cli/internal/utils"
+)
+
+// Event is what --json writes per line. Fields that don't apply to an
+// event type are left empty.
+type Event = ui.Event
+
+// Event types
+const (
+	EventRoomCreated = ui.EventRoomCreated
+	EventPeerJoined  = ui.EventPeerJoined
+	EventProgress    = ui.EventProgress
+	EventComplete    = ui.EventComplete
+	EventError       = ui.EventError
+)
+
+// Errors callers may want to tell apart, matched with errors.Is
+var (
+	ErrTransferDeclined = transfer.ErrTransferDeclined
+	ErrWrongPassword    = transfer.ErrWrongPassword
+	ErrPasswordRequired = transfer.ErrPasswordRequired
+	ErrNoEncryption     = transfer.ErrNoEncryption
+)
+
+// Config picks the signaling server and how peers connect. Empty fields
+// fall back to the environment and config file, as with the CLI.
+type Config struct {
+	Domain   string
+	Server   string // e.g. "ws://localhost:8080/ws", used instead of Domain
+	Insecure bool
+
+	STUNServer string
+	TURNServer string
+	TURNUser   string
+	TURNPass   string
+	ForceRelay bool
+	NoTURN     bool
+	ForceTCP   bool
+	Unordered  bool
+
+	// IPVersion is "4" or "6" to gather only IPv4 or IPv6 candidates;
+	// empty uses both
+	IPVersion string
+
+	// MaxChannels caps how many files are sent at once between CLIs; zero
+	// uses the default
+	MaxChannels int
+
+	// ViaServer sends files through the signaling server instead of a
+	// WebRTC connection. It is slow and the server can read the files
+	// unless a password is set.
+	ViaServer bool
+}
+
+// SendOptions configures Send
+type SendOptions struct {
+	// Password encrypts the transfer end to end. Only CLI receivers can
+	// answer it.
+	Password string
+
+	// RateLimit caps the upload rate in bytes per second; zero is unlimited
+	RateLimit int64
+
+	// Compress, PipelineDepth and NumericCode match the send flags
+	Compress      bool
+	PipelineDepth int
+	NumericCode   bool
+
+	// HeartbeatTimeout fails the transfer when the receiver stops answering
+	// pings. Zero uses the CLI default; a negative value turns pings off.
+	HeartbeatTimeout time.Duration
+
+	// AllowEmpty sends empty files instead of rejecting them, or skipping
+	// them inside directories. Empty folders inside directories are always
+	// skipped, as only files are sent.
+	AllowEmpty bool
+
+	// Exclude leaves out entries of directories, as the --exclude flag
+	Exclude []string
+
+	// Name offers a single file under this name instead of its own, as the
+	// --name flag
+	Name string
+
+	// Text sends this text as a plain text file, as the --text flag, in
+	// which case Send takes no paths
+	Text string
+
+	// ConfirmTimeout bounds the wait for the receiver to confirm it saved
+	// everything. Zero waits while it answers pings, or for a time scaled
+	// to the size with pings off.
+	ConfirmTimeout time.Duration
+
+	// WaitTimeout fails Send when no receiver joins in time; zero waits
+	// until ctx is cancelled
+	WaitTimeout time.Duration
+
+	// Retries is how many times a file whose channel fails is sent again.
+	// Zero uses the CLI default; a negative value turns retries off.
+	Retries int
+
+	// StatsOut is a CSV file throughput samples are written to once the
+	// transfer completes. Empty records nothing.
+	StatsOut string
+
+	// OnEvent receives this transfer's events one at a time and should
+	// return quickly. The room to share arrives in the EventRoomCreated
+	// event.
+	OnEvent func(Event)
+}
+
+// ReceiveOptions configures Receive. Offered files are always accepted.
+type ReceiveOptions struct {
+	// OutputDir is where files are saved; empty uses the working directory
+	OutputDir  string
+	CreateDirs bool
+
+	// Password answers a protected room. Without one such rooms fail with
+	// ErrPasswordRequired rather than prompting.
+	Password string
+
+	// Verify, OnConflict and Preserve match the receive flags
+	Verify     bool
+	OnConflict string
+	Preserve   bool
+
+	// MaxSize and MaxFiles decline larger offers. Zero is unlimited.
+	MaxSize  uint64
+	MaxFiles int
+
+	// StallTimeout fails a receive that gets no data for this long; zero
+	// never gives up. HeartbeatTimeout is as in SendOptions.
+	StallTimeout     time.Duration
+	HeartbeatTimeout time.Duration
+
+	// OnEvent is as in SendOptions
+	OnEvent func(Event)
+}
+
+// sendFiles returns the files Send offers: opts.Text, or those at paths
+func sendFiles(paths []string, opts SendOptions) ([]files.FileInfo, error) {
+	if opts.Text != "" {
+		if len(paths) > 0 {
+			return nil, errors.New("cannot send text and files together")
+		}
+		info, err := files.NewTextFile(opts.Text, opts.Name)
+		if err != nil {
+			return nil, err
+		}
+		return []files.FileInfo{info}, nil
+	}
+
+	fileInfos, _, err := files.ValidateFilesSkipped(paths, files.ValidateOptions{
+		AllowEmpty: opts.AllowEmpty,
+		Exclude:    opts.Exclude,
+		Name:       opts.Name,
+	})
+	return fileInfos, err
+}
+
+// Send offers the files and directories at paths in a new room, waits for
+// a receiver to join and sends them. Cancelling ctx stops the transfer.
+func Send(ctx context.Context, cfg Config, paths []string, opts SendOptions) error {
+	out := ui.NewReporter(opts.OnEvent)
+
+	fileInfos, err := sendFiles(paths, opts)
+	if err != nil {
+		return err
+	}
+
+	conf, err := loadConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	conn, err := engine.Connect(conf, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	codeMode := ""
+	if opts.NumericCode {
+		codeMode = signaling.CodeModeNumeric
+	}
+	roomID, shortCode, err := conn.CreateRoom(ctx, codeMode)
+	if err != nil {
+		return err
+	}
+	out.Emit(Event{Type: EventRoomCreated, RoomID: roomID, RoomLink: conf.GetRoomLink(roomID), Code: shortCode})
+
+	peerInfo, err := conn.WaitForPeer(ctx, opts.WaitTimeout)
+	if err != nil {
+		return err
+	}
+	out.Emit(Event{Type: EventPeerJoined, RoomID: roomID, PeerType: peerInfo.ClientType})
+
+	if opts.Password != "" && peerInfo.ClientType != "cli" {
+		return transfer.ErrNoEncryption
+	}
+
+	ptrs := make([]*files.FileInfo, len(fileInfos))
+	for i := range fileInfos {
+		ptrs[i] = &fileInfos[i]
+	}
+	session, err := conn.NewSender(ptrs)
+	if err != nil {
+		return transfer.NewError("create session", err)
+	}
+
+	return engine.RunSender(ctx, session, &transfer.TransferOptions{
+		RateLimit:        opts.RateLimit,
+		Password:         opts.Password,
+		RoomID:           roomID,
+		PipelineDepth:    opts.PipelineDepth,
+		Compress:         opts.Compress,
+		HeartbeatTimeout: heartbeatTimeout(opts.HeartbeatTimeout),
+		ConfirmTimeout:   opts.ConfirmTimeout,
+		Retries:          retries(opts.Retries),
+		StatsOut:         opts.StatsOut,
+		Reporter:         out,
+	})
+}
+
+// Receive joins roomID, which may also be a short code, and saves the
+// offered files. Cancelling ctx stops the transfer.
+func Receive(ctx context.Context, cfg Config, roomID string, opts ReceiveOptions) error {
+	out := ui.NewReporter(opts.OnEvent)
+
+	roomID, err := utils.ValidateRoomID(roomID)
+	if err != nil {
+		return err
+	}
+
+	conf, err := loadConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	conn, err := engine.Connect(conf, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	conn.ResumeToken = transfer.LoadResumeState(opts.OutputDir).Token()
+	peerInfo, err := conn.JoinRoom(ctx, roomID)
+	if err != nil {
+		return err
+	}
+	out.Emit(Event{Type: EventPeerJoined, RoomID: roomID, PeerType: peerInfo.ClientType})
+
+	session, err := conn.NewReceiver()
+	if err != nil {
+		return transfer.NewError("create session", err)
+	}
+
+	return engine.RunReceiver(ctx, session, &transfer.TransferOptions{
+		OutputDir:        opts.OutputDir,
+		CreateDirs:       opts.CreateDirs,
+		Password:         opts.Password,
+		Verify:           opts.Verify,
+		OnConflict:       opts.OnConflict,
+		Preserve:         opts.Preserve,
+		MaxSize:          opts.MaxSize,
+		MaxFiles:         opts.MaxFiles,
+		StallTimeout:     opts.StallTimeout,
+		HeartbeatTimeout: heartbeatTimeout(opts.HeartbeatTimeout),
+		RoomID:           roomID,
+		AutoAccept:       true,
+		Reporter:         out,
+	})
+}
+
+func loadConfig(cfg Config) (*config.Config, error) {
+	conf, err := config.Load(config.Options{
+		Domain:      cfg.Domain,
+		Server:      cfg.Server,
+		Insecure:    cfg.Insecure,
+		STUNServer:  cfg.STUNServer,
+		TURNServer:  cfg.TURNServer,
+		TURNUser:    cfg.TURNUser,
+		TURNPass:    cfg.TURNPass,
+		ForceRelay:  cfg.ForceRelay,
+		NoTURN:      cfg.NoTURN,
+		ForceTCP:    cfg.ForceTCP,
+		IPVersion:   cfg.IPVersion,
+		ViaServer:   cfg.ViaServer,
+		Unordered:   cfg.Unordered,
+		MaxChannels: cfg.MaxChannels,
+		Reconnects:  config.DefaultReconnects,
+	})
+	if err != nil {
+		return nil, transfer.NewError("load config", err)
+	}
+	return conf, nil
+}
+
+func heartbeatTimeout(d time.Duration) time.Duration {
+	switch {
+	case d == 0:
+		return transfer.DefaultHeartbeatTimeout
+	case d < 0:
+		return 0
+	}
+	return d
+}
+
+func retries(n int) int {
+	switch {
+	case n == 0:
+		return transfer.DefaultRetries
+	case n < 0:
+		return 0
+	}
+	return n
+}
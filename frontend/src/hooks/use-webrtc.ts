@@ -4,6 +4,7 @@ import { IsSenderContext } from "@/context/is-sender-context";
 import { logger } from "@/lib/logger";
 import { type MessageOfType, MessageType, parseMessage } from "@/lib/messages";
 import { createPeerConnection } from "@/lib/webrtc";
+import { setServerTurnCredentials } from "@/lib/webrtc-utils";
 import { ReceiverStatus, useReceiverActions } from "@/store/use-receiver-store";
 import { useRTCActions } from "@/store/use-rtc-store";
 import { SenderStatus, useSenderActions } from "@/store/use-sender-store";
@@ -61,6 +62,20 @@ export function useWebRTC({
 					sendJsonMessage(message);
 				}
 			},
+			// TURN credentials arrive right before room_created or
+			// join_success, so they are taken here rather than from
+			// lastMessage, which only holds the latest of the two
+			onMessage: (event) => {
+				const message = parseMessage(JSON.parse(event.data));
+				if (message.type === MessageType.TURN_CREDENTIALS) {
+					setServerTurnCredentials(message.payload);
+					logger(
+						null,
+						import.meta.url,
+						"Received TURN credentials from server",
+					);
+				}
+			},
 			onClose: (event) => {
 				logger(null, import.meta.url, "WebSocket Disconnected", event);
 			},
@@ -159,6 +174,10 @@ export function useWebRTC({
 					receiverActions.setError(message.payload?.error ?? "Unknown error");
 				logger(null, import.meta.url, "Server error:", message.payload?.error);
 				break;
+
+			case MessageType.SERVER_SHUTDOWN:
+				logger(null, import.meta.url, "Signaling server is shutting down.");
+				break;
 		}
 	}, [lastMessage, sendJsonMessage]);
 
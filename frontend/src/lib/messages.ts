@@ -15,6 +15,13 @@ export enum MessageType {
 	SIGNAL = "signal",
 	DOWNLOADING_DONE = "downloading_done",
 	CHUNK_ACKNOWLEDGEMENT = "chunk_acknowledgement",
+	SERVER_SHUTDOWN = "server_shutdown",
+	TRANSFER_ERROR = "transfer_error",
+	FILES_SKIPPED = "files_skipped",
+	REQUEST_RANGE = "request_range",
+	PING = "ping",
+	PONG = "pong",
+	TURN_CREDENTIALS = "turn_credentials",
 }
 
 export const DeviceInfoMessage = z.object({
@@ -114,6 +121,53 @@ export const DownloadingDoneMessage = z.object({
 	type: z.literal(MessageType.DOWNLOADING_DONE),
 });
 
+export const ServerShutdownMessage = z.object({
+	type: z.literal(MessageType.SERVER_SHUTDOWN),
+});
+
+export const TransferErrorMessage = z.object({
+	type: z.literal(MessageType.TRANSFER_ERROR),
+	payload: z.object({
+		code: z.string(),
+		message: z.string(),
+		fileName: z.string().optional(),
+	}),
+});
+
+export const FilesSkippedMessage = z.object({
+	type: z.literal(MessageType.FILES_SKIPPED),
+	payload: z.object({
+		fileNames: z.array(z.string()),
+	}),
+});
+
+export const RequestRangeMessage = z.object({
+	type: z.literal(MessageType.REQUEST_RANGE),
+	payload: z.object({
+		fileName: z.string(),
+		offset: z.number(),
+		length: z.number(),
+	}),
+});
+
+export const PingMessage = z.object({
+	type: z.literal(MessageType.PING),
+});
+
+export const PongMessage = z.object({
+	type: z.literal(MessageType.PONG),
+});
+
+export const TurnCredentialsMessage = z.object({
+	type: z.literal(MessageType.TURN_CREDENTIALS),
+	payload: z.object({
+		urls: z.array(z.string()),
+		username: z.string(),
+		credential: z.string(),
+		ttl: z.number(),
+	}),
+});
+
 export const Message = z.discriminatedUnion("type", [
 	DeviceInfoMessage,
 	FilesMetadataMessage,
@@ -129,6 +183,13 @@ export const Message = z.discriminatedUnion("type", [
 	SignalMessage,
 	DownloadingDoneMessage,
 	ChunkAcknowledgmentMessage,
+	ServerShutdownMessage,
+	TransferErrorMessage,
+	FilesSkippedMessage,
+	RequestRangeMessage,
+	PingMessage,
+	PongMessage,
+	TurnCredentialsMessage,
 ]);
 
 export type Message = z.infer<typeof Message>;
@@ -1,7 +1,22 @@
 import { decode, encode } from "@msgpack/msgpack";
-import type { Message } from "@/lib/messages";
+import type { Message, MessageOfType, MessageType } from "@/lib/messages";
 
 // --- Configuration ---
+
+// TURN server with short-lived credentials issued by the signaling server,
+// which takes the place of the one configured at build time
+let serverTurn: RTCIceServer | null = null;
+
+export function setServerTurnCredentials(
+	credentials: MessageOfType<MessageType.TURN_CREDENTIALS>["payload"],
+) {
+	serverTurn = {
+		urls: credentials.urls,
+		username: credentials.username,
+		credential: credentials.credential,
+	};
+}
+
 function getIceServers(): RTCIceServer[] {
 	const stunServer =
 		process.env.NEXT_PUBLIC_STUN_SERVER || "stun:stun.l.google.com:19302";
@@ -9,7 +24,9 @@ function getIceServers(): RTCIceServer[] {
 	const servers: RTCIceServer[] = [{ urls: stunServer }];
 
 	const turnServer = process.env.NEXT_PUBLIC_TURN_SERVER;
-	if (turnServer) {
+	if (serverTurn) {
+		servers.push(serverTurn);
+	} else if (turnServer) {
 		const turnUsername = process.env.NEXT_PUBLIC_TURN_USERNAME || "warpdrop";
 		const turnPassword =
 			process.env.NEXT_PUBLIC_TURN_PASSWORD || "warpdrop-secret";
@@ -28,9 +45,9 @@ function getIceServers(): RTCIceServer[] {
 	return servers;
 }
 
-export const PEER_CONNECTION_CONFIG: RTCConfiguration = {
-	iceServers: getIceServers(),
-};
+export function getPeerConnectionConfig(): RTCConfiguration {
+	return { iceServers: getIceServers() };
+}
 
 // Chunk sizes
 export const CHUNK_SIZE = 60 * 1024; // 60 KB 
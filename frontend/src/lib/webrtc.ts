@@ -9,10 +9,10 @@ import { type MessageOfType, MessageType, parseMessage } from "@/lib/messages";
 import { calculateTransferStats } from "@/lib/transfer-stats-utils";
 import {
 	CHUNK_SIZE,
+	getPeerConnectionConfig,
 	getZipFilename,
 	HIGH_WATER_MARK,
 	LOW_WATER_MARK,
-	PEER_CONNECTION_CONFIG,
 	packMessage,
 	unpackMessage,
 	validateOffset,
@@ -31,7 +31,7 @@ import useSenderStore, { SenderStatus } from "@/store/use-sender-store";
 export function createPeerConnection(
 	sendMessage: SendJsonMessage,
 ): RTCPeerConnection {
-	const pc = new RTCPeerConnection(PEER_CONNECTION_CONFIG);
+	const pc = new RTCPeerConnection(getPeerConnectionConfig());
 	const { setDataChannel, setPeerConnection } = useRTCStore.getState().actions;
 	const { isSender } = useRoleStore.getState();
 	const senderActions = useSenderStore.getState().actions;
@@ -222,6 +222,40 @@ export function setupDataChannelHandlers(dataChannel: RTCDataChannel) {
 					handleReceivedChunk(message.payload);
 					break;
 
+				case MessageType.FILES_SKIPPED:
+					// The receiver filtered these out and won't request them
+					logger(
+						"sender",
+						import.meta.url,
+						"Receiver skipped files:",
+						message.payload.fileNames,
+					);
+					break;
+
+				case MessageType.REQUEST_RANGE:
+					// The receiver lost these chunks and asks for them again
+					logger(
+						"sender",
+						import.meta.url,
+						"Receiver requested range:",
+						message.payload,
+					);
+					void resendRange(message.payload);
+					break;
+
+				case MessageType.PING: {
+					// The CLI pings to notice a dead connection; answer so it
+					// knows this tab is still here
+					const pong: MessageOfType<MessageType.PONG> = {
+						type: MessageType.PONG,
+					};
+					dataChannel.send(packMessage(pong));
+					break;
+				}
+
+				case MessageType.PONG:
+					break;
+
 				case MessageType.DOWNLOADING_DONE:
 					senderActions.setStatus(SenderStatus.COMPLETED);
 					logger(
@@ -230,6 +264,25 @@ export function setupDataChannelHandlers(dataChannel: RTCDataChannel) {
 						"Receiver has completed downloading all files",
 					);
 					break;
+
+				case MessageType.TRANSFER_ERROR: {
+					logger(
+						null,
+						import.meta.url,
+						"Peer reported an error:",
+						message.payload,
+					);
+					const { fileName, message: errMsg } = message.payload;
+					const description = fileName
+						? `${fileName}: ${errMsg}`
+						: errMsg;
+					if (isSender) {
+						senderActions.setError(description);
+					} else {
+						receiverActions.setError(description);
+					}
+					break;
+				}
 			}
 		} catch (error) {
 			logger(null, import.meta.url, "Error parsing message:", error);
@@ -257,6 +310,7 @@ function sendFilesMetaData() {
 				name: file.name,
 				size: file.size,
 				type: file.type,
+				modTime: file.lastModified,
 			})),
 		}),
 	);
@@ -417,6 +471,54 @@ async function streamFileChunks(fileName: string, startOffset: number) {
 	}
 }
 
+// Sender: Resend a span of a file whose chunks the receiver never got
+async function resendRange(
+	range: MessageOfType<MessageType.REQUEST_RANGE>["payload"],
+) {
+	const { dataChannel } = useRTCStore.getState();
+	const { files } = useFileUploadStore.getState();
+
+	try {
+		const file = validateOffset(
+			files.map(({ file }) => file),
+			range.fileName,
+			range.offset,
+		);
+		const end = Math.min(range.offset + range.length, file.size);
+
+		for (let offset = range.offset; offset < end; offset += CHUNK_SIZE) {
+			if (!dataChannel || dataChannel.readyState !== "open") return;
+
+			// A listener rather than onbufferedamountlow, which a file being
+			// streamed may be waiting on
+			if (dataChannel.bufferedAmount > HIGH_WATER_MARK) {
+				await new Promise((resolve) =>
+					dataChannel.addEventListener("bufferedamountlow", resolve, {
+						once: true,
+					}),
+				);
+			}
+
+			const chunkEnd = Math.min(offset + CHUNK_SIZE, end);
+			const bytes = new Uint8Array(
+				await file.slice(offset, chunkEnd).arrayBuffer(),
+			);
+			const message: MessageOfType<MessageType.CHUNK> = {
+				type: MessageType.CHUNK,
+				payload: {
+					fileName: range.fileName,
+					offset,
+					bytes,
+					final: chunkEnd >= file.size,
+				},
+			};
+			dataChannel.send(packMessage(message));
+		}
+	} catch (err) {
+		logger("sender", import.meta.url, "Resending range failed", err);
+	}
+}
+
 // Sender: Initiate file transfer when receiver signals ready
 function sendFiles(
 	fileInfo: MessageOfType<MessageType.READY_TO_RECEIVE>["payload"],
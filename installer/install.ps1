@@ -0,0 +1,176 @@
+#===============================================================================
+#
+#          FILE: install.ps1
+#
+#         USAGE: irm https://install.warpdrop.qzz.io/install.ps1 | iex
+#                 OR
+#                .\install.ps1 -Prefix "C:\Tools\warpdrop"
+#
+#   DESCRIPTION: WarpDrop CLI Installer Script for Windows PowerShell.
+#
+#                This script installs the WarpDrop CLI into a specified prefix
+#                and adds it to the user's PATH.
+#                Default prefix = $env:LOCALAPPDATA\Programs\warpdrop
+#
+#       OPTIONS: -Prefix "${INSTALL_PREFIX}"
+#                      Directory to install WarpDrop CLI into. When piped into
+#                      iex, set $env:WARPDROP_PREFIX instead.
+#  REQUIREMENTS: PowerShell 5.1 or later
+#
+#         NOTES: Homepage: https://github.com/BioHazard786/Warpdrop
+#                  Issues: https://github.com/BioHazard786/Warpdrop/issues
+#
+#        AUTHOR: Mohd Zaid (BioHazard786),
+#===============================================================================
+param(
+  [string]$Prefix = $(if ($env:WARPDROP_PREFIX) { $env:WARPDROP_PREFIX } else { Join-Path $env:LOCALAPPDATA "Programs\warpdrop" })
+)
+
+$ErrorActionPreference = "Stop" # Errors throw rather than exit, which would close a shell running iex
+$ProgressPreference = "SilentlyContinue" # Invoke-WebRequest is far slower with the progress bar
+
+# Older Windows PowerShell defaults to TLS 1.0, which GitHub refuses
+[Net.ServicePointManager]::SecurityProtocol = [Net.ServicePointManager]::SecurityProtocol -bor [Net.SecurityProtocolType]::Tls12
+
+$BinName = "warpdrop"
+$BaseUrl = "https://github.com/BioHazard786/Warpdrop/releases/download"
+$ApiUrl = "https://api.github.com/repos/BioHazard786/Warpdrop/releases/latest"
+
+#---  FUNCTION  ----------------------------------------------------------------
+#          NAME:  Write-Message
+#   DESCRIPTION:  Prints a message all fancy like
+#    PARAMETERS:  $Message = Message to print
+#                 $Severity = info, ok, error, warn
+#-------------------------------------------------------------------------------
+function Write-Message {
+  param([string]$Message, [string]$Severity = "info")
+
+  switch ($Severity) {
+    "ok"    { Write-Host $Message -ForegroundColor Green }
+    "error" { Write-Host $Message -ForegroundColor Red }
+    "warn"  { Write-Host $Message -ForegroundColor Yellow }
+    default { Write-Host $Message }
+  }
+}
+
+#---  FUNCTION  ----------------------------------------------------------------
+#          NAME:  Get-LatestVersion
+#   DESCRIPTION:  Fetch the latest release version from GitHub API
+#       RETURNS:  Version without the leading v, or $null on failure
+#-------------------------------------------------------------------------------
+function Get-LatestVersion {
+  try {
+    $release = Invoke-RestMethod -Uri $ApiUrl -Headers @{ Accept = "application/vnd.github+json" }
+    return $release.tag_name -replace "^v", ""
+  } catch {
+    return $null
+  }
+}
+
+#---  FUNCTION  ----------------------------------------------------------------
+#          NAME:  Get-Arch
+#   DESCRIPTION:  Maps the processor architecture to the release asset name
+#       RETURNS:  64bit, 32bit or ARM64, or $null when unsupported
+#-------------------------------------------------------------------------------
+function Get-Arch {
+  # PROCESSOR_ARCHITEW6432 is set when 32-bit PowerShell runs on 64-bit Windows
+  $arch = if ($env:PROCESSOR_ARCHITEW6432) { $env:PROCESSOR_ARCHITEW6432 } else { $env:PROCESSOR_ARCHITECTURE }
+  switch ($arch) {
+    "AMD64" { return "64bit" }
+    "ARM64" { return "ARM64" }
+    "x86"   { return "32bit" }
+    default { return $null }
+  }
+}
+
+#---  FUNCTION  ----------------------------------------------------------------
+#          NAME:  Add-ToUserPath
+#   DESCRIPTION:  Adds a directory to the user's PATH if it isn't there yet
+#    PARAMETERS:  $Dir = Directory to add
+#-------------------------------------------------------------------------------
+function Add-ToUserPath {
+  param([string]$Dir)
+
+  $userPath = [Environment]::GetEnvironmentVariable("Path", "User")
+  $entries = @()
+  if ($userPath) { $entries = @($userPath.Split(";") | Where-Object { $_ }) }
+  if ($entries -contains $Dir) {
+    return $false
+  }
+
+  [Environment]::SetEnvironmentVariable("Path", (($entries + $Dir) -join ";"), "User")
+  $env:Path = "$env:Path;$Dir"
+  return $true
+}
+
+Write-Message "== WarpDrop CLI Installer"
+Write-Message "== Fetching latest Warpdrop version..."
+$version = Get-LatestVersion
+if ($version) {
+  Write-Message "== Latest version detected: $version" "ok"
+} else {
+  Write-Message "== Failed to fetch latest version from GitHub, falling back to v0.0.3" "warn"
+  $version = "0.0.3"
+}
+
+$arch = Get-Arch
+if (-not $arch) {
+  throw "== Architecture $env:PROCESSOR_ARCHITECTURE is not supported"
+}
+Write-Message "== Architecture detected as $arch"
+
+$file = "${BinName}_v${version}_Windows-${arch}.zip"
+$checksumFile = "${BinName}_${version}_checksums.txt"
+$url = "$BaseUrl/v$version/$file"
+$checksumUrl = "$BaseUrl/v$version/$checksumFile"
+
+$tmpdir = Join-Path ([IO.Path]::GetTempPath()) ("$BinName." + [Guid]::NewGuid().ToString("N").Substring(0, 6))
+New-Item -ItemType Directory -Path $tmpdir | Out-Null
+Write-Message "== Created temp dir at $tmpdir"
+
+try {
+  Write-Message "== Looking for file: $file"
+  try {
+    Invoke-WebRequest -Uri $url -OutFile (Join-Path $tmpdir $file) -UseBasicParsing
+    Invoke-WebRequest -Uri $checksumUrl -OutFile (Join-Path $tmpdir $checksumFile) -UseBasicParsing
+  } catch {
+    throw "== Failed to download Warpdrop CLI: $($_.Exception.Message)"
+  }
+  Write-Message "== Downloaded Warpdrop CLI archive into $tmpdir"
+
+  $expected = Get-Content (Join-Path $tmpdir $checksumFile) |
+    Where-Object { $_ -match "\s\*?$([Regex]::Escape($file))$" } |
+    ForEach-Object { ($_ -split "\s+")[0] } |
+    Select-Object -First 1
+  $actual = (Get-FileHash -Algorithm SHA256 (Join-Path $tmpdir $file)).Hash
+  if (-not $expected -or $expected.ToLower() -ne $actual.ToLower()) {
+    throw "== Failed to verify checksum of $file"
+  }
+  Write-Message "== Checksum of $file verified" "ok"
+
+  Expand-Archive -Path (Join-Path $tmpdir $file) -DestinationPath $tmpdir -Force
+  Write-Message "== Extracted $file to $tmpdir"
+
+  if (-not (Test-Path $Prefix)) {
+    New-Item -ItemType Directory -Path $Prefix | Out-Null
+    Write-Message "== Created install prefix at $Prefix"
+  }
+
+  $target = Join-Path $Prefix "$BinName.exe"
+  # A running warpdrop.exe can't be overwritten but can be renamed aside
+  if (Test-Path $target) {
+    $old = "$target.old"
+    Remove-Item $old -Force -ErrorAction SilentlyContinue
+    Move-Item $target $old -Force
+  }
+  Copy-Item (Join-Path $tmpdir "$BinName.exe") $target -Force
+  Write-Message "== Installed Warpdrop CLI to $target" "ok"
+
+  if (Add-ToUserPath $Prefix) {
+    Write-Message "== Added $Prefix to your PATH. Open a new terminal to use it." "ok"
+  }
+} finally {
+  Remove-Item $tmpdir -Recurse -Force -ErrorAction SilentlyContinue
+}
+
+Write-Message "== Installation complete! Run '$BinName --help' to get started." "ok"
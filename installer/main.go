@@ -3,12 +3,133 @@ package main
 import (
 	"bytes"
 	"embed"
+	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
 )
 
-//go:embed install.sh
-var installScript embed.FS
+//go:embed install.sh install.ps1
+var installScripts embed.FS
+
+// installScript is one of the embedded install scripts
+type installScript struct {
+	name        string
+	contentType string
+	// lineEnding is what line endings are normalized to; bash chokes on
+	// CRLF while PowerShell takes either
+	lineEnding string
+}
+
+var (
+	shellScript      = installScript{name: "install.sh", contentType: "text/x-sh; charset=utf-8", lineEnding: "\n"}
+	powershellScript = installScript{name: "install.ps1", contentType: "text/plain; charset=utf-8", lineEnding: "\r\n"}
+)
+
+// selectScript picks the script for a request: an explicit path wins, then
+// ?os=, then a PowerShell User-Agent. Everything else gets the shell script.
+func selectScript(r *http.Request) installScript {
+	switch strings.TrimPrefix(r.URL.Path, "/") {
+	case powershellScript.name:
+		return powershellScript
+	case shellScript.name:
+		return shellScript
+	}
+
+	switch strings.ToLower(r.URL.Query().Get("os")) {
+	case "windows", "win", "powershell", "ps1":
+		return powershellScript
+	case "":
+	default:
+		return shellScript
+	}
+
+	// irm and iwr identify as WindowsPowerShell/5.1 or PowerShell/7.x
+	if strings.Contains(r.UserAgent(), "PowerShell") {
+		return powershellScript
+	}
+	return shellScript
+}
+
+// latestReleaseURL is the same GitHub API endpoint install.sh resolves the
+// version from
+const latestReleaseURL = "https://api.github.com/repos/BioHazard786/Warpdrop/releases/latest"
+
+// versionCacheTTL keeps the GitHub API well under its unauthenticated rate
+// limit however often CLIs check
+const versionCacheTTL = time.Hour
+
+// VersionPayload is served at /version for CLIs checking for upgrades
+type VersionPayload struct {
+	Version string `json:"version"`
+}
+
+// versionCache holds the last release version fetched from GitHub
+type versionCache struct {
+	mu        sync.Mutex
+	version   string
+	fetchedAt time.Time
+	client    *http.Client
+}
+
+// Latest returns the latest release version without a leading v. LATEST_VERSION
+// overrides the lookup, for pinning or for hosts without GitHub access. A
+// failed lookup serves the last known version when there is one.
+func (c *versionCache) Latest() (string, error) {
+	if v := os.Getenv("LATEST_VERSION"); v != "" {
+		return strings.TrimPrefix(v, "v"), nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.version != "" && time.Since(c.fetchedAt) < versionCacheTTL {
+		return c.version, nil
+	}
+
+	version, err := c.fetch()
+	if err != nil {
+		if c.version != "" {
+			log.Printf("Error fetching latest version, serving cached %s: %v", c.version, err)
+			return c.version, nil
+		}
+		return "", err
+	}
+	c.version = version
+	c.fetchedAt = time.Now()
+	return version, nil
+}
+
+func (c *versionCache) fetch() (string, error) {
+	req, err := http.NewRequest(http.MethodGet, latestReleaseURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GitHub API returned %s", resp.Status)
+	}
+
+	var release struct {
+		TagName string `json:"tag_name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return "", err
+	}
+	if release.TagName == "" {
+		return "", fmt.Errorf("latest release has no tag")
+	}
+	return strings.TrimPrefix(release.TagName, "v"), nil
+}
 
 func main() {
 	// Health check endpoint
@@ -18,7 +139,29 @@ func main() {
 		w.Write([]byte("Installer service is healthy."))
 	})
 
-	// Serve install.sh
+	// Latest CLI version, checked by the CLI to suggest `warpdrop upgrade`
+	versions := &versionCache{client: &http.Client{Timeout: 10 * time.Second}}
+	http.HandleFunc("/version", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		version, err := versions.Latest()
+		if err != nil {
+			log.Printf("Error fetching latest version: %v", err)
+			http.Error(w, "Latest version unavailable", http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=3600") // Cache for 1 hour
+		if err := json.NewEncoder(w).Encode(VersionPayload{Version: version}); err != nil {
+			log.Printf("Error writing response: %v", err)
+		}
+	})
+
+	// Serve the install script for the requesting platform
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		// Only allow GET and HEAD requests
 		if r.Method != http.MethodGet && r.Method != http.MethodHead {
@@ -26,22 +169,27 @@ func main() {
 			return
 		}
 
-		// Serve install.sh for any path
-		script, err := installScript.ReadFile("install.sh")
+		selected := selectScript(r)
+		script, err := installScripts.ReadFile(selected.name)
 		if err != nil {
-			log.Printf("Error reading install.sh: %v", err)
+			log.Printf("Error reading %s: %v", selected.name, err)
 			http.Error(w, "Script not found", http.StatusNotFound)
 			return
 		}
 
-		// Normalize line endings to LF (remove Windows CRLF)
+		// Normalize line endings for the script's interpreter
 		script = bytes.ReplaceAll(script, []byte("\r\n"), []byte("\n"))
+		if selected.lineEnding != "\n" {
+			script = bytes.ReplaceAll(script, []byte("\n"), []byte(selected.lineEnding))
+		}
 
 		// Set appropriate headers
-		w.Header().Set("Content-Type", "text/x-sh; charset=utf-8")
-		w.Header().Set("Content-Disposition", "inline; filename=\"install.sh\"")
+		w.Header().Set("Content-Type", selected.contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", selected.name))
 		w.Header().Set("Cache-Control", "public, max-age=3600") // Cache for 1 hour
 		w.Header().Set("X-Content-Type-Options", "nosniff")
+		// The same URL serves different scripts depending on the client
+		w.Header().Set("Vary", "User-Agent")
 
 		// Write the script
 		_, err = w.Write(script)